@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// deletionTokensBucket holds each user's pending account deletion
+	// confirmation, keyed by user name.
+	deletionTokensBucket = []byte("deletionTokens")
+	// accountDeletionsBucket records that an account was deleted, keyed by
+	// sequence, without saying whose.
+	accountDeletionsBucket = []byte("accountDeletions")
+)
+
+const (
+	confirmationHeader = "X-Confirmation-Token"
+	deletionTokenTTL   = 15 * time.Minute
+)
+
+// DeletionToken confirms a DELETE /me request.
+type DeletionToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// AccountDeletion is the anonymized record of a deleted account: when, and
+// how much was deleted.
+type AccountDeletion struct {
+	DeletedAt   time.Time `json:"deletedAt"`
+	Todos       int       `json:"todos"`
+	Comments    int       `json:"comments"`
+	Attachments int       `json:"attachments"`
+	History     int       `json:"history"`
+}
+
+// accountUser returns the caller, who must be identified to manage their
+// account.
+func accountUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Account endpoints require the "+userHeader+" header", http.StatusBadRequest)
+		return "", false
+	}
+	if err := validUserName(user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return user, true
+}
+
+// deleteNested deletes the records of a per-todo nested bucket, such as
+// comments, that match. It returns how many were deleted.
+func deleteNested(tx *bolt.Tx, bucket []byte, match func(v []byte) (bool, error)) (int, error) {
+	n := 0
+	err := tx.Bucket(bucket).ForEachBucket(func(k []byte) error {
+		b := tx.Bucket(bucket).Bucket(k)
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			matched, err := match(v)
+			if matched {
+				keys = append(keys, k)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n += len(keys)
+		return nil
+	})
+	return n, err
+}
+
+// ownTodos lists the todos that belong to a user: those assigned to them,
+// and those they created without assigning anyone.
+func ownTodos(tx *bolt.Tx, user string) ([]Todo, error) {
+	var todos []Todo
+	for _, field := range []string{"assignee", "creator"} {
+		it := newIndexIterator(tx, field, user)
+		for k, v := it.first(); k != nil; k, v = it.next() {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return nil, err
+			}
+			if field == "assignee" || todo.Assignee == "" {
+				todos = append(todos, todo)
+			}
+		}
+	}
+	return todos, nil
+}
+
+// purgeUser deletes everything stored about a user: the todos assigned to
+// them or created for no one else, with their history, live or archived, what they wrote or uploaded
+// elsewhere, and their settings. It goes one bucket per transaction, so a large account doesn't
+// hold the write lock for long; a failed purge can simply be run again.
+func purgeUser(user string) (AccountDeletion, error) {
+	deletion := AccountDeletion{DeletedAt: clock.Now().UTC()}
+	purged := make(map[int]bool)
+	archived, archivedComments, err := purgeArchivedUser(user)
+	if err != nil {
+		return deletion, err
+	}
+
+	steps := []func(tx *bolt.Tx) error{
+		func(tx *bolt.Tx) error {
+			purged = make(map[int]bool)
+			for _, id := range archived {
+				purged[id] = true
+			}
+			todos, err := ownTodos(tx, user)
+			if err != nil {
+				return err
+			}
+			for _, todo := range todos {
+				if err := removeTodo(tx, todo.ID); err != nil {
+					return err
+				}
+				purged[todo.ID] = true
+			}
+			deletion.Todos = len(archived) + len(todos)
+			return nil
+		},
+
+		// Todos they created for someone else stay, without their creator.
+		func(tx *bolt.Tx) error {
+			var created []Todo
+			it := newIndexIterator(tx, "creator", user)
+			for k, v := it.first(); k != nil; k, v = it.next() {
+				var todo Todo
+				if err := codec.Unmarshal(v, &todo); err != nil {
+					return err
+				}
+				created = append(created, todo)
+			}
+			for _, todo := range created {
+				old := todo
+				todo.CreatedBy = ""
+				buf, err := codec.Marshal(todo)
+				if err != nil {
+					return err
+				}
+				key := itob(todo.ID)
+				if err := tx.Bucket(todosBucket).Put(key, buf); err != nil {
+					return err
+				}
+				if err := updateIndexes(tx, key, &old, &todo); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+
+		func(tx *bolt.Tx) error {
+			n, err := deleteNested(tx, commentsBucket, func(v []byte) (bool, error) {
+				var comment Comment
+				err := codec.Unmarshal(v, &comment)
+				return err == nil && comment.Author == user, err
+			})
+			deletion.Comments = archivedComments + n
+			return err
+		},
+
+		func(tx *bolt.Tx) error {
+			var keys []string
+			n, err := deleteNested(tx, attachmentsBucket, func(v []byte) (bool, error) {
+				var attachment storedAttachment
+				if err := codec.Unmarshal(v, &attachment); err != nil || attachment.Uploader != user {
+					return false, err
+				}
+				keys = append(keys, attachment.blobKeys()...)
+				return true, nil
+			})
+			deletion.Attachments = n
+			tx.OnCommit(func() { deleteBlobs(keys) })
+			return err
+		},
+
+		// The change feed keeps the tombstones of deleted todos, so
+		// clients still learn of the deletions, but nothing else about
+		// them. Records of todos since reassigned are scrubbed instead.
+		func(tx *bolt.Tx) error {
+			b := tx.Bucket(changesBucket)
+			var deleted [][]byte
+			scrubbed := make(map[string][]byte)
+			err := b.ForEach(func(k, v []byte) error {
+				var change Change
+				if err := codec.Unmarshal(v, &change); err != nil {
+					return err
+				}
+				mine := change.Todo != nil && change.Todo.Assignee == user
+				created := change.Todo != nil && change.Todo.CreatedBy == user
+				switch {
+				case change.Type == EventTodoDeleted:
+				case purged[change.ID] || mine && tx.Bucket(todosBucket).Get(itob(change.ID)) == nil:
+					deleted = append(deleted, k)
+				case mine || created:
+					if mine {
+						change.Todo.Assignee = ""
+					}
+					if created {
+						change.Todo.CreatedBy = ""
+					}
+					buf, err := codec.Marshal(change)
+					if err != nil {
+						return err
+					}
+					scrubbed[string(k)] = buf
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range deleted {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			for k, buf := range scrubbed {
+				if err := b.Put([]byte(k), buf); err != nil {
+					return err
+				}
+			}
+			deletion.History = len(deleted)
+			return nil
+		},
+
+		func(tx *bolt.Tx) error {
+			var keys [][]byte
+			tx.Bucket(watchersBucket).ForEach(func(k, _ []byte) error {
+				if len(k) > 8 && string(k[8:]) == user {
+					keys = append(keys, k)
+				}
+				return nil
+			})
+			for _, k := range keys {
+				if err := tx.Bucket(watchersBucket).Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+
+		func(tx *bolt.Tx) error {
+			var keys [][]byte
+			err := tx.Bucket(savedFiltersBucket).ForEach(func(k, v []byte) error {
+				var f SavedFilter
+				if err := codec.Unmarshal(v, &f); err != nil {
+					return err
+				}
+				if f.Owner == user {
+					keys = append(keys, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err := tx.Bucket(savedFiltersBucket).Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+
+		func(tx *bolt.Tx) error {
+			prefix := []byte(user + "\x00")
+			var keys [][]byte
+			c := tx.Bucket(smsRemindedBucket).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				keys = append(keys, k)
+			}
+			for _, k := range keys {
+				if err := tx.Bucket(smsRemindedBucket).Delete(k); err != nil {
+					return err
+				}
+			}
+
+			keys = nil
+			err := tx.Bucket(smsMessagesBucket).ForEach(func(k, v []byte) error {
+				var message SMSMessage
+				if err := codec.Unmarshal(v, &message); err != nil {
+					return err
+				}
+				if message.User == user {
+					keys = append(keys, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err := tx.Bucket(smsMessagesBucket).Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+
+		func(tx *bolt.Tx) error {
+			export, err := loadUserExport(tx, user)
+			if err != nil || export == nil {
+				return err
+			}
+			if export.Blob != "" {
+				tx.OnCommit(func() { deleteBlobs([]string{export.Blob}) })
+			}
+			return tx.Bucket(userExportsBucket).Delete([]byte(user))
+		},
+
+		func(tx *bolt.Tx) error {
+			var keys [][]byte
+			var blobKeys []string
+			err := tx.Bucket(exportJobsBucket).ForEach(func(k, v []byte) error {
+				var job storedExportJob
+				if err := codec.Unmarshal(v, &job); err != nil {
+					return err
+				}
+				if job.Owner == user {
+					keys = append(keys, k)
+					if job.Blob != "" {
+						blobKeys = append(blobKeys, job.Blob)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err := tx.Bucket(exportJobsBucket).Delete(k); err != nil {
+					return err
+				}
+			}
+			tx.OnCommit(func() { deleteBlobs(blobKeys) })
+			return nil
+		},
+
+		func(tx *bolt.Tx) error {
+			var ids []string
+			err := tx.Bucket(importJobsBucket).ForEach(func(k, v []byte) error {
+				var job storedImportJob
+				if err := codec.Unmarshal(v, &job); err != nil {
+					return err
+				}
+				if job.Owner == user {
+					ids = append(ids, job.ID)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			var blobKeys []string
+			for _, id := range ids {
+				blob, err := deleteImportJob(tx, id)
+				if err != nil {
+					return err
+				}
+				if blob != "" {
+					blobKeys = append(blobKeys, blob)
+				}
+			}
+			tx.OnCommit(func() { deleteBlobs(blobKeys) })
+			return nil
+		},
+
+		// Last, so the confirmation stays valid until everything else is
+		// gone.
+		func(tx *bolt.Tx) error {
+			if err := tx.Bucket(preferencesBucket).Delete([]byte(user)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(achievementsBucket).DeleteBucket([]byte(user)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+			if err := revokeFeedTokens(tx, user); err != nil {
+				return err
+			}
+			if err := revokeInboundHooks(tx, user); err != nil {
+				return err
+			}
+			if err := tx.Bucket(deletionTokensBucket).Delete([]byte(user)); err != nil {
+				return err
+			}
+
+			b := tx.Bucket(accountDeletionsBucket)
+			seq, _ := b.NextSequence()
+			buf, err := codec.Marshal(deletion)
+			if err != nil {
+				return err
+			}
+			return b.Put(itob(int(seq)), buf)
+		},
+	}
+
+	for _, step := range steps {
+		if err := writeTx(step); err != nil {
+			return deletion, err
+		}
+	}
+	return deletion, nil
+}
+
+// deletionToken issues the caller a short-lived token confirming the
+// deletion of their account.
+func deletionToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := accountUser(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	confirmation := DeletionToken{Token: token, ExpiresAt: clock.Now().UTC().Add(deletionTokenTTL)}
+	err = writeTx(func(tx *bolt.Tx) error {
+		buf, err := codec.Marshal(confirmation)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(deletionTokensBucket).Put([]byte(user), buf)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(confirmation)
+}
+
+// deleteAccount deletes the caller's account and data. It must be confirmed
+// with a token from POST /me/deletion-token in the X-Confirmation-Token
+// header.
+func deleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := accountUser(w, r)
+	if !ok {
+		return
+	}
+
+	var confirmation DeletionToken
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(deletionTokensBucket).Get([]byte(user))
+		if v == nil {
+			return nil
+		}
+		return codec.Unmarshal(v, &confirmation)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := r.Header.Get(confirmationHeader)
+	if confirmation.Token == "" || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(confirmation.Token)) != 1 || clock.Now().After(confirmation.ExpiresAt) {
+		http.Error(w, "Confirm with a token from POST /me/deletion-token in the "+confirmationHeader+" header", http.StatusForbidden)
+		return
+	}
+
+	deletion, err := purgeUser(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	infof("account deleted: %d todos, %d comments, %d attachments", deletion.Todos, deletion.Comments, deletion.Attachments)
+
+	json.NewEncoder(w).Encode(deletion)
+}
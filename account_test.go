@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	clearBucket(t)
+	withAttachmentLimits(t)
+	router := setupRouter()
+
+	request := func(method, url, user string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, body)
+		req.Header.Set(userHeader, user)
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	mine := saveTodo(t, Todo{Title: "See the doctor", Assignee: "alice"})
+	mine.Title = "See the dentist"
+	saveTodo(t, mine)
+	theirs := saveTodo(t, Todo{Title: "Mow lawn", Assignee: "alice", CreatedBy: "alice"})
+	theirs.Assignee = "bob"
+	saveTodo(t, theirs)
+	theirsURL := "/todos/" + strconv.Itoa(theirs.ID)
+	w := request(http.MethodPost, "/todos", "alice", strings.NewReader(`{"title":"Secret plan"}`))
+	var plan Todo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	request(http.MethodPost, theirsURL+"/comments", "alice", strings.NewReader(`{"body":"Before it rains"}`))
+	request(http.MethodPost, theirsURL+"/comments", "bob", strings.NewReader(`{"body":"Sure"}`))
+	request(http.MethodPost, theirsURL+"/watch", "alice", nil)
+	request(http.MethodPost, "/filters", "alice", strings.NewReader(`{"name":"Open","query":"completed=false"}`))
+	request(http.MethodPost, "/me/feed-token", "alice", nil)
+	request(http.MethodPut, "/preferences", "alice", strings.NewReader(`{"timezone":"Europe/Lisbon"}`))
+	upload := uploadRequest(theirsURL+"/attachments", "file", "photo.txt", []byte("grass"))
+	upload.Header.Set(userHeader, "alice")
+	router.ServeHTTP(httptest.NewRecorder(), upload)
+	request(http.MethodPost, "/exports?format=json", "alice", nil)
+	buildExportJob(<-exportJobQueue)
+
+	// Deletion needs a fresh confirmation token.
+	assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, "/me", "alice", nil).Code)
+	w = request(http.MethodPost, "/me/deletion-token", "alice", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var confirmation DeletionToken
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &confirmation))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, "/me", "bob", nil, confirmationHeader, confirmation.Token).Code)
+	assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, "/me", "alice", nil, confirmationHeader, "wrong").Code)
+
+	w = request(http.MethodDelete, "/me", "alice", nil, confirmationHeader, confirmation.Token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var deletion AccountDeletion
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &deletion))
+	assert.Equal(t, 2, deletion.Todos)
+	assert.Equal(t, 1, deletion.Comments)
+	assert.Equal(t, 1, deletion.Attachments)
+	assert.Equal(t, 3, deletion.History)
+
+	// Nothing about alice is left but the tombstones of her todos, including
+	// the one she created for no one.
+	assert.Equal(t, []string{"Mow lawn"}, localTitles(t))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/todos/"+strconv.Itoa(plan.ID), "bob", nil).Code)
+	w = request(http.MethodGet, "/me/export", "alice", nil)
+	files := readArchive(t, w.Body.Bytes())
+	for _, name := range []string{"todos.json", "comments.json", "attachments.json", "filters.json", "watching.json", "history.json"} {
+		assert.Equal(t, "[]\n", files[name], name)
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 0, tx.Bucket(attachmentBlobsBucket).Stats().KeyN)
+		assert.Equal(t, 0, tx.Bucket(exportJobsBucket).Stats().KeyN)
+		assert.Equal(t, 0, tx.Bucket(feedTokensBucket).Stats().KeyN)
+		assert.Nil(t, tx.Bucket(preferencesBucket).Get([]byte("alice")))
+		assert.NotContains(t, string(tx.Bucket(todosBucket).Get(itob(theirs.ID))), "alice")
+		assert.Zero(t, newIndexIterator(tx, "creator", "alice").count())
+		return tx.Bucket(changesBucket).ForEach(func(k, v []byte) error {
+			assert.NotContains(t, string(v), "alice")
+			assert.NotContains(t, string(v), "See the")
+			assert.NotContains(t, string(v), "Secret plan")
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	w = request(http.MethodGet, theirsURL+"/comments", "bob", nil)
+	assert.Contains(t, w.Body.String(), "Sure")
+
+	// The token is used up.
+	assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, "/me", "alice", nil, confirmationHeader, confirmation.Token).Code)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		var marker AccountDeletion
+		assert.NoError(t, codec.Unmarshal(tx.Bucket(accountDeletionsBucket).Get(itob(1)), &marker))
+		assert.Equal(t, deletion.Todos, marker.Todos)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// achievementsBucket holds a nested bucket per user with their UserStats
+// under statsKey and the keys of the todos already credited to them, so
+// reopening and completing a todo again doesn't count twice.
+var (
+	achievementsBucket = []byte("achievements")
+	statsKey           = []byte("stats")
+	creditedBucket     = []byte("credited")
+)
+
+// UserStats tracks a user's completions. A streak counts consecutive days,
+// in the user's time zone, with at least one completion.
+type UserStats struct {
+	Completed       int                  `json:"completed"`
+	Streak          int                  `json:"currentStreak"`
+	LongestStreak   int                  `json:"longestStreak"`
+	LastCompletedOn string               `json:"lastCompletedOn,omitempty"`
+	Unlocked        map[string]time.Time `json:"unlocked,omitempty"`
+}
+
+type Achievement struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	UnlockedAt  time.Time `json:"unlockedAt"`
+}
+
+type AchievementsResponse struct {
+	Completed     int           `json:"completed"`
+	Streak        int           `json:"currentStreak"`
+	LongestStreak int           `json:"longestStreak"`
+	Achievements  []Achievement `json:"achievements"`
+}
+
+// milestones are the achievements there are to unlock, in display order.
+var milestones = []struct {
+	id, description string
+	reached         func(UserStats) bool
+}{
+	{"first-done", "Completed a first todo", func(s UserStats) bool { return s.Completed >= 1 }},
+	{"10-done", "Completed 10 todos", func(s UserStats) bool { return s.Completed >= 10 }},
+	{"100-done", "Completed 100 todos", func(s UserStats) bool { return s.Completed >= 100 }},
+	{"1000-done", "Completed 1000 todos", func(s UserStats) bool { return s.Completed >= 1000 }},
+	{"7-day-streak", "Completed todos 7 days in a row", func(s UserStats) bool { return s.LongestStreak >= 7 }},
+	{"30-day-streak", "Completed todos 30 days in a row", func(s UserStats) bool { return s.LongestStreak >= 30 }},
+}
+
+func loadStats(tx *bolt.Tx, user string) (UserStats, error) {
+	var stats UserStats
+	b := tx.Bucket(achievementsBucket).Bucket([]byte(user))
+	if b == nil || b.Get(statsKey) == nil {
+		return stats, nil
+	}
+	err := codec.Unmarshal(b.Get(statsKey), &stats)
+	return stats, err
+}
+
+// creditCompletion counts a completed todo towards user's stats, at now in
+// the user's time zone.
+func creditCompletion(tx *bolt.Tx, user string, todoID int, now time.Time) error {
+	b, err := tx.Bucket(achievementsBucket).CreateBucketIfNotExists([]byte(user))
+	if err != nil {
+		return err
+	}
+	credited, err := b.CreateBucketIfNotExists(creditedBucket)
+	if err != nil {
+		return err
+	}
+	if credited.Get(itob(todoID)) != nil {
+		return nil
+	}
+	if err := credited.Put(itob(todoID), nil); err != nil {
+		return err
+	}
+
+	stats, err := loadStats(tx, user)
+	if err != nil {
+		return err
+	}
+	stats.Completed++
+	today := now.Format(dueDateLayout)
+	switch stats.LastCompletedOn {
+	case today:
+	case now.AddDate(0, 0, -1).Format(dueDateLayout):
+		stats.Streak++
+	default:
+		stats.Streak = 1
+	}
+	stats.LastCompletedOn = today
+	if stats.Streak > stats.LongestStreak {
+		stats.LongestStreak = stats.Streak
+	}
+
+	for _, m := range milestones {
+		if _, ok := stats.Unlocked[m.id]; !ok && m.reached(stats) {
+			if stats.Unlocked == nil {
+				stats.Unlocked = make(map[string]time.Time)
+			}
+			stats.Unlocked[m.id] = now.UTC()
+		}
+	}
+
+	buf, err := codec.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return b.Put(statsKey, buf)
+}
+
+// trackCompletions credits todos to their assignee as they are completed,
+// or to their creator when nobody is assigned. Todos with neither count for
+// nobody.
+func trackCompletions(e Event) {
+	if e.Type != EventTodoUpdated || !e.Todo.Completed || e.Previous == nil || e.Previous.Completed {
+		return
+	}
+	user := e.Todo.Assignee
+	if user == "" {
+		user = e.Todo.CreatedBy
+	}
+	if user == "" {
+		return
+	}
+
+	err := writeTx(func(tx *bolt.Tx) error {
+		prefs, err := loadPreferences(tx, user)
+		if err != nil {
+			return err
+		}
+		loc, err := time.LoadLocation(prefs.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		return creditCompletion(tx, user, e.Todo.ID, clock.Now().In(loc))
+	})
+	if err != nil {
+		warnf("crediting completion of todo %d: %v", e.Todo.ID, err)
+	}
+}
+
+func init() {
+	events.subscribe(trackCompletions)
+}
+
+// getAchievements returns the caller's completion stats and achievements.
+func getAchievements(w http.ResponseWriter, r *http.Request) {
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Achievements require the "+userHeader+" header", http.StatusBadRequest)
+		return
+	}
+	loc, err := locationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var stats UserStats
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		stats, err = loadStats(tx, user)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := AchievementsResponse{Completed: stats.Completed, LongestStreak: stats.LongestStreak, Achievements: []Achievement{}}
+	// A streak is still alive until a whole day passes without a completion.
+	now := clock.Now().In(loc)
+	if stats.LastCompletedOn == now.Format(dueDateLayout) || stats.LastCompletedOn == now.AddDate(0, 0, -1).Format(dueDateLayout) {
+		response.Streak = stats.Streak
+	}
+	for _, m := range milestones {
+		if at, ok := stats.Unlocked[m.id]; ok {
+			response.Achievements = append(response.Achievements, Achievement{m.id, m.description, at})
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCreditCompletionStreaks(t *testing.T) {
+	clearBucket(t)
+
+	day := func(d, hour int) time.Time { return time.Date(2026, 10, d, hour, 0, 0, 0, time.UTC) }
+	steps := []struct {
+		todoID          int
+		at              time.Time
+		completed       int
+		streak, longest int
+	}{
+		{1, day(1, 9), 1, 1, 1},
+		{2, day(1, 18), 2, 1, 1},
+		{3, day(2, 9), 3, 2, 2},
+		{3, day(3, 9), 3, 2, 2}, // already credited
+		{4, day(3, 23), 4, 3, 3},
+		{5, day(5, 9), 5, 1, 3},
+	}
+
+	for i, step := range steps {
+		var stats UserStats
+		err := db.Update(func(tx *bolt.Tx) error {
+			if err := creditCompletion(tx, "alice", step.todoID, step.at); err != nil {
+				return err
+			}
+			var err error
+			stats, err = loadStats(tx, "alice")
+			return err
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, step.completed, stats.Completed, "step %d", i)
+		assert.Equal(t, step.streak, stats.Streak, "step %d", i)
+		assert.Equal(t, step.longest, stats.LongestStreak, "step %d", i)
+	}
+
+	var stats UserStats
+	db.View(func(tx *bolt.Tx) error {
+		stats, _ = loadStats(tx, "alice")
+		return nil
+	})
+	assert.Equal(t, day(1, 9), stats.Unlocked["first-done"])
+	assert.NotContains(t, stats.Unlocked, "7-day-streak")
+
+	for d := 6; d <= 11; d++ {
+		db.Update(func(tx *bolt.Tx) error { return creditCompletion(tx, "alice", 100+d, day(d, 12)) })
+	}
+	db.View(func(tx *bolt.Tx) error {
+		stats, _ = loadStats(tx, "alice")
+		return nil
+	})
+	assert.Equal(t, 7, stats.Streak)
+	assert.Equal(t, day(11, 12), stats.Unlocked["7-day-streak"])
+}
+
+func TestGetAchievements(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for i := 1; i <= 3; i++ {
+		payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Todo %d", i), Assignee: "alice"})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+	payload, _ := json.Marshal(Todo{Title: "Unassigned"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+
+	put := func(id int, completed bool) {
+		body := fmt.Sprintf(`{"title":"Todo %d","assignee":"alice","completed":%t}`, id, completed)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, fmt.Sprintf("/todos/%d", id), bytes.NewBufferString(body)))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	put(1, true)
+	put(2, true)
+	// Reopening and completing again doesn't count twice.
+	put(2, false)
+	put(2, true)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/todos/4", bytes.NewBufferString(`{"title":"Unassigned","completed":true}`)))
+	// Without an assignee, the creator is credited.
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("bob", http.MethodPost, "/todos", `{"title":"Water plants"}`))
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("bob", http.MethodPut, "/todos/5", `{"title":"Water plants","completed":true}`))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodGet, "/me/achievements", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response AchievementsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.Completed)
+	assert.Equal(t, 1, response.Streak)
+	assert.Equal(t, 1, response.LongestStreak)
+	if assert.Len(t, response.Achievements, 1) {
+		assert.Equal(t, "first-done", response.Achievements[0].ID)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("bob", http.MethodGet, "/me/achievements", ""))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Completed)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("carol", http.MethodGet, "/me/achievements", ""))
+	assert.JSONEq(t, `{"completed":0,"currentStreak":0,"longestStreak":0,"achievements":[]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("", http.MethodGet, "/me/achievements", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const activityFeedSize = 50
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// baseURL is the scheme and host the request was made to.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// recentActivity returns the latest creations and completions in the change
+// feed, newest first. A completion is an update that flips completed on, so
+// the feed is replayed from the start to know each todo's previous state.
+func recentActivity(tx *bolt.Tx, limit int) ([]Change, error) {
+	var activity []Change
+	completed := make(map[int]bool)
+	err := tx.Bucket(changesBucket).ForEach(func(k, v []byte) error {
+		var change Change
+		if err := codec.Unmarshal(v, &change); err != nil {
+			return err
+		}
+		switch change.Type {
+		case EventTodoCreated:
+			activity = append(activity, change)
+		case EventTodoUpdated:
+			if change.Todo.Completed && !completed[change.ID] {
+				activity = append(activity, change)
+			}
+		}
+		completed[change.ID] = change.Todo != nil && change.Todo.Completed
+		return nil
+	})
+	if len(activity) > limit {
+		activity = activity[len(activity)-limit:]
+	}
+	for i, j := 0, len(activity)-1; i < j; i, j = i+1, j-1 {
+		activity[i], activity[j] = activity[j], activity[i]
+	}
+	return activity, err
+}
+
+// getActivityFeed serves recently created and completed todos as an Atom
+// feed, authenticated by a feed token.
+func getActivityFeed(w http.ResponseWriter, r *http.Request) {
+	if _, ok := feedUser(w, r); !ok {
+		return
+	}
+
+	var activity []Change
+	err := timedView(r, func(tx *bolt.Tx) error {
+		var err error
+		activity, err = recentActivity(tx, activityFeedSize)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	base := baseURL(r)
+	feed := atomFeed{
+		Title:   "Todo activity",
+		ID:      base + "/feeds/activity.atom",
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Author:  "todo-list-service",
+		Links:   []atomLink{{Href: base + "/feeds/activity.atom", Rel: "self"}},
+		Entries: []atomEntry{},
+	}
+	for i, change := range activity {
+		if i == 0 {
+			feed.Updated = change.At.UTC().Format(time.RFC3339)
+		}
+		verb := "Created"
+		if change.Type == EventTodoUpdated {
+			verb = "Completed"
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   verb + ": " + change.Todo.Title,
+			ID:      fmt.Sprintf("%s/todos/%d#change-%d", base, change.ID, change.Seq),
+			Updated: change.At.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: fmt.Sprintf("%s/todos/%d", base, change.ID)},
+			Summary: fmt.Sprintf("Todo %d was %s.", change.ID, strings.ToLower(verb)),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(feed)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivityFeed(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	// Creates todos 1 and 2, completes 1 and deletes 2.
+	recordSampleChanges()
+	// Editing a completed todo is not another completion.
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/todos/1", strings.NewReader(`{"title":"Renamed","completed":true}`)))
+	token := issueFeedToken(t, router, "alice")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/feeds/activity.atom?token="+token, nil)
+	req.Host = "todo.example.com"
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/atom+xml; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var feed atomFeed
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, "http://todo.example.com/feeds/activity.atom", feed.ID)
+	var titles []string
+	for _, entry := range feed.Entries {
+		titles = append(titles, entry.Title)
+	}
+	assert.Equal(t, []string{"Completed: Keep", "Created: Drop", "Created: Keep"}, titles)
+	assert.Equal(t, "http://todo.example.com/todos/1", feed.Entries[0].Link.Href)
+	assert.Equal(t, feed.Entries[0].Updated, feed.Updated)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feeds/activity.atom", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//go:embed static/admin.html static/login.html
+var adminFS embed.FS
+
+// adminTemplates render the admin pages; {{t .Lang "..."}} translates their
+// text into the language the browser asks for.
+var adminTemplates = template.Must(template.New("").Funcs(template.FuncMap{"t": localize}).ParseFS(adminFS, "static/*.html"))
+
+type AdminStats struct {
+	DBPath         string     `json:"dbPath"`
+	DBSizeBytes    int64      `json:"dbSizeBytes"`
+	TotalTodos     int        `json:"totalTodos"`
+	CompletedTodos int        `json:"completedTodos"`
+	OpenTodos      int        `json:"openTodos"`
+	Cache          CacheStats `json:"cache"`
+	// Deliveries counts outbound deliveries, such as SMS reminders, by
+	// destination.
+	Deliveries []DeliveryStats `json:"deliveries"`
+	// Classes are the requests in flight and rejected by priority class.
+	Classes []ClassStats `json:"classes"`
+}
+
+// requireAdmin guards admin routes with ADMIN_TOKEN. API clients send it as
+// a bearer token; browsers log in once and use a session cookie, in which
+// case mutating requests must also carry the session's CSRF token.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if secret("ADMIN_TOKEN", config.AdminToken) == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+
+		if validAdminToken(bearerToken(r)) {
+			next(w, r)
+			return
+		}
+
+		session, ok := sessionFromRequest(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if isMutating(r.Method) && !session.validCSRF(r.Header.Get(csrfHeader)) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+func validAdminToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret("ADMIN_TOKEN", config.AdminToken))) == 1
+}
+
+func adminDashboard(w http.ResponseWriter, r *http.Request) {
+	session, ok := sessionFromRequest(r)
+	if !ok {
+		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	adminTemplates.ExecuteTemplate(w, "admin.html", map[string]string{"CSRFToken": session.CSRFToken, "Lang": requestLanguage(r)})
+}
+
+func adminStats(w http.ResponseWriter, r *http.Request) {
+	stats := AdminStats{DBPath: db.Path(), Cache: cache.stats(), Deliveries: deliveryCounters(), Classes: classCounters()}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		stats.DBSizeBytes = tx.Size()
+		stats.TotalTodos = newTodoIterator(tx).count()
+		stats.CompletedTodos = newIndexIterator(tx, "completed", "true").count()
+		stats.OpenTodos = newIndexIterator(tx, "completed", "false").count()
+		return nil
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// adminBackup streams a consistent snapshot of the database file.
+func adminBackup(w http.ResponseWriter, r *http.Request) {
+	err := db.View(func(tx *bolt.Tx) error {
+		filename := fmt.Sprintf("todos-%s.db", clock.Now().UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.Header().Set("Content-Length", fmt.Sprint(tx.Size()))
+		_, err := tx.WriteTo(w)
+		return err
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// adminCompact rewrites the database into a fresh file, dropping free pages,
+// and swaps it in place. It holds dbGate exclusively throughout, so
+// requests and jobs wait for it rather than writing to the old file or
+// using a closed handle. If the new file can't be opened, the old one is
+// put back and stays in use.
+func adminCompact(w http.ResponseWriter, r *http.Request) {
+	dbGate.Lock()
+	defer dbGate.Unlock()
+
+	path := db.Path()
+	tmpPath := path + ".compact"
+	oldPath := path + ".old"
+	os.Remove(tmpPath)
+
+	sizeBefore, err := fileSize(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dst, err := bolt.Open(tmpPath, 0600, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := bolt.Compact(dst, db, 65536); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dst.Close()
+
+	// The open handle follows the old file through the renames, so it
+	// stays usable until the compacted one is open.
+	if err := os.Rename(path, oldPath); err != nil {
+		os.Remove(tmpPath)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	compacted, err := func() (*bolt.DB, error) {
+		if err := os.Rename(tmpPath, path); err != nil {
+			return nil, err
+		}
+		return openDB(path, false)
+	}()
+	if err != nil {
+		os.Rename(path, tmpPath)
+		os.Remove(tmpPath)
+		if restoreErr := os.Rename(oldPath, path); restoreErr != nil {
+			warnf("restoring %s after a failed compaction: %v", path, restoreErr)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	db.Close()
+	db = compacted
+	os.Remove(oldPath)
+
+	sizeAfter, err := fileSize(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{
+		"sizeBefore": sizeBefore,
+		"sizeAfter":  sizeAfter,
+	})
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withAdminToken(t *testing.T, token string) {
+	previous := config.AdminToken
+	config.AdminToken = token
+	t.Cleanup(func() { config.AdminToken = previous })
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name           string
+		adminToken     string
+		setupRequest   func(r *http.Request)
+		expectedStatus int
+	}{
+		{
+			name:           "admin disabled",
+			adminToken:     "",
+			setupRequest:   func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "missing credentials",
+			adminToken:     "secret",
+			setupRequest:   func(r *http.Request) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong bearer token",
+			adminToken:     "secret",
+			setupRequest:   func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "valid bearer token",
+			adminToken:     "secret",
+			setupRequest:   func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withAdminToken(t, tt.adminToken)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+			tt.setupRequest(req)
+			w := httptest.NewRecorder()
+
+			requireAdmin(adminStats)(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	clearBucket(t)
+
+	todos := []Todo{
+		{Title: "Todo 1", Completed: false},
+		{Title: "Todo 2", Completed: true},
+		{Title: "Todo 3", Completed: false},
+	}
+
+	for _, todo := range todos {
+		payload, _ := json.Marshal(todo)
+		req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		createTodo(w, req)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+	w := httptest.NewRecorder()
+
+	adminStats(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats AdminStats
+	err := json.Unmarshal(w.Body.Bytes(), &stats)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.TotalTodos)
+	assert.Equal(t, 1, stats.CompletedTodos)
+	assert.Equal(t, 2, stats.OpenTodos)
+	assert.NotZero(t, stats.DBSizeBytes)
+}
+
+func TestAdminBackup(t *testing.T) {
+	clearBucket(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/backup", nil)
+	w := httptest.NewRecorder()
+
+	adminBackup(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.NotZero(t, w.Body.Len())
+}
+
+func TestAdminCompact(t *testing.T) {
+	clearBucket(t)
+
+	payload, _ := json.Marshal(Todo{Title: "Survives compaction"})
+	req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+	w := httptest.NewRecorder()
+	createTodo(w, req)
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/compact", nil)
+	w = httptest.NewRecorder()
+
+	adminCompact(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result map[string]int64
+	err := json.Unmarshal(w.Body.Bytes(), &result)
+	assert.NoError(t, err)
+	assert.NotZero(t, result["sizeAfter"])
+
+	req = httptest.NewRequest(http.MethodGet, "/todos", nil)
+	w = httptest.NewRecorder()
+	getTodos(w, req)
+
+	var response PaginatedResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 1, response.TotalItems)
+}
+
+func TestAdminCompactWaitsForRequests(t *testing.T) {
+	clearBucket(t)
+	previous := config
+	config.BatchDelay = 25 * time.Millisecond
+	t.Cleanup(func() { config = previous })
+	saveTodo(t, Todo{Title: "Survives compaction"})
+
+	// A request in flight holds the gate until it finishes.
+	dbGate.RLock()
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		adminCompact(w, httptest.NewRequest(http.MethodPost, "/admin/compact", nil))
+		done <- w.Code
+	}()
+	select {
+	case <-done:
+		t.Fatal("compaction swapped the database under a request")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Len(t, localTitles(t), 1)
+	dbGate.RUnlock()
+
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, []string{"Survives compaction"}, localTitles(t))
+	// The new handle is opened like the first one.
+	assert.Equal(t, 25*time.Millisecond, db.MaxBatchDelay)
+	_, err := os.Stat(db.Path() + ".old")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAdminListener(t *testing.T) {
+	withAdminToken(t, "secret")
+	previous := config.AdminListen
+	config.AdminListen = "127.0.0.1:9090"
+	t.Cleanup(func() { config.AdminListen = previous })
+
+	get := func(router http.Handler, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	public, admin := setupRouter(), setupAdminRouter()
+	for _, path := range []string{"/admin/login", "/admin/stats", "/metrics"} {
+		assert.Equal(t, http.StatusNotFound, get(public, path), path)
+		assert.Equal(t, http.StatusOK, get(admin, path), path)
+	}
+	assert.Equal(t, http.StatusNotFound, get(admin, "/todos"))
+	assert.Equal(t, http.StatusOK, get(public, "/health"))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTitleLength caps titles, in characters.
+const maxTitleLength = 500
+
+// maxIconLength caps icons, in code points; enough for emoji joined into
+// one, such as a family.
+const maxIconLength = 10
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// normalizeTitle trims a title, collapses runs of whitespace, line breaks
+// included, into single spaces and cuts it at maxTitleLength characters.
+func normalizeTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if utf8.RuneCountInString(title) <= maxTitleLength {
+		return title
+	}
+	return strings.TrimSpace(string([]rune(title)[:maxTitleLength]))
+}
+
+// normalizeTodo tidies the free-form fields of a todo before it is stored,
+// so every write path stores them alike.
+func normalizeTodo(todo *Todo) {
+	todo.Title = normalizeTitle(todo.Title)
+	todo.Color = strings.ToLower(todo.Color)
+}
+
+func validTitle(title string) error {
+	if n := utf8.RuneCountInString(strings.Join(strings.Fields(title), " ")); n > maxTitleLength {
+		return fmt.Errorf("title longer than %d characters", maxTitleLength)
+	}
+	return nil
+}
+
+// validColor accepts an empty color or a hex color such as #1e90ff.
+func validColor(color string) error {
+	if color != "" && !colorPattern.MatchString(color) {
+		return fmt.Errorf("invalid color %q: use a hex color such as #1e90ff", color)
+	}
+	return nil
+}
+
+// validIcon accepts an empty icon or a single emoji: symbols, optionally
+// joined with zero-width joiners and followed by variation selectors or
+// skin tone modifiers.
+func validIcon(icon string) error {
+	if icon == "" {
+		return nil
+	}
+	invalid := fmt.Errorf("invalid icon %q: use a single emoji", icon)
+	if utf8.RuneCountInString(icon) > maxIconLength {
+		return invalid
+	}
+	for i, r := range []rune(icon) {
+		switch {
+		case unicode.Is(unicode.So, r):
+		case i > 0 && (r == '\u200d' || r == '\ufe0f' || unicode.Is(unicode.Sk, r)):
+		default:
+			return invalid
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		name, title, want string
+	}{
+		{"clean", "Buy milk", "Buy milk"},
+		{"trimmed", "  Buy milk\t", "Buy milk"},
+		{"collapsed", "Buy \t  milk\n\nand eggs", "Buy milk and eggs"},
+		{"unicode spaces", "Café com　leite", "Café com leite"},
+		{"cut in characters", strings.Repeat("é", maxTitleLength+5), strings.Repeat("é", maxTitleLength)},
+		{"no trailing space after cut", strings.Repeat("a", maxTitleLength-1) + " b", strings.Repeat("a", maxTitleLength-1)},
+		{"empty", " \n ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeTitle(tt.title))
+		})
+	}
+}
+
+func TestValidColorAndIcon(t *testing.T) {
+	tests := []struct {
+		name, color, icon string
+		err               string
+	}{
+		{"none", "", "", ""},
+		{"hex color", "#1E90ff", "", ""},
+		{"short hex", "#fff", "", `invalid color "#fff": use a hex color such as #1e90ff`},
+		{"named color", "red", "", `invalid color "red": use a hex color such as #1e90ff`},
+		{"emoji", "", "🛒", ""},
+		{"variation selector", "", "❤️", ""},
+		{"skin tone", "", "👍🏽", ""},
+		{"joined", "", "👩‍💻", ""},
+		{"flag", "", "🇧🇷", ""},
+		{"text", "", "ab", `invalid icon "ab": use a single emoji`},
+		{"emoji and text", "", "🛒 list", `invalid icon "🛒 list": use a single emoji`},
+		{"bare joiner", "", "\u200d", `invalid icon "\u200d": use a single emoji`},
+		{"too long", "", strings.Repeat("🛒", maxIconLength+1), `invalid icon "` + strings.Repeat("🛒", maxIconLength+1) + `": use a single emoji`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTodo(Todo{Title: "x", Color: tt.color, Icon: tt.icon})
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTitleNormalizedOnStore(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	body, _ := json.Marshal(Todo{Title: "  Buy\n milk  ", Color: "#1E90FF", Icon: "🛒"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var todo Todo
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&todo))
+	assert.Equal(t, "Buy milk", todo.Title)
+	assert.Equal(t, "#1e90ff", todo.Color)
+	assert.Equal(t, "🛒", todo.Icon)
+
+	// Paths that bypass the API, such as imports, are normalized too.
+	stored := saveTodo(t, Todo{Title: "Water\tplants "})
+	assert.Equal(t, "Water plants", stored.Title)
+
+	body, _ = json.Marshal(Todo{Title: strings.Repeat("a", maxTitleLength+1)})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "title longer than 500 characters\n", w.Body.String())
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// archiveDB holds todos completed long ago, moved out of the live database
+// to keep it small. It is a second bolt file laid out like the live one,
+// with todos, their indexes and comments, so the same iterators list it.
+// It is nil unless ARCHIVE_AFTER is set.
+var archiveDB *bolt.DB
+
+// errTodoArchived is returned for writes to an archived todo, which is
+// read-only.
+var errTodoArchived = errors.New("todo is archived and read-only")
+
+// archiveBatchSize is how many todos are moved to the archive per
+// transaction, so archiving doesn't hold the write lock for long.
+const archiveBatchSize = 500
+
+// initArchive opens and prepares the archive when ARCHIVE_AFTER is set.
+func initArchive() error {
+	if config.ArchiveAfter <= 0 {
+		return nil
+	}
+	var err error
+	if archiveDB, err = openDB(config.ArchivePath, false); err != nil {
+		return err
+	}
+	return archiveDB.Update(ensureArchiveBuckets)
+}
+
+func ensureArchiveBuckets(tx *bolt.Tx) error {
+	for _, name := range [][]byte{todosBucket, commentsBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+	indexes := tx.Bucket(indexesBucket)
+	for field := range indexedFields {
+		if indexes == nil || indexes.Bucket([]byte(field)) == nil {
+			return rebuildIndexes(tx)
+		}
+	}
+	return nil
+}
+
+// viewArchive runs fn in a read transaction of the archive, or with a nil
+// tx when archived todos aren't wanted or there is no archive.
+func viewArchive(include bool, fn func(atx *bolt.Tx) error) error {
+	if !include || archiveDB == nil {
+		return fn(nil)
+	}
+	return archiveDB.View(fn)
+}
+
+// loadArchivedTodo reads a todo from the archive, returning nil when it
+// isn't there.
+func loadArchivedTodo(id int) (*Todo, error) {
+	var todo *Todo
+	err := viewArchive(true, func(atx *bolt.Tx) error {
+		var err error
+		if atx != nil {
+			todo, err = loadTodo(atx, id)
+		}
+		return err
+	})
+	return todo, err
+}
+
+// archiveTodos moves to the archive the completed todos that haven't
+// changed since ARCHIVE_AFTER before now, going by the change feed.
+// Todos with attachments stay live, with their files. Archiving isn't a
+// change to a todo: it stays in the change feed as it was last written.
+func archiveTodos(now time.Time) error {
+	if archiveDB == nil {
+		return errors.New("set ARCHIVE_AFTER to archive")
+	}
+	cutoff := now.Add(-config.ArchiveAfter)
+
+	changed := make(map[int]time.Time)
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(changesBucket).ForEach(func(k, v []byte) error {
+			var change Change
+			if err := codec.Unmarshal(v, &change); err != nil {
+				return err
+			}
+			if change.At.After(changed[change.ID]) {
+				changed[change.ID] = change.At
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	var after []byte
+	for {
+		var batch map[int][]byte
+		batch, after, err = archiveCandidates(after, changed, cutoff)
+		if err != nil {
+			return err
+		}
+		if len(batch) > 0 {
+			n, err := archiveBatch(batch)
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+		if after == nil {
+			break
+		}
+	}
+	if total > 0 {
+		infof("archived %d todos", total)
+	}
+	return nil
+}
+
+// archiveCandidates returns up to archiveBatchSize todos to archive, by
+// ID with their stored values, from the completed todos after key after.
+// It also returns the key to continue from, nil once all were looked at.
+func archiveCandidates(after []byte, changed map[int]time.Time, cutoff time.Time) (map[int][]byte, []byte, error) {
+	batch := make(map[int][]byte)
+	var next []byte
+	err := db.View(func(tx *bolt.Tx) error {
+		it := newIndexIterator(tx, "completed", "true")
+		k, v := it.first()
+		if after != nil {
+			k, v = it.seekAfter(after)
+		}
+		var last []byte
+		for ; k != nil; k, v = it.next() {
+			if len(batch) == archiveBatchSize {
+				next = last
+				return nil
+			}
+			last = append(last[:0], k...)
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			at, ok := changed[todo.ID]
+			if !ok || at.After(cutoff) || hasAttachments(tx, k) {
+				continue
+			}
+			batch[todo.ID] = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return batch, next, err
+}
+
+func hasAttachments(tx *bolt.Tx, key []byte) bool {
+	b := tx.Bucket(attachmentsBucket).Bucket(key)
+	if b == nil {
+		return false
+	}
+	k, _ := b.Cursor().First()
+	return k != nil
+}
+
+// archiveBatch copies todos to the archive, with their comments, then
+// removes them from the live database, all while holding its write lock.
+// Todos written since they were picked stay live. The archive writes can
+// be repeated, so a batched write running fn again is harmless, and a crash
+// between the two commits leaves a todo in both for the next run to finish
+// moving.
+func archiveBatch(batch map[int][]byte) (int, error) {
+	moved := 0
+	err := writeTx(func(tx *bolt.Tx) error {
+		moved = 0
+		var todos []Todo
+		for id, snapshot := range batch {
+			v := tx.Bucket(todosBucket).Get(itob(id))
+			if v == nil || !bytes.Equal(v, snapshot) {
+				continue
+			}
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			todos = append(todos, todo)
+		}
+		if len(todos) == 0 {
+			return nil
+		}
+
+		err := archiveDB.Update(func(atx *bolt.Tx) error {
+			for _, todo := range todos {
+				if err := putArchivedTodo(tx, atx, todo); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, todo := range todos {
+			if err := unlinkArchivedTodo(tx, todo); err != nil {
+				return err
+			}
+		}
+		moved = len(todos)
+		return nil
+	})
+	return moved, err
+}
+
+// putArchivedTodo writes a live todo and its comments to the archive.
+func putArchivedTodo(tx, atx *bolt.Tx, todo Todo) error {
+	key := itob(todo.ID)
+	old, err := loadTodo(atx, todo.ID)
+	if err != nil {
+		return err
+	}
+	if err := atx.Bucket(todosBucket).Put(key, tx.Bucket(todosBucket).Get(key)); err != nil {
+		return err
+	}
+	if err := updateIndexes(atx, key, old, &todo); err != nil {
+		return err
+	}
+
+	comments := tx.Bucket(commentsBucket).Bucket(key)
+	if comments == nil {
+		return nil
+	}
+	archived, err := atx.Bucket(commentsBucket).CreateBucketIfNotExists(key)
+	if err != nil {
+		return err
+	}
+	if err := archived.SetSequence(comments.Sequence()); err != nil {
+		return err
+	}
+	return comments.ForEach(func(k, v []byte) error {
+		return archived.Put(k, v)
+	})
+}
+
+// unlinkArchivedTodo removes an archived todo from the live database. Unlike
+// removeTodo, it records no deletion.
+func unlinkArchivedTodo(tx *bolt.Tx, todo Todo) error {
+	key := itob(todo.ID)
+	if err := tx.Bucket(todosBucket).Delete(key); err != nil {
+		return err
+	}
+	if err := updateIndexes(tx, key, &todo, nil); err != nil {
+		return err
+	}
+	if err := deleteComments(tx, key); err != nil {
+		return err
+	}
+	if err := removeDependencies(tx, todo.ID); err != nil {
+		return err
+	}
+	if err := forgetCalDAVObject(tx, key); err != nil {
+		return err
+	}
+	if err := deleteWatchers(tx, key); err != nil {
+		return err
+	}
+	tx.OnCommit(func() { cache.invalidateTodo(todo.ID) })
+	return nil
+}
+
+// removeArchivedTodo deletes a todo from the archive, with its index
+// entries and comments.
+func removeArchivedTodo(atx *bolt.Tx, todo Todo) error {
+	key := itob(todo.ID)
+	if err := atx.Bucket(todosBucket).Delete(key); err != nil {
+		return err
+	}
+	if err := updateIndexes(atx, key, &todo, nil); err != nil {
+		return err
+	}
+	return deleteComments(atx, key)
+}
+
+// deleteArchivedTodo deletes todo id from the archive, if it is there. The
+// deletion is recorded in the live change feed first, so a failed delete
+// can be run again.
+func deleteArchivedTodo(id int) error {
+	todo, err := loadArchivedTodo(id)
+	if err != nil || todo == nil {
+		return err
+	}
+	err = writeTx(func(tx *bolt.Tx) error {
+		return recordChange(tx, EventTodoDeleted, *todo)
+	})
+	if err != nil {
+		return err
+	}
+	return archiveDB.Update(func(atx *bolt.Tx) error {
+		return removeArchivedTodo(atx, *todo)
+	})
+}
+
+// purgeArchivedUser deletes from the archive the todos that belong to user,
+// with their comments, and the comments user wrote on other archived
+// todos. The deletions are recorded in the live change feed first, so a
+// failed purge can be run again. It returns the IDs of the deleted todos.
+func purgeArchivedUser(user string) ([]int, int, error) {
+	if archiveDB == nil {
+		return nil, 0, nil
+	}
+	var todos []Todo
+	err := archiveDB.View(func(atx *bolt.Tx) error {
+		var err error
+		todos, err = ownTodos(atx, user)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(todos) > 0 {
+		err = writeTx(func(tx *bolt.Tx) error {
+			for _, todo := range todos {
+				if err := recordChange(tx, EventTodoDeleted, todo); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	ids := make([]int, len(todos))
+	comments := 0
+	err = archiveDB.Update(func(atx *bolt.Tx) error {
+		for i, todo := range todos {
+			ids[i] = todo.ID
+			if err := removeArchivedTodo(atx, todo); err != nil {
+				return err
+			}
+		}
+		var err error
+		comments, err = deleteNested(atx, commentsBucket, func(v []byte) (bool, error) {
+			var comment Comment
+			err := codec.Unmarshal(v, &comment)
+			return err == nil && comment.Author == user, err
+		})
+		return err
+	})
+	return ids, comments, err
+}
+
+// archiveChain lists live todos, then archived ones, each in the order of
+// its iterator. Keys are tagged with the side they come from, so a page or
+// cursor can cross from one to the other.
+type archiveChain struct {
+	live, archived listIterator
+	inArchive      bool
+}
+
+const (
+	liveTag    = 'l'
+	archiveTag = 'a'
+)
+
+func (c *archiveChain) wrap(k, v []byte) ([]byte, []byte) {
+	if k == nil {
+		return nil, nil
+	}
+	tag := byte(liveTag)
+	if c.inArchive {
+		tag = archiveTag
+	}
+	return append([]byte{tag}, k...), v
+}
+
+// fallThrough moves on to the archive when the live side is exhausted.
+func (c *archiveChain) fallThrough(k, v []byte) ([]byte, []byte) {
+	if k == nil && !c.inArchive {
+		c.inArchive = true
+		k, v = c.archived.first()
+	}
+	return c.wrap(k, v)
+}
+
+func (c *archiveChain) first() ([]byte, []byte) {
+	c.inArchive = false
+	return c.fallThrough(c.live.first())
+}
+
+func (c *archiveChain) seek(key []byte) ([]byte, []byte) {
+	if key[0] == archiveTag {
+		c.inArchive = true
+		return c.wrap(c.archived.seek(key[1:]))
+	}
+	c.inArchive = false
+	return c.fallThrough(c.live.seek(key[1:]))
+}
+
+// validArchiveCursor reports whether cursor came from an archiveChain,
+// tagged with its side.
+func validArchiveCursor(cursor []byte) bool {
+	return len(cursor) > 1 && (cursor[0] == liveTag || cursor[0] == archiveTag)
+}
+
+// seekAfter resumes after a tagged cursor. An untagged one, such as from a
+// listing without archived todos, matches nothing.
+func (c *archiveChain) seekAfter(cursor []byte) ([]byte, []byte) {
+	if !validArchiveCursor(cursor) {
+		c.inArchive = true
+		return nil, nil
+	}
+	if cursor[0] == archiveTag {
+		c.inArchive = true
+		return c.wrap(c.archived.seekAfter(cursor[1:]))
+	}
+	c.inArchive = false
+	return c.fallThrough(c.live.seekAfter(cursor[1:]))
+}
+
+func (c *archiveChain) next() ([]byte, []byte) {
+	if c.inArchive {
+		return c.wrap(c.archived.next())
+	}
+	return c.fallThrough(c.live.next())
+}
+
+func (c *archiveChain) count() int {
+	return c.live.count() + c.archived.count()
+}
+
+func (c *archiveChain) cursor(key []byte) []byte {
+	if key[0] == archiveTag {
+		return append([]byte{archiveTag}, c.archived.cursor(key[1:])...)
+	}
+	return append([]byte{liveTag}, c.live.cursor(key[1:])...)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withArchive(t *testing.T, after time.Duration) {
+	previous, previousConfig := archiveDB, config
+	config.ArchiveAfter = after
+	config.ArchivePath = filepath.Join(t.TempDir(), "archive.db")
+	assert.NoError(t, initArchive())
+	t.Cleanup(func() {
+		archiveDB.Close()
+		archiveDB, config = previous, previousConfig
+	})
+}
+
+func archivedTitles(t *testing.T) []string {
+	titles := []string{}
+	err := archiveDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(todosBucket).ForEach(func(k, v []byte) error {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			titles = append(titles, todo.Title)
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	return titles
+}
+
+func listTitles(t *testing.T, router http.Handler, url string) ([]string, PaginatedResponse) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response PaginatedResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	titles := []string{}
+	for _, todo := range response.Items {
+		titles = append(titles, todo.Title)
+	}
+	return titles, response
+}
+
+func TestArchiveTodos(t *testing.T) {
+	clearBucket(t)
+	withAttachmentLimits(t)
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	fake := withClock(t, start)
+	withArchive(t, 90*24*time.Hour)
+	router := setupRouter()
+
+	rent := saveTodo(t, Todo{Title: "Pay rent", Completed: true})
+	saveTodo(t, Todo{Title: "Review PR"})
+	photo := saveTodo(t, Todo{Title: "Frame photo", Completed: true})
+	upload := uploadRequest("/todos/3/attachments", "file", "photo.txt", []byte("beach"))
+	router.ServeHTTP(httptest.NewRecorder(), upload)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("bob", http.MethodPost, "/todos/1/comments", `{"body":"Paid by transfer"}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("bob", http.MethodPost, "/todos/1/watch", ""))
+	watchers, _ := todoWatchers(rent.ID)
+	assert.Equal(t, []string{"bob"}, watchers)
+	fake.Advance(60 * 24 * time.Hour)
+	saveTodo(t, Todo{Title: "Ship release", Completed: true})
+	fake.Advance(30 * 24 * time.Hour)
+
+	// Warm the list cache, which archiving has to drop.
+	titles, _ := listTitles(t, router, "/todos?sort=id")
+	assert.Len(t, titles, 4)
+
+	assert.NoError(t, archiveTodos(clock.Now()))
+	assert.ElementsMatch(t, []string{"Review PR", "Frame photo", "Ship release"}, localTitles(t))
+	assert.Equal(t, []string{"Pay rent"}, archivedTitles(t))
+	// Running again moves nothing more.
+	assert.NoError(t, archiveTodos(clock.Now()))
+	assert.Equal(t, []string{"Pay rent"}, archivedTitles(t))
+
+	titles, response := listTitles(t, router, "/todos?sort=id")
+	assert.Equal(t, []string{"Review PR", "Frame photo", "Ship release"}, titles)
+	assert.Equal(t, 3, response.TotalItems)
+	titles, response = listTitles(t, router, "/todos?sort=id&include_archived=true")
+	assert.Equal(t, []string{"Review PR", "Frame photo", "Ship release", "Pay rent"}, titles)
+	assert.Equal(t, 4, response.TotalItems)
+	titles, _ = listTitles(t, router, "/todos?completed=true&include_archived=true&sort=id")
+	assert.Equal(t, []string{"Frame photo", "Ship release", "Pay rent"}, titles)
+	titles, _ = listTitles(t, router, "/todos?q=completed:true+NOT+tag:work&include_archived=true&sort=id")
+	assert.Equal(t, []string{"Frame photo", "Ship release", "Pay rent"}, titles)
+
+	rentURL := "/todos/" + strconv.Itoa(rent.ID)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, rentURL, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, rentURL+"?include_archived=true", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var archived Todo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &archived))
+	assert.Equal(t, rent, archived)
+
+	// Comments move with the todo; attachments keep theirs live.
+	err := archiveDB.View(func(tx *bolt.Tx) error {
+		assert.NotNil(t, tx.Bucket(commentsBucket).Bucket(itob(rent.ID)))
+		return nil
+	})
+	assert.NoError(t, err)
+	err = db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket(commentsBucket).Bucket(itob(rent.ID)))
+		assert.True(t, hasAttachments(tx, itob(photo.ID)))
+		return nil
+	})
+	assert.NoError(t, err)
+	watchers, _ = todoWatchers(rent.ID)
+	assert.Empty(t, watchers)
+}
+
+func TestArchiveChainPagination(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	fake := withClock(t, start)
+	withArchive(t, time.Hour)
+	router := setupRouter()
+	for _, title := range []string{"Pay rent", "Water plants", "Review PR"} {
+		saveTodo(t, Todo{Title: title, Completed: true})
+	}
+	fake.Advance(2 * time.Hour)
+	saveTodo(t, Todo{Title: "Ship release"})
+	saveTodo(t, Todo{Title: "Book flights"})
+	assert.NoError(t, archiveTodos(clock.Now()))
+
+	var titles []string
+	url := "/todos?sort=id&limit=2&include_archived=true"
+	for url != "" {
+		page, response := listTitles(t, router, url)
+		titles = append(titles, page...)
+		url = ""
+		if response.NextCursor != "" {
+			url = "/todos?sort=id&limit=2&include_archived=true&cursor=" + response.NextCursor
+		}
+	}
+	assert.Equal(t, []string{"Ship release", "Book flights", "Pay rent", "Water plants", "Review PR"}, titles)
+
+	page, response := listTitles(t, router, "/todos?sort=id&limit=2&page=2&include_archived=true")
+	assert.Equal(t, []string{"Pay rent", "Water plants"}, page)
+	assert.Equal(t, 3, response.TotalPages)
+
+	// A cursor from a listing without archived todos carries no side.
+	_, live := listTitles(t, router, "/todos?sort=id&limit=1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos?sort=id&limit=2&include_archived=true&cursor="+live.NextCursor, nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestArchiveKeepsRecentlyChanged(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	fake := withClock(t, start)
+	withArchive(t, time.Hour)
+	todo := saveTodo(t, Todo{Title: "Pay rent", Completed: true})
+	fake.Advance(2 * time.Hour)
+	todo.Title = "Pay the rent"
+	saveTodo(t, todo)
+
+	assert.NoError(t, archiveTodos(clock.Now()))
+	assert.Equal(t, []string{"Pay the rent"}, localTitles(t))
+	assert.Empty(t, archivedTitles(t))
+}
+
+func TestArchivedTodoWrites(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	fake := withClock(t, start)
+	withArchive(t, time.Hour)
+	router := setupRouter()
+	saveTodo(t, Todo{Title: "Pay rent", Completed: true})
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("bob", http.MethodPost, "/todos/1/comments", `{"body":"Paid by transfer"}`))
+	fake.Advance(2 * time.Hour)
+	assert.NoError(t, archiveTodos(clock.Now()))
+
+	// Replacing an archived todo doesn't bring a second one to life.
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodPut, "/todos/1", `{"title":"Pay the rent"}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, localTitles(t))
+	titles, _ := listTitles(t, router, "/todos?include_archived=true")
+	assert.Equal(t, []string{"Pay rent"}, titles)
+
+	// Deleting it removes it from the archive, with its comments.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodDelete, "/todos/1", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, archivedTitles(t))
+	titles, _ = listTitles(t, router, "/todos?include_archived=true")
+	assert.Empty(t, titles)
+	err := archiveDB.View(func(atx *bolt.Tx) error {
+		assert.Nil(t, atx.Bucket(commentsBucket).Bucket(itob(1)))
+		return nil
+	})
+	assert.NoError(t, err)
+	changes := fetchChanges(t, "/todos/changes").Changes
+	assert.Equal(t, EventTodoDeleted, changes[len(changes)-1].Type)
+}
+
+func TestPurgeArchivedUser(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	fake := withClock(t, start)
+	withArchive(t, time.Hour)
+	router := setupRouter()
+	saveTodo(t, Todo{Title: "See the dentist", Assignee: "alice", Completed: true})
+	saveTodo(t, Todo{Title: "Mow lawn", Assignee: "bob", Completed: true})
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("alice", http.MethodPost, "/todos/2/comments", `{"body":"Before it rains"}`))
+	fake.Advance(2 * time.Hour)
+	assert.NoError(t, archiveTodos(clock.Now()))
+	assert.Len(t, archivedTitles(t), 2)
+
+	deletion, err := purgeUser("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deletion.Todos)
+	assert.Equal(t, 1, deletion.Comments)
+	assert.Equal(t, []string{"Mow lawn"}, archivedTitles(t))
+
+	// Only the tombstone of the archived todo is left in the change feed.
+	var changes []Change
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(changesBucket).ForEach(func(k, v []byte) error {
+			var change Change
+			err := codec.Unmarshal(v, &change)
+			if change.ID == 1 {
+				changes = append(changes, change)
+			}
+			return err
+		})
+	})
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, EventTodoDeleted, changes[0].Type)
+}
+
+func TestReencryptArchive(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	fake := withClock(t, start)
+	withArchive(t, time.Hour)
+	oldKey := newTestKey(t)
+	withEncryption(t, oldKey)
+	todo := saveTodo(t, Todo{Title: "Pay rent", Completed: true})
+	fake.Advance(2 * time.Hour)
+	assert.NoError(t, archiveTodos(clock.Now()))
+
+	key := newTestKey(t)
+	withEncryption(t, key, oldKey)
+	n, err := reencrypt()
+	assert.NoError(t, err)
+	assert.Greater(t, n, 1)
+
+	// Archived todos still read once the old key is dropped.
+	withEncryption(t, key)
+	archived, err := loadArchivedTodo(todo.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Pay rent", archived.Title)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// attachmentsBucket holds a nested bucket per todo, keyed like the todo,
+// with the metadata of the todo's attachments keyed by their ID. Contents
+// are kept in the blob store.
+var attachmentsBucket = []byte("attachments")
+
+// maxAttachmentName caps the length of a stored file name.
+const maxAttachmentName = 255
+
+type Attachment struct {
+	ID          int       `json:"id"`
+	TodoID      int       `json:"todoId"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Uploader    string    `json:"uploader,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Thumbnails lists the sizes, from THUMBNAIL_SIZES, an image can be
+	// downloaded at.
+	Thumbnails []string `json:"thumbnails,omitempty"`
+}
+
+// storedAttachment is an attachment as stored, with the key of its
+// contents in the blob store.
+type storedAttachment struct {
+	Attachment
+	Blob string `json:"blob"`
+}
+
+// blobKeys returns the keys of the attachment's contents and thumbnails.
+func (a storedAttachment) blobKeys() []string {
+	keys := []string{a.Blob}
+	for _, size := range a.Thumbnails {
+		keys = append(keys, thumbnailKey(a.Blob, size))
+	}
+	return keys
+}
+
+func deleteBlobs(keys []string) {
+	for _, key := range keys {
+		if err := blobs.delete(key); err != nil {
+			warnf("deleting attachment blob %s: %v", key, err)
+		}
+	}
+}
+
+var errAttachmentNotFound = errors.New("attachment not found")
+
+// todoAttachments returns the attachment bucket of a todo, creating it when
+// create is set. It fails with errTodoNotFound if the todo doesn't exist.
+func todoAttachments(tx *bolt.Tx, id int, create bool) (*bolt.Bucket, error) {
+	if tx.Bucket(todosBucket).Get(itob(id)) == nil {
+		return nil, errTodoNotFound
+	}
+	if create {
+		return tx.Bucket(attachmentsBucket).CreateBucketIfNotExists(itob(id))
+	}
+	return tx.Bucket(attachmentsBucket).Bucket(itob(id)), nil
+}
+
+func loadAttachment(tx *bolt.Tx, todoID, attachmentID int) (storedAttachment, error) {
+	var attachment storedAttachment
+	b, err := todoAttachments(tx, todoID, false)
+	if err != nil {
+		return attachment, err
+	}
+	var v []byte
+	if b != nil {
+		v = b.Get(itob(attachmentID))
+	}
+	if v == nil {
+		return attachment, errAttachmentNotFound
+	}
+	err = codec.Unmarshal(v, &attachment)
+	return attachment, err
+}
+
+// deleteAttachments removes a todo's attachments along with the todo. Their
+// blobs are deleted once the transaction commits.
+func deleteAttachments(tx *bolt.Tx, key []byte) error {
+	b := tx.Bucket(attachmentsBucket).Bucket(key)
+	if b == nil {
+		return nil
+	}
+	var keys []string
+	err := b.ForEach(func(k, v []byte) error {
+		var attachment storedAttachment
+		if err := codec.Unmarshal(v, &attachment); err != nil {
+			return err
+		}
+		keys = append(keys, attachment.blobKeys()...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(attachmentsBucket).DeleteBucket(key); err != nil {
+		return err
+	}
+	tx.OnCommit(func() { deleteBlobs(keys) })
+	return nil
+}
+
+// allowedAttachmentType reports whether ATTACHMENT_TYPES accepts a media
+// type. Entries ending in "/" accept a whole family, such as image/.
+func allowedAttachmentType(mediaType string) bool {
+	for _, allowed := range config.AttachmentTypes {
+		if mediaType == allowed || strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func attachmentName(filename string) string {
+	name := strings.TrimSpace(filepath.Base(strings.ReplaceAll(filename, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if runes := []rune(name); len(runes) > maxAttachmentName {
+		name = string(runes[:maxAttachmentName])
+	}
+	return name
+}
+
+func attachmentError(w http.ResponseWriter, err error) {
+	switch {
+	case err == errTodoNotFound, err == errAttachmentNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// attachmentRequest parses the todo and attachment IDs of an attachment
+// route. The attachment ID is zero on collection routes.
+func attachmentRequest(w http.ResponseWriter, r *http.Request) (todoID, attachmentID int, ok bool) {
+	vars := mux.Vars(r)
+	todoID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	if s, found := vars["attachmentID"]; found {
+		if attachmentID, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return todoID, attachmentID, true
+}
+
+func getAttachments(w http.ResponseWriter, r *http.Request) {
+	todoID, _, ok := attachmentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	attachments := []Attachment{}
+	err := db.View(func(tx *bolt.Tx) error {
+		b, err := todoAttachments(tx, todoID, false)
+		if err != nil || b == nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var attachment Attachment
+			if err := codec.Unmarshal(v, &attachment); err != nil {
+				return err
+			}
+			attachments = append(attachments, attachment)
+			return nil
+		})
+	})
+	if err != nil {
+		attachmentError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// createAttachment stores the file uploaded in the multipart field "file".
+// Its type is detected from the contents rather than trusted from the
+// client.
+func createAttachment(w http.ResponseWriter, r *http.Request) {
+	todoID, _, ok := attachmentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	maxSize := config.AttachmentMaxSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Attachment is larger than %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, `Upload the file as multipart/form-data in the field "file"`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		http.Error(w, fmt.Sprintf("Attachment is larger than %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	contentType := http.DetectContentType(data)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !allowedAttachmentType(mediaType) {
+		http.Error(w, fmt.Sprintf("Attachments of type %s are not accepted", mediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	blob, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := blobs.put(blob, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	thumbnails := createThumbnails(blob, contentType, data)
+
+	var attachment Attachment
+	err = writeTx(func(tx *bolt.Tx) error {
+		if err := checkAttachmentQuota(tx, userFromRequest(r), int64(len(data))); err != nil {
+			return err
+		}
+		b, err := todoAttachments(tx, todoID, true)
+		if err != nil {
+			return err
+		}
+		id, _ := b.NextSequence()
+		attachment = Attachment{
+			ID:          int(id),
+			TodoID:      todoID,
+			Name:        attachmentName(header.Filename),
+			ContentType: contentType,
+			Size:        int64(len(data)),
+			Uploader:    userFromRequest(r),
+			CreatedAt:   clock.Now().UTC(),
+			Thumbnails:  thumbnails,
+		}
+		buf, err := codec.Marshal(storedAttachment{Attachment: attachment, Blob: blob})
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(attachment.ID), buf)
+	})
+	if err != nil {
+		deleteBlobs(storedAttachment{Attachment: Attachment{Thumbnails: thumbnails}, Blob: blob}.blobKeys())
+		attachmentError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// getAttachment downloads an attachment's contents, or with ?size= one of
+// its thumbnails.
+func getAttachment(w http.ResponseWriter, r *http.Request) {
+	todoID, attachmentID, ok := attachmentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var attachment storedAttachment
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		attachment, err = loadAttachment(tx, todoID, attachmentID)
+		return err
+	})
+	if err != nil {
+		attachmentError(w, err)
+		return
+	}
+
+	if size := r.URL.Query().Get("size"); size != "" {
+		getThumbnail(w, attachment, size)
+		return
+	}
+
+	data, err := blobs.get(attachment.Blob)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+func deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	todoID, attachmentID, ok := attachmentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var attachment storedAttachment
+	err := writeTx(func(tx *bolt.Tx) error {
+		var err error
+		if attachment, err = loadAttachment(tx, todoID, attachmentID); err != nil {
+			return err
+		}
+		b, _ := todoAttachments(tx, todoID, false)
+		return b.Delete(itob(attachmentID))
+	})
+	if err != nil {
+		attachmentError(w, err)
+		return
+	}
+	deleteBlobs(attachment.blobKeys())
+
+	w.WriteHeader(http.StatusNoContent)
+}
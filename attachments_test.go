@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// pngHeader is enough of a PNG for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func withAttachmentLimits(t *testing.T) {
+	previous := config
+	config.AttachmentMaxSize = 64
+	config.AttachmentTypes = []string{"image/", "text/plain"}
+	config.ThumbnailSizes = map[string]int{"thumb": 16}
+	t.Cleanup(func() { config = previous })
+}
+
+func uploadRequest(url, field, filename string, data []byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile(field, filename)
+	part.Write(data)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, url, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestAttachmentName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"photo.jpg", "photo.jpg"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\notes.txt`, "notes.txt"},
+		{"", "attachment"},
+		{strings.Repeat("a", 300), strings.Repeat("a", maxAttachmentName)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.want, attachmentName(tt.in))
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	clearBucket(t)
+	withAttachmentLimits(t)
+	router := setupRouter()
+	todo := saveTodo(t, Todo{Title: "Fix the sink"})
+	url := "/todos/" + strconv.Itoa(todo.ID) + "/attachments"
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"missing todo", uploadRequest("/todos/999/attachments", "file", "a.txt", []byte("hi")), http.StatusNotFound},
+		{"wrong field", uploadRequest(url, "upload", "a.txt", []byte("hi")), http.StatusBadRequest},
+		{"too large", uploadRequest(url, "file", "a.txt", bytes.Repeat([]byte("x"), 65)), http.StatusRequestEntityTooLarge},
+		{"type not accepted", uploadRequest(url, "file", "a.pdf", []byte("%PDF-1.4\n")), http.StatusUnsupportedMediaType},
+		{"image", uploadRequest(url, "file", "leak.png", pngHeader), http.StatusCreated},
+		{"text", uploadRequest(url, "file", "notes.txt", []byte("Call a plumber")), http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tt.req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	var attachments []Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &attachments))
+	assert.Len(t, attachments, 2)
+	assert.Equal(t, "leak.png", attachments[0].Name)
+	assert.Equal(t, "image/png", attachments[0].ContentType)
+	assert.Equal(t, int64(len(pngHeader)), attachments[0].Size)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url+"/2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=notes.txt`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "Call a plumber", w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, url+"/2", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url+"/2", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Deleting the todo deletes its attachments' contents too.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/todos/"+strconv.Itoa(todo.ID), nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	err := db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 0, tx.Bucket(attachmentBlobsBucket).Stats().KeyN)
+		return nil
+	})
+	assert.NoError(t, err)
+}
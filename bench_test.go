@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var checkBudgets = flag.Bool("budgets", false, "check p99 latencies against testdata/perf_budgets.json")
+
+// benchKey is a fixed AES-256 key for benchmarking encryption at rest.
+const benchKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+var benchTags = []string{"home", "work", "errands", "finance", "health"}
+
+// benchBackends are the storage setups benchmarked: every codec built in,
+// and the std codec with encryption at rest.
+func benchBackends(tb testing.TB) map[string]Codec {
+	backends := make(map[string]Codec)
+	for name, c := range codecs {
+		backends[name] = c
+	}
+	encrypted, err := newEncryptedCodec(stdCodec{}, benchKey, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	backends["std+encrypted"] = encrypted
+	return backends
+}
+
+// benchPosition is a fixed-width position for the i-th seeded todo. Seeding
+// through positionBetween would append one character every few todos,
+// making a 100k seed quadratic.
+func benchPosition(i int) string {
+	b := []byte("0000")
+	for j := len(b) - 1; j >= 0 && i > 0; j-- {
+		b[j] = positionDigits[i%len(positionDigits)]
+		i /= len(positionDigits)
+	}
+	return string(b)
+}
+
+// seedBench fills the database with count todos spread over tags and
+// priorities, so queries have something to select.
+func seedBench(tb testing.TB, count int) {
+	rng := rand.New(rand.NewSource(1))
+	for created := 0; created < count; created += seedBatchSize {
+		err := db.Update(func(tx *bolt.Tx) error {
+			for i := created; i < min(created+seedBatchSize, count); i++ {
+				todo := fakeTodo(rng)
+				todo.Priority = []string{"", "low", "medium", "high"}[rng.Intn(4)]
+				todo.Tags = []string{benchTags[rng.Intn(len(benchTags))]}
+				id, _ := tx.Bucket(todosBucket).NextSequence()
+				todo.ID = int(id)
+				todo.Position = benchPosition(i + 1)
+				reconcileStatus(nil, &todo)
+				if err := putTodo(tx, &todo); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// benchOps are the requests benchmarked, by name. Each returns a fresh
+// request, since bodies are consumed.
+var benchOps = map[string]func(i int) *http.Request{
+	"create": func(i int) *http.Request {
+		body, _ := json.Marshal(Todo{Title: fmt.Sprintf("Bench %d", i), Priority: "medium", Tags: []string{"work"}})
+		return httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader(body))
+	},
+	"list": func(int) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/todos?limit=100", nil)
+	},
+	"search": func(int) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/todos?limit=100&q=tag:work+AND+priority>=medium+AND+NOT+completed:true", nil)
+	},
+}
+
+// serveBench serves one request, failing on an error status.
+func serveBench(tb testing.TB, router http.Handler, req *http.Request) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code >= 300 {
+		tb.Fatalf("%s %s: status %d: %s", req.Method, req.URL, w.Code, w.Body)
+	}
+}
+
+// p99 returns the 99th percentile of latencies, sorting them.
+func p99(latencies []time.Duration) time.Duration {
+	slices.Sort(latencies)
+	return latencies[(len(latencies)-1)*99/100]
+}
+
+// BenchmarkStore times create, list and search at 1k and 100k todos for
+// every backend, reporting the p99 latency alongside the mean. The 100k
+// runs are skipped with -short.
+func BenchmarkStore(b *testing.B) {
+	router := setupRouter()
+	for _, size := range []int{1000, 100000} {
+		if size > 1000 && testing.Short() {
+			continue
+		}
+		backends := benchBackends(b)
+		for _, backend := range slices.Sorted(maps.Keys(backends)) {
+			b.Run(fmt.Sprintf("%dk/%s", size/1000, backend), func(b *testing.B) {
+				useTestDB(b)
+				withCodec(b, backends[backend])
+				seedBench(b, size)
+
+				for _, op := range slices.Sorted(maps.Keys(benchOps)) {
+					b.Run(op, func(b *testing.B) {
+						latencies := make([]time.Duration, 0, b.N)
+						b.ReportAllocs()
+						b.ResetTimer()
+						for i := 0; i < b.N; i++ {
+							start := time.Now()
+							serveBench(b, router, benchOps[op](i))
+							latencies = append(latencies, time.Since(start))
+						}
+						b.StopTimer()
+						b.ReportMetric(float64(p99(latencies).Nanoseconds()), "p99-ns/op")
+					})
+				}
+			})
+		}
+	}
+}
+
+// TestPerformanceBudgets fails when an operation's p99 latency, on 1k todos
+// with the default codec, is over its budget in testdata/perf_budgets.json.
+// It only runs with -budgets, on a quiet machine:
+//
+//	go test -run PerformanceBudgets -budgets .
+func TestPerformanceBudgets(t *testing.T) {
+	if !*checkBudgets {
+		t.Skip("run with -budgets")
+	}
+	data, err := os.ReadFile("testdata/perf_budgets.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var budgets struct {
+		Records int               `json:"records"`
+		Samples int               `json:"samples"`
+		P99     map[string]string `json:"p99"`
+	}
+	if err := json.Unmarshal(data, &budgets); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestDB(t)
+	seedBench(t, budgets.Records)
+	router := setupRouter()
+	for _, op := range slices.Sorted(maps.Keys(budgets.P99)) {
+		budget, err := time.ParseDuration(budgets.P99[op])
+		if err != nil {
+			t.Fatalf("%s: %v", op, err)
+		}
+		request, ok := benchOps[op]
+		if !ok {
+			t.Fatalf("no benchmark operation %q", op)
+		}
+
+		latencies := make([]time.Duration, budgets.Samples)
+		for i := range latencies {
+			start := time.Now()
+			serveBench(t, router, request(i))
+			latencies[i] = time.Since(start)
+		}
+		got := p99(latencies)
+		t.Logf("%s: p99 %s, budget %s", op, got, budget)
+		if got > budget {
+			t.Errorf("%s: p99 %s is over its %s budget", op, got, budget)
+		}
+	}
+}
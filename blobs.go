@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// attachmentBlobsBucket holds attachment contents, and export archives,
+// when they are kept in the database, keyed by blob key.
+var attachmentBlobsBucket = []byte("attachmentBlobs")
+
+var errBlobNotFound = errors.New("blob not found")
+
+// blobStore keeps attachment contents apart from their metadata, so large
+// files can live outside the database.
+type blobStore interface {
+	put(key string, data []byte) error
+	get(key string) ([]byte, error)
+	delete(key string) error
+}
+
+// blobs is where attachment contents go, chosen by ATTACHMENT_STORE.
+var blobs blobStore = boltBlobStore{}
+
+func newBlobStore(kind, dir string) (blobStore, error) {
+	switch kind {
+	case "", "bolt":
+		return boltBlobStore{}, nil
+	case "disk":
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		return diskBlobStore{dir: dir}, nil
+	}
+	return nil, fmt.Errorf("unknown attachment store %q: use bolt or disk", kind)
+}
+
+// boltBlobStore keeps blobs in their own bucket of the todo database, sealed
+// like every other value when ENCRYPTION_KEY is set.
+type boltBlobStore struct{}
+
+func (boltBlobStore) put(key string, data []byte) error {
+	data, err := sealBlob(data)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(attachmentBlobsBucket).Put([]byte(key), data)
+	})
+}
+
+func (boltBlobStore) get(key string) ([]byte, error) {
+	var data []byte
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(attachmentBlobsBucket).Get([]byte(key))
+		if v == nil {
+			return errBlobNotFound
+		}
+		var err error
+		data, err = openBlob(append([]byte(nil), v...))
+		return err
+	})
+	return data, err
+}
+
+func (boltBlobStore) delete(key string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(attachmentBlobsBucket).Delete([]byte(key))
+	})
+}
+
+// diskBlobStore keeps a file per blob in a directory.
+type diskBlobStore struct {
+	dir string
+}
+
+func (s diskBlobStore) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\.`) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+// put writes to a temporary file first, so a blob is never seen half
+// written.
+func (s diskBlobStore) put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s diskBlobStore) get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errBlobNotFound
+	}
+	return data, err
+}
+
+func (s diskBlobStore) delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobStores(t *testing.T) {
+	clearBucket(t)
+	disk, err := newBlobStore("disk", t.TempDir())
+	assert.NoError(t, err)
+	_, err = newBlobStore("s3", "")
+	assert.Error(t, err)
+
+	for name, store := range map[string]blobStore{"bolt": boltBlobStore{}, "disk": disk} {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.get("abc123")
+			assert.Equal(t, errBlobNotFound, err)
+
+			assert.NoError(t, store.put("abc123", []byte("hello")))
+			data, err := store.get("abc123")
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", string(data))
+
+			assert.NoError(t, store.delete("abc123"))
+			assert.NoError(t, store.delete("abc123"))
+			_, err = store.get("abc123")
+			assert.Equal(t, errBlobNotFound, err)
+		})
+	}
+
+	assert.Error(t, disk.put("../escape", []byte("x")))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+var errCircuitOpen = errors.New("circuit open")
+
+// Circuit is the state of a circuit breaker, as shown at GET
+// /admin/circuits.
+type Circuit struct {
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+	// LastError is the latest failure, kept after recovery for debugging.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// circuitBreaker stops calls to a downstream service after consecutive
+// failures, so callers such as the reminder job fail fast instead of each
+// waiting out a timeout. After BREAKER_COOLDOWN one trial call is let
+// through: its success closes the circuit, its failure opens it again.
+type circuitBreaker struct {
+	mu      sync.Mutex
+	circuit Circuit
+	probing bool
+}
+
+// allow reports whether a call may go ahead, failing with errCircuitOpen
+// while the circuit is open.
+func (b *circuitBreaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if config.BreakerThreshold == 0 {
+		return nil
+	}
+	switch b.circuit.State {
+	case circuitOpen:
+		if now.Sub(*b.circuit.OpenedAt) < config.BreakerCooldown {
+			break
+		}
+		b.circuit.State = circuitHalfOpen
+		fallthrough
+	case circuitHalfOpen:
+		if b.probing {
+			break
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s is unavailable after %d failures (%w)", b.circuit.Name, b.circuit.Failures, errCircuitOpen)
+}
+
+// record counts the outcome of an allowed call.
+func (b *circuitBreaker) record(now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		if b.circuit.State != circuitClosed {
+			infof("circuit %s closed", b.circuit.Name)
+		}
+		b.circuit.State = circuitClosed
+		b.circuit.Failures = 0
+		b.circuit.OpenedAt = nil
+		return
+	}
+
+	b.circuit.Failures++
+	b.circuit.LastError = err.Error()
+	if config.BreakerThreshold == 0 {
+		return
+	}
+	if b.circuit.State == circuitHalfOpen || b.circuit.Failures >= config.BreakerThreshold {
+		if b.circuit.State != circuitOpen {
+			warnf("circuit %s opened after %d failures: %v", b.circuit.Name, b.circuit.Failures, err)
+		}
+		b.circuit.State = circuitOpen
+		b.circuit.OpenedAt = &now
+	}
+}
+
+func (b *circuitBreaker) state() Circuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.circuit
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*circuitBreaker)
+)
+
+// breakerFor returns the circuit breaker of a downstream service, such as
+// twilio or github.
+func breakerFor(name string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = &circuitBreaker{circuit: Circuit{Name: name, State: circuitClosed}}
+		breakers[name] = b
+	}
+	return b
+}
+
+// breakerTransport sends requests through a circuit breaker. Network errors
+// and 5xx or 429 responses count as failures; other responses mean the
+// service is up, even if it rejected the request.
+type breakerTransport struct {
+	breaker *circuitBreaker
+	next    http.RoundTripper
+}
+
+func (t breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(clock.Now()); err != nil {
+		debugf("%s %s not sent: %v", req.Method, req.URL.Host, err)
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	failure := err
+	if err == nil && (resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests) {
+		failure = fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	t.breaker.record(clock.Now(), failure)
+	return resp, err
+}
+
+// withBreaker routes a client's requests through the named breaker.
+func withBreaker(name string, client *http.Client) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = breakerTransport{breaker: breakerFor(name), next: next}
+	return client
+}
+
+// getCircuits reports the state of every downstream service's circuit.
+func getCircuits(w http.ResponseWriter, r *http.Request) {
+	breakersMu.Lock()
+	circuits := make([]Circuit, 0, len(breakers))
+	for _, b := range breakers {
+		circuits = append(circuits, b.state())
+	}
+	breakersMu.Unlock()
+	sort.Slice(circuits, func(i, j int) bool { return circuits[i].Name < circuits[j].Name })
+
+	json.NewEncoder(w).Encode(circuits)
+}
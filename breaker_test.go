@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withBreakers(t *testing.T, threshold int, cooldown time.Duration) {
+	previous, previousConfig := breakers, config
+	breakers = make(map[string]*circuitBreaker)
+	config.BreakerThreshold, config.BreakerCooldown = threshold, cooldown
+	t.Cleanup(func() { breakers, config = previous, previousConfig })
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	withBreakers(t, 2, time.Minute)
+	b := breakerFor("twilio")
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	down := errors.New("connection refused")
+
+	assert.NoError(t, b.allow(start))
+	b.record(start, down)
+	assert.Equal(t, circuitClosed, b.state().State)
+	b.record(start, down)
+	assert.Equal(t, circuitOpen, b.state().State)
+	assert.ErrorIs(t, b.allow(start.Add(30*time.Second)), errCircuitOpen)
+
+	// After the cooldown one trial call goes through, and failing reopens.
+	assert.NoError(t, b.allow(start.Add(time.Minute)))
+	assert.ErrorIs(t, b.allow(start.Add(time.Minute)), errCircuitOpen)
+	b.record(start.Add(time.Minute), down)
+	assert.Equal(t, circuitOpen, b.state().State)
+	assert.ErrorIs(t, b.allow(start.Add(90*time.Second)), errCircuitOpen)
+
+	// A successful trial closes it.
+	assert.NoError(t, b.allow(start.Add(2*time.Minute)))
+	b.record(start.Add(2*time.Minute), nil)
+	circuit := b.state()
+	assert.Equal(t, circuitClosed, circuit.State)
+	assert.Zero(t, circuit.Failures)
+	assert.Nil(t, circuit.OpenedAt)
+	assert.Equal(t, "connection refused", circuit.LastError)
+	assert.NoError(t, b.allow(start.Add(2*time.Minute)))
+
+	// A zero threshold turns breakers off.
+	config.BreakerThreshold = 0
+	for i := 0; i < 5; i++ {
+		b.record(start, down)
+	}
+	assert.NoError(t, b.allow(start))
+}
+
+func TestBreakerTransport(t *testing.T) {
+	withBreakers(t, 2, time.Minute)
+	status := http.StatusServiceUnavailable
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client := withBreaker("jira", &http.Client{})
+
+	for _, expected := range []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable} {
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, resp.StatusCode)
+		resp.Body.Close()
+	}
+	_, err := client.Get(server.URL)
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, 2, calls, "an open circuit makes no request")
+
+	// Client errors mean the service is up.
+	withBreakers(t, 2, time.Minute)
+	client = withBreaker("jira", &http.Client{})
+	status = http.StatusNotFound
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, circuitClosed, breakerFor("jira").state().State)
+}
+
+func TestGetCircuits(t *testing.T) {
+	withBreakers(t, 1, time.Minute)
+	withAdminToken(t, "secret")
+	breakerFor("twilio")
+	breakerFor("github").record(time.Now(), errors.New("api.github.com answered 502 Bad Gateway"))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/circuits", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var circuits []Circuit
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &circuits))
+	assert.Len(t, circuits, 2)
+	assert.Equal(t, "github", circuits[0].Name)
+	assert.Equal(t, circuitOpen, circuits[0].State)
+	assert.Equal(t, "api.github.com answered 502 Bad Gateway", circuits[0].LastError)
+	assert.NotNil(t, circuits[0].OpenedAt)
+	assert.Equal(t, circuitClosed, circuits[1].State)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const listCachePrefix = "list:"
+
+type CacheStats struct {
+	Size   int    `json:"size"`
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+type cacheEntry struct {
+	key   string
+	value interface{}
+}
+
+// readCache is an LRU cache for single todos and first listing pages. Writes
+// invalidate it through the event bus. Every invalidation bumps generation,
+// and readers only store values loaded under the current generation, so a
+// read racing with a write can't put stale data back.
+type readCache struct {
+	mu         sync.Mutex
+	capacity   int
+	entries    map[string]*list.Element
+	order      *list.List
+	generation uint64
+	hits       uint64
+	misses     uint64
+}
+
+var cache = newReadCache(0)
+
+func newReadCache(capacity int) *readCache {
+	return &readCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func todoCacheKey(id int) string {
+	return fmt.Sprintf("todo:%d", id)
+}
+
+func (c *readCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity <= 0 {
+		return nil, false
+	}
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).value, true
+}
+
+func (c *readCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put stores value unless an invalidation happened since gen was read.
+func (c *readCache) put(key string, value interface{}, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity <= 0 || gen != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidateTodo drops a todo and every cached listing, since any write can
+// change first pages and totals.
+func (c *readCache) invalidateTodo(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.remove(todoCacheKey(id))
+	for key := range c.entries {
+		if strings.HasPrefix(key, listCachePrefix) {
+			c.remove(key)
+		}
+	}
+}
+
+func (c *readCache) remove(key string) {
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+func (c *readCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *readCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Size: c.order.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+func init() {
+	events.subscribe(func(e Event) {
+		cache.invalidateTodo(e.Todo.ID)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func withCache(t *testing.T, capacity int) {
+	previous := cache
+	cache = newReadCache(capacity)
+	t.Cleanup(func() { cache = previous })
+}
+
+func TestReadCacheEviction(t *testing.T) {
+	c := newReadCache(2)
+	gen := c.currentGeneration()
+
+	c.put("a", 1, gen)
+	c.put("b", 2, gen)
+	c.get("a") // a becomes most recently used
+	c.put("c", 3, gen)
+
+	_, ok := c.get("b")
+	assert.False(t, ok)
+
+	value, ok := c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	_, ok = c.get("c")
+	assert.True(t, ok)
+}
+
+func TestReadCacheSkipsStalePut(t *testing.T) {
+	c := newReadCache(10)
+
+	gen := c.currentGeneration()
+	c.invalidateTodo(1)
+	c.put(todoCacheKey(1), Todo{ID: 1, Title: "Stale"}, gen)
+
+	_, ok := c.get(todoCacheKey(1))
+	assert.False(t, ok)
+}
+
+func TestReadCacheDisabled(t *testing.T) {
+	c := newReadCache(0)
+
+	c.put("a", 1, c.currentGeneration())
+	_, ok := c.get("a")
+
+	assert.False(t, ok)
+	assert.Equal(t, CacheStats{}, c.stats())
+}
+
+func TestCachedReadsInvalidatedOnWrite(t *testing.T) {
+	clearBucket(t)
+	withCache(t, 100)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/todos", getTodos).Methods("GET")
+	router.HandleFunc("/todos", createTodo).Methods("POST")
+	router.HandleFunc("/todos/{id}", getTodoByID).Methods("GET")
+	router.HandleFunc("/todos/{id}", updateTodo).Methods("PUT")
+
+	request := func(method, url string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, bytes.NewBuffer(payload)))
+		return w
+	}
+
+	request(http.MethodPost, "/todos", Todo{Title: "Original"})
+
+	// Miss then hit for both the todo and the first page
+	request(http.MethodGet, "/todos/1", nil)
+	request(http.MethodGet, "/todos", nil)
+	request(http.MethodGet, "/todos/1", nil)
+	request(http.MethodGet, "/todos", nil)
+	assert.Equal(t, uint64(2), cache.stats().Hits)
+	assert.Equal(t, uint64(2), cache.stats().Misses)
+
+	request(http.MethodPut, "/todos/1", Todo{Title: "Changed"})
+
+	var todo Todo
+	json.Unmarshal(request(http.MethodGet, "/todos/1", nil).Body.Bytes(), &todo)
+	assert.Equal(t, "Changed", todo.Title)
+
+	request(http.MethodPost, "/todos", Todo{Title: "Second"})
+
+	var list PaginatedResponse
+	json.Unmarshal(request(http.MethodGet, "/todos", nil).Body.Bytes(), &list)
+	assert.Equal(t, 2, list.TotalItems)
+	assert.Equal(t, "Changed", list.Items[0].Title)
+}
@@ -0,0 +1,753 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CalDAV access for native task apps such as Apple Reminders and
+// Thunderbird. It serves a small subset of RFC 4791: a single calendar
+// collection of VTODOs, discovery through PROPFIND, calendar-query and
+// calendar-multiget REPORTs, and GET, PUT and DELETE of objects with ETag
+// preconditions. Clients log in with HTTP Basic auth, using their user name
+// and their feed token as the password.
+
+const (
+	caldavRoot       = "/caldav/"
+	caldavCollection = "/caldav/todos/"
+
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+
+	maxCalDAVObjectSize = 1 << 20
+)
+
+// caldavNamesBucket maps the object names clients choose to todo keys, and
+// caldavObjectsBucket maps todo keys to their CalDAVObject. Todos that never
+// went through CalDAV have neither and are served as <id>.ics.
+var (
+	caldavNamesBucket   = []byte("caldavNames")
+	caldavObjectsBucket = []byte("caldavObjects")
+)
+
+// CalDAVObject is how a todo appears over CalDAV: its resource name and the
+// UID the client gave it.
+type CalDAVObject struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// caldavError carries the HTTP status of a failed CalDAV request.
+type caldavError struct {
+	code int
+	msg  string
+}
+
+func (e *caldavError) Error() string {
+	return e.msg
+}
+
+var (
+	errPreconditionFailed = &caldavError{http.StatusPreconditionFailed, "ETag precondition failed"}
+	errObjectNotFound     = &caldavError{http.StatusNotFound, "object not found"}
+
+	defaultObjectName = regexp.MustCompile(`^([0-9]+)\.ics$`)
+
+	// caldavStamp is the DTSTAMP of served objects. Todos carry no
+	// modification time, and a stable stamp keeps a todo's body in step with
+	// its ETag.
+	caldavStamp = time.Unix(0, 0)
+)
+
+func caldavObject(tx *bolt.Tx, todo Todo, host string) CalDAVObject {
+	obj := CalDAVObject{Name: fmt.Sprintf("%d.ics", todo.ID), UID: icsUID(todo.ID, host)}
+	if v := tx.Bucket(caldavObjectsBucket).Get(itob(todo.ID)); v != nil {
+		codec.Unmarshal(v, &obj)
+	}
+	return obj
+}
+
+// lookupObject finds the todo stored under an object name.
+func lookupObject(tx *bolt.Tx, name string) (*Todo, error) {
+	if k := tx.Bucket(caldavNamesBucket).Get([]byte(name)); k != nil {
+		return loadTodo(tx, int(binary.BigEndian.Uint64(k)))
+	}
+	m := defaultObjectName.FindStringSubmatch(name)
+	if m == nil {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(m[1])
+	if err != nil || tx.Bucket(caldavObjectsBucket).Get(itob(id)) != nil {
+		// The todo has a name of its own.
+		return nil, nil
+	}
+	return loadTodo(tx, id)
+}
+
+// forgetCalDAVObject drops a deleted todo's CalDAV name.
+func forgetCalDAVObject(tx *bolt.Tx, key []byte) error {
+	objects := tx.Bucket(caldavObjectsBucket)
+	v := objects.Get(key)
+	if v == nil {
+		return nil
+	}
+	var obj CalDAVObject
+	if err := codec.Unmarshal(v, &obj); err != nil {
+		return err
+	}
+	if err := tx.Bucket(caldavNamesBucket).Delete([]byte(obj.Name)); err != nil {
+		return err
+	}
+	return objects.Delete(key)
+}
+
+// todoETag derives an ETag from a stored todo, so it changes with every
+// write however it is made.
+func todoETag(stored []byte) string {
+	sum := sha256.Sum256(stored)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+func renderCalDAVObject(todo Todo, uid string) string {
+	var ics icsWriter
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("VERSION", "2.0")
+	ics.line("PRODID", "-//todo-list-service//EN")
+	writeICSTodo(&ics, todo, "VTODO", uid, caldavStamp)
+	ics.line("END", "VCALENDAR")
+	return ics.b.String()
+}
+
+// caldavUser authenticates a CalDAV request.
+func caldavUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, token, ok := r.BasicAuth()
+	if ok && token != "" {
+		var owner string
+		db.View(func(tx *bolt.Tx) error {
+			owner = string(tx.Bucket(feedTokensBucket).Get([]byte(token)))
+			return nil
+		})
+		if owner != "" && owner == user {
+			return user, true
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="todos"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return "", false
+}
+
+// caldavHandler serves everything under /caldav/.
+func caldavHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		return
+	}
+
+	user, ok := caldavUser(w, r)
+	if !ok {
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == caldavRoot || path+"/" == caldavRoot:
+		if r.Method != "PROPFIND" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		caldavPropfind(w, r, user, "")
+
+	case path == caldavCollection || path+"/" == caldavCollection:
+		switch r.Method {
+		case "PROPFIND":
+			caldavPropfind(w, r, user, caldavCollection)
+		case "REPORT":
+			caldavReport(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case strings.HasPrefix(path, caldavCollection) && !strings.Contains(path[len(caldavCollection):], "/"):
+		name := path[len(caldavCollection):]
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			getCalDAVObject(w, r, name)
+		case http.MethodPut:
+			putCalDAVObject(w, r, user, name)
+		case http.MethodDelete:
+			deleteCalDAVObject(w, r, name)
+		case "PROPFIND":
+			caldavPropfind(w, r, user, path)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeCalDAVError(w http.ResponseWriter, err error) {
+	var cerr *caldavError
+	switch {
+	case errors.As(err, &cerr):
+		http.Error(w, cerr.msg, cerr.code)
+	default:
+		writeServiceError(w, err)
+	}
+}
+
+func getCalDAVObject(w http.ResponseWriter, r *http.Request, name string) {
+	var body, etag string
+	err := db.View(func(tx *bolt.Tx) error {
+		todo, err := lookupObject(tx, name)
+		if err != nil {
+			return err
+		}
+		if todo == nil {
+			return errObjectNotFound
+		}
+		etag = todoETag(tx.Bucket(todosBucket).Get(itob(todo.ID)))
+		body = renderCalDAVObject(*todo, caldavObject(tx, *todo, r.Host).UID)
+		return nil
+	})
+	if err != nil {
+		writeCalDAVError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", etag)
+	if r.Method == http.MethodGet {
+		io.WriteString(w, body)
+	}
+}
+
+// checkPreconditions applies If-Match and If-None-Match to the todo an
+// object name currently holds, if any.
+func checkPreconditions(r *http.Request, tx *bolt.Tx, todo *Todo) error {
+	etag := ""
+	if todo != nil {
+		etag = todoETag(tx.Bucket(todosBucket).Get(itob(todo.ID)))
+	}
+	if r.Header.Get("If-None-Match") == "*" && todo != nil {
+		return errPreconditionFailed
+	}
+	if match := r.Header.Get("If-Match"); match != "" && (todo == nil || (match != "*" && match != etag)) {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// putCalDAVObject creates or replaces the todo under an object name. Fields
+// VTODO has no equivalent for, such as the assignee, are kept.
+func putCalDAVObject(w http.ResponseWriter, r *http.Request, user, name string) {
+	if !strings.HasSuffix(name, ".ics") {
+		http.Error(w, "Object names must end in .ics", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxCalDAVObjectSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxCalDAVObjectSize {
+		http.Error(w, "Object too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	loc, err := userLocation(user, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	vtodo, err := parseVTODO(string(data), loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created := false
+	err = writeTx(func(tx *bolt.Tx) error {
+		old, err := lookupObject(tx, name)
+		if err != nil {
+			return err
+		}
+		if err := checkPreconditions(r, tx, old); err != nil {
+			return err
+		}
+
+		var todo Todo
+		if old != nil {
+			todo = *old
+		}
+		if err := vtodo.apply(&todo, old); err != nil {
+			return err
+		}
+		created = old == nil
+		todo.CreatedBy = user
+		if err := todoService.save(tx, old, &todo, false); err != nil {
+			return err
+		}
+
+		obj := caldavObject(tx, todo, r.Host)
+		obj.Name = name
+		if vtodo.uid != "" {
+			obj.UID = vtodo.uid
+		}
+		buf, err := codec.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(caldavObjectsBucket).Put(itob(todo.ID), buf); err != nil {
+			return err
+		}
+		return tx.Bucket(caldavNamesBucket).Put([]byte(name), itob(todo.ID))
+	})
+	if err != nil {
+		writeCalDAVError(w, err)
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteCalDAVObject(w http.ResponseWriter, r *http.Request, name string) {
+	err := writeTx(func(tx *bolt.Tx) error {
+		todo, err := lookupObject(tx, name)
+		if err != nil {
+			return err
+		}
+		if todo == nil {
+			return errObjectNotFound
+		}
+		if err := checkPreconditions(r, tx, todo); err != nil {
+			return err
+		}
+		return removeTodo(tx, todo.ID)
+	})
+	if err != nil {
+		writeCalDAVError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// davResource is one resource in a multistatus response: its properties as
+// inner XML, or just a status if it doesn't exist.
+type davResource struct {
+	href   string
+	props  map[xml.Name]string
+	status string
+}
+
+type davProp struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func (p *davProp) names() []xml.Name {
+	if p == nil {
+		return nil
+	}
+	names := make([]xml.Name, len(p.Names))
+	for i, n := range p.Names {
+		names[i] = n.XMLName
+	}
+	return names
+}
+
+type propfindRequest struct {
+	Prop *davProp `xml:"DAV: prop"`
+}
+
+type compFilter struct {
+	Name    string       `xml:"name,attr"`
+	Filters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *davProp    `xml:"DAV: prop"`
+	Hrefs   []string    `xml:"DAV: href"`
+	Filter  *compFilter `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+}
+
+func davHref(inner string) string {
+	var b bytes.Buffer
+	b.WriteString("<d:href>")
+	xml.EscapeText(&b, []byte(inner))
+	b.WriteString("</d:href>")
+	return b.String()
+}
+
+func rootProps(user string) map[xml.Name]string {
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                 "<d:collection/><d:principal/>",
+		{Space: nsDAV, Local: "displayname"}:                  escapeXML(user),
+		{Space: nsDAV, Local: "current-user-principal"}:       davHref(caldavRoot),
+		{Space: nsDAV, Local: "principal-URL"}:                davHref(caldavRoot),
+		{Space: nsCalDAV, Local: "calendar-home-set"}:         davHref(caldavRoot),
+		{Space: nsCalDAV, Local: "calendar-user-address-set"}: davHref("mailto:" + user),
+	}
+}
+
+func collectionProps(tx *bolt.Tx) map[xml.Name]string {
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                        "<d:collection/><c:calendar/>",
+		{Space: nsDAV, Local: "displayname"}:                         "Todos",
+		{Space: nsDAV, Local: "current-user-principal"}:              davHref(caldavRoot),
+		{Space: nsDAV, Local: "current-user-privilege-set"}:          "<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege>",
+		{Space: nsDAV, Local: "supported-report-set"}:                "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report><d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>",
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<c:comp name="VTODO"/>`,
+		// Every write adds to the change feed, so its sequence makes a ctag.
+		{Space: nsCS, Local: "getctag"}: strconv.FormatUint(tx.Bucket(changesBucket).Sequence(), 10),
+	}
+}
+
+func objectProps(tx *bolt.Tx, todo Todo, host string) (string, map[xml.Name]string) {
+	obj := caldavObject(tx, todo, host)
+	return caldavCollection + obj.Name, map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:     "",
+		{Space: nsDAV, Local: "getcontenttype"}:   "text/calendar; charset=utf-8; component=VTODO",
+		{Space: nsDAV, Local: "getetag"}:          escapeXML(todoETag(tx.Bucket(todosBucket).Get(itob(todo.ID)))),
+		{Space: nsCalDAV, Local: "calendar-data"}: escapeXML(renderCalDAVObject(todo, obj.UID)),
+	}
+}
+
+func escapeXML(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// caldavPropfind answers PROPFIND on the root, the collection or an object.
+func caldavPropfind(w http.ResponseWriter, r *http.Request, user, path string) {
+	var req propfindRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+	depth := r.Header.Get("Depth") != "0"
+
+	var resources []davResource
+	err := db.View(func(tx *bolt.Tx) error {
+		switch {
+		case path == "":
+			resources = append(resources, davResource{href: caldavRoot, props: rootProps(user)})
+			if depth {
+				resources = append(resources, davResource{href: caldavCollection, props: collectionProps(tx)})
+			}
+		case path == caldavCollection:
+			resources = append(resources, davResource{href: caldavCollection, props: collectionProps(tx)})
+			if depth {
+				return tx.Bucket(todosBucket).ForEach(func(k, v []byte) error {
+					var todo Todo
+					if err := codec.Unmarshal(v, &todo); err != nil {
+						return err
+					}
+					href, props := objectProps(tx, todo, r.Host)
+					resources = append(resources, davResource{href: href, props: props})
+					return nil
+				})
+			}
+		default:
+			todo, err := lookupObject(tx, path[len(caldavCollection):])
+			if err != nil {
+				return err
+			}
+			if todo == nil {
+				return errObjectNotFound
+			}
+			href, props := objectProps(tx, *todo, r.Host)
+			resources = append(resources, davResource{href: href, props: props})
+		}
+		return nil
+	})
+	if err != nil {
+		writeCalDAVError(w, err)
+		return
+	}
+
+	writeMultistatus(w, resources, req.Prop.names())
+}
+
+// caldavReport answers calendar-query and calendar-multiget REPORTs on the
+// collection. Query filters other than the component are not applied; the
+// result is a superset clients filter themselves.
+func caldavReport(w http.ResponseWriter, r *http.Request) {
+	var req reportRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid REPORT body", http.StatusBadRequest)
+		return
+	}
+	if req.XMLName.Space != nsCalDAV || (req.XMLName.Local != "calendar-query" && req.XMLName.Local != "calendar-multiget") {
+		http.Error(w, "Unsupported report", http.StatusForbidden)
+		return
+	}
+
+	var resources []davResource
+	err := db.View(func(tx *bolt.Tx) error {
+		if req.XMLName.Local == "calendar-multiget" {
+			for _, href := range req.Hrefs {
+				href = strings.TrimSpace(href)
+				todo, err := lookupObject(tx, strings.TrimPrefix(href, caldavCollection))
+				if err != nil {
+					return err
+				}
+				if todo == nil || !strings.HasPrefix(href, caldavCollection) {
+					resources = append(resources, davResource{href: href, status: "HTTP/1.1 404 Not Found"})
+					continue
+				}
+				_, props := objectProps(tx, *todo, r.Host)
+				resources = append(resources, davResource{href: href, props: props})
+			}
+			return nil
+		}
+
+		if req.Filter != nil {
+			for _, f := range req.Filter.Filters {
+				if f.Name != "VTODO" {
+					return nil
+				}
+			}
+		}
+		return tx.Bucket(todosBucket).ForEach(func(k, v []byte) error {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			href, props := objectProps(tx, todo, r.Host)
+			resources = append(resources, davResource{href: href, props: props})
+			return nil
+		})
+	})
+	if err != nil {
+		writeCalDAVError(w, err)
+		return
+	}
+
+	writeMultistatus(w, resources, req.Prop.names())
+}
+
+// davElement renders a property element, declaring namespaces other than
+// the ones on the multistatus root inline.
+func davElement(name xml.Name, inner string) string {
+	prefix := map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}[name.Space]
+	if prefix == "" {
+		return fmt.Sprintf(`<x:%s xmlns:x="%s">%s</x:%s>`, name.Local, escapeXML(name.Space), inner, name.Local)
+	}
+	if inner == "" {
+		return fmt.Sprintf("<%s:%s/>", prefix, name.Local)
+	}
+	return fmt.Sprintf("<%s:%s>%s</%s:%s>", prefix, name.Local, inner, prefix, name.Local)
+}
+
+// writeMultistatus writes a 207 response with the requested properties of
+// each resource, or all but calendar-data if none were requested.
+func writeMultistatus(w http.ResponseWriter, resources []davResource, requested []xml.Name) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	for _, res := range resources {
+		b.WriteString("<d:response>" + davHref(res.href))
+		if res.status != "" {
+			b.WriteString("<d:status>" + res.status + "</d:status></d:response>")
+			continue
+		}
+
+		var found, missing []string
+		if requested == nil {
+			for name, inner := range res.props {
+				if name.Local != "calendar-data" {
+					found = append(found, davElement(name, inner))
+				}
+			}
+		}
+		for _, name := range requested {
+			if inner, ok := res.props[name]; ok {
+				found = append(found, davElement(name, inner))
+			} else {
+				missing = append(missing, davElement(name, ""))
+			}
+		}
+		if len(found) > 0 {
+			b.WriteString("<d:propstat><d:prop>" + strings.Join(found, "") + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+		}
+		if len(missing) > 0 {
+			b.WriteString("<d:propstat><d:prop>" + strings.Join(missing, "") + "</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+// vtodo holds the properties of an uploaded VTODO that map onto a todo.
+type vtodo struct {
+	uid, summary, status, due string
+	priority                  int
+	categories                []string
+	completedAt               bool
+}
+
+var icsUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";")
+
+// parseVTODO reads the first VTODO of an iCalendar object. Date-times are
+// turned into dates in loc, the user's time zone.
+func parseVTODO(data string, loc *time.Location) (vtodo, error) {
+	var v vtodo
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	depth, found := 0, false
+	for _, line := range strings.Split(data, "\n") {
+		sep := strings.IndexByte(line, ':')
+		if sep < 0 {
+			continue
+		}
+		name, value := strings.ToUpper(line[:sep]), line[sep+1:]
+		var params string
+		if i := strings.IndexByte(name, ';'); i >= 0 {
+			name, params = name[:i], name[i+1:]
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VTODO") && !found:
+			found, depth = true, 1
+			continue
+		case depth == 0:
+			continue
+		case name == "BEGIN":
+			depth++
+		case name == "END":
+			depth--
+		}
+		if depth != 1 {
+			// Nested components such as VALARM, or past the VTODO.
+			continue
+		}
+
+		switch name {
+		case "UID":
+			v.uid = value
+		case "SUMMARY":
+			v.summary = icsUnescaper.Replace(value)
+		case "STATUS":
+			v.status = strings.ToUpper(value)
+		case "COMPLETED":
+			v.completedAt = true
+		case "PRIORITY":
+			p, err := strconv.Atoi(value)
+			if err != nil || p < 0 || p > 9 {
+				return v, fmt.Errorf("invalid PRIORITY %q", value)
+			}
+			v.priority = p
+		case "CATEGORIES":
+			for _, c := range strings.Split(value, ",") {
+				v.categories = append(v.categories, icsUnescaper.Replace(c))
+			}
+		case "DUE":
+			due, err := parseICSDate(value, strings.Contains(params, "TZID="), loc)
+			if err != nil {
+				return v, err
+			}
+			v.due = due
+		}
+	}
+	if !found {
+		return v, errors.New("no VTODO in calendar object")
+	}
+	return v, nil
+}
+
+// parseICSDate reads a DATE or DATE-TIME value as a due date. Floating and
+// TZID date-times already name the local date; UTC ones are moved to loc.
+func parseICSDate(value string, zoned bool, loc *time.Location) (string, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil && !zoned {
+		return t.In(loc).Format(dueDateLayout), nil
+	}
+	if len(value) >= 8 {
+		if t, err := time.Parse("20060102", value[:8]); err == nil {
+			return t.Format(dueDateLayout), nil
+		}
+	}
+	return "", fmt.Errorf("invalid DUE %q", value)
+}
+
+// apply copies an uploaded VTODO onto todo. old is the todo it replaces, if
+// any.
+func (v vtodo) apply(todo *Todo, old *Todo) error {
+	todo.Title = v.summary
+	todo.DueDate = v.due
+
+	switch {
+	case v.priority == 0:
+		todo.Priority = ""
+	case v.priority <= 4:
+		todo.Priority = "high"
+	case v.priority == 5:
+		todo.Priority = "medium"
+	default:
+		todo.Priority = "low"
+	}
+
+	// Categories that aren't valid tags, such as ones with spaces, are
+	// hyphenated or dropped.
+	todo.Tags = nil
+	seen := make(map[string]bool)
+	for _, c := range v.categories {
+		tag := strings.Join(strings.Fields(c), "-")
+		if validTag(tag) == nil && !seen[tag] {
+			seen[tag] = true
+			todo.Tags = append(todo.Tags, tag)
+		}
+	}
+
+	// Blocked todos are served as NEEDS-ACTION and stay blocked while they
+	// come back that way.
+	switch v.status {
+	case "COMPLETED":
+		todo.Status = StatusDone
+	case "IN-PROCESS":
+		todo.Status = StatusInProgress
+	case "NEEDS-ACTION":
+		if old == nil || todoStatus(*old) != StatusBlocked {
+			todo.Status = StatusTodo
+		}
+	case "":
+		if v.completedAt {
+			todo.Status = StatusDone
+		} else if old == nil {
+			todo.Status = StatusTodo
+		}
+	default:
+		return &caldavError{http.StatusBadRequest, fmt.Sprintf("unsupported STATUS %q", v.status)}
+	}
+	todo.Completed = todoStatus(*todo) == StatusDone
+	return nil
+}
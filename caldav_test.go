@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func caldavRequest(token, method, url, body string, headers ...string) *http.Request {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.SetBasicAuth("alice", token)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return req
+}
+
+const sampleVTODO = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//EN\r\n" +
+	"BEGIN:VTODO\r\n" +
+	"UID:A1B2-C3\r\n" +
+	"SUMMARY:Buy milk\\, eggs\r\n" +
+	"DUE;VALUE=DATE:20261101\r\n" +
+	"PRIORITY:1\r\n" +
+	"CATEGORIES:Errands,Long list\r\n" +
+	"STATUS:NEEDS-ACTION\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"SUMMARY:Not the todo\r\n" +
+	"END:VALARM\r\n" +
+	"END:VTODO\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseVTODO(t *testing.T) {
+	v, err := parseVTODO(sampleVTODO, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, vtodo{uid: "A1B2-C3", summary: "Buy milk, eggs", status: "NEEDS-ACTION", due: "2026-11-01", priority: 1, categories: []string{"Errands", "Long list"}}, v)
+
+	var todo Todo
+	assert.NoError(t, v.apply(&todo, nil))
+	assert.Equal(t, Todo{Title: "Buy milk, eggs", Status: StatusTodo, Priority: "high", DueDate: "2026-11-01", Tags: []string{"Errands", "Long-list"}}, todo)
+
+	// Folded lines, and UTC due times moved to the user's zone.
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	v, err = parseVTODO("BEGIN:VTODO\nSUMMARY:Long\n  title\nDUE:20261101T200000Z\nCOMPLETED:20261101T100000Z\nEND:VTODO\n", tokyo)
+	assert.NoError(t, err)
+	assert.Equal(t, "Long title", v.summary)
+	assert.Equal(t, "2026-11-02", v.due)
+	v.apply(&todo, nil)
+	assert.True(t, todo.Completed)
+
+	v, _ = parseVTODO("BEGIN:VTODO\nDUE;TZID=Europe/Lisbon:20261101T233000\nEND:VTODO\n", tokyo)
+	assert.Equal(t, "2026-11-01", v.due)
+
+	_, err = parseVTODO("BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VEVENT\nEND:VCALENDAR\n", time.UTC)
+	assert.EqualError(t, err, "no VTODO in calendar object")
+	_, err = parseVTODO("BEGIN:VTODO\nDUE:soon\nEND:VTODO\n", time.UTC)
+	assert.EqualError(t, err, `invalid DUE "soon"`)
+}
+
+func TestCalDAV(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	token := issueFeedToken(t, router, "alice")
+
+	payload, _ := json.Marshal(Todo{Title: "From the API", Assignee: "bob"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Authentication
+	assert.Equal(t, http.StatusUnauthorized, serve(caldavRequest("wrong", "PROPFIND", "/caldav/", "")).Code)
+	w := serve(httptest.NewRequest("PROPFIND", "/caldav/", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="todos"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusMovedPermanently, serve(httptest.NewRequest("PROPFIND", "/.well-known/caldav", nil)).Code)
+
+	// Discovery
+	w = serve(caldavRequest(token, "PROPFIND", "/caldav/", `<?xml version="1.0"?>
+		<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+		  <d:prop><d:current-user-principal/><c:calendar-home-set/><d:quota-used-bytes/></d:prop>
+		</d:propfind>`, "Depth", "0"))
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "<d:current-user-principal><d:href>/caldav/</d:href></d:current-user-principal>")
+	assert.Contains(t, body, "<c:calendar-home-set><d:href>/caldav/</d:href></c:calendar-home-set>")
+	assert.Contains(t, body, "<d:quota-used-bytes/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status>")
+
+	w = serve(caldavRequest(token, "PROPFIND", "/caldav/todos/", `<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">
+		<d:prop><d:resourcetype/><cs:getctag/><d:getetag/></d:prop></d:propfind>`, "Depth", "1"))
+	body = w.Body.String()
+	assert.Contains(t, body, "<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>")
+	assert.Contains(t, body, "<d:href>/caldav/todos/1.ics</d:href>")
+	ctag := body[strings.Index(body, "<cs:getctag>"):strings.Index(body, "</cs:getctag>")]
+
+	// Create from a client.
+	w = serve(caldavRequest(token, http.MethodPut, "/caldav/todos/A1B2-C3.ics", sampleVTODO, "If-None-Match", "*"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(caldavRequest(token, http.MethodPut, "/caldav/todos/A1B2-C3.ics", sampleVTODO, "If-None-Match", "*")).Code)
+
+	var todo Todo
+	w = serve(httptest.NewRequest(http.MethodGet, "/todos/2", nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &todo))
+	assert.Equal(t, "Buy milk, eggs", todo.Title)
+	assert.Equal(t, "high", todo.Priority)
+
+	w = serve(caldavRequest(token, http.MethodGet, "/caldav/todos/A1B2-C3.ics", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "UID:A1B2-C3\r\n")
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = serve(caldavRequest(token, "PROPFIND", "/caldav/todos/", `<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/"><d:prop><cs:getctag/></d:prop></d:propfind>`, "Depth", "0"))
+	assert.NotContains(t, w.Body.String(), ctag+"<")
+
+	// Multiget, including an object that doesn't exist.
+	w = serve(caldavRequest(token, "REPORT", "/caldav/todos/", `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+		<d:prop><d:getetag/><c:calendar-data/></d:prop>
+		<d:href>/caldav/todos/A1B2-C3.ics</d:href>
+		<d:href>/caldav/todos/missing.ics</d:href>
+		</c:calendar-multiget>`))
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	body = w.Body.String()
+	assert.Contains(t, body, "SUMMARY:Buy milk\\, eggs")
+	assert.Contains(t, body, "<d:href>/caldav/todos/missing.ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status>")
+
+	// calendar-query for VTODOs lists every todo; for events, none.
+	query := func(comp string) string {
+		return serve(caldavRequest(token, "REPORT", "/caldav/todos/", `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+			<d:prop><d:getetag/></d:prop>
+			<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="`+comp+`"/></c:comp-filter></c:filter>
+			</c:calendar-query>`)).Body.String()
+	}
+	assert.Equal(t, 2, strings.Count(query("VTODO"), "<d:response>"))
+	assert.Equal(t, 0, strings.Count(query("VEVENT"), "<d:response>"))
+
+	// Update, keeping fields VTODO doesn't carry.
+	completed := strings.Replace(sampleVTODO, "STATUS:NEEDS-ACTION", "STATUS:COMPLETED", 1)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(caldavRequest(token, http.MethodPut, "/caldav/todos/1.ics", completed, "If-Match", `"stale"`)).Code)
+	w = serve(caldavRequest(token, http.MethodGet, "/caldav/todos/1.ics", ""))
+	assert.Equal(t, http.StatusNoContent, serve(caldavRequest(token, http.MethodPut, "/caldav/todos/1.ics", completed, "If-Match", w.Header().Get("ETag"))).Code)
+	w = serve(httptest.NewRequest(http.MethodGet, "/todos/1", nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &todo))
+	assert.True(t, todo.Completed)
+	assert.Equal(t, "bob", todo.Assignee)
+	assert.Equal(t, http.StatusBadRequest, serve(caldavRequest(token, http.MethodPut, "/caldav/todos/1.ics", "not a calendar")).Code)
+
+	// Delete
+	assert.Equal(t, http.StatusPreconditionFailed, serve(caldavRequest(token, http.MethodDelete, "/caldav/todos/A1B2-C3.ics", "", "If-Match", `"stale"`)).Code)
+	assert.Equal(t, http.StatusNoContent, serve(caldavRequest(token, http.MethodDelete, "/caldav/todos/A1B2-C3.ics", "", "If-Match", etag)).Code)
+	assert.Equal(t, http.StatusNotFound, serve(caldavRequest(token, http.MethodGet, "/caldav/todos/A1B2-C3.ics", "")).Code)
+	assert.Equal(t, http.StatusNotFound, serve(httptest.NewRequest(http.MethodGet, "/todos/2", nil)).Code)
+	assert.Equal(t, http.StatusNotFound, serve(caldavRequest(token, http.MethodGet, "/caldav/todos/2.ics", "")).Code)
+}
+
+// FuzzParseVTODO checks that no calendar object crashes the parser.
+func FuzzParseVTODO(f *testing.F) {
+	f.Add(sampleVTODO)
+	f.Add("BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nDUE:20261101T100000Z\r\n END:VTODO\r\n")
+	f.Add("BEGIN:VTODO\nSUMMARY;LANGUAGE=en:a\\nb\\;c\nRRULE:FREQ=DAILY\nEND:VTODO")
+
+	f.Fuzz(func(t *testing.T, data string) {
+		parseVTODO(data, time.UTC)
+	})
+}
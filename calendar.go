@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const maxCalendarDays = 366
+
+// Calendar lists todos by due date, one entry per day in the range.
+type Calendar struct {
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	Days []CalendarDay `json:"days"`
+}
+
+type CalendarDay struct {
+	Date  string `json:"date"`
+	Items []Todo `json:"items"`
+}
+
+// calendarRange works out the inclusive range of a calendar request. With
+// span=week or span=month the range is the week (Monday to Sunday) or month
+// containing from, which defaults to today.
+func calendarRange(r *http.Request, today string) (time.Time, time.Time, string) {
+	query := r.URL.Query()
+	parse := func(param string) (time.Time, bool) {
+		t, err := time.Parse(dueDateLayout, query.Get(param))
+		return t, err == nil
+	}
+
+	span := query.Get("span")
+	switch span {
+	case "week", "month":
+		from, _ := time.Parse(dueDateLayout, today)
+		if query.Get("from") != "" {
+			var ok bool
+			if from, ok = parse("from"); !ok {
+				return time.Time{}, time.Time{}, "Invalid from: use YYYY-MM-DD"
+			}
+		}
+		if span == "week" {
+			from = from.AddDate(0, 0, -(int(from.Weekday())+6)%7)
+			return from, from.AddDate(0, 0, 6), ""
+		}
+		from = from.AddDate(0, 0, 1-from.Day())
+		return from, from.AddDate(0, 1, -1), ""
+	case "":
+	default:
+		return time.Time{}, time.Time{}, "Invalid span: use week or month"
+	}
+
+	from, ok := parse("from")
+	if !ok {
+		return time.Time{}, time.Time{}, "Invalid from: use YYYY-MM-DD"
+	}
+	to, ok := parse("to")
+	if !ok {
+		return time.Time{}, time.Time{}, "Invalid to: use YYYY-MM-DD"
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, "to is before from"
+	}
+	if to.Sub(from) >= maxCalendarDays*24*time.Hour {
+		return time.Time{}, time.Time{}, "Calendar range is longer than 366 days"
+	}
+	return from, to, ""
+}
+
+// getCalendar returns the todos due in a date range, grouped by day. It
+// accepts the listing filters of GET /todos.
+func getCalendar(w http.ResponseWriter, r *http.Request) {
+	loc, err := locationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, msg := calendarRange(r, clock.Now().In(loc).Format(dueDateLayout))
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	filters, err := listFilters(r.URL.Query(), userFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	calendar := Calendar{From: from.Format(dueDateLayout), To: to.Format(dueDateLayout), Days: []CalendarDay{}}
+	err = timedView(r, func(tx *bolt.Tx) error {
+		inRange := andNode{dueRangeNode{">=", calendar.From}, dueRangeNode{"<=", calendar.To}}
+		todos, err := viewTodos(tx, filterNode(inRange, filters))
+		if err != nil {
+			return err
+		}
+
+		byDate := make(map[string][]Todo)
+		for _, todo := range todos {
+			byDate[todo.DueDate] = append(byDate[todo.DueDate], todo)
+		}
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			date := day.Format(dueDateLayout)
+			items := byDate[date]
+			if items == nil {
+				items = []Todo{}
+			}
+			calendar.Days = append(calendar.Days, CalendarDay{Date: date, Items: items})
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(calendar)
+}
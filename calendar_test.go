@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarRange(t *testing.T) {
+	tests := []struct {
+		query    string
+		from, to string
+		err      string
+	}{
+		{"from=2026-10-14&to=2026-10-16", "2026-10-14", "2026-10-16", ""},
+		{"span=week&from=2026-10-14", "2026-10-12", "2026-10-18", ""},
+		{"span=week&from=2026-10-18", "2026-10-12", "2026-10-18", ""},
+		{"span=month&from=2026-02-10", "2026-02-01", "2026-02-28", ""},
+		{"span=month", "2026-10-01", "2026-10-31", ""},
+		{"from=2026-10-14", "", "", "Invalid to: use YYYY-MM-DD"},
+		{"from=2026-10-14&to=2026-10-01", "", "", "to is before from"},
+		{"from=2026-01-01&to=2027-06-01", "", "", "Calendar range is longer than 366 days"},
+		{"span=year", "", "", "Invalid span: use week or month"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			from, to, msg := calendarRange(httptest.NewRequest(http.MethodGet, "/todos/calendar?"+tt.query, nil), "2026-10-16")
+			assert.Equal(t, tt.err, msg)
+			if tt.err == "" {
+				assert.Equal(t, tt.from, from.Format(dueDateLayout))
+				assert.Equal(t, tt.to, to.Format(dueDateLayout))
+			}
+		})
+	}
+}
+
+func TestGetCalendar(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, todo := range []Todo{
+		{Title: "Before", DueDate: "2026-10-11"},
+		{Title: "Monday", DueDate: "2026-10-12"},
+		{Title: "Thursday", DueDate: "2026-10-15", Priority: "low"},
+		{Title: "Thursday done", DueDate: "2026-10-15", Completed: true},
+		{Title: "Thursday urgent", DueDate: "2026-10-15", Priority: "high"},
+		{Title: "Undated"},
+	} {
+		payload, _ := json.Marshal(todo)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/calendar?span=week&from=2026-10-15&completed=false", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var calendar Calendar
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &calendar))
+	assert.Equal(t, "2026-10-12", calendar.From)
+	assert.Equal(t, "2026-10-18", calendar.To)
+	assert.Len(t, calendar.Days, 7)
+	assert.Equal(t, []string{"Monday"}, sectionTitles(ViewSection{Items: calendar.Days[0].Items}))
+	assert.Empty(t, calendar.Days[1].Items)
+	assert.Equal(t, "2026-10-15", calendar.Days[3].Date)
+	assert.Equal(t, []string{"Thursday urgent", "Thursday"}, sectionTitles(ViewSection{Items: calendar.Days[3].Items}))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/calendar?from=2026-10-15", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
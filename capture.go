@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// maxCapturedBody caps how much of each request and response body is kept.
+const maxCapturedBody = 64 << 10
+
+// maskedHeaders are replaced in captures: they carry credentials.
+var maskedHeaders = map[string]bool{
+	"Authorization":        true,
+	"Cookie":               true,
+	"Set-Cookie":           true,
+	"X-Csrf-Token":         true,
+	"X-Confirmation-Token": true,
+	"X-Hub-Signature-256":  true,
+	"X-Twilio-Signature":   true,
+}
+
+// maskedQueryParams are replaced in captured queries: feed tokens, and the
+// OAuth code and state of integration callbacks.
+var maskedQueryParams = []string{"token", "code", "state"}
+
+// secretResponseRoutes answer with credentials, by method and path
+// template, so their response bodies are replaced in captures.
+var secretResponseRoutes = map[string]bool{
+	"POST /me/feed-token":     true,
+	"POST /me/deletion-token": true,
+	"GET /me/inbound-hooks":   true,
+	"POST /me/inbound-hooks":  true,
+}
+
+// CaptureSettings turn capture mode on for a fraction of requests.
+type CaptureSettings struct {
+	Enabled    bool    `json:"enabled"`
+	SampleRate float64 `json:"sampleRate"`
+}
+
+// Capture is a recorded request and its response.
+type Capture struct {
+	ID              int                 `json:"id"`
+	Time            time.Time           `json:"time"`
+	Duration        string              `json:"duration"`
+	Method          string              `json:"method"`
+	Path            string              `json:"path"`
+	Query           string              `json:"query,omitempty"`
+	User            string              `json:"user,omitempty"`
+	RequestHeaders  map[string][]string `json:"requestHeaders"`
+	RequestBody     string              `json:"requestBody,omitempty"`
+	Status          int                 `json:"status"`
+	ResponseHeaders map[string][]string `json:"responseHeaders"`
+	ResponseBody    string              `json:"responseBody,omitempty"`
+}
+
+// captureBuffer keeps the latest captures in a ring.
+type captureBuffer struct {
+	mu       sync.Mutex
+	settings CaptureSettings
+	ring     []Capture
+	next     int
+	lastID   int
+}
+
+var captures = &captureBuffer{}
+
+func (b *captureBuffer) sample() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.settings.Enabled && rand.Float64() < b.settings.SampleRate
+}
+
+func (b *captureBuffer) add(c Capture) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	size := max(config.CaptureBufferSize, 1)
+	b.lastID++
+	c.ID = b.lastID
+	if len(b.ring) < size {
+		b.ring = append(b.ring, c)
+		return
+	}
+	b.ring[b.next%len(b.ring)] = c
+	b.next++
+}
+
+// list returns the captures, newest first.
+func (b *captureBuffer) list() []Capture {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := make([]Capture, 0, len(b.ring))
+	for i := len(b.ring) - 1; i >= 0; i-- {
+		list = append(list, b.ring[(b.next+i)%len(b.ring)])
+	}
+	return list
+}
+
+func (b *captureBuffer) configure(settings CaptureSettings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.settings = settings
+}
+
+func (b *captureBuffer) clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ring, b.next = nil, 0
+}
+
+func maskHeaders(h http.Header) map[string][]string {
+	masked := make(map[string][]string, len(h))
+	for name, values := range h {
+		if maskedHeaders[http.CanonicalHeaderKey(name)] {
+			masked[name] = []string{"[redacted]"}
+			continue
+		}
+		masked[name] = values
+	}
+	return masked
+}
+
+// captureQuery masks the parameters that carry credentials. Under
+// LOG_REDACTION the query is left out, as filter values can name
+// users.
+func captureQuery(query url.Values) string {
+	switch {
+	case len(query) == 0:
+		return ""
+	case config.LogRedaction:
+		return "[redacted]"
+	}
+	for _, name := range maskedQueryParams {
+		if query.Has(name) {
+			query.Set(name, "[redacted]")
+		}
+	}
+	return query.Encode()
+}
+
+// captureBody keeps body as text. Under LOG_REDACTION, and for binary
+// content, only its size is kept.
+func captureBody(body []byte, truncated bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if config.LogRedaction || !utf8.Valid(body) {
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+	if truncated {
+		return string(body) + "…"
+	}
+	return string(body)
+}
+
+// captureRecorder tees the start of the response body.
+type captureRecorder struct {
+	statusRecorder
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *captureRecorder) Write(p []byte) (int, error) {
+	room := maxCapturedBody - r.body.Len()
+	r.body.Write(p[:min(len(p), room)])
+	r.truncated = r.truncated || len(p) > room
+	return r.ResponseWriter.Write(p)
+}
+
+// captureMiddleware records a sample of requests while capture mode is on.
+// Requests of the admin class, such as /cdc and /metrics, are never
+// captured, since their bodies carry the admin token and secrets.
+func captureMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if routeClass(r) == classAdmin || strings.HasPrefix(r.URL.Path, "/admin") || !captures.sample() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		var requestBody []byte
+		requestTruncated := false
+		if r.Body != nil {
+			requestBody, _ = io.ReadAll(io.LimitReader(r.Body, maxCapturedBody+1))
+			requestTruncated = len(requestBody) > maxCapturedBody
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+			requestBody = requestBody[:min(len(requestBody), maxCapturedBody)]
+		}
+		rec := &captureRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		next.ServeHTTP(rec, r)
+
+		c := Capture{
+			Time:            start.UTC(),
+			Duration:        time.Since(start).Round(time.Microsecond).String(),
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			Query:           captureQuery(r.URL.Query()),
+			User:            redactUser(userFromRequest(r)),
+			RequestHeaders:  maskHeaders(r.Header),
+			RequestBody:     captureBody(requestBody, requestTruncated),
+			Status:          rec.status,
+			ResponseHeaders: maskHeaders(rec.Header()),
+			ResponseBody:    captureBody(rec.body.Bytes(), rec.truncated),
+		}
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil && (config.LogRedaction || strings.Contains(tmpl, "{token}")) {
+				c.Path = tmpl
+			}
+		}
+		if secretResponseRoutes[r.Method+" "+routeName(r)] && c.ResponseBody != "" {
+			c.ResponseBody = "[redacted]"
+		}
+		captures.add(c)
+	})
+}
+
+// CapturesResponse is the body of GET /admin/captures.
+type CapturesResponse struct {
+	CaptureSettings
+	Captures []Capture `json:"captures"`
+}
+
+// capturesHandler lists the captures (GET), changes the capture settings
+// (PUT), or discards the captures (DELETE).
+func capturesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var settings CaptureSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if settings.SampleRate < 0 || settings.SampleRate > 1 {
+			http.Error(w, "sampleRate must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		if settings.Enabled && settings.SampleRate == 0 {
+			settings.SampleRate = 1
+		}
+		captures.configure(settings)
+		infof("capture mode enabled=%t sampleRate=%g", settings.Enabled, settings.SampleRate)
+	case http.MethodDelete:
+		captures.clear()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	captures.mu.Lock()
+	settings := captures.settings
+	captures.mu.Unlock()
+	json.NewEncoder(w).Encode(CapturesResponse{CaptureSettings: settings, Captures: captures.list()})
+}
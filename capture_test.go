@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withCaptures(t *testing.T, size int) {
+	previous, previousConfig := captures, config
+	captures = &captureBuffer{}
+	config.CaptureBufferSize = size
+	t.Cleanup(func() { captures, config = previous, previousConfig })
+}
+
+func TestCaptureBuffer(t *testing.T) {
+	withCaptures(t, 3)
+	for i := 0; i < 5; i++ {
+		captures.add(Capture{Status: 200 + i})
+	}
+	var ids []int
+	for _, c := range captures.list() {
+		ids = append(ids, c.ID)
+	}
+	assert.Equal(t, []int{5, 4, 3}, ids)
+
+	captures.clear()
+	assert.Empty(t, captures.list())
+	captures.add(Capture{})
+	assert.Equal(t, 6, captures.list()[0].ID)
+}
+
+func TestCaptureMode(t *testing.T) {
+	clearBucket(t)
+	withCaptures(t, 10)
+	withAdminToken(t, "secret")
+	router := setupRouter()
+
+	admin := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/captures", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	request := func(method, url, body string) string {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set(userHeader, "alice")
+		req.Header.Set("X-Confirmation-Token", "abc123")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	// Off by default.
+	request(http.MethodPost, "/todos", `{"title":"Not captured"}`)
+	assert.Empty(t, captures.list())
+
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, `{"enabled":true,"sampleRate":1.5}`).Code)
+	w := admin(http.MethodPut, `{"enabled":true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled":true,"sampleRate":1,"captures":[]}`, w.Body.String())
+
+	request(http.MethodPost, "/todos", `{"title":"Call the bank"}`)
+	request(http.MethodGet, "/feeds/activity.atom?token=s3cr3t&limit=5", "")
+	request(http.MethodPost, "/hooks/inbound/s3cr3t", `{"title":"From a hook"}`)
+
+	var response CapturesResponse
+	assert.NoError(t, json.Unmarshal(admin(http.MethodGet, "").Body.Bytes(), &response))
+	assert.Len(t, response.Captures, 3, "admin requests are not captured")
+
+	hook, feed, created := response.Captures[0], response.Captures[1], response.Captures[2]
+	assert.Equal(t, http.MethodPost, created.Method)
+	assert.Equal(t, "/todos", created.Path)
+	assert.Equal(t, `{"title":"Call the bank"}`, created.RequestBody)
+	assert.Equal(t, http.StatusCreated, created.Status)
+	assert.Contains(t, created.ResponseBody, `"title":"Call the bank"`)
+	assert.Equal(t, "alice", created.User)
+	assert.Equal(t, []string{"[redacted]"}, created.RequestHeaders["X-Confirmation-Token"])
+
+	assert.Equal(t, "limit=5&token=%5Bredacted%5D", feed.Query)
+	assert.Equal(t, "/hooks/inbound/{token}", hook.Path)
+	assert.NotContains(t, admin(http.MethodGet, "").Body.String(), "s3cr3t")
+
+	// Credentials in callbacks and issued secrets are masked, and other
+	// admin routes are not captured either.
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "").Code)
+	request(http.MethodGet, "/integrations/google/callback?code=c0de&state=st4te", "")
+	var issued []string
+	for _, url := range []string{"/me/feed-token", "/me/deletion-token", "/me/inbound-hooks"} {
+		var secret struct {
+			Token string `json:"token"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(request(http.MethodPost, url, "{}")), &secret))
+		assert.NotEmpty(t, secret.Token, url)
+		issued = append(issued, secret.Token)
+	}
+	request(http.MethodGet, "/me/inbound-hooks", "")
+	for _, url := range []string{"/metrics", "/cdc"} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	list := captures.list()
+	assert.Len(t, list, 5)
+	assert.Equal(t, "code=%5Bredacted%5D&state=%5Bredacted%5D", list[4].Query)
+	for _, c := range list[:4] {
+		assert.Equal(t, "[redacted]", c.ResponseBody, c.Path)
+	}
+	body := admin(http.MethodGet, "").Body.String()
+	for _, secret := range append(issued, "c0de", "st4te") {
+		assert.NotContains(t, body, secret)
+	}
+
+	// Redaction keeps only sizes and route templates.
+	config.LogRedaction = true
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "").Code)
+	request(http.MethodGet, "/todos?assignee=alice", "")
+	c := captures.list()[0]
+	assert.Equal(t, "[redacted]", c.Query)
+	assert.Equal(t, redactUser("alice"), c.User)
+	assert.Regexp(t, `^\[\d+ bytes\]$`, c.ResponseBody)
+
+	admin(http.MethodPut, `{"enabled":false}`)
+	request(http.MethodGet, "/todos", "")
+	assert.Len(t, captures.list(), 1)
+}
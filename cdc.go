@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	cdcConsumersBucket = []byte("cdcConsumers")
+
+	// prunedThroughKey holds the highest sequence number of any change
+	// record removed by compaction, superseded or not. Reading from at or
+	// below it would skip records.
+	prunedThroughKey = []byte("prunedThrough")
+)
+
+var (
+	errChangesPruned       = errors.New("changes from this sequence number were compacted")
+	errCDCConsumerNotFound = errors.New("CDC consumer not found")
+	errCDCSeqAhead         = errors.New("seq is ahead of the change feed")
+)
+
+// CDCResponse is a page of the CDC feed. Next is the sequence number to
+// read from after it.
+type CDCResponse struct {
+	Changes []Change `json:"changes"`
+	Next    uint64   `json:"next"`
+	HasMore bool     `json:"hasMore"`
+}
+
+// CDCConsumer is a downstream system's position in the CDC feed: the last
+// sequence number it processed. Compaction keeps every record after the
+// lowest position.
+type CDCConsumer struct {
+	Name      string    `json:"name"`
+	Seq       uint64    `json:"seq"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func prunedThrough(tx *bolt.Tx) uint64 {
+	v := tx.Bucket(syncMetaBucket).Get(prunedThroughKey)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// cdcFloor is the lowest position of a registered CDC consumer, the last
+// sequence number compaction may remove.
+func cdcFloor(tx *bolt.Tx) (uint64, error) {
+	floor := uint64(math.MaxUint64)
+	err := tx.Bucket(cdcConsumersBucket).ForEach(func(k, v []byte) error {
+		var consumer CDCConsumer
+		if err := codec.Unmarshal(v, &consumer); err != nil {
+			return err
+		}
+		floor = min(floor, consumer.Seq)
+		return nil
+	})
+	return floor, err
+}
+
+// getCDC returns the change records from sequence number from onwards, with
+// the same records as GET /todos/changes, for downstream systems to replay.
+// Without from it starts at the oldest record kept, which replays to the
+// current state even after compaction. A from at or below a compacted
+// record gets 410 Gone: the consumer must start over without one.
+func getCDC(w http.ResponseWriter, r *http.Request) {
+	limit := 1000
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	var from uint64
+	if f := r.URL.Query().Get("from"); f != "" {
+		var err error
+		if from, err = strconv.ParseUint(f, 10, 64); err != nil || from == 0 {
+			http.Error(w, "from must be a positive sequence number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	response := CDCResponse{Changes: []Change{}}
+	err := timedView(r, func(tx *bolt.Tx) error {
+		if from > 0 && from <= prunedThrough(tx) {
+			return errChangesPruned
+		}
+		b := tx.Bucket(changesBucket)
+		c := b.Cursor()
+		k, v := c.First()
+		if from > 0 {
+			k, v = c.Seek(itob(int(from)))
+		}
+		for ; k != nil; k, v = c.Next() {
+			if len(response.Changes) == limit {
+				response.HasMore = true
+				break
+			}
+			var change Change
+			if err := codec.Unmarshal(v, &change); err != nil {
+				return err
+			}
+			response.Changes = append(response.Changes, change)
+		}
+
+		if response.HasMore {
+			response.Next = response.Changes[limit-1].Seq + 1
+		} else {
+			response.Next = max(from, b.Sequence()+1)
+		}
+		return nil
+	})
+	if err == errChangesPruned {
+		http.Error(w, "Changes from this sequence number were compacted; read from the start", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	codec.NewEncoder(w).Encode(response)
+}
+
+func getCDCConsumers(w http.ResponseWriter, r *http.Request) {
+	consumers := []CDCConsumer{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(cdcConsumersBucket).ForEach(func(k, v []byte) error {
+			var consumer CDCConsumer
+			if err := codec.Unmarshal(v, &consumer); err != nil {
+				return err
+			}
+			consumers = append(consumers, consumer)
+			return nil
+		})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	json.NewEncoder(w).Encode(consumers)
+}
+
+// updateCDCConsumer registers a consumer or records its new position.
+func updateCDCConsumer(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Seq *uint64 `json:"seq"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if input.Seq == nil {
+		http.Error(w, "seq is required", http.StatusBadRequest)
+		return
+	}
+
+	consumer := CDCConsumer{Name: mux.Vars(r)["name"], Seq: *input.Seq, UpdatedAt: clock.Now().UTC()}
+	err := writeTx(func(tx *bolt.Tx) error {
+		if consumer.Seq > tx.Bucket(changesBucket).Sequence() {
+			return errCDCSeqAhead
+		}
+		buf, err := codec.Marshal(consumer)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(cdcConsumersBucket).Put([]byte(consumer.Name), buf)
+	})
+	if err == errCDCSeqAhead {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(consumer)
+}
+
+// deleteCDCConsumer forgets a consumer, so compaction no longer waits for
+// it.
+func deleteCDCConsumer(w http.ResponseWriter, r *http.Request) {
+	name := []byte(mux.Vars(r)["name"])
+	err := writeTx(func(tx *bolt.Tx) error {
+		b := tx.Bucket(cdcConsumersBucket)
+		if b.Get(name) == nil {
+			return errCDCConsumerNotFound
+		}
+		return b.Delete(name)
+	})
+	if err == errCDCConsumerNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
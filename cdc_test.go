@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func cdcRequest(method, url, body string) *http.Request {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+func fetchCDC(t *testing.T, router http.Handler, url string) CDCResponse {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, cdcRequest(http.MethodGet, url, ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response CDCResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func compactNow(t *testing.T) int {
+	var removed int
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		removed, err = compactChanges(tx, clock.Now().Add(time.Minute))
+		return err
+	})
+	assert.NoError(t, err)
+	return removed
+}
+
+func TestGetCDC(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+	router := setupRouter()
+	recordSampleChanges()
+
+	first := fetchCDC(t, router, "/cdc?limit=3")
+	assert.True(t, first.HasMore)
+	assert.Len(t, first.Changes, 3)
+	assert.Equal(t, uint64(1), first.Changes[0].Seq)
+	assert.Equal(t, uint64(4), first.Next)
+
+	second := fetchCDC(t, router, "/cdc?from=4")
+	assert.False(t, second.HasMore)
+	assert.Len(t, second.Changes, 1)
+	assert.Equal(t, EventTodoDeleted, second.Changes[0].Type)
+	assert.Equal(t, uint64(5), second.Next)
+
+	// Replaying from an earlier position returns the same records.
+	replay := fetchCDC(t, router, "/cdc?from=2&limit=2")
+	assert.Equal(t, []uint64{2, 3}, []uint64{replay.Changes[0].Seq, replay.Changes[1].Seq})
+
+	caughtUp := fetchCDC(t, router, "/cdc?from=5")
+	assert.Empty(t, caughtUp.Changes)
+	assert.Equal(t, uint64(5), caughtUp.Next)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{"zero", "/cdc?from=0", http.StatusBadRequest},
+		{"not a number", "/cdc?from=latest", http.StatusBadRequest},
+		{"no token", "/cdc", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := cdcRequest(http.MethodGet, tt.url, "")
+			if tt.expectedStatus == http.StatusUnauthorized {
+				req.Header.Del("Authorization")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestCDCAfterCompaction(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+	router := setupRouter()
+	recordSampleChanges()
+	assert.Equal(t, 3, compactNow(t))
+
+	// Reading on from the record kept would miss the compacted tombstone.
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, cdcRequest(http.MethodGet, "/cdc?from=3", ""))
+	assert.Equal(t, http.StatusGone, w.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, cdcRequest(http.MethodGet, "/cdc?from=5", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Starting over replays to the current state.
+	full := fetchCDC(t, router, "/cdc")
+	assert.Len(t, full.Changes, 1)
+	assert.Equal(t, uint64(3), full.Changes[0].Seq)
+	assert.Equal(t, uint64(5), full.Next)
+}
+
+func TestCDCConsumers(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+	withClock(t, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))
+	router := setupRouter()
+	recordSampleChanges()
+
+	for _, consumer := range []struct{ name, body string }{{"warehouse", `{"seq":1}`}, {"search", `{"seq":3}`}} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, cdcRequest(http.MethodPut, "/cdc/consumers/"+consumer.name, consumer.body))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, cdcRequest(http.MethodPut, "/cdc/consumers/search", `{"seq":9}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, cdcRequest(http.MethodPut, "/cdc/consumers/search", `{}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, cdcRequest(http.MethodGet, "/cdc/consumers", ""))
+	var consumers []CDCConsumer
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &consumers))
+	assert.Equal(t, []CDCConsumer{
+		{Name: "search", Seq: 3, UpdatedAt: clock.Now()},
+		{Name: "warehouse", Seq: 1, UpdatedAt: clock.Now()},
+	}, consumers)
+
+	// Compaction stops at the slowest consumer, which can still read on.
+	assert.Equal(t, 1, compactNow(t))
+	assert.Len(t, fetchCDC(t, router, "/cdc?from=2").Changes, 3)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, cdcRequest(http.MethodDelete, "/cdc/consumers/warehouse", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, cdcRequest(http.MethodDelete, "/cdc/consumers/warehouse", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, 1, compactNow(t))
+	assert.Len(t, fetchCDC(t, router, "/cdc?from=3").Changes, 2)
+}
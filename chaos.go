@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	faultLatency = "latency"
+	faultError   = "error"
+	faultDrop    = "drop"
+)
+
+// ChaosRule injects a fault into a fraction of requests. Route is a mux path
+// template such as "/todos/{id}"; an empty Route or Method matches everything.
+type ChaosRule struct {
+	Route     string  `json:"route"`
+	Method    string  `json:"method"`
+	Fault     string  `json:"fault"`
+	Rate      float64 `json:"rate"`
+	LatencyMs int     `json:"latencyMs"`
+}
+
+func (c ChaosRule) validate() error {
+	switch c.Fault {
+	case faultLatency:
+		if c.LatencyMs <= 0 {
+			return fmt.Errorf("latency rules need a positive latencyMs")
+		}
+	case faultError, faultDrop:
+	default:
+		return fmt.Errorf("unknown fault %q", c.Fault)
+	}
+	if c.Rate < 0 || c.Rate > 1 {
+		return fmt.Errorf("rate must be between 0 and 1")
+	}
+	return nil
+}
+
+func (c ChaosRule) matches(route, method string) bool {
+	return (c.Route == "" || c.Route == route) &&
+		(c.Method == "" || strings.EqualFold(c.Method, method))
+}
+
+type chaosConfig struct {
+	mu    sync.RWMutex
+	rules []ChaosRule
+}
+
+var chaos = &chaosConfig{}
+
+func (c *chaosConfig) set(rules []ChaosRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = rules
+}
+
+func (c *chaosConfig) get() []ChaosRule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]ChaosRule{}, c.rules...)
+}
+
+// chaosMiddleware applies the configured fault rules in dev mode. Admin
+// routes, /cdc, /metrics and the replica snapshot endpoint among them, and
+// health checks are never affected: chaos can always be switched off again,
+// and monitoring and replication keep telling the truth.
+func chaosMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !config.DevMode {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if class := routeClass(r); class == classAdmin || class == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := routeName(r)
+
+		for _, rule := range chaos.get() {
+			if !rule.matches(route, r.Method) || rand.Float64() >= rule.Rate {
+				continue
+			}
+
+			switch rule.Fault {
+			case faultLatency:
+				time.Sleep(time.Duration(rule.LatencyMs) * time.Millisecond)
+			case faultError:
+				http.Error(w, "Injected fault", http.StatusInternalServerError)
+				return
+			case faultDrop:
+				// Aborting the handler makes net/http close the connection
+				// without writing a response.
+				panic(http.ErrAbortHandler)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getChaos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]ChaosRule{"rules": chaos.get()})
+}
+
+func setChaos(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Rules []ChaosRule `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, rule := range body.Rules {
+		if err := rule.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	chaos.set(body.Rules)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]ChaosRule{"rules": chaos.get()})
+}
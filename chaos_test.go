@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withChaosRules(t *testing.T, rules ...ChaosRule) {
+	chaos.set(rules)
+	t.Cleanup(func() { chaos.set(nil) })
+}
+
+func TestChaosMiddleware(t *testing.T) {
+	clearBucket(t)
+	withDevMode(t, true)
+	withAdminToken(t, "secret")
+
+	router := setupRouter()
+
+	tests := []struct {
+		name           string
+		rules          []ChaosRule
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "no rules",
+			rules:          nil,
+			path:           "/todos",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "error on matching route",
+			rules:          []ChaosRule{{Route: "/todos", Fault: faultError, Rate: 1}},
+			path:           "/todos",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "error matches route template",
+			rules:          []ChaosRule{{Route: "/todos/{id}", Method: "GET", Fault: faultError, Rate: 1}},
+			path:           "/todos/42",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "other routes unaffected",
+			rules:          []ChaosRule{{Route: "/todos/{id}", Fault: faultError, Rate: 1}},
+			path:           "/todos",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "zero rate never fires",
+			rules:          []ChaosRule{{Fault: faultError, Rate: 0}},
+			path:           "/todos",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "admin routes exempt",
+			rules:          []ChaosRule{{Fault: faultError, Rate: 1}},
+			path:           "/admin/chaos",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "CDC exempt",
+			rules:          []ChaosRule{{Fault: faultError, Rate: 1}},
+			path:           "/cdc",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "metrics exempt",
+			rules:          []ChaosRule{{Fault: faultError, Rate: 1}},
+			path:           "/metrics",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "health checks exempt",
+			rules:          []ChaosRule{{Route: "/health", Fault: faultError, Rate: 1}},
+			path:           "/health",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withChaosRules(t, tt.rules...)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestChaosLatencyAndDrop(t *testing.T) {
+	clearBucket(t)
+	withDevMode(t, true)
+
+	server := setupTestServer(t)
+	defer server.Close()
+
+	withChaosRules(t, ChaosRule{Route: "/todos", Fault: faultLatency, Rate: 1, LatencyMs: 50})
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/todos")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	withChaosRules(t, ChaosRule{Route: "/todos", Fault: faultDrop, Rate: 1})
+	_, err = http.Get(server.URL + "/todos")
+	assert.Error(t, err)
+}
+
+func TestChaosIgnoredOutsideDevMode(t *testing.T) {
+	clearBucket(t)
+	withDevMode(t, false)
+	withChaosRules(t, ChaosRule{Fault: faultError, Rate: 1})
+
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	w := httptest.NewRecorder()
+
+	setupRouter().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSetChaos(t *testing.T) {
+	withChaosRules(t)
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+		expectedRules  int
+	}{
+		{
+			name:           "valid rules",
+			payload:        `{"rules":[{"route":"/todos","fault":"error","rate":0.5},{"fault":"latency","rate":1,"latencyMs":100}]}`,
+			expectedStatus: http.StatusOK,
+			expectedRules:  2,
+		},
+		{
+			name:           "unknown fault",
+			payload:        `{"rules":[{"fault":"explode","rate":1}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedRules:  2,
+		},
+		{
+			name:           "rate out of range",
+			payload:        `{"rules":[{"fault":"error","rate":1.5}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedRules:  2,
+		},
+		{
+			name:           "latency without duration",
+			payload:        `{"rules":[{"fault":"latency","rate":1}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedRules:  2,
+		},
+		{
+			name:           "clear rules",
+			payload:        `{"rules":[]}`,
+			expectedStatus: http.StatusOK,
+			expectedRules:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/admin/chaos", bytes.NewBufferString(tt.payload))
+			w := httptest.NewRecorder()
+
+			setChaos(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Len(t, chaos.get(), tt.expectedRules, fmt.Sprintf("rules after %q", tt.name))
+		})
+	}
+}
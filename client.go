@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a running instance of the service over HTTP. It backs the
+// `client` subcommand.
+type Client struct {
+	BaseURL string
+	Token   string
+	// User is sent as X-User, which the service needs to attribute todos,
+	// for instance when QUOTA_TODOS is set.
+	User string
+	HTTP *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func newClientFromEnv() *Client {
+	baseURL := os.Getenv("TODO_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	c := NewClient(baseURL, os.Getenv("TODO_TOKEN"))
+	c.User = os.Getenv("TODO_USER")
+	return c
+}
+
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.User != "" {
+		req.Header.Set(userHeader, c.User)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func (c *Client) List(page, limit int) (*PaginatedResponse, error) {
+	var response PaginatedResponse
+	path := fmt.Sprintf("/todos?page=%d&limit=%d", page, limit)
+	if err := c.do(http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// ListAll follows pagination until every todo has been fetched.
+func (c *Client) ListAll() ([]Todo, error) {
+	var todos []Todo
+	for page := 1; ; page++ {
+		response, err := c.List(page, 100)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, response.Items...)
+		if page >= response.TotalPages {
+			return todos, nil
+		}
+	}
+}
+
+func (c *Client) Get(id int) (*Todo, error) {
+	var todo Todo
+	if err := c.do(http.MethodGet, fmt.Sprintf("/todos/%d", id), nil, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+func (c *Client) Add(title string) (*Todo, error) {
+	var todo Todo
+	if err := c.do(http.MethodPost, "/todos", Todo{Title: title}, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+func (c *Client) Update(todo Todo) (*Todo, error) {
+	var updated Todo
+	if err := c.do(http.MethodPut, fmt.Sprintf("/todos/%d", todo.ID), todo, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (c *Client) Delete(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/todos/%d", id), nil, nil)
+}
+
+const clientUsage = `usage: todo-list-service client <command> [args]
+
+commands:
+  add <title>   create a todo
+  list          list all todos
+  done <id>     mark a todo as completed
+  rm <id>       delete a todo
+
+environment:
+  TODO_URL      base URL of the service (default: http://localhost:8080)
+  TODO_TOKEN    bearer token sent with every request
+  TODO_USER     user name sent as X-User, needed when the service has quotas
+`
+
+// runClient executes a client subcommand and returns the process exit code.
+func runClient(c *Client, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, clientUsage)
+		return 2
+	}
+
+	if err := dispatchClient(c, args[0], args[1:], stdout); err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+func dispatchClient(c *Client, command string, args []string, stdout io.Writer) error {
+	switch command {
+	case "add":
+		if len(args) == 0 {
+			return fmt.Errorf("add requires a title")
+		}
+		todo, err := c.Add(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		printTodo(stdout, *todo)
+
+	case "list":
+		todos, err := c.ListAll()
+		if err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			printTodo(stdout, todo)
+		}
+
+	case "done":
+		id, err := parseClientID(args)
+		if err != nil {
+			return err
+		}
+		todo, err := c.Get(id)
+		if err != nil {
+			return err
+		}
+		todo.Completed = true
+		updated, err := c.Update(*todo)
+		if err != nil {
+			return err
+		}
+		printTodo(stdout, *updated)
+
+	case "rm":
+		id, err := parseClientID(args)
+		if err != nil {
+			return err
+		}
+		if err := c.Delete(id); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	return nil
+}
+
+func parseClientID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected exactly one todo ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", args[0])
+	}
+	return id, nil
+}
+
+func printTodo(w io.Writer, todo Todo) {
+	mark := " "
+	if todo.Completed {
+		mark = "x"
+	}
+	fmt.Fprintf(w, "[%s] %d\t%s\n", mark, todo.ID, todo.Title)
+}
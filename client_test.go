@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCommands(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedOutput string
+	}{
+		{
+			name:           "add",
+			args:           []string{"add", "Buy", "milk"},
+			expectedCode:   0,
+			expectedOutput: "[ ] 1\tBuy milk\n",
+		},
+		{
+			name:           "done",
+			args:           []string{"done", "1"},
+			expectedCode:   0,
+			expectedOutput: "[x] 1\tBuy milk\n",
+		},
+		{
+			name:           "list",
+			args:           []string{"list"},
+			expectedCode:   0,
+			expectedOutput: "[x] 1\tBuy milk\n",
+		},
+		{
+			name:           "rm",
+			args:           []string{"rm", "1"},
+			expectedCode:   0,
+			expectedOutput: "",
+		},
+		{
+			name:           "done on missing todo",
+			args:           []string{"done", "1"},
+			expectedCode:   1,
+			expectedOutput: "",
+		},
+		{
+			name:           "invalid id",
+			args:           []string{"rm", "abc"},
+			expectedCode:   1,
+			expectedOutput: "",
+		},
+		{
+			name:           "unknown command",
+			args:           []string{"frobnicate"},
+			expectedCode:   1,
+			expectedOutput: "",
+		},
+		{
+			name:           "no command",
+			args:           []string{},
+			expectedCode:   2,
+			expectedOutput: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := runClient(client, tt.args, &stdout, &stderr)
+
+			assert.Equal(t, tt.expectedCode, code)
+			assert.Equal(t, tt.expectedOutput, stdout.String())
+		})
+	}
+}
+
+func TestClientSendsToken(t *testing.T) {
+	var authHeader string
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	client := NewClient(server.URL, "secret")
+	client.HTTP.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		authHeader = r.Header.Get("Authorization")
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	_, err := client.List(1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer secret", authHeader)
+}
+
+func TestClientSendsUser(t *testing.T) {
+	clearBucket(t)
+	withQuotas(t, 2, 1, 10)
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	t.Setenv("TODO_URL", server.URL)
+	client := newClientFromEnv()
+	_, err := client.Add("Buy milk")
+	assert.Error(t, err, "a quota needs a creator")
+
+	t.Setenv("TODO_USER", "alice")
+	client = newClientFromEnv()
+	todo, err := client.Add("Buy milk")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", todo.CreatedBy)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the peers whose X-Forwarded-For and Forwarded headers
+// are believed, from TRUSTED_PROXIES.
+type TrustedProxies struct {
+	Prefixes []netip.Prefix
+	// Unix trusts peers on a Unix socket, such as a reverse proxy on the
+	// same host.
+	Unix bool
+}
+
+// parseTrustedProxies parses a comma-separated list of CIDRs, addresses,
+// and "unix".
+func parseTrustedProxies(s string) (TrustedProxies, error) {
+	var trusted TrustedProxies
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "unix" {
+			trusted.Unix = true
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return TrustedProxies{}, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: use a CIDR, an address or unix", entry)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted.Prefixes = append(trusted.Prefixes, prefix.Masked())
+	}
+	return trusted, nil
+}
+
+func (t TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range t.Prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client behind r. Forwarding headers
+// are only read when the peer is a trusted proxy, and then from the right,
+// skipping trusted proxies, since hops further left are the client's own
+// claims. It returns "" when the peer is on a Unix socket that isn't
+// trusted.
+func clientIP(r *http.Request) string {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		if !config.TrustedProxies.Unix {
+			return ""
+		}
+	} else if !config.TrustedProxies.contains(peer.Addr()) {
+		return peer.Addr().Unmap().String()
+	}
+
+	client := ""
+	if err == nil {
+		client = peer.Addr().Unmap().String()
+	}
+	hops := forwardedFor(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			// An obfuscated or garbled hop: the last trusted proxy's view
+			// is all we know.
+			break
+		}
+		client = addr.String()
+		if !config.TrustedProxies.contains(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedFor returns the hops listed in the Forwarded header's for
+// parameters, or in X-Forwarded-For without one, client first.
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	if forwarded := r.Header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+		return hops
+	}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseHop parses a forwarded address, with or without a port, and IPv6
+// addresses with or without brackets.
+func parseHop(hop string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), true
+	}
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	return addr.Unmap(), err == nil
+}
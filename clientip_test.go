@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.7,fd00::1/64,unix")
+	assert.NoError(t, err)
+	assert.True(t, trusted.Unix)
+	assert.Equal(t, "[10.0.0.0/8 192.168.1.7/32 fd00::/64]", fmt.Sprint(trusted.Prefixes))
+
+	_, err = parseTrustedProxies("10.0.0.0/8,proxy.internal")
+	assert.ErrorContains(t, err, `"proxy.internal"`)
+}
+
+func TestClientIP(t *testing.T) {
+	previous := config
+	t.Cleanup(func() { config = previous })
+	config.TrustedProxies, _ = parseTrustedProxies("10.0.0.0/8,unix")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", "203.0.113.9:5123", nil, "203.0.113.9"},
+		{"untrusted peer", "203.0.113.9:5123", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.9"},
+		{"trusted peer", "10.0.0.2:5123", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hop", "10.0.0.2:5123", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"all trusted", "10.0.0.2:5123", map[string]string{"X-Forwarded-For": "10.0.0.4"}, "10.0.0.4"},
+		{"no header", "10.0.0.2:5123", nil, "10.0.0.2"},
+		{"garbled hop", "10.0.0.2:5123", map[string]string{"X-Forwarded-For": "198.51.100.1, junk"}, "10.0.0.2"},
+		{"forwarded", "10.0.0.2:5123", map[string]string{"Forwarded": `for=198.51.100.1;proto=https, For="[2001:db8::17]:4711"`}, "2001:db8::17"},
+		{"forwarded wins", "10.0.0.2:5123", map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "1.2.3.4"}, "198.51.100.1"},
+		{"obfuscated", "10.0.0.2:5123", map[string]string{"Forwarded": "for=_hidden"}, "10.0.0.2"},
+		{"mapped ipv4", "[::ffff:10.0.0.2]:5123", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"unix socket", "@", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			assert.Equal(t, tt.want, clientIP(req))
+		})
+	}
+
+	config.TrustedProxies = TrustedProxies{}
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	req.RemoteAddr = "@"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	assert.Empty(t, clientIP(req), "untrusted Unix socket peer")
+}
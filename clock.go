@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+// Clock tells the time. Anything that depends on "now", such as due dates,
+// expiry, reminders and the scheduler, reads it through clock, so tests can
+// set and advance time instead of sleeping. Latencies in logs and metrics
+// are measured with the time package directly.
+type Clock interface {
+	Now() time.Time
+	// NewTicker ticks every d until stop is called.
+	NewTicker(d time.Duration) (ticks <-chan time.Time, stop func())
+}
+
+// systemClock is the real time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+var clock Clock = systemClock{}
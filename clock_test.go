@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	c       chan time.Time
+	every   time.Duration
+	next    time.Time
+	stopped bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{c: make(chan time.Time, 1), every: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t.c, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		t.stopped = true
+	}
+}
+
+// Advance moves the clock forward by d and fires the tickers that came due.
+// A ticker whose reader is behind gets only the latest tick.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if t.stopped || t.next.After(c.now) {
+			continue
+		}
+		missed := c.now.Sub(t.next) / t.every
+		tick := t.next.Add(missed * t.every)
+		t.next = tick.Add(t.every)
+		select {
+		case <-t.c:
+		default:
+		}
+		t.c <- tick
+	}
+}
+
+// withClock sets the time to start for the test.
+func withClock(t *testing.T, start time.Time) *fakeClock {
+	previous := clock
+	fake := &fakeClock{now: start}
+	clock = fake
+	t.Cleanup(func() { clock = previous })
+	return fake
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	fake := withClock(t, start)
+	assert.Equal(t, start, clock.Now())
+
+	ticks, stop := clock.NewTicker(time.Minute)
+	fake.Advance(30 * time.Second)
+	assert.Len(t, ticks, 0)
+	fake.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-ticks)
+
+	fake.Advance(2 * time.Minute)
+	fake.Advance(90 * time.Second)
+	assert.Equal(t, start.Add(4*time.Minute), <-ticks, "a slow reader gets the latest tick")
+	assert.Len(t, ticks, 0)
+
+	stop()
+	fake.Advance(time.Hour)
+	assert.Len(t, ticks, 0)
+}
+
+func TestSchedulerRunFollowsClock(t *testing.T) {
+	withScheduler(t)
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	fake := withClock(t, start)
+
+	ran := make(chan time.Time, 1)
+	assert.NoError(t, scheduler.add("hourly", "@every 1h", start, func(now time.Time) error {
+		ran <- now
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- scheduler.run(ctx) }()
+
+	// Wait for the loop to create its ticker before moving time.
+	assert.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.tickers) == 1
+	}, time.Second, time.Millisecond)
+
+	fake.Advance(59 * time.Minute)
+	select {
+	case <-ran:
+		t.Fatal("job ran before it was due")
+	default:
+	}
+	fake.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Hour), <-ran)
+
+	cancel()
+	assert.NoError(t, <-stopped)
+	assert.Equal(t, start.Add(2*time.Hour), *scheduler.list()[0].NextRun)
+}
+
+func TestSessionExpiry(t *testing.T) {
+	fake := withClock(t, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))
+
+	session, err := sessions.create()
+	assert.NoError(t, err)
+	fake.Advance(sessionTTL)
+	_, ok := sessions.get(session.ID)
+	assert.True(t, ok)
+	fake.Advance(time.Second)
+	_, ok = sessions.get(session.ID)
+	assert.False(t, ok)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Codec encodes and decodes todos in the storage layer and the bulk listing
+// path. The standard library codec is always available; faster ones register
+// themselves in codecs from build-tagged files and are picked with JSON_CODEC.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	NewEncoder(w io.Writer) Encoder
+}
+
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+type stdCodec struct{}
+
+func (stdCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (stdCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (stdCodec) NewEncoder(w io.Writer) Encoder             { return json.NewEncoder(w) }
+
+var codecs = map[string]Codec{
+	"std": stdCodec{},
+}
+
+var codec Codec = stdCodec{}
+
+func selectCodec(name string) (Codec, error) {
+	c, ok := codecs[name]
+	if !ok {
+		var names []string
+		for n := range codecs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown JSON codec %q (available: %s; others need their build tag, e.g. -tags jsoniter)",
+			name, strings.Join(names, ", "))
+	}
+	return c, nil
+}
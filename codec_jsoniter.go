@@ -0,0 +1,21 @@
+//go:build jsoniter
+
+package main
+
+import (
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type jsoniterCodec struct {
+	api jsoniter.API
+}
+
+func (c jsoniterCodec) Marshal(v interface{}) ([]byte, error)      { return c.api.Marshal(v) }
+func (c jsoniterCodec) Unmarshal(data []byte, v interface{}) error { return c.api.Unmarshal(data, v) }
+func (c jsoniterCodec) NewEncoder(w io.Writer) Encoder             { return c.api.NewEncoder(w) }
+
+func init() {
+	codecs["jsoniter"] = jsoniterCodec{api: jsoniter.ConfigCompatibleWithStandardLibrary}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withCodec(t testing.TB, c Codec) {
+	previous := codec
+	codec = c
+	t.Cleanup(func() { codec = previous })
+}
+
+func codecNames() []string {
+	var names []string
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSelectCodec(t *testing.T) {
+	c, err := selectCodec("std")
+	assert.NoError(t, err)
+	assert.Equal(t, stdCodec{}, c)
+
+	_, err = selectCodec("nope")
+	assert.Error(t, err)
+}
+
+// Every registered codec must produce output the standard library accepts
+// and that round-trips to the same value.
+func TestCodecsRoundTrip(t *testing.T) {
+	todo := Todo{ID: 7, Title: "Ünïcode <&> \"quoted\"", Completed: true}
+
+	for _, name := range codecNames() {
+		t.Run(name, func(t *testing.T) {
+			c := codecs[name]
+
+			buf, err := c.Marshal(todo)
+			assert.NoError(t, err)
+
+			expected, _ := stdCodec{}.Marshal(todo)
+			assert.JSONEq(t, string(expected), string(buf))
+
+			var decoded Todo
+			assert.NoError(t, c.Unmarshal(buf, &decoded))
+			assert.Equal(t, todo, decoded)
+		})
+	}
+}
+
+func BenchmarkListTodos(b *testing.B) {
+	useTestDB(b)
+	if err := seedTodos(10000, rand.New(rand.NewSource(1))); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, name := range codecNames() {
+		b.Run(name, func(b *testing.B) {
+			withCodec(b, codecs[name])
+			url := fmt.Sprintf("/todos?limit=%d", 10000)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				getTodos(w, httptest.NewRequest(http.MethodGet, url, nil))
+				if w.Code != http.StatusOK {
+					b.Fatalf("unexpected status %d", w.Code)
+				}
+			}
+		})
+	}
+}
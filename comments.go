@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// commentsBucket holds a nested bucket per todo, keyed like the todo, with
+// the todo's comments keyed by their ID.
+var commentsBucket = []byte("comments")
+
+const reasonMentioned = "mentioned"
+
+type Comment struct {
+	ID        int       `json:"id"`
+	TodoID    int       `json:"todoId"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+var (
+	errTodoNotFound    = errors.New("todo not found")
+	errCommentNotFound = errors.New("comment not found")
+	errNotCommentOwner = errors.New("only the author can change a comment")
+
+	mentionPattern = regexp.MustCompile(`(?:^|\s)@([A-Za-z0-9._-]+)`)
+)
+
+// mentions returns the distinct user names @-mentioned in a comment body.
+func mentions(body string) []string {
+	var users []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		user := strings.TrimRight(m[1], ".")
+		if user != "" && !seen[user] {
+			seen[user] = true
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// todoComments returns the comment bucket of a todo, creating it when create
+// is set. It fails with errTodoNotFound if the todo doesn't exist.
+func todoComments(tx *bolt.Tx, id int, create bool) (*bolt.Bucket, error) {
+	if tx.Bucket(todosBucket).Get(itob(id)) == nil {
+		return nil, errTodoNotFound
+	}
+	if create {
+		return tx.Bucket(commentsBucket).CreateBucketIfNotExists(itob(id))
+	}
+	return tx.Bucket(commentsBucket).Bucket(itob(id)), nil
+}
+
+func deleteComments(tx *bolt.Tx, key []byte) error {
+	if err := tx.Bucket(commentsBucket).DeleteBucket(key); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	return nil
+}
+
+func commentError(w http.ResponseWriter, err error) {
+	switch err {
+	case errTodoNotFound, errCommentNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errNotCommentOwner:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// commentRequest parses the todo and comment IDs of a comment route. The
+// comment ID is zero on collection routes.
+func commentRequest(w http.ResponseWriter, r *http.Request) (todoID, commentID int, ok bool) {
+	vars := mux.Vars(r)
+	todoID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	if s, found := vars["commentID"]; found {
+		if commentID, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return todoID, commentID, true
+}
+
+// commentAuthor returns the caller, who must be identified to write comments.
+func commentAuthor(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Commenting requires the "+userHeader+" header", http.StatusBadRequest)
+		return "", false
+	}
+	if err := validUserName(user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return user, true
+}
+
+func decodeCommentBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if strings.TrimSpace(input.Body) == "" {
+		http.Error(w, "Comment body is required", http.StatusBadRequest)
+		return "", false
+	}
+	return input.Body, true
+}
+
+func getComments(w http.ResponseWriter, r *http.Request) {
+	todoID, _, ok := commentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	comments := []Comment{}
+	err := db.View(func(tx *bolt.Tx) error {
+		b, err := todoComments(tx, todoID, false)
+		if err != nil || b == nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var comment Comment
+			if err := codec.Unmarshal(v, &comment); err != nil {
+				return err
+			}
+			comments = append(comments, comment)
+			return nil
+		})
+	})
+	if err != nil {
+		commentError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(comments)
+}
+
+func createComment(w http.ResponseWriter, r *http.Request) {
+	todoID, _, ok := commentRequest(w, r)
+	if !ok {
+		return
+	}
+	author, ok := commentAuthor(w, r)
+	if !ok {
+		return
+	}
+	body, ok := decodeCommentBody(w, r)
+	if !ok {
+		return
+	}
+
+	var comment Comment
+	err := writeTx(func(tx *bolt.Tx) error {
+		b, err := todoComments(tx, todoID, true)
+		if err != nil {
+			return err
+		}
+		id, _ := b.NextSequence()
+		now := clock.Now().UTC()
+		comment = Comment{ID: int(id), TodoID: todoID, Author: author, Body: body, CreatedAt: now, UpdatedAt: now}
+		buf, err := codec.Marshal(comment)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(comment.ID), buf)
+	})
+	if err != nil {
+		commentError(w, err)
+		return
+	}
+
+	notifyComment(comment)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// updateComment edits (PUT) or deletes (DELETE) one of the caller's comments.
+func updateComment(w http.ResponseWriter, r *http.Request) {
+	todoID, commentID, ok := commentRequest(w, r)
+	if !ok {
+		return
+	}
+	author, ok := commentAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	var body string
+	if r.Method == http.MethodPut {
+		if body, ok = decodeCommentBody(w, r); !ok {
+			return
+		}
+	}
+
+	var comment Comment
+	err := writeTx(func(tx *bolt.Tx) error {
+		b, err := todoComments(tx, todoID, false)
+		if err != nil {
+			return err
+		}
+		var v []byte
+		if b != nil {
+			v = b.Get(itob(commentID))
+		}
+		if v == nil {
+			return errCommentNotFound
+		}
+		if err := codec.Unmarshal(v, &comment); err != nil {
+			return err
+		}
+		if comment.Author != author {
+			return errNotCommentOwner
+		}
+
+		if r.Method == http.MethodDelete {
+			return b.Delete(itob(commentID))
+		}
+
+		comment.Body = body
+		comment.UpdatedAt = clock.Now().UTC()
+		buf, err := codec.Marshal(comment)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(commentID), buf)
+	})
+	if err != nil {
+		commentError(w, err)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	json.NewEncoder(w).Encode(comment)
+}
+
+// notifyComment tells mentioned users and the todo's watchers about a new
+// comment. Authors aren't notified about their own comments.
+func notifyComment(comment Comment) {
+	notified := map[string]bool{comment.Author: true}
+	for _, user := range mentions(comment.Body) {
+		if !notified[user] {
+			notified[user] = true
+			notify(Notification{User: user, TodoID: comment.TodoID, Reason: reasonMentioned, Message: redactUser(comment.Author) + " mentioned you: " + redactText(comment.Body)})
+		}
+	}
+
+	watchers, err := todoWatchers(comment.TodoID)
+	if err != nil {
+		warnf("loading watchers of todo %d: %v", comment.TodoID, err)
+		return
+	}
+	for _, user := range watchers {
+		if !notified[user] {
+			notified[user] = true
+			notify(Notification{User: user, TodoID: comment.TodoID, Reason: reasonWatching, Message: redactUser(comment.Author) + " commented: " + redactText(comment.Body)})
+		}
+	}
+}
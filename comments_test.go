@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func requestAs(user, method, url, body string) *http.Request {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, url, nil)
+	} else {
+		req = httptest.NewRequest(method, url, strings.NewReader(body))
+	}
+	if user != "" {
+		req.Header.Set(userHeader, user)
+	}
+	return req
+}
+
+func TestComments(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	payload, _ := json.Marshal(Todo{Title: "Discuss"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+
+	tests := []struct {
+		name           string
+		user           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "create",
+			user:           "alice",
+			method:         http.MethodPost,
+			url:            "/todos/1/comments",
+			body:           `{"body":"First"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "create without user",
+			method:         http.MethodPost,
+			url:            "/todos/1/comments",
+			body:           `{"body":"Anonymous"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "create empty",
+			user:           "alice",
+			method:         http.MethodPost,
+			url:            "/todos/1/comments",
+			body:           `{"body":"  "}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "create on missing todo",
+			user:           "alice",
+			method:         http.MethodPost,
+			url:            "/todos/99/comments",
+			body:           `{"body":"Lost"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "edit someone else's",
+			user:           "bob",
+			method:         http.MethodPut,
+			url:            "/todos/1/comments/1",
+			body:           `{"body":"Hijacked"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "edit own",
+			user:           "alice",
+			method:         http.MethodPut,
+			url:            "/todos/1/comments/1",
+			body:           `{"body":"Edited"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "delete missing",
+			user:           "alice",
+			method:         http.MethodDelete,
+			url:            "/todos/1/comments/7",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, requestAs(tt.user, tt.method, tt.url, tt.body))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1/comments", nil))
+
+	var comments []Comment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &comments))
+	assert.Len(t, comments, 1)
+	assert.Equal(t, "alice", comments[0].Author)
+	assert.Equal(t, "Edited", comments[0].Body)
+	assert.False(t, comments[0].UpdatedAt.Before(comments[0].CreatedAt))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodDelete, "/todos/1/comments/1", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestCommentNotifications(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	notifications := withRecordingNotifier(t)
+
+	payload, _ := json.Marshal(Todo{Title: "Discuss"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("carol", http.MethodPost, "/todos/1/watch", ""))
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("bob", http.MethodPost, "/todos/1/watch", ""))
+
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("alice", http.MethodPost, "/todos/1/comments", `{"body":"@bob can you check? cc @alice"}`))
+
+	assert.Equal(t, []Notification{
+		{User: "bob", TodoID: 1, Reason: reasonMentioned, Message: "alice mentioned you: @bob can you check? cc @alice"},
+		{User: "carol", TodoID: 1, Reason: reasonWatching, Message: "alice commented: @bob can you check? cc @alice"},
+	}, notifications.sent)
+}
+
+func TestMentions(t *testing.T) {
+	assert.Equal(t, []string{"bob", "carol.d"}, mentions("@bob and @carol.d. Also @bob, not me@example.com"))
+	assert.Empty(t, mentions("no mentions"))
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type Config struct {
+	Port          string
+	Listen        string
+	AdminListen   string
+	AdminToken    string
+	SecureCookies bool
+	DevMode       bool
+	WriteBatching bool
+	BatchDelay    time.Duration
+	CacheSize     int
+	JSONCodec     string
+
+	// DataDir holds the database, disk attachments and backups: relative
+	// ATTACHMENT_DIR and BACKUP_DIR paths are inside it. DBPath is the
+	// database file, todos.db in DataDir unless set.
+	DataDir string
+	DBPath  string
+
+	// Completed todos unchanged for ArchiveAfter are moved to the archive
+	// database at ArchivePath, archive.db in DataDir unless set. Zero
+	// turns archiving off.
+	ArchiveAfter time.Duration
+	ArchivePath  string
+
+	// PrimaryURL makes the service a read replica of the primary there:
+	// every ReplicaSyncInterval it copies a snapshot from
+	// PrimarySnapshotURL, authorized with PrimaryToken, and it forwards
+	// writes to the primary.
+	PrimaryURL          string
+	PrimarySnapshotURL  string
+	PrimaryToken        string
+	ReplicaSyncInterval time.Duration
+
+	// Bolt options: how long Open waits for the file lock, whether commits
+	// skip fsync, whether the freelist is written to disk or rebuilt at
+	// open, its array or map type, and the initial mmap size in bytes.
+	BoltTimeout         time.Duration
+	BoltNoSync          bool
+	BoltNoFreelistSync  bool
+	BoltFreelistType    string
+	BoltInitialMmapSize int
+
+	// ShutdownTimeout is how long each component, such as the HTTP server
+	// draining requests, may take to stop on shutdown.
+	ShutdownTimeout time.Duration
+
+	// SlowQueryThreshold is how long a listing's read transaction may take
+	// before it is logged and counted as slow. Zero turns it off.
+	SlowQueryThreshold time.Duration
+
+	// Batch routes, such as imports and exports, are answered with 503
+	// while the average write transaction takes longer than
+	// ShedWriteLatency or more than ShedWriteQueue writes are queued, asking
+	// clients to retry after ShedRetryAfter. Zero turns a threshold off.
+	ShedWriteLatency time.Duration
+	ShedWriteQueue   int
+	ShedRetryAfter   time.Duration
+
+	// ExportRetention and ImportRetention are how long a finished export
+	// or import job is kept. Zero keeps jobs until they are deleted.
+	ExportRetention time.Duration
+	ImportRetention time.Duration
+
+	// ClassLimits caps each priority class of routes, interactive, batch
+	// and admin.
+	ClassLimits map[string]ClassLimit
+
+	// TrustedProxies may set the client address in forwarding headers.
+	TrustedProxies TrustedProxies
+
+	// AccessLog logs every request. LogRedaction keeps todo titles and
+	// user names out of logs and notification payloads.
+	AccessLog    bool
+	LogRedaction bool
+	// LogLevel is the level logged from startup: debug, info or warn.
+	LogLevel int32
+	// CaptureBufferSize is how many requests capture mode keeps.
+	CaptureBufferSize int
+	// SentryDSN, when set, sends handler panics and 5xx responses to
+	// Sentry, tagged with SentryEnvironment.
+	SentryDSN         string
+	SentryEnvironment string
+	// DebugAddr, when set, serves pprof and expvar on this loopback
+	// address, apart from the API port.
+	DebugAddr string
+	// ChangeRetention is how long tombstones and superseded change records
+	// are kept in the sync feed. Zero keeps them forever.
+	ChangeRetention time.Duration
+	// SyncInterval is how often connected task services are synced. Zero
+	// leaves syncing to the admin endpoint.
+	SyncInterval          time.Duration
+	GoogleClientID        string
+	GoogleClientSecret    string
+	MicrosoftClientID     string
+	MicrosoftClientSecret string
+	// MicrosoftTenant is the Entra ID tenant users sign in to; "common"
+	// accepts any work or personal account.
+	MicrosoftTenant string
+	// GitHubRepo is the owner/name repository todos open issues in.
+	GitHubRepo          string
+	GitHubToken         string
+	GitHubWebhookSecret string
+	GitHubIssueOnCreate bool
+	// JiraURL is the Jira site, such as https://acme.atlassian.net.
+	JiraURL   string
+	JiraEmail string
+	JiraToken string
+	// JiraDoneTransition names the transition applied to a todo's issue
+	// when it is completed. Empty leaves issues alone.
+	JiraDoneTransition string
+	TwilioAccountSID   string
+	TwilioAuthToken    string
+	// TwilioFrom is the number SMS reminders are sent from.
+	TwilioFrom string
+	// TwilioStatusCallback is the public URL of /webhooks/twilio/status.
+	// Twilio signs callbacks over it, so it must match exactly.
+	TwilioStatusCallback string
+	// ReminderInterval is how often overdue todos are checked for SMS
+	// reminders.
+	ReminderInterval time.Duration
+	// JobSchedules overrides the schedules of recurring jobs by name: a
+	// cron expression, a descriptor such as @daily, "@every" and a
+	// duration, or "off".
+	JobSchedules map[string]string
+	// BackupDir, when set, is where the backup job writes copies of the
+	// database, keeping the newest BackupKeep.
+	BackupDir  string
+	BackupKeep int
+	// BreakerThreshold is how many consecutive failures open the circuit
+	// to a downstream service, and BreakerCooldown how long it stays open
+	// before a trial request. A zero threshold turns breakers off.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// DeliveryAttempts is how many times outbound deliveries, such as SMS
+	// reminders, are tried. Retries wait DeliveryBackoff, doubled after
+	// each one and varied by up to DeliveryJitter of it; every attempt
+	// times out after DeliveryTimeout.
+	DeliveryAttempts int
+	DeliveryBackoff  time.Duration
+	DeliveryJitter   float64
+	DeliveryTimeout  time.Duration
+	// AttachmentStore is where attachment contents are kept: bolt, in the
+	// database, or disk, as files in AttachmentDir.
+	AttachmentStore   string
+	AttachmentDir     string
+	AttachmentMaxSize int64
+	// QuotaTodos, QuotaFilters and QuotaAttachmentBytes limit each user's
+	// assigned todos, saved filters and attachment storage. Zero is
+	// unlimited.
+	QuotaTodos           int
+	QuotaFilters         int
+	QuotaAttachmentBytes int64
+	// AttachmentTypes are the accepted media types. Entries ending in "/"
+	// accept a whole family, such as image/.
+	AttachmentTypes []string
+	// ThumbnailSizes maps the names image attachments can be downloaded
+	// at, with ?size=, to the side of the square their thumbnail fits.
+	ThumbnailSizes map[string]int
+	// EncryptionKey, when set, encrypts stored values with AES-GCM. It is
+	// the base64 key from ENCRYPTION_KEY, or read from ENCRYPTION_KEY_FILE
+	// where a KMS or secrets agent writes it.
+	EncryptionKey string
+	// EncryptionOldKeys still decrypt values sealed before a key rotation.
+	EncryptionOldKeys []string
+	// VaultAddr, when set, is the Vault server secrets are read from at
+	// startup, from the secret at VaultSecretPath, such as
+	// secret/data/todo-list-service.
+	VaultAddr       string
+	VaultToken      string
+	VaultSecretPath string
+	// VaultRefreshInterval is how often the Vault token is renewed and the
+	// secrets refetched. Zero reads them only at startup.
+	VaultRefreshInterval time.Duration
+}
+
+var config Config
+
+func loadConfig() Config {
+	c := Config{
+		Port:          os.Getenv("PORT"),
+		Listen:        os.Getenv("LISTEN"),
+		AdminListen:   os.Getenv("ADMIN_LISTEN"),
+		AdminToken:    os.Getenv("ADMIN_TOKEN"),
+		SecureCookies: os.Getenv("SESSION_COOKIE_SECURE") != "false",
+		DevMode:       os.Getenv("DEV_MODE") == "true",
+		WriteBatching: os.Getenv("WRITE_BATCHING") == "true",
+		JSONCodec:     os.Getenv("JSON_CODEC"),
+		AccessLog:     os.Getenv("ACCESS_LOG") == "true",
+		LogRedaction:  os.Getenv("LOG_REDACTION") == "true",
+
+		DataDir: os.Getenv("DATA_DIR"),
+		DBPath:  os.Getenv("DB_PATH"),
+
+		ArchivePath: os.Getenv("ARCHIVE_PATH"),
+
+		PrimaryURL:         strings.TrimSuffix(os.Getenv("PRIMARY_URL"), "/"),
+		PrimarySnapshotURL: os.Getenv("PRIMARY_SNAPSHOT_URL"),
+		PrimaryToken:       os.Getenv("PRIMARY_TOKEN"),
+
+		BoltNoSync:         os.Getenv("BOLT_NO_SYNC") == "true",
+		BoltNoFreelistSync: os.Getenv("BOLT_NO_FREELIST_SYNC") == "true",
+		BoltFreelistType:   os.Getenv("BOLT_FREELIST_TYPE"),
+
+		SentryDSN:         os.Getenv("SENTRY_DSN"),
+		SentryEnvironment: os.Getenv("SENTRY_ENVIRONMENT"),
+		DebugAddr:         os.Getenv("DEBUG_ADDR"),
+
+		GoogleClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+		GoogleClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+
+		MicrosoftClientID:     os.Getenv("MICROSOFT_CLIENT_ID"),
+		MicrosoftClientSecret: os.Getenv("MICROSOFT_CLIENT_SECRET"),
+		MicrosoftTenant:       os.Getenv("MICROSOFT_TENANT"),
+
+		GitHubRepo:          os.Getenv("GITHUB_REPO"),
+		GitHubToken:         os.Getenv("GITHUB_TOKEN"),
+		GitHubWebhookSecret: os.Getenv("GITHUB_WEBHOOK_SECRET"),
+		GitHubIssueOnCreate: os.Getenv("GITHUB_ISSUE_ON_CREATE") == "true",
+
+		JiraURL:            os.Getenv("JIRA_URL"),
+		JiraEmail:          os.Getenv("JIRA_EMAIL"),
+		JiraToken:          os.Getenv("JIRA_API_TOKEN"),
+		JiraDoneTransition: os.Getenv("JIRA_DONE_TRANSITION"),
+
+		TwilioAccountSID:     os.Getenv("TWILIO_ACCOUNT_SID"),
+		TwilioAuthToken:      os.Getenv("TWILIO_AUTH_TOKEN"),
+		TwilioFrom:           os.Getenv("TWILIO_FROM"),
+		TwilioStatusCallback: os.Getenv("TWILIO_STATUS_CALLBACK_URL"),
+
+		BackupDir: os.Getenv("BACKUP_DIR"),
+
+		AttachmentStore: os.Getenv("ATTACHMENT_STORE"),
+		AttachmentDir:   os.Getenv("ATTACHMENT_DIR"),
+
+		EncryptionKey: os.Getenv("ENCRYPTION_KEY"),
+
+		VaultAddr:       os.Getenv("VAULT_ADDR"),
+		VaultToken:      os.Getenv("VAULT_TOKEN"),
+		VaultSecretPath: os.Getenv("VAULT_SECRET_PATH"),
+	}
+
+	if c.JSONCodec == "" {
+		c.JSONCodec = "std"
+	}
+
+	if c.MicrosoftTenant == "" {
+		c.MicrosoftTenant = "common"
+	}
+
+	c.CacheSize = 1000
+	if size := os.Getenv("CACHE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid CACHE_SIZE %q", size)
+		}
+		c.CacheSize = n
+	}
+
+	c.BoltTimeout = 10 * time.Second
+	if timeout := os.Getenv("BOLT_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid BOLT_TIMEOUT %q", timeout)
+		}
+		c.BoltTimeout = d
+	}
+
+	switch c.BoltFreelistType {
+	case "":
+		c.BoltFreelistType = string(bolt.FreelistArrayType)
+	case string(bolt.FreelistArrayType), string(bolt.FreelistMapType):
+	default:
+		log.Fatalf("invalid BOLT_FREELIST_TYPE %q: use array or map", c.BoltFreelistType)
+	}
+
+	if size := os.Getenv("BOLT_INITIAL_MMAP_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid BOLT_INITIAL_MMAP_SIZE %q: use a size in bytes", size)
+		}
+		c.BoltInitialMmapSize = n
+	}
+
+	if delay := os.Getenv("WRITE_BATCH_DELAY"); delay != "" {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			log.Fatalf("invalid WRITE_BATCH_DELAY %q: %v", delay, err)
+		}
+		c.BatchDelay = d
+	}
+
+	if retention := os.Getenv("CHANGE_RETENTION"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid CHANGE_RETENTION %q", retention)
+		}
+		c.ChangeRetention = d
+	}
+
+	if after := os.Getenv("ARCHIVE_AFTER"); after != "" {
+		d, err := time.ParseDuration(after)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid ARCHIVE_AFTER %q", after)
+		}
+		c.ArchiveAfter = d
+	}
+
+	if c.PrimaryURL != "" {
+		if u, err := url.Parse(c.PrimaryURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("invalid PRIMARY_URL %q: use the primary's base URL, such as http://todo-primary:8080", c.PrimaryURL)
+		}
+		if c.PrimarySnapshotURL == "" {
+			c.PrimarySnapshotURL = c.PrimaryURL + "/admin/backup"
+		}
+	}
+	c.ReplicaSyncInterval = time.Minute
+	if interval := os.Getenv("REPLICA_SYNC_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid REPLICA_SYNC_INTERVAL %q", interval)
+		}
+		c.ReplicaSyncInterval = d
+	}
+
+	c.SyncInterval = 15 * time.Minute
+	if interval := os.Getenv("SYNC_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid SYNC_INTERVAL %q", interval)
+		}
+		c.SyncInterval = d
+	}
+
+	c.ReminderInterval = 15 * time.Minute
+	if interval := os.Getenv("REMINDER_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid REMINDER_INTERVAL %q", interval)
+		}
+		c.ReminderInterval = d
+	}
+
+	if schedules := os.Getenv("JOB_SCHEDULES"); schedules != "" {
+		c.JobSchedules = make(map[string]string)
+		for _, entry := range strings.Split(schedules, ";") {
+			name, spec, ok := strings.Cut(entry, "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				log.Fatalf("invalid JOB_SCHEDULES entry %q: use name=schedule", entry)
+			}
+			c.JobSchedules[strings.TrimSpace(name)] = strings.TrimSpace(spec)
+		}
+	}
+
+	c.BackupKeep = 7
+	if keep := os.Getenv("BACKUP_KEEP"); keep != "" {
+		n, err := strconv.Atoi(keep)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid BACKUP_KEEP %q", keep)
+		}
+		c.BackupKeep = n
+	}
+
+	c.BreakerThreshold = 5
+	if threshold := os.Getenv("BREAKER_THRESHOLD"); threshold != "" {
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid BREAKER_THRESHOLD %q", threshold)
+		}
+		c.BreakerThreshold = n
+	}
+
+	c.BreakerCooldown = 30 * time.Second
+	if cooldown := os.Getenv("BREAKER_COOLDOWN"); cooldown != "" {
+		d, err := time.ParseDuration(cooldown)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid BREAKER_COOLDOWN %q", cooldown)
+		}
+		c.BreakerCooldown = d
+	}
+
+	c.DeliveryAttempts = 3
+	if attempts := os.Getenv("DELIVERY_MAX_ATTEMPTS"); attempts != "" {
+		n, err := strconv.Atoi(attempts)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid DELIVERY_MAX_ATTEMPTS %q", attempts)
+		}
+		c.DeliveryAttempts = n
+	}
+
+	c.DeliveryBackoff, c.DeliveryTimeout = time.Second, integrationTimeout
+	for name, d := range map[string]*time.Duration{"DELIVERY_BACKOFF": &c.DeliveryBackoff, "DELIVERY_TIMEOUT": &c.DeliveryTimeout} {
+		if s := os.Getenv(name); s != "" {
+			parsed, err := time.ParseDuration(s)
+			if err != nil || parsed <= 0 {
+				log.Fatalf("invalid %s %q", name, s)
+			}
+			*d = parsed
+		}
+	}
+
+	c.DeliveryJitter = 0.2
+	if jitter := os.Getenv("DELIVERY_JITTER"); jitter != "" {
+		f, err := strconv.ParseFloat(jitter, 64)
+		if err != nil || f < 0 || f > 1 {
+			log.Fatalf("invalid DELIVERY_JITTER %q: use a fraction from 0 to 1", jitter)
+		}
+		c.DeliveryJitter = f
+	}
+
+	if c.DataDir == "" {
+		c.DataDir = "."
+	}
+	if c.DBPath == "" {
+		c.DBPath = "todos.db"
+	}
+	if c.AttachmentDir == "" {
+		c.AttachmentDir = "attachments"
+	}
+	if c.ArchivePath == "" {
+		c.ArchivePath = "archive.db"
+	}
+	c.DBPath = inDataDir(c.DataDir, c.DBPath)
+	c.ArchivePath = inDataDir(c.DataDir, c.ArchivePath)
+	c.AttachmentDir = inDataDir(c.DataDir, c.AttachmentDir)
+	if c.BackupDir != "" {
+		c.BackupDir = inDataDir(c.DataDir, c.BackupDir)
+	}
+
+	c.AttachmentMaxSize = 10 << 20
+	if size := os.Getenv("ATTACHMENT_MAX_SIZE"); size != "" {
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid ATTACHMENT_MAX_SIZE %q", size)
+		}
+		c.AttachmentMaxSize = n
+	}
+
+	for name, limit := range map[string]*int{"QUOTA_TODOS": &c.QuotaTodos, "QUOTA_FILTERS": &c.QuotaFilters} {
+		if s := os.Getenv(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				log.Fatalf("invalid %s %q", name, s)
+			}
+			*limit = n
+		}
+	}
+	if s := os.Getenv("QUOTA_ATTACHMENT_BYTES"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid QUOTA_ATTACHMENT_BYTES %q", s)
+		}
+		c.QuotaAttachmentBytes = n
+	}
+
+	c.AttachmentTypes = []string{"image/", "application/pdf", "text/plain"}
+	if types := os.Getenv("ATTACHMENT_TYPES"); types != "" {
+		c.AttachmentTypes = nil
+		for _, t := range strings.Split(types, ",") {
+			c.AttachmentTypes = append(c.AttachmentTypes, strings.TrimSpace(t))
+		}
+	}
+
+	c.ThumbnailSizes = map[string]int{"thumb": 256}
+	if sizes := os.Getenv("THUMBNAIL_SIZES"); sizes != "" {
+		c.ThumbnailSizes = make(map[string]int)
+		for _, entry := range strings.Split(sizes, ",") {
+			name, side, _ := strings.Cut(strings.TrimSpace(entry), "=")
+			n, err := strconv.Atoi(side)
+			if name == "" || strings.ContainsAny(name, `./\`) || err != nil || n <= 0 {
+				log.Fatalf("invalid THUMBNAIL_SIZES entry %q: use name=pixels", entry)
+			}
+			c.ThumbnailSizes[name] = n
+		}
+	}
+
+	if path := os.Getenv("ENCRYPTION_KEY_FILE"); path != "" && c.EncryptionKey == "" {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("invalid ENCRYPTION_KEY_FILE: %v", err)
+		}
+		c.EncryptionKey = strings.TrimSpace(string(key))
+	}
+	if keys := os.Getenv("ENCRYPTION_OLD_KEYS"); keys != "" {
+		for _, key := range strings.Split(keys, ",") {
+			c.EncryptionOldKeys = append(c.EncryptionOldKeys, strings.TrimSpace(key))
+		}
+	}
+
+	if c.VaultSecretPath == "" {
+		c.VaultSecretPath = "secret/data/todo-list-service"
+	}
+	c.VaultRefreshInterval = 5 * time.Minute
+	if interval := os.Getenv("VAULT_REFRESH_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid VAULT_REFRESH_INTERVAL %q", interval)
+		}
+		c.VaultRefreshInterval = d
+	}
+
+	if c.Port == "" {
+		c.Port = "8080"
+	}
+	if c.Listen == "" {
+		c.Listen = ":" + c.Port
+	}
+
+	c.CaptureBufferSize = 100
+	if size := os.Getenv("CAPTURE_BUFFER_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CAPTURE_BUFFER_SIZE %q", size)
+		}
+		c.CaptureBufferSize = n
+	}
+
+	c.ShutdownTimeout = 20 * time.Second
+	if timeout := os.Getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid SHUTDOWN_TIMEOUT %q", timeout)
+		}
+		c.ShutdownTimeout = d
+	}
+
+	c.SlowQueryThreshold = 100 * time.Millisecond
+	if threshold := os.Getenv("SLOW_QUERY_THRESHOLD"); threshold != "" {
+		d, err := time.ParseDuration(threshold)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid SLOW_QUERY_THRESHOLD %q", threshold)
+		}
+		c.SlowQueryThreshold = d
+	}
+
+	c.ShedWriteLatency, c.ShedRetryAfter = 500*time.Millisecond, 10*time.Second
+	for name, d := range map[string]*time.Duration{"SHED_WRITE_LATENCY": &c.ShedWriteLatency, "SHED_RETRY_AFTER": &c.ShedRetryAfter} {
+		if s := os.Getenv(name); s != "" {
+			parsed, err := time.ParseDuration(s)
+			if err != nil || parsed < 0 {
+				log.Fatalf("invalid %s %q", name, s)
+			}
+			*d = parsed
+		}
+	}
+	c.ShedWriteQueue = 64
+	if queue := os.Getenv("SHED_WRITE_QUEUE"); queue != "" {
+		n, err := strconv.Atoi(queue)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid SHED_WRITE_QUEUE %q", queue)
+		}
+		c.ShedWriteQueue = n
+	}
+
+	c.ExportRetention, c.ImportRetention = 24*time.Hour, 24*time.Hour
+	for name, d := range map[string]*time.Duration{"EXPORT_RETENTION": &c.ExportRetention, "IMPORT_RETENTION": &c.ImportRetention} {
+		if s := os.Getenv(name); s != "" {
+			parsed, err := time.ParseDuration(s)
+			if err != nil || parsed < 0 {
+				log.Fatalf("invalid %s %q", name, s)
+			}
+			*d = parsed
+		}
+	}
+
+	c.ClassLimits = map[string]ClassLimit{
+		classBatch: {Concurrency: 4, Rate: 2},
+		classAdmin: {Concurrency: 8},
+	}
+	if limits := os.Getenv("CLASS_LIMITS"); limits != "" {
+		if err := parseClassLimits(limits, c.ClassLimits); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		var err error
+		if c.TrustedProxies, err = parseTrustedProxies(proxies); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		var err error
+		if c.LogLevel, err = parseLogLevel(level); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return c
+}
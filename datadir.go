@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// inDataDir resolves path against dataDir unless it is absolute.
+func inDataDir(dataDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dataDir, path)
+}
+
+// prepareDataDir creates DATA_DIR and the directories the service writes
+// to that are missing, readable only by the service's user. Existing
+// directories, such as a mounted volume, keep their mode.
+func prepareDataDir() error {
+	dirs := []string{config.DataDir, filepath.Dir(config.DBPath)}
+	if config.ArchiveAfter > 0 {
+		dirs = append(dirs, filepath.Dir(config.ArchivePath))
+	}
+	if config.BackupDir != "" {
+		dirs = append(dirs, config.BackupDir)
+	}
+	if config.AttachmentStore == "disk" {
+		dirs = append(dirs, config.AttachmentDir)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInDataDir(t *testing.T) {
+	assert.Equal(t, "todos.db", inDataDir(".", "todos.db"))
+	assert.Equal(t, "/var/lib/todo/backups", inDataDir("/var/lib/todo", "backups"))
+	assert.Equal(t, "/mnt/backups", inDataDir("/var/lib/todo", "/mnt/backups"))
+}
+
+func TestPrepareDataDir(t *testing.T) {
+	previous := config
+	t.Cleanup(func() { config = previous })
+	dir := filepath.Join(t.TempDir(), "data")
+	config.DataDir = dir
+	config.DBPath = filepath.Join(dir, "db", "todos.db")
+	config.BackupDir = filepath.Join(dir, "backups")
+	config.AttachmentStore = "disk"
+	config.AttachmentDir = filepath.Join(dir, "attachments")
+
+	assert.NoError(t, prepareDataDir())
+	for _, path := range []string{dir, filepath.Dir(config.DBPath), config.BackupDir, config.AttachmentDir} {
+		info, err := os.Stat(path)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), path)
+		}
+	}
+}
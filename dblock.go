@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// dbGate is held shared by everything that uses db: requests, scheduled
+// jobs and queue workers. adminCompact holds it exclusively while it
+// swaps the database file, so nothing uses the handle it replaces.
+var dbGate sync.RWMutex
+
+// usingDB runs fn holding dbGate shared.
+func usingDB(fn func()) {
+	dbGate.RLock()
+	defer dbGate.RUnlock()
+	fn()
+}
+
+// dbGateMiddleware holds dbGate for the duration of a request, except for
+// the compaction that takes it exclusively.
+func dbGateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if routeName(r) == "/admin/compact" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		usingDB(func() { next.ServeHTTP(w, r) })
+	})
+}
+
+// openDB opens the database at path. If another process holds it for
+// longer than BOLT_TIMEOUT, it fails naming that process or, with wait,
+// logs and tries again until the lock is released.
+func openDB(path string, wait bool) (*bolt.DB, error) {
+	for {
+		opened, err := bolt.Open(path, 0600, boltOptions())
+		if err == nil && config.BatchDelay > 0 {
+			opened.MaxBatchDelay = config.BatchDelay
+		}
+		if !errors.Is(err, bolt.ErrTimeout) {
+			return opened, err
+		}
+		err = lockedError(path)
+		if !wait {
+			return nil, fmt.Errorf("%w: stop it, or start with --wait-for-db to wait for it", err)
+		}
+		warnf("%v, waiting for it", err)
+	}
+}
+
+// lockedError describes the lock on the database at path, naming the
+// process holding it where the platform tells.
+func lockedError(path string) error {
+	if pid := lockHolder(path); pid > 0 {
+		return fmt.Errorf("database %s is locked by PID %d (%w)", path, pid, bolt.ErrTimeout)
+	}
+	return fmt.Errorf("database %s is locked by another process (%w)", path, bolt.ErrTimeout)
+}
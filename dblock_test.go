@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestOpenDBLocked(t *testing.T) {
+	logs := withLogging(t, false, false)
+	config.BoltTimeout = 100 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "todos.db")
+
+	holder, err := openDB(path, false)
+	assert.NoError(t, err)
+
+	_, err = openDB(path, false)
+	assert.ErrorIs(t, err, bolt.ErrTimeout)
+	assert.Contains(t, err.Error(), "--wait-for-db")
+	if runtime.GOOS == "linux" {
+		assert.Contains(t, err.Error(), fmt.Sprintf("locked by PID %d", os.Getpid()))
+	}
+
+	// Waiting succeeds once the holder lets go.
+	go func() {
+		time.Sleep(250 * time.Millisecond)
+		holder.Close()
+	}()
+	waited, err := openDB(path, true)
+	if assert.NoError(t, err) {
+		waited.Close()
+	}
+	assert.Contains(t, logs.String(), "WARN database "+path+" is locked")
+}
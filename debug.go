@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// startedAt is when the process started, for the uptime in GET
+// /admin/runtime.
+var startedAt = time.Now()
+
+// debugHandler serves net/http/pprof under /debug/pprof/ and expvar at
+// /debug/vars. It is only served on DEBUG_ADDR, never on the API port.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// loopbackAddr checks that addr, such as 127.0.0.1:6060, only listens on
+// a loopback interface: profiles expose memory contents and stop the world.
+func loopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid DEBUG_ADDR %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("invalid DEBUG_ADDR %q: use a loopback address such as 127.0.0.1:6060", addr)
+	}
+	return nil
+}
+
+// listenDebug listens on DEBUG_ADDR for the debug endpoints.
+func listenDebug(addr string) (net.Listener, error) {
+	if err := loopbackAddr(addr); err != nil {
+		return nil, err
+	}
+	return net.Listen("tcp", addr)
+}
+
+// RuntimeStats is a snapshot of the process, as shown at GET /admin/runtime.
+type RuntimeStats struct {
+	GoVersion  string    `json:"goVersion"`
+	StartedAt  time.Time `json:"startedAt"`
+	Uptime     string    `json:"uptime"`
+	Goroutines int       `json:"goroutines"`
+	CPUs       int       `json:"cpus"`
+	Heap       HeapStats `json:"heap"`
+	Bolt       BoltStats `json:"bolt"`
+}
+
+type HeapStats struct {
+	AllocBytes   uint64     `json:"allocBytes"`
+	SysBytes     uint64     `json:"sysBytes"`
+	Objects      uint64     `json:"objects"`
+	GCRuns       uint32     `json:"gcRuns"`
+	GCPauseTotal string     `json:"gcPauseTotal"`
+	LastGC       *time.Time `json:"lastGc,omitempty"`
+}
+
+// BoltStats are the database's transaction and free page counters.
+type BoltStats struct {
+	Transactions   int `json:"transactions"`
+	OpenReadTxs    int `json:"openReadTxs"`
+	FreePages      int `json:"freePages"`
+	PendingPages   int `json:"pendingPages"`
+	FreeAllocBytes int `json:"freeAllocBytes"`
+	FreelistInuse  int `json:"freelistInuseBytes"`
+}
+
+func runtimeStats(now time.Time) RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	dbStats := db.Stats()
+
+	stats := RuntimeStats{
+		GoVersion:  runtime.Version(),
+		StartedAt:  startedAt.UTC(),
+		Uptime:     now.Sub(startedAt).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		CPUs:       runtime.NumCPU(),
+		Heap: HeapStats{
+			AllocBytes:   mem.HeapAlloc,
+			SysBytes:     mem.HeapSys,
+			Objects:      mem.HeapObjects,
+			GCRuns:       mem.NumGC,
+			GCPauseTotal: time.Duration(mem.PauseTotalNs).String(),
+		},
+		Bolt: BoltStats{
+			Transactions:   dbStats.TxN,
+			OpenReadTxs:    dbStats.OpenTxN,
+			FreePages:      dbStats.FreePageN,
+			PendingPages:   dbStats.PendingPageN,
+			FreeAllocBytes: dbStats.FreeAlloc,
+			FreelistInuse:  dbStats.FreelistInuse,
+		},
+	}
+	if mem.LastGC > 0 {
+		last := time.Unix(0, int64(mem.LastGC)).UTC()
+		stats.Heap.LastGC = &last
+	}
+	return stats
+}
+
+// getRuntime reports goroutines, heap and database stats of the running
+// process.
+func getRuntime(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runtimeStats(time.Now()))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopbackAddr(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:6060", "[::1]:6060", "localhost:6060"} {
+		assert.NoError(t, loopbackAddr(addr), addr)
+	}
+	for _, addr := range []string{":6060", "0.0.0.0:6060", "10.0.0.5:6060", "debug.internal:6060", "6060"} {
+		assert.Error(t, loopbackAddr(addr), addr)
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/vars"} {
+		w := httptest.NewRecorder()
+		debugHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	// Debug endpoints are not on the API router.
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetRuntime(t *testing.T) {
+	withAdminToken(t, "secret")
+	req := httptest.NewRequest(http.MethodGet, "/admin/runtime", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats RuntimeStats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.NotEmpty(t, stats.GoVersion)
+	assert.Positive(t, stats.Goroutines)
+	assert.Positive(t, stats.CPUs)
+	assert.NotZero(t, stats.Heap.AllocBytes)
+	assert.Positive(t, stats.Bolt.Transactions)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errDeliveryRejected is wrapped by delivery errors that retrying won't fix,
+// such as a destination refusing the request as invalid.
+var errDeliveryRejected = errors.New("rejected")
+
+// DeliveryStats counts the outbound deliveries to one destination, as shown
+// in the admin stats.
+type DeliveryStats struct {
+	Destination string     `json:"destination"`
+	Attempts    int        `json:"attempts"`
+	Delivered   int        `json:"delivered"`
+	Failed      int        `json:"failed"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+}
+
+var (
+	deliveryMu    sync.Mutex
+	deliveryStats = make(map[string]*DeliveryStats)
+	// sleep is a variable so tests can skip the backoff.
+	sleep = time.Sleep
+)
+
+// retryDelay is the wait before retry n, counting from 1: DELIVERY_BACKOFF
+// doubled for every earlier retry, give or take DELIVERY_JITTER of it.
+func retryDelay(n int) time.Duration {
+	d := config.DeliveryBackoff << (n - 1)
+	if config.DeliveryJitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * config.DeliveryJitter * float64(d))
+	}
+	return d
+}
+
+// deliver calls attempt until it succeeds, up to DELIVERY_MAX_ATTEMPTS
+// times, and counts the outcome against destination. Rejected deliveries
+// and open circuits are not retried.
+func deliver(destination string, attempt func() error) error {
+	attempts := max(config.DeliveryAttempts, 1)
+	var err error
+	for n := 1; n <= attempts; n++ {
+		if n > 1 {
+			delay := retryDelay(n - 1)
+			debugf("%s delivery failed, retrying in %s: %v", destination, delay, err)
+			sleep(delay)
+		}
+		err = attempt()
+		recordDelivery(destination, err)
+		if err == nil || errors.Is(err, errDeliveryRejected) || errors.Is(err, errCircuitOpen) {
+			break
+		}
+	}
+	return err
+}
+
+func recordDelivery(destination string, err error) {
+	deliveryMu.Lock()
+	defer deliveryMu.Unlock()
+	stats, ok := deliveryStats[destination]
+	if !ok {
+		stats = &DeliveryStats{Destination: destination}
+		deliveryStats[destination] = stats
+	}
+	stats.Attempts++
+	if err == nil {
+		stats.Delivered++
+		return
+	}
+	now := clock.Now().UTC()
+	stats.Failed++
+	stats.LastError = err.Error()
+	stats.LastFailure = &now
+}
+
+// deliveryCounters returns the delivery stats of every destination, by name.
+func deliveryCounters() []DeliveryStats {
+	deliveryMu.Lock()
+	defer deliveryMu.Unlock()
+	counters := make([]DeliveryStats, 0, len(deliveryStats))
+	for _, stats := range deliveryStats {
+		counters = append(counters, *stats)
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].Destination < counters[j].Destination })
+	return counters
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withDeliveries resets the delivery counters and records the backoff
+// instead of sleeping.
+func withDeliveries(t *testing.T, attempts int) *[]time.Duration {
+	var waits []time.Duration
+	previousStats, previousSleep, previousConfig := deliveryStats, sleep, config
+	deliveryStats = make(map[string]*DeliveryStats)
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	config.DeliveryAttempts, config.DeliveryBackoff, config.DeliveryJitter = attempts, time.Second, 0
+	t.Cleanup(func() { deliveryStats, sleep, config = previousStats, previousSleep, previousConfig })
+	return &waits
+}
+
+func TestRetryDelay(t *testing.T) {
+	withDeliveries(t, 3)
+	assert.Equal(t, time.Second, retryDelay(1))
+	assert.Equal(t, 4*time.Second, retryDelay(3))
+
+	config.DeliveryJitter = 0.5
+	for i := 0; i < 20; i++ {
+		d := retryDelay(2)
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.LessOrEqual(t, d, 3*time.Second)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	down := errors.New("connection reset")
+	tests := []struct {
+		name             string
+		errs             []error
+		expectedCalls    int
+		expectedErr      error
+		expectedWaits    []time.Duration
+		expectedFailures int
+	}{
+		{"first attempt", []error{nil}, 1, nil, nil, 0},
+		{"retried until delivered", []error{down, down, nil}, 3, nil, []time.Duration{time.Second, 2 * time.Second}, 2},
+		{"gives up", []error{down, down, down, down}, 3, down, []time.Duration{time.Second, 2 * time.Second}, 3},
+		{"rejected is not retried", []error{errDeliveryRejected, nil}, 1, errDeliveryRejected, nil, 1},
+		{"open circuit is not retried", []error{errCircuitOpen, nil}, 1, errCircuitOpen, nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits := withDeliveries(t, 3)
+			calls := 0
+			err := deliver("twilio", func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedCalls, calls)
+			assert.Equal(t, tt.expectedWaits, *waits)
+
+			stats := deliveryCounters()[0]
+			assert.Equal(t, tt.expectedCalls, stats.Attempts)
+			assert.Equal(t, tt.expectedFailures, stats.Failed)
+			assert.Equal(t, tt.expectedCalls-tt.expectedFailures, stats.Delivered)
+		})
+	}
+}
+
+func TestSendSMSRetries(t *testing.T) {
+	withTwilio(t)
+	withDeliveries(t, 3)
+	statuses := []int{http.StatusServiceUnavailable, http.StatusCreated}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[0])
+		if statuses[0] == http.StatusCreated {
+			w.Write([]byte(`{"sid":"SM1"}`))
+		} else {
+			w.Write([]byte(`{"message":"Try again"}`))
+		}
+		statuses = statuses[1:]
+	}))
+	defer server.Close()
+	twilioAPI = server.URL
+
+	sid, err := sendSMS("+15551234567", "Overdue: todo #1")
+	assert.NoError(t, err)
+	assert.Equal(t, "SM1", sid)
+
+	statuses = []int{http.StatusBadRequest, http.StatusCreated}
+	_, err = sendSMS("not a number", "Overdue: todo #1")
+	assert.ErrorIs(t, err, errDeliveryRejected)
+	assert.Len(t, statuses, 1, "a rejected text is not retried")
+
+	w := httptest.NewRecorder()
+	adminStats(w, httptest.NewRequest(http.MethodGet, "/admin/stats", nil))
+	var stats AdminStats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Len(t, stats.Deliveries, 1)
+	assert.Equal(t, "twilio", stats.Deliveries[0].Destination)
+	assert.Equal(t, 3, stats.Deliveries[0].Attempts)
+	assert.Equal(t, 1, stats.Deliveries[0].Delivered)
+	assert.Equal(t, 2, stats.Deliveries[0].Failed)
+	assert.Contains(t, stats.Deliveries[0].LastError, "400 Bad Request")
+	assert.NotNil(t, stats.Deliveries[0].LastFailure)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Dependencies are stored in both directions: blockedByBucket keys are
+// todo key + blocker key, blockingBucket keys are blocker key + todo key.
+var (
+	blockedByBucket = []byte("blockedBy")
+	blockingBucket  = []byte("blocking")
+)
+
+var (
+	errSelfDependency = errors.New("a todo can't block itself")
+	errDependencyLoop = errors.New("dependency would create a cycle")
+	errBlocked        = errors.New("todo is blocked by open todos")
+)
+
+// Blocker is a todo that another todo waits on.
+type Blocker struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+}
+
+func relatedIDs(b *bolt.Bucket, id int) []int {
+	var ids []int
+	prefix := itob(id)
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids = append(ids, int(binary.BigEndian.Uint64(k[len(prefix):])))
+	}
+	return ids
+}
+
+func blockerIDs(tx *bolt.Tx, id int) []int {
+	return relatedIDs(tx.Bucket(blockedByBucket), id)
+}
+
+// openBlockers returns the blockers of a todo that aren't completed yet.
+func openBlockers(tx *bolt.Tx, id int) ([]int, error) {
+	var open []int
+	for _, blockerID := range blockerIDs(tx, id) {
+		blocker, err := loadTodo(tx, blockerID)
+		if err != nil {
+			return nil, err
+		}
+		if blocker != nil && !blocker.Completed {
+			open = append(open, blockerID)
+		}
+	}
+	return open, nil
+}
+
+// checkCompletable fails with errBlocked when a todo that isn't completed
+// yet still has open blockers. Todos already completed can be edited freely.
+func checkCompletable(tx *bolt.Tx, id int) error {
+	old, err := loadTodo(tx, id)
+	if err != nil || (old != nil && old.Completed) {
+		return err
+	}
+	open, err := openBlockers(tx, id)
+	if err != nil {
+		return err
+	}
+	if len(open) > 0 {
+		return errBlocked
+	}
+	return nil
+}
+
+// reachable reports whether to can be reached from from by following
+// blocked-by edges.
+func reachable(tx *bolt.Tx, from, to int) bool {
+	seen := map[int]bool{from: true}
+	queue := []int{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			return true
+		}
+		for _, next := range blockerIDs(tx, id) {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
+
+func addDependency(tx *bolt.Tx, id, blockerID int) error {
+	if id == blockerID {
+		return errSelfDependency
+	}
+	for _, todoID := range []int{id, blockerID} {
+		todo, err := loadTodo(tx, todoID)
+		if err != nil {
+			return err
+		}
+		if todo == nil {
+			return errTodoNotFound
+		}
+	}
+	// The new edge closes a loop if id is already upstream of blockerID.
+	if reachable(tx, blockerID, id) {
+		return errDependencyLoop
+	}
+
+	if err := tx.Bucket(blockedByBucket).Put(append(itob(id), itob(blockerID)...), nil); err != nil {
+		return err
+	}
+	return tx.Bucket(blockingBucket).Put(append(itob(blockerID), itob(id)...), nil)
+}
+
+func removeDependency(tx *bolt.Tx, id, blockerID int) error {
+	if err := tx.Bucket(blockedByBucket).Delete(append(itob(id), itob(blockerID)...)); err != nil {
+		return err
+	}
+	return tx.Bucket(blockingBucket).Delete(append(itob(blockerID), itob(id)...))
+}
+
+// removeDependencies drops every dependency a deleted todo takes part in.
+func removeDependencies(tx *bolt.Tx, id int) error {
+	for _, blockerID := range blockerIDs(tx, id) {
+		if err := removeDependency(tx, id, blockerID); err != nil {
+			return err
+		}
+	}
+	for _, blockedID := range relatedIDs(tx.Bucket(blockingBucket), id) {
+		if err := removeDependency(tx, blockedID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dependencyError(w http.ResponseWriter, err error) {
+	switch err {
+	case errTodoNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errSelfDependency:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errDependencyLoop, errBlocked:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func getBlockers(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	blockers := []Blocker{}
+	err = db.View(func(tx *bolt.Tx) error {
+		todo, err := loadTodo(tx, id)
+		if err != nil {
+			return err
+		}
+		if todo == nil {
+			return errTodoNotFound
+		}
+		for _, blockerID := range blockerIDs(tx, id) {
+			blocker, err := loadTodo(tx, blockerID)
+			if err != nil {
+				return err
+			}
+			blockers = append(blockers, Blocker{ID: blocker.ID, Title: blocker.Title, Completed: blocker.Completed})
+		}
+		return nil
+	})
+	if err != nil {
+		dependencyError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(blockers)
+}
+
+// addBlocker declares that the todo is blocked by the todo in the body:
+// {"id": <blocker ID>}.
+func addBlocker(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = writeTx(func(tx *bolt.Tx) error {
+		return addDependency(tx, id, input.ID)
+	})
+	if err != nil {
+		dependencyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteBlocker(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	blockerID, err := strconv.Atoi(vars["blockerID"])
+	if err != nil {
+		http.Error(w, "Invalid blocker ID", http.StatusBadRequest)
+		return
+	}
+
+	err = writeTx(func(tx *bolt.Tx) error {
+		return removeDependency(tx, id, blockerID)
+	})
+	if err != nil {
+		dependencyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
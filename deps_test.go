@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockers(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for i := 1; i <= 3; i++ {
+		payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Todo %d", i)})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "1 blocked by 2",
+			method:         http.MethodPost,
+			url:            "/todos/1/blockers",
+			body:           `{"id":2}`,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "2 blocked by 3",
+			method:         http.MethodPost,
+			url:            "/todos/2/blockers",
+			body:           `{"id":3}`,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "cycle",
+			method:         http.MethodPost,
+			url:            "/todos/3/blockers",
+			body:           `{"id":1}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "self",
+			method:         http.MethodPost,
+			url:            "/todos/1/blockers",
+			body:           `{"id":1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing blocker",
+			method:         http.MethodPost,
+			url:            "/todos/1/blockers",
+			body:           `{"id":99}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "complete while blocked",
+			method:         http.MethodPut,
+			url:            "/todos/1",
+			body:           `{"title":"Todo 1","completed":true}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "complete blocker",
+			method:         http.MethodPut,
+			url:            "/todos/2",
+			body:           `{"title":"Todo 2","completed":true}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "force complete blocker",
+			method:         http.MethodPut,
+			url:            "/todos/2?force=true",
+			body:           `{"title":"Todo 2","completed":true}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "complete once unblocked",
+			method:         http.MethodPut,
+			url:            "/todos/1",
+			body:           `{"title":"Todo 1","completed":true}`,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1/blockers", nil))
+
+	var blockers []Blocker
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &blockers))
+	assert.Equal(t, []Blocker{{ID: 2, Title: "Todo 2", Completed: true}}, blockers)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/todos/2", nil))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1/blockers", nil))
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	maxSeedCount  = 100000
+	seedBatchSize = 1000
+)
+
+var (
+	seedVerbs = []string{
+		"Buy", "Call", "Email", "Fix", "Review", "Schedule", "Clean", "Pay",
+		"Plan", "Book", "Update", "Renew", "Organize", "Return", "Prepare",
+	}
+	seedObjects = []string{
+		"groceries", "the dentist", "the landlord", "the kitchen sink",
+		"quarterly report", "team meeting", "the garage", "electricity bill",
+		"weekend trip", "flight tickets", "resume", "passport", "closet",
+		"library books", "presentation slides", "car insurance", "birthday gift",
+	}
+)
+
+// requireDevMode hides development-only routes unless DEV_MODE is enabled.
+func requireDevMode(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.DevMode {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func fakeTodo(rng *rand.Rand) Todo {
+	verb := seedVerbs[rng.Intn(len(seedVerbs))]
+	object := seedObjects[rng.Intn(len(seedObjects))]
+	return Todo{
+		Title:     fmt.Sprintf("%s %s", verb, object),
+		Completed: rng.Intn(4) == 0,
+	}
+}
+
+// seedTodos inserts count generated todos, committing every seedBatchSize
+// records so a large seed doesn't hold one huge write transaction.
+func seedTodos(count int, rng *rand.Rand) error {
+	for created := 0; created < count; {
+		batch := seedBatchSize
+		if remaining := count - created; remaining < batch {
+			batch = remaining
+		}
+
+		err := db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(todosBucket)
+			for i := 0; i < batch; i++ {
+				todo := fakeTodo(rng)
+				id, _ := b.NextSequence()
+				todo.ID = int(id)
+
+				if err := todoService.saveExternal(tx, nil, &todo); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		created += batch
+	}
+	return nil
+}
+
+func adminSeed(w http.ResponseWriter, r *http.Request) {
+	count := 100
+	if countStr := r.URL.Query().Get("count"); countStr != "" {
+		c, err := strconv.Atoi(countStr)
+		if err != nil || c <= 0 || c > maxSeedCount {
+			http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxSeedCount), http.StatusBadRequest)
+			return
+		}
+		count = c
+	}
+
+	rng := rand.New(rand.NewSource(rand.Int63()))
+	if err := seedTodos(count, rng); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"created": count})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withDevMode(t *testing.T, enabled bool) {
+	previous := config.DevMode
+	config.DevMode = enabled
+	t.Cleanup(func() { config.DevMode = previous })
+}
+
+func TestAdminSeed(t *testing.T) {
+	tests := []struct {
+		name           string
+		devMode        bool
+		count          string
+		expectedStatus int
+		expectedTotal  int
+	}{
+		{
+			name:           "dev mode disabled",
+			devMode:        false,
+			count:          "10",
+			expectedStatus: http.StatusNotFound,
+			expectedTotal:  0,
+		},
+		{
+			name:           "seed across several batches",
+			devMode:        true,
+			count:          "2500",
+			expectedStatus: http.StatusCreated,
+			expectedTotal:  2500,
+		},
+		{
+			name:           "invalid count",
+			devMode:        true,
+			count:          "abc",
+			expectedStatus: http.StatusBadRequest,
+			expectedTotal:  0,
+		},
+		{
+			name:           "count above maximum",
+			devMode:        true,
+			count:          fmt.Sprint(maxSeedCount + 1),
+			expectedStatus: http.StatusBadRequest,
+			expectedTotal:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearBucket(t)
+			withDevMode(t, tt.devMode)
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/seed?count="+tt.count, nil)
+			w := httptest.NewRecorder()
+
+			requireDevMode(adminSeed)(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			req = httptest.NewRequest(http.MethodGet, "/todos?limit=1", nil)
+			w = httptest.NewRecorder()
+			getTodos(w, req)
+
+			var response PaginatedResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTotal, response.TotalItems)
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// sealedPrefix starts every encrypted value. JSON never starts with a zero
+// byte, so values written before encryption was enabled still read as
+// plaintext.
+const sealedPrefix = 0
+
+const keyIDSize = 4
+
+// plainValueBuckets hold values that aren't written through the codec, such
+// as user names, so they are never sealed. Blobs aren't either, but are
+// sealed by their store and resealed by resealBlobs.
+var plainValueBuckets = [][]byte{attachmentBlobsBucket, caldavNamesBucket, feedTokensBucket, indexesBucket, smsRemindedBucket, syncMetaBucket}
+
+// encryptedCodec seals what its Codec marshals with AES-GCM before it is
+// stored, so the database file holds no plaintext todos. Values are opened
+// with whichever key sealed them, so old keys keep working until every value
+// has been re-encrypted. Encoders write responses and stay plaintext.
+type encryptedCodec struct {
+	Codec
+	key  []byte
+	keys map[string]cipher.AEAD
+}
+
+// parseEncryptionKey decodes a base64 AES-256 key.
+func parseEncryptionKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("encryption keys must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// keyID identifies a key in the values it sealed without revealing it.
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:keyIDSize]
+}
+
+// newEncryptedCodec wraps inner to seal values with key, and to open values
+// sealed with key or any of oldKeys. Without a key it returns inner.
+func newEncryptedCodec(inner Codec, key string, oldKeys []string) (Codec, error) {
+	if key == "" {
+		return inner, nil
+	}
+	c := encryptedCodec{Codec: inner, keys: make(map[string]cipher.AEAD)}
+	for i, s := range append([]string{key}, oldKeys...) {
+		k, err := parseEncryptionKey(s)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			c.key = keyID(k)
+		}
+		c.keys[string(keyID(k))] = aead
+	}
+	return c, nil
+}
+
+// plainCodec returns the codec that encodes values for responses.
+func plainCodec() Codec {
+	if c, ok := codec.(encryptedCodec); ok {
+		return c.Codec
+	}
+	return codec
+}
+
+func isSealed(v []byte) bool {
+	return len(v) > 0 && v[0] == sealedPrefix
+}
+
+// seal encrypts plaintext as prefix, key ID, nonce and ciphertext.
+func (c encryptedCodec) seal(plaintext []byte) ([]byte, error) {
+	aead := c.keys[string(c.key)]
+	out := make([]byte, 1+keyIDSize+aead.NonceSize(), 1+keyIDSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = sealedPrefix
+	copy(out[1:], c.key)
+	nonce := out[1+keyIDSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plaintext, out[:1+keyIDSize]), nil
+}
+
+// open decrypts a sealed value; anything else is returned as it is.
+func (c encryptedCodec) open(v []byte) ([]byte, error) {
+	if !isSealed(v) {
+		return v, nil
+	}
+	if len(v) < 1+keyIDSize {
+		return nil, errors.New("truncated encrypted value")
+	}
+	aead, ok := c.keys[string(v[1:1+keyIDSize])]
+	if !ok {
+		return nil, fmt.Errorf("value encrypted with unknown key %x", v[1:1+keyIDSize])
+	}
+	if len(v) < 1+keyIDSize+aead.NonceSize() {
+		return nil, errors.New("truncated encrypted value")
+	}
+	nonce := v[1+keyIDSize : 1+keyIDSize+aead.NonceSize()]
+	return aead.Open(nil, nonce, v[1+keyIDSize+aead.NonceSize():], v[:1+keyIDSize])
+}
+
+// sealBlob encrypts blob contents when ENCRYPTION_KEY is set.
+func sealBlob(data []byte) ([]byte, error) {
+	c, ok := codec.(encryptedCodec)
+	if !ok {
+		return data, nil
+	}
+	return c.seal(data)
+}
+
+// openBlob decrypts blob contents when ENCRYPTION_KEY is set. Blobs can
+// start with a zero byte before they are sealed, so only values carrying a
+// known key ID are opened; anything else was stored before encryption was
+// enabled and is returned as it is.
+func openBlob(v []byte) ([]byte, error) {
+	c, ok := codec.(encryptedCodec)
+	if !ok || !c.sealedBlob(v) {
+		return v, nil
+	}
+	return c.open(v)
+}
+
+func (c encryptedCodec) sealedBlob(v []byte) bool {
+	if !isSealed(v) || len(v) < 1+keyIDSize {
+		return false
+	}
+	_, ok := c.keys[string(v[1:1+keyIDSize])]
+	return ok
+}
+
+func (c encryptedCodec) Marshal(v interface{}) ([]byte, error) {
+	buf, err := c.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.seal(buf)
+}
+
+func (c encryptedCodec) Unmarshal(data []byte, v interface{}) error {
+	buf, err := c.open(data)
+	if err != nil {
+		return err
+	}
+	return c.Codec.Unmarshal(buf, v)
+}
+
+// reseal returns v sealed with the current key, and whether it changed.
+// Plaintext JSON is sealed too, so re-encryption also encrypts values
+// written before encryption was enabled.
+func (c encryptedCodec) reseal(v []byte) ([]byte, bool, error) {
+	if isSealed(v) && len(v) > keyIDSize && bytes.Equal(v[1:1+keyIDSize], c.key) {
+		return v, false, nil
+	}
+	if !isSealed(v) && !json.Valid(v) {
+		return v, false, nil
+	}
+	plaintext, err := c.open(v)
+	if err != nil {
+		return nil, false, err
+	}
+	buf, err := c.seal(plaintext)
+	return buf, err == nil, err
+}
+
+// resealBucket re-encrypts the values of b and its nested buckets, and
+// returns how many changed.
+func (c encryptedCodec) resealBucket(b *bolt.Bucket) (int, error) {
+	updated := make(map[string][]byte)
+	var nested [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			if b.Bucket(k) != nil {
+				nested = append(nested, k)
+			}
+			return nil
+		}
+		buf, changed, err := c.reseal(v)
+		if changed {
+			updated[string(k)] = buf
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for k, buf := range updated {
+		if err := b.Put([]byte(k), buf); err != nil {
+			return 0, err
+		}
+	}
+	n := len(updated)
+	for _, k := range nested {
+		m, err := c.resealBucket(b.Bucket(k))
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// reencrypt seals every stored value with the current key, in the database
+// and the archive, and returns how many values changed. Run it after
+// rotating ENCRYPTION_KEY, with the old key in ENCRYPTION_OLD_KEYS.
+func reencrypt() (int, error) {
+	c, ok := codec.(encryptedCodec)
+	if !ok {
+		return 0, errors.New("set ENCRYPTION_KEY to re-encrypt")
+	}
+
+	total, err := c.resealFile(db)
+	if err != nil {
+		return total, err
+	}
+	n, err := c.resealBlobs()
+	total += n
+	if err != nil || archiveDB == nil {
+		return total, err
+	}
+	n, err = c.resealFile(archiveDB)
+	if err != nil {
+		err = fmt.Errorf("archive: %w", err)
+	}
+	return total + n, err
+}
+
+// resealFile reseals the values of one bolt file, one top-level bucket per
+// transaction.
+func (c encryptedCodec) resealFile(d *bolt.DB) (int, error) {
+	var names [][]byte
+	err := d.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			for _, plain := range plainValueBuckets {
+				if bytes.Equal(name, plain) {
+					return nil
+				}
+			}
+			names = append(names, append([]byte(nil), name...))
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, name := range names {
+		var n int
+		err := d.Update(func(tx *bolt.Tx) error {
+			var err error
+			n, err = c.resealBucket(tx.Bucket(name))
+			return err
+		})
+		if err != nil {
+			return total, fmt.Errorf("bucket %s: %w", name, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// resealBlobs seals the blobs kept in the database with the current key,
+// including ones stored before encryption was enabled.
+func (c encryptedCodec) resealBlobs() (int, error) {
+	n := 0
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(attachmentBlobsBucket)
+		updated := make(map[string][]byte)
+		err := b.ForEach(func(k, v []byte) error {
+			if c.sealedBlob(v) && bytes.Equal(v[1:1+keyIDSize], c.key) {
+				return nil
+			}
+			plaintext, err := openBlob(v)
+			if err != nil {
+				return err
+			}
+			buf, err := c.seal(plaintext)
+			updated[string(k)] = buf
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for k, buf := range updated {
+			if err := b.Put([]byte(k), buf); err != nil {
+				return err
+			}
+		}
+		n = len(updated)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("bucket %s: %w", attachmentBlobsBucket, err)
+	}
+	return n, err
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestKey(t *testing.T) string {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func withEncryption(t *testing.T, key string, oldKeys ...string) encryptedCodec {
+	c, err := newEncryptedCodec(stdCodec{}, key, oldKeys)
+	assert.NoError(t, err)
+	withCodec(t, c)
+	return c.(encryptedCodec)
+}
+
+// rawValues returns every stored value of a bucket and its nested buckets.
+func rawValues(t *testing.T, name []byte) [][]byte {
+	var values [][]byte
+	var walk func(b *bolt.Bucket)
+	walk = func(b *bolt.Bucket) {
+		b.ForEach(func(k, v []byte) error {
+			if nested := b.Bucket(k); nested != nil {
+				walk(nested)
+			} else if len(v) > 0 {
+				values = append(values, append([]byte(nil), v...))
+			}
+			return nil
+		})
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		walk(tx.Bucket(name))
+		return nil
+	})
+	assert.NoError(t, err)
+	return values
+}
+
+func TestEncryptedCodec(t *testing.T) {
+	oldKey, key := newTestKey(t), newTestKey(t)
+	old, err := newEncryptedCodec(stdCodec{}, oldKey, nil)
+	assert.NoError(t, err)
+	c, err := newEncryptedCodec(stdCodec{}, key, []string{oldKey})
+	assert.NoError(t, err)
+
+	todo := Todo{ID: 1, Title: "Call the bank"}
+	sealed, err := c.Marshal(todo)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), "Call the bank")
+	again, _ := c.Marshal(todo)
+	assert.NotEqual(t, sealed, again, "each value gets its own nonce")
+
+	var decoded Todo
+	assert.NoError(t, c.Unmarshal(sealed, &decoded))
+	assert.Equal(t, todo, decoded)
+
+	// Values sealed with an old key, and plaintext, still read.
+	sealedWithOld, _ := old.Marshal(todo)
+	decoded = Todo{}
+	assert.NoError(t, c.Unmarshal(sealedWithOld, &decoded))
+	assert.Equal(t, todo, decoded)
+	decoded = Todo{}
+	assert.NoError(t, c.Unmarshal([]byte(`{"id":1,"title":"Call the bank"}`), &decoded))
+	assert.Equal(t, todo, decoded)
+
+	// Without the key, or after tampering, they don't.
+	assert.Error(t, old.Unmarshal(sealed, &decoded))
+	sealed[len(sealed)-1] ^= 1
+	assert.Error(t, c.Unmarshal(sealed, &decoded))
+
+	noKey, err := newEncryptedCodec(stdCodec{}, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, stdCodec{}, noKey)
+	for _, bad := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		_, err := newEncryptedCodec(stdCodec{}, bad, nil)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestEncryptionAtRest(t *testing.T) {
+	clearBucket(t)
+	withEncryption(t, newTestKey(t))
+	router := setupRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"title":"Call the bank"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	for _, bucket := range [][]byte{todosBucket, changesBucket} {
+		values := rawValues(t, bucket)
+		assert.NotEmpty(t, values)
+		for _, v := range values {
+			assert.True(t, isSealed(v))
+			assert.NotContains(t, string(v), "Call the bank")
+		}
+	}
+
+	// Responses are plaintext, with or without a field selection.
+	for _, url := range []string{"/todos", "/todos?fields=id,title"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"title":"Call the bank"`, url)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	todo := saveTodo(t, Todo{Title: "Call the bank"})
+	comment := httptest.NewRequest(http.MethodPost, "/todos/"+strconv.Itoa(todo.ID)+"/comments", strings.NewReader(`{"body":"Before noon"}`))
+	comment.Header.Set(userHeader, "alice")
+	router.ServeHTTP(httptest.NewRecorder(), comment)
+	// Values not written through the codec stay as they are, even if they
+	// look like JSON.
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(feedTokensBucket).Put([]byte("token"), []byte(`"alice"`))
+	})
+
+	_, err := reencrypt()
+	assert.Error(t, err, "needs a key")
+
+	// The first run encrypts what was written before encryption.
+	oldKey := newTestKey(t)
+	withEncryption(t, oldKey)
+	n, err := reencrypt()
+	assert.NoError(t, err)
+	assert.Greater(t, n, 2)
+	for _, bucket := range [][]byte{todosBucket, changesBucket, commentsBucket} {
+		for _, v := range rawValues(t, bucket) {
+			assert.True(t, isSealed(v), string(bucket))
+		}
+	}
+	assert.Equal(t, [][]byte{[]byte(`"alice"`)}, rawValues(t, feedTokensBucket))
+
+	n, err = reencrypt()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// After a rotation, the old key is only needed until the run.
+	key := newTestKey(t)
+	rotated := withEncryption(t, key, oldKey)
+	before := rawValues(t, todosBucket)
+	_, err = reencrypt()
+	assert.NoError(t, err)
+	for _, v := range rawValues(t, todosBucket) {
+		assert.True(t, bytes.Equal(v[1:1+keyIDSize], rotated.key))
+	}
+	assert.NotEqual(t, before, rawValues(t, todosBucket))
+
+	withEncryption(t, key)
+	assert.Equal(t, []string{"Call the bank"}, localTitles(t))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/"+strconv.Itoa(todo.ID)+"/comments", nil))
+	assert.Contains(t, w.Body.String(), "Before noon")
+}
+
+func TestEncryptedBlobs(t *testing.T) {
+	clearBucket(t)
+	// Blobs stored before encryption may be binary and start with a zero byte.
+	legacy := map[string][]byte{"notes": []byte("Call the bank"), "binary": {0, 1, 2, 3, 4, 5}}
+	for k, data := range legacy {
+		assert.NoError(t, blobs.put(k, data))
+	}
+
+	oldKey := newTestKey(t)
+	withEncryption(t, oldKey)
+	for k, data := range legacy {
+		got, err := blobs.get(k)
+		assert.NoError(t, err)
+		assert.Equal(t, data, got, k)
+	}
+
+	assert.NoError(t, blobs.put("export", []byte("Secret plan")))
+	for _, v := range rawValues(t, attachmentBlobsBucket) {
+		assert.NotContains(t, string(v), "Secret plan")
+	}
+	got, err := blobs.get("export")
+	assert.NoError(t, err)
+	assert.Equal(t, "Secret plan", string(got))
+
+	// Re-encryption seals the blobs stored before encryption, and those
+	// sealed with a rotated key.
+	n, err := reencrypt()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	rotated := withEncryption(t, newTestKey(t), oldKey)
+	n, err = reencrypt()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	for _, v := range rawValues(t, attachmentBlobsBucket) {
+		assert.True(t, bytes.Equal(v[1:1+keyIDSize], rotated.key))
+		assert.NotContains(t, string(v), "Call the bank")
+	}
+	for k, data := range legacy {
+		got, err := blobs.get(k)
+		assert.NoError(t, err)
+		assert.Equal(t, data, got, k)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxErrorBody caps how much of a 5xx response is kept as the error message.
+const maxErrorBody = 1 << 10
+
+// sentryClient sends error events to Sentry's envelope endpoint.
+type sentryClient struct {
+	dsn      string
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+// errorTracker is nil unless SENTRY_DSN is set.
+var errorTracker *sentryClient
+
+// newSentryClient parses a DSN of the form
+// https://<key>@<host>/<project>.
+func newSentryClient(dsn string) (*sentryClient, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: use https://<key>@<host>/<project>")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: no project ID")
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:slash], project)
+	return &sentryClient{
+		dsn:      dsn,
+		endpoint: endpoint,
+		key:      u.User.Username(),
+		client:   withBreaker("sentry", &http.Client{Timeout: config.DeliveryTimeout}),
+	}, nil
+}
+
+// SentryEvent is the part of Sentry's event payload the service fills in.
+type SentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   time.Time              `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Environment string                 `json:"environment,omitempty"`
+	Message     string                 `json:"message"`
+	Request     SentryRequest          `json:"request"`
+	User        *SentryUser            `json:"user,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+type SentryRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type SentryUser struct {
+	ID string `json:"id"`
+}
+
+// requestEvent describes an error while serving r. Under LOG_REDACTION the
+// path is the route template and the user a hash, as in the access log.
+func requestEvent(r *http.Request, message string) (SentryEvent, error) {
+	id, err := randomToken()
+	if err != nil {
+		return SentryEvent{}, err
+	}
+	event := SentryEvent{
+		EventID:     id[:32],
+		Timestamp:   time.Now().UTC(),
+		Level:       "error",
+		Platform:    "go",
+		Environment: config.SentryEnvironment,
+		Message:     message,
+		Request:     SentryRequest{Method: r.Method, URL: r.URL.Path},
+		Tags:        map[string]string{},
+	}
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			event.Tags["route"] = tmpl
+			if config.LogRedaction || strings.Contains(tmpl, "{token}") {
+				event.Request.URL = tmpl
+			}
+		}
+	}
+	if user := userFromRequest(r); user != "" {
+		event.User = &SentryUser{ID: redactUser(user)}
+	}
+	return event, nil
+}
+
+// capture sends event in the background under the delivery policy.
+func (c *sentryClient) capture(event SentryEvent) {
+	go func() {
+		err := deliver("sentry", func() error { return c.send(event) })
+		if err != nil {
+			warnf("reporting error %s to Sentry: %v", event.EventID, err)
+		}
+	}()
+}
+
+func (c *sentryClient) send(event SentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	header, _ := json.Marshal(map[string]string{"event_id": event.EventID, "dsn": c.dsn})
+	var body bytes.Buffer
+	body.Write(header)
+	body.WriteString("\n{\"type\":\"event\"}\n")
+	body.Write(payload)
+	body.WriteString("\n")
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=todo-list-service/1.0, sentry_key="+c.key)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("Sentry answered %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("Sentry answered %s (%w)", resp.Status, errDeliveryRejected)
+	}
+	return nil
+}
+
+// errorRecorder keeps the start of 5xx response bodies, which hold the
+// error message written by http.Error.
+type errorRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+}
+
+func (r *errorRecorder) Write(p []byte) (int, error) {
+	if r.status >= 500 && r.body.Len() < maxErrorBody {
+		r.body.Write(p[:min(len(p), maxErrorBody-r.body.Len())])
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// errorTrackingMiddleware reports handler panics and 5xx responses to
+// Sentry when SENTRY_DSN is set. Panics are re-raised, so net/http still
+// logs them and drops the connection.
+func errorTrackingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracker := errorTracker
+		if tracker == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &errorRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		defer func() {
+			if v := recover(); v != nil {
+				if err, ok := v.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
+					message := fmt.Sprint(v)
+					if config.LogRedaction {
+						message = fmt.Sprintf("%T", v)
+					}
+					if event, err := requestEvent(r, "panic: "+message); err == nil {
+						event.Extra = map[string]interface{}{"stack": string(debug.Stack())}
+						tracker.capture(event)
+					}
+				}
+				panic(v)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= 500 {
+			message := fmt.Sprintf("%d %s", rec.status, http.StatusText(rec.status))
+			if body := strings.TrimSpace(rec.body.String()); body != "" && !config.LogRedaction {
+				message += ": " + body
+			}
+			if event, err := requestEvent(r, message); err == nil {
+				event.Tags["status"] = fmt.Sprint(rec.status)
+				tracker.capture(event)
+			}
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// withSentry points error tracking at a fake Sentry and returns the events
+// it receives.
+func withSentry(t *testing.T) <-chan SentryEvent {
+	received := make(chan SentryEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/42/envelope/", r.URL.Path)
+		assert.Contains(t, r.Header.Get("X-Sentry-Auth"), "sentry_key=public")
+		lines := bufio.NewScanner(r.Body)
+		var items []string
+		for lines.Scan() {
+			items = append(items, lines.Text())
+		}
+		assert.Len(t, items, 3)
+		assert.JSONEq(t, `{"type":"event"}`, items[1])
+		var event SentryEvent
+		assert.NoError(t, json.Unmarshal([]byte(items[2]), &event))
+		received <- event
+	}))
+	t.Cleanup(server.Close)
+
+	previous, previousConfig := errorTracker, config
+	tracker, err := newSentryClient(strings.Replace(server.URL, "http://", "http://public@", 1) + "/42")
+	assert.NoError(t, err)
+	errorTracker = tracker
+	config.SentryEnvironment = "test"
+	t.Cleanup(func() { errorTracker, config = previous, previousConfig })
+	return received
+}
+
+func nextEvent(t *testing.T, received <-chan SentryEvent) SentryEvent {
+	select {
+	case event := <-received:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event reached Sentry")
+		return SentryEvent{}
+	}
+}
+
+func TestNewSentryClient(t *testing.T) {
+	c, err := newSentryClient("https://abc123@o1.ingest.sentry.io/4505")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://o1.ingest.sentry.io/api/4505/envelope/", c.endpoint)
+	assert.Equal(t, "abc123", c.key)
+
+	c, err = newSentryClient("https://abc123@sentry.example.com/errors/7")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://sentry.example.com/errors/api/7/envelope/", c.endpoint)
+
+	for _, dsn := range []string{"sentry.example.com/7", "https://sentry.example.com/7", "https://abc123@sentry.example.com/"} {
+		_, err := newSentryClient(dsn)
+		assert.Error(t, err, dsn)
+	}
+}
+
+func TestErrorTracking(t *testing.T) {
+	received := withSentry(t)
+	router := mux.NewRouter()
+	router.Use(errorTrackingMiddleware)
+	router.HandleFunc("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not open", http.StatusInternalServerError)
+	})
+	router.HandleFunc("/todos/{id}/clone", func(w http.ResponseWriter, r *http.Request) {
+		panic("index out of range")
+	})
+	router.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	request := func(url string) {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set(userHeader, "alice")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	request("/ok")
+	request("/todos/7")
+	event := nextEvent(t, received)
+	assert.Equal(t, "500 Internal Server Error: database not open", event.Message)
+	assert.Equal(t, SentryRequest{Method: http.MethodGet, URL: "/todos/7"}, event.Request)
+	assert.Equal(t, "alice", event.User.ID)
+	assert.Equal(t, map[string]string{"route": "/todos/{id}", "status": "500"}, event.Tags)
+	assert.Equal(t, "test", event.Environment)
+	assert.Len(t, event.EventID, 32)
+
+	assert.Panics(t, func() { request("/todos/7/clone") })
+	event = nextEvent(t, received)
+	assert.Equal(t, "panic: index out of range", event.Message)
+	assert.Contains(t, event.Extra["stack"], "runtime/debug.Stack")
+
+	// Redaction keeps paths, users and messages out, as in the log.
+	config.LogRedaction = true
+	request("/todos/7")
+	event = nextEvent(t, received)
+	assert.Equal(t, "500 Internal Server Error", event.Message)
+	assert.Equal(t, "/todos/{id}", event.Request.URL)
+	assert.Equal(t, redactUser("alice"), event.User.ID)
+
+	assert.Panics(t, func() { request("/todos/7/clone") })
+	event = nextEvent(t, received)
+	assert.Equal(t, "panic: string", event.Message)
+
+	select {
+	case event := <-received:
+		t.Fatalf("unexpected event %q", event.Message)
+	default:
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "sync"
+
+const (
+	EventTodoCreated = "todo.created"
+	EventTodoUpdated = "todo.updated"
+	EventTodoDeleted = "todo.deleted"
+)
+
+// Event describes a committed change to a todo. For deletions Todo holds the
+// last stored version; for updates Previous holds the version replaced.
+type Event struct {
+	Type     string
+	Todo     Todo
+	Previous *Todo
+}
+
+// eventBus delivers events synchronously, in publish order, to every
+// subscriber. Handlers run on the publishing goroutine and must be quick.
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers []func(Event)
+}
+
+var events = &eventBus{}
+
+func (b *eventBus) subscribe(handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *eventBus) publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(e)
+	}
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// userExportsBucket holds each user's latest requested export, keyed by user
+// name. The archive itself is kept in the blob store.
+var userExportsBucket = []byte("userExports")
+
+// userExportQueue holds users whose export is to be built, so large
+// accounts don't tie up a request.
+var userExportQueue = make(chan string, 100)
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+const userExportFilename = "todo-export.zip"
+
+// UserExport is the state of a user's export archive.
+type UserExport struct {
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	Size        int        `json:"size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"downloadUrl,omitempty"`
+}
+
+type storedUserExport struct {
+	UserExport
+	Blob string `json:"blob,omitempty"`
+}
+
+// UserProfile is what an export holds about the user themselves.
+type UserProfile struct {
+	User         string      `json:"user"`
+	Preferences  Preferences `json:"preferences"`
+	Achievements UserStats   `json:"achievements"`
+}
+
+// userData is everything stored about a user: the todos assigned to them,
+// what they wrote or uploaded, and the change history of their todos.
+type userData struct {
+	profile     UserProfile
+	todos       []Todo
+	comments    []Comment
+	attachments []storedAttachment
+	filters     []SavedFilter
+	watching    []int
+	history     []Change
+}
+
+func collectUserData(tx *bolt.Tx, user string) (userData, error) {
+	data := userData{todos: []Todo{}, comments: []Comment{}, filters: []SavedFilter{}, watching: []int{}, history: []Change{}}
+	var err error
+	data.profile.User = user
+	if data.profile.Preferences, err = loadPreferences(tx, user); err != nil {
+		return data, err
+	}
+	if data.profile.Achievements, err = loadStats(tx, user); err != nil {
+		return data, err
+	}
+
+	it := newIndexIterator(tx, "assignee", user)
+	for k, v := it.first(); k != nil; k, v = it.next() {
+		var todo Todo
+		if err := codec.Unmarshal(v, &todo); err != nil {
+			return data, err
+		}
+		data.todos = append(data.todos, todo)
+	}
+
+	err = tx.Bucket(commentsBucket).ForEachBucket(func(k []byte) error {
+		return tx.Bucket(commentsBucket).Bucket(k).ForEach(func(_, v []byte) error {
+			var comment Comment
+			if err := codec.Unmarshal(v, &comment); err != nil {
+				return err
+			}
+			if comment.Author == user {
+				data.comments = append(data.comments, comment)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return data, err
+	}
+
+	err = tx.Bucket(attachmentsBucket).ForEachBucket(func(k []byte) error {
+		return tx.Bucket(attachmentsBucket).Bucket(k).ForEach(func(_, v []byte) error {
+			var attachment storedAttachment
+			if err := codec.Unmarshal(v, &attachment); err != nil {
+				return err
+			}
+			if attachment.Uploader == user {
+				data.attachments = append(data.attachments, attachment)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return data, err
+	}
+
+	err = tx.Bucket(savedFiltersBucket).ForEach(func(_, v []byte) error {
+		var f SavedFilter
+		if err := codec.Unmarshal(v, &f); err != nil {
+			return err
+		}
+		if f.Owner == user {
+			data.filters = append(data.filters, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return data, err
+	}
+
+	tx.Bucket(watchersBucket).ForEach(func(k, _ []byte) error {
+		if len(k) > 8 && string(k[8:]) == user {
+			data.watching = append(data.watching, int(binary.BigEndian.Uint64(k[:8])))
+		}
+		return nil
+	})
+
+	err = tx.Bucket(changesBucket).ForEach(func(_, v []byte) error {
+		var change Change
+		if err := codec.Unmarshal(v, &change); err != nil {
+			return err
+		}
+		if change.Todo != nil && change.Todo.Assignee == user {
+			data.history = append(data.history, change)
+		}
+		return nil
+	})
+	return data, err
+}
+
+// writeUserArchive writes a zip with a JSON file per kind of data and the
+// user's attachments under attachments/{todoID}/.
+func writeUserArchive(w io.Writer, data userData) error {
+	attachments := make([]Attachment, 0, len(data.attachments))
+	for _, a := range data.attachments {
+		attachments = append(attachments, a.Attachment)
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"profile.json", data.profile},
+		{"todos.json", data.todos},
+		{"comments.json", data.comments},
+		{"attachments.json", attachments},
+		{"filters.json", data.filters},
+		{"watching.json", data.watching},
+		{"history.json", data.history},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range data.attachments {
+		content, err := blobs.get(a.Blob)
+		if err != nil {
+			return fmt.Errorf("attachment %d of todo %d: %w", a.ID, a.TodoID, err)
+		}
+		fw, err := zw.Create(fmt.Sprintf("attachments/%d/%d-%s", a.TodoID, a.ID, a.Name))
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func loadUserExport(tx *bolt.Tx, user string) (*storedUserExport, error) {
+	v := tx.Bucket(userExportsBucket).Get([]byte(user))
+	if v == nil {
+		return nil, nil
+	}
+	var export storedUserExport
+	if err := codec.Unmarshal(v, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func putUserExport(tx *bolt.Tx, user string, export storedUserExport) error {
+	buf, err := codec.Marshal(export)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(userExportsBucket).Put([]byte(user), buf)
+}
+
+// buildUserExport builds the archive of a pending export. An export that was
+// replaced or deleted meanwhile is dropped.
+func buildUserExport(user string) {
+	var requestedAt time.Time
+	var data userData
+	err := db.View(func(tx *bolt.Tx) error {
+		export, err := loadUserExport(tx, user)
+		if err != nil || export == nil || export.Status != ExportPending {
+			return err
+		}
+		requestedAt = export.RequestedAt
+		data, err = collectUserData(tx, user)
+		return err
+	})
+	if err == nil && requestedAt.IsZero() {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err == nil {
+		err = writeUserArchive(&buf, data)
+	}
+	blob := ""
+	if err == nil {
+		if blob, err = randomToken(); err == nil {
+			err = blobs.put(blob, buf.Bytes())
+		}
+	}
+	if err != nil {
+		warnf("building export of %s: %v", redactUser(user), err)
+		blob = ""
+	}
+
+	kept := false
+	updateErr := writeTx(func(tx *bolt.Tx) error {
+		kept = false
+		export, err := loadUserExport(tx, user)
+		if err != nil || export == nil || !export.RequestedAt.Equal(requestedAt) {
+			return err
+		}
+		now := clock.Now().UTC()
+		export.CompletedAt = &now
+		export.Status = ExportReady
+		export.Size = buf.Len()
+		export.Blob = blob
+		if blob == "" {
+			export.Status = ExportFailed
+			export.Size = 0
+			export.Error = "the export could not be built; request another"
+		}
+		kept = true
+		return putUserExport(tx, user, *export)
+	})
+	if updateErr != nil {
+		warnf("saving export of %s: %v", redactUser(user), updateErr)
+	}
+	if blob != "" && !kept {
+		deleteBlobs([]string{blob})
+	}
+}
+
+// runUserExportQueue builds the exports queued by requestUserExport until
+// ctx is cancelled.
+func runUserExportQueue(ctx context.Context) error {
+	for {
+		select {
+		case user := <-userExportQueue:
+			usingDB(func() { buildUserExport(user) })
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// exportUser returns the caller, who must be identified to export data.
+func exportUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Exports require the "+userHeader+" header", http.StatusBadRequest)
+		return "", false
+	}
+	if err := validUserName(user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return user, true
+}
+
+// exportUserData streams the caller's archive straight away, which suits
+// small accounts. Large ones should request it with POST /me/export.
+func exportUserData(w http.ResponseWriter, r *http.Request) {
+	user, ok := exportUser(w, r)
+	if !ok {
+		return
+	}
+
+	var data userData
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		data, err = collectUserData(tx, user)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+userExportFilename+`"`)
+	if err := writeUserArchive(w, data); err != nil {
+		warnf("streaming export of %s: %v", redactUser(user), err)
+	}
+}
+
+// requestUserExport queues the caller's archive to be built in the
+// background, replacing any earlier export, and answers 202.
+func requestUserExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := exportUser(w, r)
+	if !ok {
+		return
+	}
+
+	export := storedUserExport{UserExport: UserExport{Status: ExportPending, RequestedAt: clock.Now().UTC()}}
+	var previous string
+	err := writeTx(func(tx *bolt.Tx) error {
+		previous = ""
+		old, err := loadUserExport(tx, user)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			previous = old.Blob
+		}
+		return putUserExport(tx, user, export)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if previous != "" {
+		deleteBlobs([]string{previous})
+	}
+
+	select {
+	case userExportQueue <- user:
+	default:
+		export.Status, export.Error = ExportFailed, "too many exports are being prepared; try again later"
+		writeTx(func(tx *bolt.Tx) error { return putUserExport(tx, user, export) })
+		http.Error(w, "Too many exports are being prepared; try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Location", "/me/export/status")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export.UserExport)
+}
+
+func getUserExport(w http.ResponseWriter, user string) (*storedUserExport, bool) {
+	var export *storedUserExport
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		export, err = loadUserExport(tx, user)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if export == nil {
+		http.Error(w, "No export requested: use POST /me/export", http.StatusNotFound)
+		return nil, false
+	}
+	return export, true
+}
+
+// getUserExportStatus reports on the caller's requested export.
+func getUserExportStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := exportUser(w, r)
+	if !ok {
+		return
+	}
+	export, ok := getUserExport(w, user)
+	if !ok {
+		return
+	}
+	if export.Status == ExportReady {
+		export.DownloadURL = "/me/export/download"
+	}
+	json.NewEncoder(w).Encode(export.UserExport)
+}
+
+// downloadUserExport serves the caller's requested export once it's ready.
+func downloadUserExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := exportUser(w, r)
+	if !ok {
+		return
+	}
+	export, ok := getUserExport(w, user)
+	if !ok {
+		return
+	}
+	if export.Status != ExportReady {
+		http.Error(w, "Export is "+export.Status, http.StatusConflict)
+		return
+	}
+
+	data, err := blobs.get(export.Blob)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+userExportFilename+`"`)
+	w.Write(data)
+}
+
+// deleteUserExport deletes the caller's requested export and its archive.
+func deleteUserExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := exportUser(w, r)
+	if !ok {
+		return
+	}
+
+	var blob string
+	err := writeTx(func(tx *bolt.Tx) error {
+		blob = ""
+		export, err := loadUserExport(tx, user)
+		if err != nil || export == nil {
+			return err
+		}
+		blob = export.Blob
+		return tx.Bucket(userExportsBucket).Delete([]byte(user))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if blob != "" {
+		deleteBlobs([]string{blob})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// readArchive returns the files of a zip archive by name.
+func readArchive(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestUserExport(t *testing.T) {
+	clearBucket(t)
+	withAttachmentLimits(t)
+	router := setupRouter()
+
+	request := func(method, url, user string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, body)
+		if user != "" {
+			req.Header.Set(userHeader, user)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	mine := saveTodo(t, Todo{Title: "File taxes", Assignee: "alice"})
+	theirs := saveTodo(t, Todo{Title: "Mow lawn", Assignee: "bob"})
+	mineURL := "/todos/" + strconv.Itoa(mine.ID)
+	theirsURL := "/todos/" + strconv.Itoa(theirs.ID)
+	request(http.MethodPost, theirsURL+"/comments", "alice", strings.NewReader(`{"body":"Before it rains"}`))
+	request(http.MethodPost, theirsURL+"/comments", "bob", strings.NewReader(`{"body":"Sure"}`))
+	request(http.MethodPost, theirsURL+"/watch", "alice", nil)
+	request(http.MethodPost, "/filters", "alice", strings.NewReader(`{"name":"Open","query":"completed=false"}`))
+	upload := uploadRequest(mineURL+"/attachments", "file", "receipt.txt", []byte("Paid 40"))
+	upload.Header.Set(userHeader, "alice")
+	router.ServeHTTP(httptest.NewRecorder(), upload)
+
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/me/export", "", nil).Code)
+
+	w := request(http.MethodGet, "/me/export", "alice", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	files := readArchive(t, w.Body.Bytes())
+
+	var todos []Todo
+	assert.NoError(t, json.Unmarshal([]byte(files["todos.json"]), &todos))
+	assert.Len(t, todos, 1)
+	assert.Equal(t, "File taxes", todos[0].Title)
+	var comments []Comment
+	assert.NoError(t, json.Unmarshal([]byte(files["comments.json"]), &comments))
+	assert.Len(t, comments, 1)
+	assert.Equal(t, "Before it rains", comments[0].Body)
+	assert.Contains(t, files["filters.json"], `"name": "Open"`)
+	assert.Equal(t, "[\n  "+strconv.Itoa(theirs.ID)+"\n]\n", files["watching.json"])
+	assert.Contains(t, files["history.json"], "File taxes")
+	assert.NotContains(t, files["history.json"], "Mow lawn")
+	assert.NotContains(t, files["attachments.json"], "blob")
+	assert.Equal(t, "Paid 40", files["attachments/"+strconv.Itoa(mine.ID)+"/1-receipt.txt"])
+	assert.Contains(t, files["profile.json"], `"user": "alice"`)
+}
+
+func TestUserExportQueue(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	saveTodo(t, Todo{Title: "File taxes", Assignee: "alice"})
+
+	request := func(method, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set(userHeader, "alice")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/me/export/status").Code)
+
+	w := request(http.MethodPost, "/me/export")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "/me/export/status", w.Header().Get("Location"))
+	assert.Equal(t, http.StatusConflict, request(http.MethodGet, "/me/export/download").Code)
+
+	buildUserExport(<-userExportQueue)
+	w = request(http.MethodGet, "/me/export/status")
+	var export UserExport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Equal(t, ExportReady, export.Status)
+	assert.Equal(t, "/me/export/download", export.DownloadURL)
+	assert.NotNil(t, export.CompletedAt)
+
+	w = request(http.MethodGet, "/me/export/download")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, export.Size, w.Body.Len())
+	assert.Contains(t, readArchive(t, w.Body.Bytes())["todos.json"], "File taxes")
+
+	blobCount := func() int {
+		n := 0
+		db.View(func(tx *bolt.Tx) error {
+			n = tx.Bucket(attachmentBlobsBucket).Stats().KeyN
+			return nil
+		})
+		return n
+	}
+
+	// A new request replaces the earlier export and its archive.
+	request(http.MethodPost, "/me/export")
+	buildUserExport(<-userExportQueue)
+	assert.Equal(t, 1, blobCount())
+
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/me/export").Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/me/export/download").Code)
+	assert.Equal(t, 0, blobCount())
+}
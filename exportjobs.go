@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// exportJobsBucket holds export jobs, keyed by job ID. Their documents are
+// kept in the blob store.
+var exportJobsBucket = []byte("exportJobs")
+
+// exportExpiryInterval is how often expired export jobs are deleted.
+const exportExpiryInterval = time.Hour
+
+// exportJobQueue holds the IDs of export jobs to be built.
+var exportJobQueue = make(chan string, 100)
+
+// ExportJob is an export of todos built in the background, so a large one
+// doesn't hold a connection open. It takes the parameters of GET
+// /todos/export.
+type ExportJob struct {
+	ID          string     `json:"id"`
+	Format      string     `json:"format"`
+	Query       string     `json:"query,omitempty"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// ExpiresAt is when a finished job and its document are deleted.
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	Todos       int        `json:"todos,omitempty"`
+	Size        int        `json:"size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"downloadUrl,omitempty"`
+}
+
+type storedExportJob struct {
+	ExportJob
+	// Owner is the caller who requested the job, the only one who sees it.
+	Owner string `json:"owner,omitempty"`
+	Blob  string `json:"blob,omitempty"`
+}
+
+func loadExportJob(tx *bolt.Tx, id string) (*storedExportJob, error) {
+	v := tx.Bucket(exportJobsBucket).Get([]byte(id))
+	if v == nil {
+		return nil, nil
+	}
+	var job storedExportJob
+	if err := codec.Unmarshal(v, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func putExportJob(tx *bolt.Tx, job storedExportJob) error {
+	buf, err := codec.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(exportJobsBucket).Put([]byte(job.ID), buf)
+}
+
+// buildExportJob writes the document of a pending export job to the blob
+// store. A job deleted meanwhile is dropped.
+func buildExportJob(id string) {
+	var job *storedExportJob
+	var todos []Todo
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		if job, err = loadExportJob(tx, id); err != nil || job == nil || job.Status != ExportPending {
+			return err
+		}
+		query, err := url.ParseQuery(job.Query)
+		if err != nil {
+			return err
+		}
+		filters, err := listFilters(query, job.Owner)
+		if err != nil {
+			return err
+		}
+		todos, err = readExport(tx, filters)
+		return err
+	})
+	if err == nil && (job == nil || job.Status != ExportPending) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err == nil {
+		err = writeExport(&buf, job.Format, todos, clock.Now())
+	}
+	blob := ""
+	if err == nil {
+		if blob, err = randomToken(); err == nil {
+			err = blobs.put(blob, buf.Bytes())
+		}
+	}
+	if err != nil {
+		warnf("building export job %s: %v", id, err)
+		blob = ""
+	}
+
+	kept := false
+	updateErr := writeTx(func(tx *bolt.Tx) error {
+		kept = false
+		job, err := loadExportJob(tx, id)
+		if err != nil || job == nil {
+			return err
+		}
+		now := clock.Now().UTC()
+		job.CompletedAt = &now
+		if config.ExportRetention > 0 {
+			expires := now.Add(config.ExportRetention)
+			job.ExpiresAt = &expires
+		}
+		job.Status = ExportReady
+		job.Todos = len(todos)
+		job.Size = buf.Len()
+		job.Blob = blob
+		if blob == "" {
+			job.Status = ExportFailed
+			job.Todos, job.Size = 0, 0
+			job.Error = "the export could not be built; request another"
+		}
+		kept = true
+		return putExportJob(tx, *job)
+	})
+	if updateErr != nil {
+		warnf("saving export job %s: %v", id, updateErr)
+	}
+	if blob != "" && !kept {
+		deleteBlobs([]string{blob})
+	}
+}
+
+// runExportJobQueue builds the jobs still pending from before a restart,
+// then those queued by createExportJob, until ctx is cancelled.
+func runExportJobQueue(ctx context.Context) error {
+	var pending []string
+	var err error
+	usingDB(func() {
+		err = db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(exportJobsBucket).ForEach(func(k, v []byte) error {
+				var job storedExportJob
+				if err := codec.Unmarshal(v, &job); err != nil {
+					return err
+				}
+				if job.Status == ExportPending {
+					pending = append(pending, job.ID)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		warnf("finding pending export jobs: %v", err)
+	}
+	for _, id := range pending {
+		if ctx.Err() != nil {
+			return nil
+		}
+		usingDB(func() { buildExportJob(id) })
+	}
+
+	for {
+		select {
+		case id := <-exportJobQueue:
+			usingDB(func() { buildExportJob(id) })
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// expireExportJobs deletes finished export jobs past their expiry, with
+// their documents.
+func expireExportJobs(now time.Time) error {
+	var blobKeys []string
+	err := writeTx(func(tx *bolt.Tx) error {
+		blobKeys = nil
+		var expired [][]byte
+		err := tx.Bucket(exportJobsBucket).ForEach(func(k, v []byte) error {
+			var job storedExportJob
+			if err := codec.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if job.ExpiresAt != nil && !now.Before(*job.ExpiresAt) {
+				expired = append(expired, k)
+				if job.Blob != "" {
+					blobKeys = append(blobKeys, job.Blob)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := tx.Bucket(exportJobsBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	deleteBlobs(blobKeys)
+	if len(blobKeys) > 0 {
+		debugf("expired %d export documents", len(blobKeys))
+	}
+	return nil
+}
+
+// createExportJob queues an export with the parameters of GET
+// /todos/export and answers 202, pointing at the job.
+func createExportJob(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if err := validExportFormat(format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user := userFromRequest(r)
+	if _, err := listFilters(query, user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.Del("format")
+
+	id, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job := storedExportJob{
+		ExportJob: ExportJob{ID: id, Format: format, Query: query.Encode(), Status: ExportPending, RequestedAt: clock.Now().UTC()},
+		Owner:     user,
+	}
+	if err := writeTx(func(tx *bolt.Tx) error { return putExportJob(tx, job) }); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case exportJobQueue <- id:
+	default:
+		writeTx(func(tx *bolt.Tx) error { return tx.Bucket(exportJobsBucket).Delete([]byte(id)) })
+		http.Error(w, "Too many exports are being prepared; try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Location", "/exports/"+id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.ExportJob)
+}
+
+// getCallerExportJob loads the export job named in the path, answering 404
+// unless the caller requested it.
+func getCallerExportJob(w http.ResponseWriter, r *http.Request) (*storedExportJob, bool) {
+	var job *storedExportJob
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = loadExportJob(tx, mux.Vars(r)["id"])
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if job == nil || job.Owner != userFromRequest(r) {
+		http.Error(w, "Export job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+// getExportJob reports on an export job, with its download URL once it's
+// ready.
+func getExportJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := getCallerExportJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status == ExportReady {
+		job.DownloadURL = "/exports/" + job.ID + "/download"
+	}
+	json.NewEncoder(w).Encode(job.ExportJob)
+}
+
+// downloadExportJob serves the document of a ready export job.
+func downloadExportJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := getCallerExportJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != ExportReady {
+		http.Error(w, "Export is "+job.Status, http.StatusConflict)
+		return
+	}
+
+	data, err := blobs.get(job.Blob)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", exportFormats[job.Format].contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportFormats[job.Format].filename+`"`)
+	w.Write(data)
+}
+
+// deleteExportJob deletes an export job and its document. A pending job is
+// dropped instead of built.
+func deleteExportJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := getCallerExportJob(w, r)
+	if !ok {
+		return
+	}
+	var blob string
+	err := writeTx(func(tx *bolt.Tx) error {
+		blob = ""
+		current, err := loadExportJob(tx, job.ID)
+		if err != nil || current == nil {
+			return err
+		}
+		blob = current.Blob
+		return tx.Bucket(exportJobsBucket).Delete([]byte(job.ID))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if blob != "" {
+		deleteBlobs([]string{blob})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
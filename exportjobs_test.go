@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withExportRetention(t *testing.T, d time.Duration) {
+	previous := config
+	config.ExportRetention = d
+	t.Cleanup(func() { config = previous })
+}
+
+func exportJobCounts(t *testing.T) (jobs, blobs int) {
+	err := db.View(func(tx *bolt.Tx) error {
+		jobs = tx.Bucket(exportJobsBucket).Stats().KeyN
+		blobs = tx.Bucket(attachmentBlobsBucket).Stats().KeyN
+		return nil
+	})
+	assert.NoError(t, err)
+	return jobs, blobs
+}
+
+func TestExportJob(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	withClock(t, start)
+	withExportRetention(t, 24*time.Hour)
+	router := setupRouter()
+	serve := func(method, url, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, requestAs(user, method, url, ""))
+		return w
+	}
+	saveTodo(t, Todo{Title: "Pay rent", Tags: []string{"home"}})
+	saveTodo(t, Todo{Title: "Review PR", Tags: []string{"work"}})
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/exports?format=docx", "alice").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/exports?format=json&completed=maybe", "alice").Code)
+
+	w := serve(http.MethodPost, "/exports?format=markdown&tag=home", "alice")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var job ExportJob
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, "/exports/"+job.ID, w.Header().Get("Location"))
+	assert.Equal(t, ExportJob{ID: job.ID, Format: "markdown", Query: "tag=home", Status: ExportPending, RequestedAt: start}, job)
+
+	jobURL := "/exports/" + job.ID
+	assert.Equal(t, http.StatusConflict, serve(http.MethodGet, jobURL+"/download", "alice").Code)
+	// Only the caller who requested a job sees it.
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, jobURL, "bob").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, jobURL, "").Code)
+
+	buildExportJob(<-exportJobQueue)
+	w = serve(http.MethodGet, jobURL, "alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, ExportReady, job.Status)
+	assert.Equal(t, 1, job.Todos)
+	assert.Equal(t, jobURL+"/download", job.DownloadURL)
+	assert.Equal(t, start.Add(24*time.Hour), *job.ExpiresAt)
+
+	w = serve(http.MethodGet, jobURL+"/download", "alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "todos.md")
+	assert.Equal(t, "## home\n\n- [ ] Pay rent\n", w.Body.String())
+	assert.Equal(t, job.Size, w.Body.Len())
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, jobURL+"/download", "bob").Code)
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, jobURL, "alice").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, jobURL, "alice").Code)
+	jobs, blobs := exportJobCounts(t)
+	assert.Zero(t, jobs)
+	assert.Zero(t, blobs)
+}
+
+func TestExportJobDeletedWhilePending(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodPost, "/exports?format=json", ""))
+	var job ExportJob
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodDelete, "/exports/"+job.ID, ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	buildExportJob(<-exportJobQueue)
+	jobs, blobs := exportJobCounts(t)
+	assert.Zero(t, jobs)
+	assert.Zero(t, blobs)
+}
+
+func TestExpireExportJobs(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	withClock(t, start)
+	withExportRetention(t, time.Hour)
+	router := setupRouter()
+	for range 2 {
+		router.ServeHTTP(httptest.NewRecorder(), requestAs("alice", http.MethodPost, "/exports?format=json", ""))
+		buildExportJob(<-exportJobQueue)
+	}
+	// Pending jobs don't expire.
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("alice", http.MethodPost, "/exports?format=json", ""))
+	<-exportJobQueue
+
+	assert.NoError(t, expireExportJobs(start.Add(59*time.Minute)))
+	jobs, blobs := exportJobCounts(t)
+	assert.Equal(t, 3, jobs)
+	assert.Equal(t, 2, blobs)
+
+	assert.NoError(t, expireExportJobs(start.Add(time.Hour)))
+	jobs, blobs = exportJobCounts(t)
+	assert.Equal(t, 1, jobs)
+	assert.Zero(t, blobs)
+}
+
+func TestRunExportJobQueueResumesPending(t *testing.T) {
+	clearBucket(t)
+	saveTodo(t, Todo{Title: "Pay rent"})
+	job := storedExportJob{ExportJob: ExportJob{ID: "left-over", Format: "json", Status: ExportPending}}
+	assert.NoError(t, db.Update(func(tx *bolt.Tx) error { return putExportJob(tx, job) }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runExportJobQueue(ctx) }()
+	assert.Eventually(t, func() bool {
+		var built *storedExportJob
+		db.View(func(tx *bolt.Tx) error {
+			built, _ = loadExportJob(tx, "left-over")
+			return nil
+		})
+		return built.Status == ExportReady && built.Todos == 1
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// feedTokensBucket maps feed tokens to their user. Feed readers and calendar
+// apps can't send headers, so subscription URLs carry a token instead of
+// X-User. Each user has at most one token.
+var feedTokensBucket = []byte("feedTokens")
+
+type FeedTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// revokeFeedTokens deletes every token of user.
+func revokeFeedTokens(tx *bolt.Tx, user string) error {
+	b := tx.Bucket(feedTokensBucket)
+	var tokens [][]byte
+	b.ForEach(func(k, v []byte) error {
+		if string(v) == user {
+			tokens = append(tokens, k)
+		}
+		return nil
+	})
+	for _, token := range tokens {
+		if err := b.Delete(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// feedToken issues the caller a new feed token, revoking the old one (POST),
+// or just revokes it (DELETE).
+func feedToken(w http.ResponseWriter, r *http.Request) {
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Feed tokens require the "+userHeader+" header", http.StatusBadRequest)
+		return
+	}
+	if err := validUserName(user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var token string
+	if r.Method == http.MethodPost {
+		var err error
+		if token, err = randomToken(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := writeTx(func(tx *bolt.Tx) error {
+		if err := revokeFeedTokens(tx, user); err != nil {
+			return err
+		}
+		if token == "" {
+			return nil
+		}
+		return tx.Bucket(feedTokensBucket).Put([]byte(token), []byte(user))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if token == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(FeedTokenResponse{Token: token})
+}
+
+// feedUser authenticates a feed request by its token query parameter.
+func feedUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token := r.URL.Query().Get("token")
+	var user string
+	if token != "" {
+		db.View(func(tx *bolt.Tx) error {
+			user = string(tx.Bucket(feedTokensBucket).Get([]byte(token)))
+			return nil
+		})
+	}
+	if user == "" {
+		http.Error(w, "Invalid feed token", http.StatusUnauthorized)
+		return "", false
+	}
+	return user, true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// issueFeedToken gets user a feed token.
+func issueFeedToken(t *testing.T, router http.Handler, user string) string {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs(user, http.MethodPost, "/me/feed-token", ""))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response FeedTokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Token
+}
+
+func TestFeedTokens(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	feed := func(token string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/calendar.ics?token="+token, nil))
+		return w.Code
+	}
+
+	first := issueFeedToken(t, router, "alice")
+	assert.Len(t, first, 64)
+	assert.Equal(t, http.StatusOK, feed(first))
+
+	// A new token replaces the old one.
+	second := issueFeedToken(t, router, "alice")
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, http.StatusUnauthorized, feed(first))
+	assert.Equal(t, http.StatusOK, feed(second))
+
+	bob := issueFeedToken(t, router, "bob")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodDelete, "/me/feed-token", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, feed(second))
+	assert.Equal(t, http.StatusOK, feed(bob))
+
+	assert.Equal(t, http.StatusUnauthorized, feed(""))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("", http.MethodPost, "/me/feed-token", ""))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
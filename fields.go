@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// fieldSelection is the set of Todo fields requested with ?fields=, as struct
+// field indexes in declaration order. nil selects every field.
+type fieldSelection []int
+
+var todoFieldIndex = jsonFieldIndex(reflect.TypeOf(Todo{}))
+
+// jsonFieldIndex maps the JSON names of a struct's fields to their indexes.
+func jsonFieldIndex(t reflect.Type) map[string]int {
+	index := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		index[name] = i
+	}
+	return index
+}
+
+func parseFieldSelection(s string) (fieldSelection, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	selected := make(map[int]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		i, ok := todoFieldIndex[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		selected[i] = true
+	}
+
+	var fields fieldSelection
+	for i := 0; i < reflect.TypeOf(Todo{}).NumField(); i++ {
+		if selected[i] {
+			fields = append(fields, i)
+		}
+	}
+	return fields, nil
+}
+
+// encode marshals todo with only the selected fields, in declaration order.
+func (f fieldSelection) encode(todo Todo) ([]byte, error) {
+	c := plainCodec()
+	if f == nil {
+		return c.Marshal(todo)
+	}
+
+	v := reflect.ValueOf(todo)
+	t := v.Type()
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for n, i := range f {
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := c.Marshal(strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+		if err != nil {
+			return nil, err
+		}
+		value, err := c.Marshal(v.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
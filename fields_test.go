@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTodosFieldSelection(t *testing.T) {
+	clearBucket(t)
+
+	payload, _ := json.Marshal(Todo{Title: "Pick me", Completed: true})
+	createTodo(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedItem   map[string]interface{}
+	}{
+		{
+			name:           "all fields by default",
+			url:            "/todos",
+			expectedStatus: http.StatusOK,
+			expectedItem:   map[string]interface{}{"id": float64(1), "title": "Pick me", "completed": true, "status": "done", "position": "V"},
+		},
+		{
+			name:           "selected fields",
+			url:            "/todos?fields=title,id",
+			expectedStatus: http.StatusOK,
+			expectedItem:   map[string]interface{}{"id": float64(1), "title": "Pick me"},
+		},
+		{
+			name:           "selected fields on a streamed page",
+			url:            "/todos?fields=completed&limit=5000",
+			expectedStatus: http.StatusOK,
+			expectedItem:   map[string]interface{}{"completed": true},
+		},
+		{
+			name:           "unknown field",
+			url:            "/todos?fields=id,owner",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Run twice so both the uncached and cached paths are covered.
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+				w := httptest.NewRecorder()
+
+				getTodos(w, req)
+
+				assert.Equal(t, tt.expectedStatus, w.Code)
+				if tt.expectedItem == nil {
+					continue
+				}
+
+				var response struct {
+					Items      []map[string]interface{} `json:"items"`
+					TotalItems int                      `json:"totalItems"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, 1, response.TotalItems)
+				assert.Equal(t, []map[string]interface{}{tt.expectedItem}, response.Items)
+			}
+		})
+	}
+}
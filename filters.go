@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// listFilters turns the filter parameters of a listing into index filters.
+// user is the caller, for assignee=me.
+func listFilters(query url.Values, user string) ([]indexFilter, error) {
+	var filters []indexFilter
+
+	for _, field := range []string{"completed", "starred"} {
+		s := query.Get(field)
+		if s == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s filter", field)
+		}
+		filters = append(filters, indexFilter{field, strconv.FormatBool(b)})
+	}
+
+	if status := query.Get("status"); status != "" {
+		if err := validStatus(status); err != nil {
+			return nil, err
+		}
+		filters = append(filters, indexFilter{"status", status})
+	}
+
+	if tag := query.Get("tag"); tag != "" {
+		filters = append(filters, indexFilter{"tag", tag})
+	}
+
+	assignee, err := resolveAssignee(query.Get("assignee"), user)
+	if err != nil {
+		return nil, err
+	}
+	if assignee != "" {
+		filters = append(filters, indexFilter{"assignee", assignee})
+	}
+
+	return filters, nil
+}
+
+// resolveAssignee resolves assignee=me to the caller.
+func resolveAssignee(assignee, user string) (string, error) {
+	if assignee != "me" {
+		return assignee, nil
+	}
+	if user == "" {
+		return "", fmt.Errorf("assignee=me requires the %s header", userHeader)
+	}
+	return user, nil
+}
+
+// savedFiltersBucket holds saved filters keyed by ID.
+var savedFiltersBucket = []byte("savedFilters")
+
+// savedFilterParams are the listing parameters a saved filter may set.
+var savedFilterParams = map[string]bool{
+	"completed": true,
+	"starred":   true,
+	"status":    true,
+	"assignee":  true,
+	"tag":       true,
+	"q":         true,
+	"sort":      true,
+}
+
+var errFilterNotFound = errors.New("filter not found")
+
+// SavedFilter is a named listing query, such as "completed=false&assignee=me",
+// that its owner can run again with GET /filters/{id}/todos.
+type SavedFilter struct {
+	ID    int    `json:"id"`
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// validateSavedFilter checks the query the way a listing would parse it, so
+// a saved filter can't fail when it runs.
+func validateSavedFilter(f SavedFilter) error {
+	if strings.TrimSpace(f.Name) == "" {
+		return errors.New("filter name is required")
+	}
+	query, err := url.ParseQuery(f.Query)
+	if err != nil {
+		return fmt.Errorf("invalid query: %v", err)
+	}
+	for param := range query {
+		if !savedFilterParams[param] {
+			return fmt.Errorf("unsupported filter parameter %q", param)
+		}
+	}
+	if sort := query.Get("sort"); sort != "" && sort != "id" && sort != "position" {
+		return errors.New("Invalid sort")
+	}
+	if q := query.Get("q"); q != "" {
+		if _, err := compileQuery(q, f.Owner); err != nil {
+			return err
+		}
+	}
+	_, err = listFilters(query, f.Owner)
+	return err
+}
+
+// loadSavedFilter returns a filter owned by user. Other users' filters are
+// reported as missing.
+func loadSavedFilter(tx *bolt.Tx, id int, user string) (*SavedFilter, error) {
+	v := tx.Bucket(savedFiltersBucket).Get(itob(id))
+	if v == nil {
+		return nil, errFilterNotFound
+	}
+	var f SavedFilter
+	if err := codec.Unmarshal(v, &f); err != nil {
+		return nil, err
+	}
+	if f.Owner != user {
+		return nil, errFilterNotFound
+	}
+	return &f, nil
+}
+
+func putSavedFilter(tx *bolt.Tx, f SavedFilter) error {
+	buf, err := codec.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(savedFiltersBucket).Put(itob(f.ID), buf)
+}
+
+func savedFilterError(w http.ResponseWriter, err error) {
+	if err == errFilterNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// filterOwner returns the caller, who must be identified to use saved
+// filters.
+func filterOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Saved filters require the "+userHeader+" header", http.StatusBadRequest)
+		return "", false
+	}
+	return user, true
+}
+
+func savedFilterID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func getSavedFilters(w http.ResponseWriter, r *http.Request) {
+	user, ok := filterOwner(w, r)
+	if !ok {
+		return
+	}
+
+	filters := []SavedFilter{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(savedFiltersBucket).ForEach(func(k, v []byte) error {
+			var f SavedFilter
+			if err := codec.Unmarshal(v, &f); err != nil {
+				return err
+			}
+			if f.Owner == user {
+				filters = append(filters, f)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		savedFilterError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(filters)
+}
+
+func getSavedFilter(w http.ResponseWriter, r *http.Request) {
+	user, ok := filterOwner(w, r)
+	if !ok {
+		return
+	}
+	id, ok := savedFilterID(w, r)
+	if !ok {
+		return
+	}
+
+	var f *SavedFilter
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		f, err = loadSavedFilter(tx, id, user)
+		return err
+	})
+	if err != nil {
+		savedFilterError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(f)
+}
+
+func createSavedFilter(w http.ResponseWriter, r *http.Request) {
+	user, ok := filterOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var f SavedFilter
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.Owner = user
+	if err := validateSavedFilter(f); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := writeTx(func(tx *bolt.Tx) error {
+		if err := checkFilterQuota(tx, user); err != nil {
+			return err
+		}
+		id, _ := tx.Bucket(savedFiltersBucket).NextSequence()
+		f.ID = int(id)
+		return putSavedFilter(tx, f)
+	})
+	if err != nil {
+		savedFilterError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(f)
+}
+
+// updateSavedFilter replaces (PUT) or deletes (DELETE) one of the caller's
+// filters.
+func updateSavedFilter(w http.ResponseWriter, r *http.Request) {
+	user, ok := filterOwner(w, r)
+	if !ok {
+		return
+	}
+	id, ok := savedFilterID(w, r)
+	if !ok {
+		return
+	}
+
+	var f SavedFilter
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.ID = id
+		f.Owner = user
+		if err := validateSavedFilter(f); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := writeTx(func(tx *bolt.Tx) error {
+		if _, err := loadSavedFilter(tx, id, user); err != nil {
+			return err
+		}
+		if r.Method == http.MethodDelete {
+			return tx.Bucket(savedFiltersBucket).Delete(itob(id))
+		}
+		return putSavedFilter(tx, f)
+	})
+	if err != nil {
+		savedFilterError(w, err)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	json.NewEncoder(w).Encode(f)
+}
+
+// runSavedFilter lists the todos matching a saved filter. Pagination and
+// field selection parameters are taken from the request, like GET /todos.
+func runSavedFilter(w http.ResponseWriter, r *http.Request) {
+	user, ok := filterOwner(w, r)
+	if !ok {
+		return
+	}
+	id, ok := savedFilterID(w, r)
+	if !ok {
+		return
+	}
+
+	var f *SavedFilter
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		f, err = loadSavedFilter(tx, id, user)
+		return err
+	})
+	if err != nil {
+		savedFilterError(w, err)
+		return
+	}
+
+	saved, _ := url.ParseQuery(f.Query)
+	query := r.URL.Query()
+	for param := range savedFilterParams {
+		query.Del(param)
+	}
+	for param, values := range saved {
+		query[param] = values
+	}
+
+	listing := r.Clone(r.Context())
+	listing.URL.RawQuery = query.Encode()
+	getTodos(w, listing)
+}
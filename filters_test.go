@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavedFilters(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, todo := range []Todo{
+		{Title: "Mine", Assignee: "alice"},
+		{Title: "Mine, done", Assignee: "alice", Completed: true},
+		{Title: "Theirs", Assignee: "bob"},
+	} {
+		payload, _ := json.Marshal(todo)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	tests := []struct {
+		name           string
+		user           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "create",
+			user:           "alice",
+			method:         http.MethodPost,
+			url:            "/filters",
+			body:           `{"name":"My open","query":"completed=false&assignee=me"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "create without user",
+			method:         http.MethodPost,
+			url:            "/filters",
+			body:           `{"name":"Open","query":"completed=false"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "create with invalid value",
+			user:           "alice",
+			method:         http.MethodPost,
+			url:            "/filters",
+			body:           `{"name":"Broken","query":"completed=maybe"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "create with unsupported parameter",
+			user:           "alice",
+			method:         http.MethodPost,
+			url:            "/filters",
+			body:           `{"name":"Paged","query":"page=2"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "someone else's filter",
+			user:           "bob",
+			method:         http.MethodGet,
+			url:            "/filters/1",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "rename",
+			user:           "alice",
+			method:         http.MethodPut,
+			url:            "/filters/1",
+			body:           `{"name":"Open for me","query":"completed=false&assignee=me"}`,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, requestAs(tt.user, tt.method, tt.url, tt.body))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodGet, "/filters", ""))
+	var filters []SavedFilter
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &filters))
+	assert.Equal(t, []SavedFilter{{ID: 1, Owner: "alice", Name: "Open for me", Query: "completed=false&assignee=me"}}, filters)
+
+	// Filter parameters in the request can't widen the saved filter.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodGet, "/filters/1/todos?limit=10&completed=true", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response PaginatedResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Items, 1)
+	assert.Equal(t, "Mine", response.Items[0].Title)
+	assert.Equal(t, 10, response.Limit)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodDelete, "/filters/1", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodGet, "/filters/1/todos", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
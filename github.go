@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// githubAPI is a variable so tests can point it at a fake.
+var githubAPI = "https://api.github.com"
+
+var errIssueLinked = errors.New("todo already has a GitHub issue")
+
+// githubIssueQueue holds todos waiting for an issue to be opened, so
+// creating a todo doesn't wait on GitHub.
+var githubIssueQueue = make(chan int, 100)
+
+type GitHubIssueRequest struct {
+	// Number links an existing issue instead of opening one.
+	Number int `json:"number"`
+}
+
+func githubConfigured() bool {
+	return config.GitHubRepo != "" && secret("GITHUB_TOKEN", config.GitHubToken) != ""
+}
+
+func githubClient() *http.Client {
+	return withBreaker("github", &http.Client{Timeout: integrationTimeout, Transport: bearerTransport{token: secret("GITHUB_TOKEN", config.GitHubToken)}})
+}
+
+// openGitHubIssue opens an issue for a todo in the configured repository
+// and returns its number.
+func openGitHubIssue(todo Todo) (int, error) {
+	var issue struct {
+		Number int `json:"number"`
+	}
+	err := apiRequest(githubClient(), http.MethodPost, githubAPI+"/repos/"+config.GitHubRepo+"/issues", map[string]string{
+		"title": todo.Title,
+		"body":  fmt.Sprintf("Opened for todo #%d.", todo.ID),
+	}, &issue)
+	return issue.Number, err
+}
+
+// setGitHubIssue links a todo to an issue, or unlinks it for number 0.
+// It returns nil when the todo doesn't exist.
+func setGitHubIssue(id, number int) (*Todo, error) {
+	todo, err := todoService.Modify(id, func(tx *bolt.Tx, todo *Todo) error {
+		todo.GitHubIssue = number
+		return nil
+	})
+	if err == errTodoNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// queueGitHubIssue queues every new todo for an issue when
+// GITHUB_ISSUE_ON_CREATE is set.
+func queueGitHubIssue(e Event) {
+	if e.Type != EventTodoCreated || e.Todo.GitHubIssue != 0 || !config.GitHubIssueOnCreate || !githubConfigured() {
+		return
+	}
+	select {
+	case githubIssueQueue <- e.Todo.ID:
+	default:
+		warnf("GitHub issue queue is full; todo %d gets no issue", e.Todo.ID)
+	}
+}
+
+func init() {
+	events.subscribe(queueGitHubIssue)
+}
+
+// runGitHubIssueQueue opens the issues queued by queueGitHubIssue until ctx
+// is cancelled.
+func runGitHubIssueQueue(ctx context.Context) error {
+	for {
+		var id int
+		select {
+		case id = <-githubIssueQueue:
+		case <-ctx.Done():
+			return nil
+		}
+		usingDB(func() { openQueuedGitHubIssue(id) })
+	}
+}
+
+// openQueuedGitHubIssue opens an issue for todo id unless it has one or
+// was deleted meanwhile.
+func openQueuedGitHubIssue(id int) {
+	var todo *Todo
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		todo, err = loadTodo(tx, id)
+		return err
+	})
+	if err != nil || todo == nil || todo.GitHubIssue != 0 {
+		return
+	}
+
+	number, err := openGitHubIssue(*todo)
+	if err == nil {
+		_, err = setGitHubIssue(id, number)
+	}
+	if err != nil {
+		warnf("opening a GitHub issue for todo %d: %v", id, err)
+	}
+}
+
+// githubIssue opens an issue for a todo, or links an existing one (POST),
+// or unlinks it (DELETE). Issues themselves are never closed or deleted.
+func githubIssue(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		todo, err := setGitHubIssue(id, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if todo == nil {
+			http.Error(w, "todo not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(todo)
+		return
+	}
+
+	if !githubConfigured() {
+		http.Error(w, "GitHub integration is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req GitHubIssueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Number < 0 {
+		http.Error(w, "Invalid issue number", http.StatusBadRequest)
+		return
+	}
+
+	var todo *Todo
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		todo, err = loadTodo(tx, id)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if todo == nil {
+		http.Error(w, "todo not found", http.StatusNotFound)
+		return
+	}
+
+	status := http.StatusOK
+	number := req.Number
+	if number == 0 {
+		if todo.GitHubIssue != 0 {
+			http.Error(w, errIssueLinked.Error(), http.StatusConflict)
+			return
+		}
+		if number, err = openGitHubIssue(*todo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		status = http.StatusCreated
+	}
+
+	todo, err = setGitHubIssue(id, number)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if todo == nil {
+		http.Error(w, "todo not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(todo)
+}
+
+// validGitHubSignature checks the X-Hub-Signature-256 header GitHub signs
+// webhook deliveries with.
+func validGitHubSignature(body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(secret("GITHUB_WEBHOOK_SECRET", config.GitHubWebhookSecret)))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// githubWebhook completes the todos linked to an issue when it is closed,
+// and reopens them when it is reopened.
+func githubWebhook(w http.ResponseWriter, r *http.Request) {
+	if secret("GITHUB_WEBHOOK_SECRET", config.GitHubWebhookSecret) == "" {
+		http.Error(w, "GitHub webhooks are disabled", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validGitHubSignature(body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Header.Get("X-GitHub-Event") != "issues" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var payload struct {
+		Action string `json:"action"`
+		Issue  struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (payload.Action != "closed" && payload.Action != "reopened") || !strings.EqualFold(payload.Repository.FullName, config.GitHubRepo) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	completed := payload.Action == "closed"
+
+	err = writeTx(func(tx *bolt.Tx) error {
+		var linked []Todo
+		err := tx.Bucket(todosBucket).ForEach(func(k, v []byte) error {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			if todo.GitHubIssue == payload.Issue.Number && todo.Completed != completed {
+				linked = append(linked, todo)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// The issue's state is settled on GitHub, so it is applied as is,
+		// even where the workflow or blockers would refuse it.
+		for _, todo := range linked {
+			old := todo
+			todo.Completed = completed
+			todo.Status = todoStatus(Todo{Completed: completed})
+			if err := todoService.saveExternal(tx, &old, &todo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
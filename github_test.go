@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withGitHub(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	previous, previousConfig := githubAPI, config
+	githubAPI = server.URL
+	config.GitHubRepo, config.GitHubToken, config.GitHubWebhookSecret = "acme/app", "ghp_test", "hook-secret"
+	t.Cleanup(func() { githubAPI, config = previous, previousConfig })
+}
+
+func githubDelivery(event, body string) *http.Request {
+	mac := hmac.New(sha256.New, []byte("hook-secret"))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestGitHubIssue(t *testing.T) {
+	clearBucket(t)
+	withGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/acme/app/issues", r.URL.Path)
+		assert.Equal(t, "Bearer ghp_test", r.Header.Get("Authorization"))
+		var issue map[string]string
+		json.NewDecoder(r.Body).Decode(&issue)
+		assert.Equal(t, "Fix login", issue["title"])
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"number": 42}`))
+	})
+	router := setupRouter()
+	todo := saveTodo(t, Todo{Title: "Fix login"})
+	url := "/todos/" + strconv.Itoa(todo.ID) + "/github-issue"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var linked Todo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &linked))
+	assert.Equal(t, 42, linked.GitHubIssue)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Updates keep the link.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/todos/"+strconv.Itoa(todo.ID), strings.NewReader(`{"title":"Fix the login"}`)))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &linked))
+	assert.Equal(t, 42, linked.GitHubIssue)
+
+	// An existing issue can be linked instead.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(`{"number": 7}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &linked))
+	assert.Equal(t, 7, linked.GitHubIssue)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, url, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var unlinked Todo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &unlinked))
+	assert.Zero(t, unlinked.GitHubIssue)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos/999/github-issue", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config.GitHubToken = ""
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestGitHubIssueOnCreate(t *testing.T) {
+	clearBucket(t)
+	withGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number": 5}`))
+	})
+
+	todo := saveTodo(t, Todo{Title: "Not queued"})
+	assert.Len(t, githubIssueQueue, 0)
+
+	config.GitHubIssueOnCreate = true
+	todo = saveTodo(t, Todo{Title: "Queued"})
+	assert.Equal(t, todo.ID, <-githubIssueQueue)
+	saveTodo(t, todo)
+	assert.Len(t, githubIssueQueue, 0)
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	clearBucket(t)
+	withGitHub(t, nil)
+	router := setupRouter()
+	todo := saveTodo(t, Todo{Title: "Fix login", Status: StatusBlocked, GitHubIssue: 42})
+	other := saveTodo(t, Todo{Title: "Other", GitHubIssue: 43})
+
+	deliver := func(req *http.Request) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	stored := func(id int) Todo {
+		var todo *Todo
+		db.View(func(tx *bolt.Tx) error {
+			todo, _ = loadTodo(tx, id)
+			return nil
+		})
+		return *todo
+	}
+
+	closed := `{"action":"closed","issue":{"number":42},"repository":{"full_name":"Acme/App"}}`
+	forged := githubDelivery("issues", closed)
+	forged.Header.Set("X-Hub-Signature-256", "sha256=00")
+	assert.Equal(t, http.StatusUnauthorized, deliver(forged))
+	assert.False(t, stored(todo.ID).Completed)
+
+	assert.Equal(t, http.StatusNoContent, deliver(githubDelivery("ping", `{"zen":"Keep it simple."}`)))
+
+	assert.Equal(t, http.StatusNoContent, deliver(githubDelivery("issues", closed)))
+	assert.True(t, stored(todo.ID).Completed)
+	assert.Equal(t, StatusDone, stored(todo.ID).Status)
+	assert.False(t, stored(other.ID).Completed)
+
+	// Issues in other repositories are ignored.
+	assert.Equal(t, http.StatusNoContent, deliver(githubDelivery("issues", `{"action":"closed","issue":{"number":43},"repository":{"full_name":"acme/other"}}`)))
+	assert.False(t, stored(other.ID).Completed)
+
+	assert.Equal(t, http.StatusNoContent, deliver(githubDelivery("issues", `{"action":"reopened","issue":{"number":42},"repository":{"full_name":"acme/app"}}`)))
+	assert.False(t, stored(todo.ID).Completed)
+	assert.Equal(t, StatusTodo, stored(todo.ID).Status)
+
+	config.GitHubWebhookSecret = ""
+	assert.Equal(t, http.StatusForbidden, deliver(githubDelivery("issues", closed)))
+}
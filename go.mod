@@ -5,6 +5,9 @@ go 1.25
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/gorilla/mux v1.8.1
+	github.com/json-iterator/go v1.1.12
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421
+	github.com/modern-go/reflect2 v1.0.2
 	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.10.0
 	go.etcd.io/bbolt v1.4.2
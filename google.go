@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Google's endpoints are variables so tests can point them at a fake.
+var (
+	googleAuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	googleTasksAPI = "https://tasks.googleapis.com/tasks/v1"
+)
+
+func init() {
+	integrations["google"] = &integration{
+		name: "google",
+		oauth: func() oauthConfig {
+			return oauthConfig{
+				ClientID:     config.GoogleClientID,
+				ClientSecret: secret("GOOGLE_CLIENT_SECRET", config.GoogleClientSecret),
+				AuthURL:      googleAuthURL,
+				TokenURL:     googleTokenURL,
+				Scopes:       []string{"https://www.googleapis.com/auth/tasks"},
+				// Without these Google issues no refresh token, or only on
+				// the first consent.
+				AuthParams: url.Values{"access_type": {"offline"}, "prompt": {"consent"}},
+			}
+		},
+		connect: func(client *http.Client, taskList string) taskService {
+			return &googleTasks{client: client, list: taskList}
+		},
+	}
+}
+
+// googleTask is a task in the Google Tasks API. Google has no priorities,
+// and keeps only the date of a due time.
+type googleTask struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Status  string `json:"status"`
+	Due     string `json:"due"`
+	Updated string `json:"updated"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (t googleTask) remote() remoteTask {
+	task := remoteTask{ID: t.ID, Title: t.Title, Completed: t.Status == "completed"}
+	if len(t.Due) >= len(dueDateLayout) {
+		task.DueDate = t.Due[:len(dueDateLayout)]
+	}
+	task.Updated, _ = time.Parse(time.RFC3339, t.Updated)
+	return task
+}
+
+// googleBody is what is sent for a task. Clearing the due date or
+// reopening a task needs explicit nulls, so it is a map.
+func googleBody(t remoteTask) map[string]interface{} {
+	body := map[string]interface{}{"title": t.Title, "status": "needsAction", "due": nil, "completed": nil}
+	if t.Completed {
+		body["status"] = "completed"
+		delete(body, "completed")
+	}
+	if t.DueDate != "" {
+		body["due"] = t.DueDate + "T00:00:00.000Z"
+	}
+	return body
+}
+
+// googleTasks is one Google task list.
+type googleTasks struct {
+	client *http.Client
+	list   string
+}
+
+func (g *googleTasks) tasksURL() string {
+	return googleTasksAPI + "/lists/" + url.PathEscape(g.list) + "/tasks"
+}
+
+func (g *googleTasks) listTasks() ([]remoteTask, error) {
+	var tasks []remoteTask
+	pageToken := ""
+	for {
+		q := url.Values{"showCompleted": {"true"}, "showHidden": {"true"}, "maxResults": {"100"}}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		var page struct {
+			Items         []googleTask `json:"items"`
+			NextPageToken string       `json:"nextPageToken"`
+		}
+		if err := apiRequest(g.client, http.MethodGet, g.tasksURL()+"?"+q.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, t := range page.Items {
+			if !t.Deleted {
+				tasks = append(tasks, t.remote())
+			}
+		}
+		if page.NextPageToken == "" {
+			return tasks, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (g *googleTasks) createTask(t remoteTask) (remoteTask, error) {
+	var created googleTask
+	err := apiRequest(g.client, http.MethodPost, g.tasksURL(), googleBody(t), &created)
+	return created.remote(), err
+}
+
+func (g *googleTasks) updateTask(t remoteTask) (remoteTask, error) {
+	var updated googleTask
+	err := apiRequest(g.client, http.MethodPatch, g.tasksURL()+"/"+url.PathEscape(t.ID), googleBody(t), &updated)
+	return updated.remote(), err
+}
+
+func (g *googleTasks) deleteTask(id string) error {
+	return apiRequest(g.client, http.MethodDelete, g.tasksURL()+"/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGoogle serves the token endpoint and one task list of the Tasks API.
+type fakeGoogle struct {
+	mu    sync.Mutex
+	tasks []map[string]interface{}
+	// grants counts the token requests by grant type.
+	grants map[string]int
+}
+
+func (g *fakeGoogle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		r.ParseForm()
+		g.grants[r.PostForm.Get("grant_type")]++
+		if r.PostForm.Get("client_secret") != "shh" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-" + r.PostForm.Get("grant_type"),
+			"refresh_token": "refresh",
+			"expires_in":    3600,
+		})
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer access-") {
+		http.Error(w, "unauthenticated", http.StatusUnauthorized)
+		return
+	}
+	const prefix = "/lists/work/tasks"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": g.tasks})
+	case http.MethodPost:
+		var task map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&task)
+		task["id"] = "g" + strconv.Itoa(len(g.tasks))
+		task["updated"] = "2026-01-01T00:00:00.000Z"
+		g.tasks = append(g.tasks, task)
+		json.NewEncoder(w).Encode(task)
+	case http.MethodPatch:
+		var patch map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&patch)
+		for _, task := range g.tasks {
+			if task["id"] == id {
+				for k, v := range patch {
+					task[k] = v
+				}
+				json.NewEncoder(w).Encode(task)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case http.MethodDelete:
+		for i, task := range g.tasks {
+			if task["id"] == id {
+				g.tasks = append(g.tasks[:i], g.tasks[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
+
+func withFakeGoogle(t *testing.T) *fakeGoogle {
+	fake := &fakeGoogle{grants: make(map[string]int)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	previous := []string{googleAuthURL, googleTokenURL, googleTasksAPI, config.GoogleClientID, config.GoogleClientSecret}
+	googleAuthURL = server.URL + "/auth"
+	googleTokenURL = server.URL + "/token"
+	googleTasksAPI = server.URL
+	config.GoogleClientID, config.GoogleClientSecret = "client", "shh"
+	t.Cleanup(func() {
+		googleAuthURL, googleTokenURL, googleTasksAPI = previous[0], previous[1], previous[2]
+		config.GoogleClientID, config.GoogleClientSecret = previous[3], previous[4]
+	})
+	return fake
+}
+
+func adminRequest(router http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGoogleTasksIntegration(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+	fake := withFakeGoogle(t)
+	fake.tasks = []map[string]interface{}{
+		{"id": "g0", "title": "From Google", "status": "completed", "due": "2026-03-04T00:00:00.000Z", "updated": "2026-01-01T00:00:00.000Z"},
+		{"id": "gone", "title": "Deleted", "status": "needsAction", "deleted": true},
+	}
+	router := setupRouter()
+	saveTodo(t, Todo{Title: "From here", DueDate: "2026-05-06"})
+
+	// Syncing needs authorization first.
+	w := adminRequest(router, http.MethodPost, "/admin/integrations/google/sync", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = adminRequest(router, http.MethodGet, "/admin/integrations/google/authorize", "")
+	assert.Equal(t, http.StatusFound, w.Code)
+	consent, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/auth", consent.Path)
+	assert.Equal(t, "offline", consent.Query().Get("access_type"))
+	assert.Equal(t, "http://example.com/integrations/google/callback", consent.Query().Get("redirect_uri"))
+	state := consent.Query().Get("state")
+	assert.NotEmpty(t, state)
+
+	// The callback only accepts the state it issued.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/integrations/google/callback?code=abc&state=forged", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/integrations/google/callback?code=abc&state="+state, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, fake.grants["authorization_code"])
+
+	// The state is single use.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/integrations/google/callback?code=abc&state="+state, nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = adminRequest(router, http.MethodPost, "/admin/integrations/google/sync", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = adminRequest(router, http.MethodPut, "/admin/integrations/google", `{"taskList":"work"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = adminRequest(router, http.MethodPost, "/admin/integrations/google/sync", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result SyncResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, SyncResult{Pushed: 1, Pulled: 1}, result)
+
+	assert.Len(t, fake.tasks, 3)
+	assert.Equal(t, "From here", fake.tasks[2]["title"])
+	assert.Equal(t, "2026-05-06T00:00:00.000Z", fake.tasks[2]["due"])
+	assert.Equal(t, "needsAction", fake.tasks[2]["status"])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos?sort=id", nil))
+	var list PaginatedResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	pulled := list.Items
+	assert.Len(t, pulled, 2)
+	assert.Equal(t, "From Google", pulled[1].Title)
+	assert.Equal(t, "2026-03-04", pulled[1].DueDate)
+	assert.True(t, pulled[1].Completed)
+
+	w = adminRequest(router, http.MethodGet, "/admin/integrations/google", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status IntegrationStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.True(t, status.Configured)
+	assert.True(t, status.Authorized)
+	assert.Equal(t, "work", status.TaskList)
+	assert.Equal(t, 2, status.Linked)
+	assert.NotNil(t, status.LastSync)
+	assert.Empty(t, status.LastError)
+
+	w = adminRequest(router, http.MethodDelete, "/admin/integrations/google", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = adminRequest(router, http.MethodGet, "/admin/integrations/google", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.False(t, status.Authorized)
+
+	w = adminRequest(router, http.MethodGet, "/admin/integrations/nope", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOAuthRefresh(t *testing.T) {
+	fake := withFakeGoogle(t)
+	oauth := integrations["google"].oauth()
+
+	token, err := oauth.exchange("abc", "http://example.com/callback")
+	assert.NoError(t, err)
+	assert.Equal(t, "access-authorization_code", token.AccessToken)
+
+	// A token that isn't about to expire is used as is.
+	same, err := oauth.fresh(token)
+	assert.NoError(t, err)
+	assert.Equal(t, token, same)
+	assert.Equal(t, 0, fake.grants["refresh_token"])
+
+	token.Expiry = token.Expiry.Add(-time.Hour)
+	refreshed, err := oauth.fresh(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "access-refresh_token", refreshed.AccessToken)
+	assert.Equal(t, "refresh", refreshed.RefreshToken)
+	assert.Equal(t, 1, fake.grants["refresh_token"])
+
+	token.RefreshToken = ""
+	_, err = oauth.fresh(token)
+	assert.Error(t, err)
+
+	oauth.ClientSecret = "wrong"
+	_, err = oauth.exchange("abc", "http://example.com/callback")
+	assert.ErrorContains(t, err, "invalid_client")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// readyCheck answers 200 while the database can serve reads, and 503
+// otherwise, such as while a compaction swaps the file.
+func readyCheck(w http.ResponseWriter, r *http.Request) {
+	err := db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("todos")) == nil {
+			return fmt.Errorf("todos bucket missing")
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "database unavailable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if config.PrimaryURL != "" && replicaSyncedAt().IsZero() {
+		http.Error(w, "replica has no snapshot from the primary yet", http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ready",
+	})
+}
+
+// healthcheckTarget returns a client and the /readyz URL of a server
+// listening on addr, in the forms LISTEN takes.
+func healthcheckTarget(addr string) (*http.Client, string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}
+		return client, "http://localhost/readyz", nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, "", err
+	}
+	// A server listening on every interface answers on loopback.
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return client, "http://" + net.JoinHostPort(host, port) + "/readyz", nil
+}
+
+// runHealthcheck probes the server on addr for the healthcheck subcommand,
+// returning the exit code: 0 when it is ready, 1 otherwise.
+func runHealthcheck(addr string, stderr io.Writer) int {
+	client, url, err := healthcheckTarget(addr)
+	if err != nil {
+		fmt.Fprintln(stderr, "healthcheck:", err)
+		return 1
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintln(stderr, "healthcheck:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		fmt.Fprintf(stderr, "healthcheck: %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+	return 0
+}
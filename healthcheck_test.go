@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthcheckTarget(t *testing.T) {
+	tests := []struct {
+		addr string
+		url  string
+	}{
+		{":8080", "http://localhost:8080/readyz"},
+		{"0.0.0.0:8080", "http://localhost:8080/readyz"},
+		{"[::]:8080", "http://localhost:8080/readyz"},
+		{"127.0.0.1:9000", "http://127.0.0.1:9000/readyz"},
+		{"unix:/run/todo.sock", "http://localhost/readyz"},
+	}
+	for _, tt := range tests {
+		_, url, err := healthcheckTarget(tt.addr)
+		assert.NoError(t, err, tt.addr)
+		assert.Equal(t, tt.url, url, tt.addr)
+	}
+	_, _, err := healthcheckTarget("8080")
+	assert.Error(t, err)
+}
+
+func TestRunHealthcheck(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+	var stderr bytes.Buffer
+	assert.Equal(t, 0, runHealthcheck(strings.TrimPrefix(server.URL, "http://"), &stderr))
+	assert.Empty(t, stderr.String())
+
+	path := filepath.Join(t.TempDir(), "todo.sock")
+	l, err := listen("unix:" + path)
+	if assert.NoError(t, err) {
+		defer l.Close()
+		go http.Serve(l, setupRouter())
+		assert.Equal(t, 0, runHealthcheck("unix:"+path, &stderr))
+	}
+
+	unready := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+	}))
+	defer unready.Close()
+	assert.Equal(t, 1, runHealthcheck(strings.TrimPrefix(unready.URL, "http://"), &stderr))
+	assert.Contains(t, stderr.String(), "503 Service Unavailable: database unavailable")
+
+	stderr.Reset()
+	unready.Close()
+	assert.Equal(t, 1, runHealthcheck(strings.TrimPrefix(unready.URL, "http://"), &stderr))
+	assert.Contains(t, stderr.String(), "connection refused")
+}
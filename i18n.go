@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultLanguage is the language messages are written in, and the one
+// served when the caller asks for none of the supported languages.
+const defaultLanguage = "en"
+
+// languages are the supported languages: English and those with a catalog
+// in locales/.
+var languages = []string{defaultLanguage}
+
+// localesFS holds a catalog per language, named after its tag, such as
+// pt-BR.json. Catalogs map English messages to their translation. Messages
+// with verbs, such as "invalid priority %q: use low, medium or high", also
+// translate the messages formatted from them; the translation must keep
+// the verbs in the same order.
+//
+//go:embed locales/*.json
+var localesFS embed.FS
+
+// catalog is the translations into one language.
+type catalog struct {
+	messages map[string]string
+	patterns []messagePattern
+}
+
+// messagePattern matches the messages formatted from a catalog key.
+type messagePattern struct {
+	re          *regexp.Regexp
+	verbs       []string
+	translation string
+}
+
+var catalogs = loadCatalogs()
+
+// verbPattern finds the verbs in catalog messages.
+var verbPattern = regexp.MustCompile(`%[qsvd]`)
+
+func loadCatalogs() map[string]*catalog {
+	files, err := localesFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := make(map[string]*catalog)
+	for _, f := range files {
+		data, err := localesFS.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		c := &catalog{}
+		if err := json.Unmarshal(data, &c.messages); err != nil {
+			panic(fmt.Sprintf("locales/%s: %v", f.Name(), err))
+		}
+		for message, translation := range c.messages {
+			if p, ok := compileMessagePattern(message, translation); ok {
+				c.patterns = append(c.patterns, p)
+			}
+		}
+		// Longer patterns are more specific.
+		sort.Slice(c.patterns, func(i, j int) bool { return len(c.patterns[i].re.String()) > len(c.patterns[j].re.String()) })
+		lang := strings.TrimSuffix(f.Name(), path.Ext(f.Name()))
+		catalogs[lang] = c
+		languages = append(languages, lang)
+	}
+	return catalogs
+}
+
+func compileMessagePattern(message, translation string) (messagePattern, bool) {
+	verbs := verbPattern.FindAllString(message, -1)
+	if len(verbs) == 0 {
+		return messagePattern{}, false
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range verbPattern.FindAllStringIndex(message, -1) {
+		expr.WriteString(regexp.QuoteMeta(message[last:loc[0]]))
+		switch message[loc[0]:loc[1]] {
+		case "%q":
+			expr.WriteString(`("(?:[^"\\]|\\.)*")`)
+		case "%d":
+			expr.WriteString(`(-?\d+)`)
+		default:
+			expr.WriteString(`(.+?)`)
+		}
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(message[last:]))
+	expr.WriteString("$")
+	return messagePattern{re: regexp.MustCompile(expr.String()), verbs: verbs, translation: translation}, true
+}
+
+// localize formats a catalog message in lang, falling back to English.
+func localize(lang, format string, args ...any) string {
+	if c, ok := catalogs[lang]; ok {
+		if translation, ok := c.messages[format]; ok {
+			format = translation
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// translate translates a formatted message into lang, such as an error
+// returned to a client. Values filled in for %s and %v are translated too,
+// since they are often wrapped errors. Unknown messages are kept as is.
+func translate(lang, message string) string {
+	c, ok := catalogs[lang]
+	if !ok {
+		return message
+	}
+	if translation, ok := c.messages[message]; ok {
+		return translation
+	}
+	for _, p := range c.patterns {
+		values := p.re.FindStringSubmatch(message)
+		if values == nil {
+			continue
+		}
+		i := 0
+		return verbPattern.ReplaceAllStringFunc(p.translation, func(string) string {
+			i++
+			if i >= len(values) {
+				return ""
+			}
+			if p.verbs[i-1] == "%s" || p.verbs[i-1] == "%v" {
+				return translate(lang, values[i])
+			}
+			return values[i]
+		})
+	}
+	return message
+}
+
+// supportedLanguage returns the supported language tag matches, comparing
+// case-insensitively and falling back from a regional variant, such as
+// pt-PT or en-GB, to another of the same language.
+func supportedLanguage(tag string) (string, bool) {
+	for _, lang := range languages {
+		if strings.EqualFold(lang, tag) {
+			return lang, true
+		}
+	}
+	primary, _, _ := strings.Cut(tag, "-")
+	for _, lang := range languages {
+		langPrimary, _, _ := strings.Cut(lang, "-")
+		if strings.EqualFold(langPrimary, primary) {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// negotiateLanguage picks the supported language the Accept-Language
+// header prefers.
+func negotiateLanguage(header string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if tag != "" && q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		if lang, ok := supportedLanguage(t.tag); ok {
+			return lang
+		}
+	}
+	return defaultLanguage
+}
+
+// requestLanguage is the language to answer r in: the caller's language
+// preference, or else what Accept-Language asks for.
+func requestLanguage(r *http.Request) string {
+	if user := userFromRequest(r); user != "" && db != nil {
+		var p Preferences
+		db.View(func(tx *bolt.Tx) error {
+			var err error
+			p, err = loadPreferences(tx, user)
+			return err
+		})
+		if p.Language != "" {
+			return p.Language
+		}
+	}
+	return negotiateLanguage(r.Header.Get("Accept-Language"))
+}
+
+// maxLocalizedBody caps the error bodies held back for translation.
+const maxLocalizedBody = 4 << 10
+
+// localizeRecorder holds back plain-text error bodies, as written by
+// http.Error, to translate them once the handler is done.
+type localizeRecorder struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+	lang        string
+	body        bytes.Buffer
+}
+
+func (l *localizeRecorder) WriteHeader(status int) {
+	if l.wroteHeader {
+		return
+	}
+	l.wroteHeader = true
+	if status >= 400 && strings.HasPrefix(l.Header().Get("Content-Type"), "text/plain") {
+		if lang := requestLanguage(l.r); lang != defaultLanguage {
+			l.lang = lang
+			l.Header().Set("Content-Language", lang)
+			l.Header().Del("Content-Length")
+		}
+	}
+	l.ResponseWriter.WriteHeader(status)
+}
+
+func (l *localizeRecorder) Write(p []byte) (int, error) {
+	if !l.wroteHeader {
+		l.WriteHeader(http.StatusOK)
+	}
+	if l.lang == "" {
+		return l.ResponseWriter.Write(p)
+	}
+	if l.body.Len()+len(p) > maxLocalizedBody {
+		// Too long for an error message: send it as is.
+		l.lang = ""
+		l.ResponseWriter.Write(l.body.Bytes())
+		return l.ResponseWriter.Write(p)
+	}
+	return l.body.Write(p)
+}
+
+func (l *localizeRecorder) finish() {
+	if l.lang == "" {
+		return
+	}
+	message := strings.TrimSuffix(l.body.String(), "\n")
+	fmt.Fprintln(l.ResponseWriter, translate(l.lang, message))
+}
+
+// localizeMiddleware translates error messages into the caller's language.
+func localizeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &localizeRecorder{ResponseWriter: w, r: r}
+		next.ServeHTTP(rec, r)
+		rec.finish()
+	})
+}
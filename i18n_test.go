@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	tests := []struct {
+		header, want string
+	}{
+		{"", "en"},
+		{"pt-BR", "pt-BR"},
+		{"pt-br,en;q=0.5", "pt-BR"},
+		{"pt-PT", "pt-BR"},
+		{"fr-FR, en-GB;q=0.8", "en"},
+		{"en;q=0.4, pt;q=0.9", "pt-BR"},
+		{"pt;q=0, fr", "en"},
+		{"de", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateLanguage(tt.header))
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name, lang, message, want string
+	}{
+		{"exact", "pt-BR", "Invalid ID", "ID inválido"},
+		{"english", "en", "Invalid ID", "Invalid ID"},
+		{"pattern", "pt-BR", `invalid priority "urgent": use low, medium or high`, `prioridade inválida "urgent": use low, medium ou high`},
+		{"nested", "pt-BR", `invalid assignee: user name "a b" contains whitespace`, `responsável inválido: o nome de usuário "a b" contém espaços`},
+		{"numbers", "pt-BR", "quota exceeded: alice already has the most todos allowed, 10", "cota excedida: alice já tem o máximo de tarefas permitido, 10"},
+		{"unknown", "pt-BR", "something else went wrong", "something else went wrong"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, translate(tt.lang, tt.message))
+		})
+	}
+}
+
+func TestLocalizeMiddleware(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	tests := []struct {
+		name, user, language string
+		want                 string
+		contentLanguage      string
+	}{
+		{"default", "", "", "Invalid ID\n", ""},
+		{"accept-language", "", "pt-BR,en;q=0.5", "ID inválido\n", "pt-BR"},
+		{"preference", "alice", "en", "ID inválido\n", "pt-BR"},
+		{"unsupported", "", "fr", "Invalid ID\n", ""},
+	}
+	savePreferences(t, "alice", Preferences{Language: "pt-BR"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := requestAs(tt.user, http.MethodGet, "/todos/abc/comments", "")
+			req.Header.Set("Accept-Language", tt.language)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+			assert.Equal(t, tt.contentLanguage, w.Header().Get("Content-Language"))
+		})
+	}
+
+	// Successful responses are left alone.
+	req := requestAs("alice", http.MethodGet, "/todos", "")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Language"))
+}
+
+func TestLocalizedSMSReminder(t *testing.T) {
+	clearBucket(t)
+	sent := withTwilio(t)
+
+	savePreferences(t, "alice", Preferences{Phone: "+14155550123", SMSReminders: true, Language: "pt-BR"})
+	saveTodo(t, Todo{Title: "Pagar impostos", Assignee: "alice", Priority: "high", DueDate: "2026-10-10"})
+
+	assert.NoError(t, sendOverdueReminders(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)))
+	assert.Len(t, *sent, 1)
+	assert.Equal(t, "Atrasadas: Pagar impostos (vencida em 2026-10-10)", (*sent)[0].Get("Body"))
+}
+
+func TestLocalizedAdminLogin(t *testing.T) {
+	router := setupRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/login", nil)
+	req.Header.Set("Accept-Language", "pt-BR")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<html lang="pt-BR">`)
+	assert.Contains(t, w.Body.String(), "Entrar")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// icsPriorities maps priorities to iCalendar's 1 (highest) to 9 scale.
+var icsPriorities = map[string]int{"high": 1, "medium": 5, "low": 9}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// icsWriter writes iCalendar content lines, folded at 75 octets as RFC 5545
+// requires.
+type icsWriter struct {
+	b strings.Builder
+}
+
+func (w *icsWriter) line(name, value string) {
+	line := name + ":" + value
+	// Continuation lines start with a space, which counts towards the limit.
+	for limit := 75; len(line) > limit; limit = 74 {
+		cut := limit
+		// Don't split a UTF-8 sequence.
+		for line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	w.b.WriteString(line + "\r\n")
+}
+
+// icsUID is the UID of a todo served from host.
+func icsUID(id int, host string) string {
+	return fmt.Sprintf("todo-%d@%s", id, host)
+}
+
+// writeICSTodo writes a todo as an all-day VEVENT on its due date, or as a
+// VTODO due that day if it has a due date.
+func writeICSTodo(w *icsWriter, todo Todo, component, uid string, stamp time.Time) {
+	due, _ := time.Parse(dueDateLayout, todo.DueDate)
+
+	w.line("BEGIN", component)
+	w.line("UID", uid)
+	w.line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+	w.line("SUMMARY", icsEscaper.Replace(todo.Title))
+	if component == "VTODO" {
+		if todo.DueDate != "" {
+			w.line("DUE;VALUE=DATE", due.Format("20060102"))
+		}
+		switch todoStatus(todo) {
+		case StatusDone:
+			w.line("STATUS", "COMPLETED")
+		case StatusInProgress:
+			w.line("STATUS", "IN-PROCESS")
+		default:
+			w.line("STATUS", "NEEDS-ACTION")
+		}
+	} else {
+		w.line("DTSTART;VALUE=DATE", due.Format("20060102"))
+		w.line("DTEND;VALUE=DATE", due.AddDate(0, 0, 1).Format("20060102"))
+		w.line("TRANSP", "TRANSPARENT")
+	}
+	if p, ok := icsPriorities[todo.Priority]; ok {
+		w.line("PRIORITY", fmt.Sprint(p))
+	}
+	if len(todo.Tags) > 0 {
+		tags := make([]string, len(todo.Tags))
+		for i, tag := range todo.Tags {
+			tags[i] = icsEscaper.Replace(tag)
+		}
+		w.line("CATEGORIES", strings.Join(tags, ","))
+	}
+	w.line("END", component)
+}
+
+// getCalendarFeed serves the todos with a due date as an iCalendar feed for
+// calendar app subscriptions. It takes the listing filters of GET /todos,
+// with assignee=me meaning the token's user.
+func getCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	user, ok := feedUser(w, r)
+	if !ok {
+		return
+	}
+
+	component := "VEVENT"
+	switch r.URL.Query().Get("component") {
+	case "", "vevent":
+	case "vtodo":
+		component = "VTODO"
+	default:
+		http.Error(w, "Invalid component: use vevent or vtodo", http.StatusBadRequest)
+		return
+	}
+
+	filters, err := listFilters(r.URL.Query(), user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ics icsWriter
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("VERSION", "2.0")
+	ics.line("PRODID", "-//todo-list-service//EN")
+	ics.line("CALSCALE", "GREGORIAN")
+	ics.line("X-WR-CALNAME", "Todos")
+
+	now := clock.Now()
+	err = timedView(r, func(tx *bolt.Tx) error {
+		todos, err := viewTodos(tx, filterNode(notNode{indexNode{"due", []string{""}}}, filters))
+		if err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			writeICSTodo(&ics, todo, component, icsUID(todo.ID, r.Host), now)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ics.line("END", "VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(ics.b.String()))
+}
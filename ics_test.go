@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICSWriterFolding(t *testing.T) {
+	var w icsWriter
+	w.line("SUMMARY", strings.Repeat("é", 60))
+
+	lines := strings.Split(strings.TrimSuffix(w.b.String(), "\r\n"), "\r\n")
+	assert.Len(t, lines, 2)
+	assert.LessOrEqual(t, len(lines[0]), 75)
+	assert.True(t, strings.HasPrefix(lines[1], " é"))
+	assert.Equal(t, "SUMMARY:"+strings.Repeat("é", 60), lines[0]+lines[1][1:])
+}
+
+func TestWriteICSTodo(t *testing.T) {
+	todo := Todo{ID: 7, Title: "Pay rent, electricity; water", DueDate: "2026-11-01", Priority: "high", Tags: []string{"home"}, Status: StatusInProgress}
+	stamp := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	var event icsWriter
+	writeICSTodo(&event, todo, "VEVENT", icsUID(7, "todo.example.com"), stamp)
+	assert.Equal(t, "BEGIN:VEVENT\r\n"+
+		"UID:todo-7@todo.example.com\r\n"+
+		"DTSTAMP:20261016T090000Z\r\n"+
+		"SUMMARY:Pay rent\\, electricity\\; water\r\n"+
+		"DTSTART;VALUE=DATE:20261101\r\n"+
+		"DTEND;VALUE=DATE:20261102\r\n"+
+		"TRANSP:TRANSPARENT\r\n"+
+		"PRIORITY:1\r\n"+
+		"CATEGORIES:home\r\n"+
+		"END:VEVENT\r\n", event.b.String())
+
+	var vtodo icsWriter
+	writeICSTodo(&vtodo, todo, "VTODO", icsUID(7, "todo.example.com"), stamp)
+	assert.Contains(t, vtodo.b.String(), "DUE;VALUE=DATE:20261101\r\nSTATUS:IN-PROCESS\r\n")
+}
+
+func TestGetCalendarFeed(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, todo := range []Todo{
+		{Title: "Dated", DueDate: "2026-11-01", Assignee: "alice"},
+		{Title: "Undated"},
+		{Title: "Someone else's", DueDate: "2026-11-02", Assignee: "bob"},
+	} {
+		payload, _ := json.Marshal(todo)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+	token := issueFeedToken(t, router, "alice")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/calendar.ics?token="+token, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(body, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(body, "BEGIN:VEVENT"))
+	assert.NotContains(t, body, "Undated")
+
+	// assignee=me is the token's user.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/calendar.ics?component=vtodo&assignee=me&token="+token, nil))
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "BEGIN:VTODO"))
+	assert.Contains(t, w.Body.String(), "SUMMARY:Dated")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/calendar.ics?component=journal&token="+token, nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
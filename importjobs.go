@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// importJobsBucket holds import jobs, keyed by job ID. Uploaded files
+	// are kept in the blob store until they are staged.
+	importJobsBucket = []byte("importJobs")
+	// importStagingBucket holds a nested bucket per import job with its
+	// valid rows, keyed by row number, until the import is committed or
+	// aborted.
+	importStagingBucket = []byte("importStaging")
+)
+
+const (
+	ImportPending   = "pending"
+	ImportReady     = "ready"
+	ImportFailed    = "failed"
+	ImportCommitted = "committed"
+)
+
+const (
+	// maxImportUpload caps the size of an uploaded file.
+	maxImportUpload = 16 << 20
+	// importBatchSize is how many rows are staged per transaction, with
+	// the job's progress.
+	importBatchSize = 1000
+	// maxImportErrors is how many row errors a job reports; the rest are
+	// only counted.
+	maxImportErrors = 100
+	// importExpiryInterval is how often expired import jobs are deleted.
+	importExpiryInterval = time.Hour
+)
+
+var (
+	errImportNotFound = errors.New("import job not found")
+	errImportNotReady = errors.New("import job is not ready to commit")
+	errImportInvalid  = errors.New("import has invalid rows: fix the file, or commit with skip_invalid=true to leave them out")
+)
+
+// importJobQueue holds the IDs of import jobs to be staged.
+var importJobQueue = make(chan string, 100)
+
+// ImportRowError is why one row of an import can't be imported. Rows are
+// numbered from 1: Markdown checklist items, or JSON array elements.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportJob is an uploaded file being validated and staged in the
+// background, then committed or aborted by the caller. It reports its
+// progress and the rows that failed validation.
+type ImportJob struct {
+	ID          string     `json:"id"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	CommittedAt *time.Time `json:"committedAt,omitempty"`
+	// ExpiresAt is when a finished job and its staged rows are deleted.
+	ExpiresAt *time.Time       `json:"expiresAt,omitempty"`
+	Rows      int              `json:"rows"`
+	Processed int              `json:"processed"`
+	Valid     int              `json:"valid"`
+	Invalid   int              `json:"invalid"`
+	Errors    []ImportRowError `json:"errors,omitempty"`
+	Created   int              `json:"created,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+type storedImportJob struct {
+	ImportJob
+	// Owner is the caller who uploaded the file, the only one who sees the
+	// job.
+	Owner string `json:"owner,omitempty"`
+	Blob  string `json:"blob,omitempty"`
+}
+
+// importRow is a row read from an uploaded file, or why it couldn't be.
+type importRow struct {
+	todo Todo
+	err  error
+}
+
+// parseImportRows reads the rows of an uploaded file: the items of a
+// Markdown checklist, or the elements of a JSON array of todos, as GET
+// /todos/export writes them. An element that isn't a todo is a row with an
+// error; a file that can't be read at all is an error.
+func parseImportRows(format string, data []byte) ([]importRow, error) {
+	if format == "markdown" {
+		todos, err := parseMarkdownChecklist(bytes.NewReader(data))
+		rows := make([]importRow, len(todos))
+		for i, todo := range todos {
+			rows[i].todo = todo
+		}
+		return rows, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, errors.New("expected a JSON array of todos")
+	}
+	var rows []importRow
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("row %d: %w", len(rows)+1, err)
+		}
+		var row importRow
+		row.err = json.Unmarshal(raw, &row.todo)
+		rows = append(rows, row)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON array")
+	}
+	return rows, nil
+}
+
+// stageTodo prepares a row to be created on commit, checking it as
+// TodoService.Create would. Its ID, position and issue links aren't
+// imported, so a file exported from elsewhere can't overwrite todos or tie
+// an issue to two of them.
+func stageTodo(todo *Todo) error {
+	todo.ID = 0
+	todo.Position = ""
+	todo.GitHubIssue = 0
+	todo.JiraIssue = ""
+	if err := validateTodo(*todo); err != nil {
+		return err
+	}
+	return reconcileStatus(nil, todo)
+}
+
+func loadImportJob(tx *bolt.Tx, id string) (*storedImportJob, error) {
+	v := tx.Bucket(importJobsBucket).Get([]byte(id))
+	if v == nil {
+		return nil, nil
+	}
+	var job storedImportJob
+	if err := codec.Unmarshal(v, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func putImportJob(tx *bolt.Tx, job storedImportJob) error {
+	buf, err := codec.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(importJobsBucket).Put([]byte(job.ID), buf)
+}
+
+// deleteImportJob deletes a job and its staged rows, returning the key of
+// its uploaded file, if it still has one.
+func deleteImportJob(tx *bolt.Tx, id string) (string, error) {
+	job, err := loadImportJob(tx, id)
+	if err != nil || job == nil {
+		return "", err
+	}
+	if err := tx.Bucket(importStagingBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+		return "", err
+	}
+	return job.Blob, tx.Bucket(importJobsBucket).Delete([]byte(id))
+}
+
+// finishImportJob marks a job ready, or failed with failure, and deletes
+// its uploaded file.
+func finishImportJob(id string, failure error) {
+	var blob string
+	err := writeTx(func(tx *bolt.Tx) error {
+		blob = ""
+		job, err := loadImportJob(tx, id)
+		if err != nil || job == nil {
+			return err
+		}
+		now := clock.Now().UTC()
+		job.CompletedAt = &now
+		if config.ImportRetention > 0 {
+			expires := now.Add(config.ImportRetention)
+			job.ExpiresAt = &expires
+		}
+		job.Status = ImportReady
+		if failure != nil {
+			if err := tx.Bucket(importStagingBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+			job.Status = ImportFailed
+			job.Error = failure.Error()
+		}
+		blob, job.Blob = job.Blob, ""
+		return putImportJob(tx, *job)
+	})
+	if err != nil {
+		warnf("saving import job %s: %v", id, err)
+	}
+	if blob != "" {
+		deleteBlobs([]string{blob})
+	}
+}
+
+// buildImportJob validates the rows of a pending import job and stages the
+// valid ones, a batch per transaction so the job's progress can be
+// followed. An aborted job is dropped.
+func buildImportJob(id string) {
+	var job *storedImportJob
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = loadImportJob(tx, id)
+		return err
+	})
+	if err != nil {
+		warnf("loading import job %s: %v", id, err)
+		return
+	}
+	if job == nil || job.Status != ImportPending {
+		return
+	}
+
+	data, err := blobs.get(job.Blob)
+	if err != nil {
+		warnf("reading the upload of import job %s: %v", id, err)
+		finishImportJob(id, errors.New("the uploaded file could not be read; upload it again"))
+		return
+	}
+	rows, err := parseImportRows(job.Format, data)
+	if err == nil && len(rows) == 0 {
+		err = errors.New("no rows found")
+	}
+	if err != nil {
+		finishImportJob(id, err)
+		return
+	}
+
+	// A job resumed after a restart starts over.
+	err = writeTx(func(tx *bolt.Tx) error {
+		job, err := loadImportJob(tx, id)
+		if err != nil || job == nil {
+			return err
+		}
+		if err := tx.Bucket(importStagingBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.Bucket(importStagingBucket).CreateBucket([]byte(id)); err != nil {
+			return err
+		}
+		job.Rows = len(rows)
+		job.Processed, job.Valid, job.Invalid, job.Errors = 0, 0, 0, nil
+		return putImportJob(tx, *job)
+	})
+	if err != nil {
+		warnf("staging import job %s: %v", id, err)
+		finishImportJob(id, errors.New("the import could not be staged; upload it again"))
+		return
+	}
+
+	for start := 0; start < len(rows); start += importBatchSize {
+		batch := rows[start:min(start+importBatchSize, len(rows))]
+		for i := range batch {
+			if batch[i].err == nil {
+				batch[i].err = stageTodo(&batch[i].todo)
+			}
+		}
+
+		aborted := false
+		err := writeTx(func(tx *bolt.Tx) error {
+			job, err := loadImportJob(tx, id)
+			if aborted = err == nil && job == nil; err != nil || aborted {
+				return err
+			}
+			staging := tx.Bucket(importStagingBucket).Bucket([]byte(id))
+			for i, row := range batch {
+				n := start + i + 1
+				if row.err != nil {
+					job.Invalid++
+					if len(job.Errors) < maxImportErrors {
+						job.Errors = append(job.Errors, ImportRowError{Row: n, Error: row.err.Error()})
+					}
+					continue
+				}
+				buf, err := codec.Marshal(row.todo)
+				if err != nil {
+					return err
+				}
+				if err := staging.Put(itob(n), buf); err != nil {
+					return err
+				}
+				job.Valid++
+			}
+			job.Processed += len(batch)
+			return putImportJob(tx, *job)
+		})
+		if aborted {
+			return
+		}
+		if err != nil {
+			warnf("staging import job %s: %v", id, err)
+			finishImportJob(id, errors.New("the import could not be staged; upload it again"))
+			return
+		}
+	}
+	finishImportJob(id, nil)
+}
+
+// runImportJobQueue stages the jobs still pending from before a restart,
+// then those queued by createImportJob, until ctx is cancelled.
+func runImportJobQueue(ctx context.Context) error {
+	var pending []string
+	var err error
+	usingDB(func() {
+		err = db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(importJobsBucket).ForEach(func(k, v []byte) error {
+				var job storedImportJob
+				if err := codec.Unmarshal(v, &job); err != nil {
+					return err
+				}
+				if job.Status == ImportPending {
+					pending = append(pending, job.ID)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		warnf("finding pending import jobs: %v", err)
+	}
+	for _, id := range pending {
+		if ctx.Err() != nil {
+			return nil
+		}
+		usingDB(func() { buildImportJob(id) })
+	}
+
+	for {
+		select {
+		case id := <-importJobQueue:
+			usingDB(func() { buildImportJob(id) })
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// expireImportJobs deletes finished import jobs past their expiry, with
+// any rows still staged.
+func expireImportJobs(now time.Time) error {
+	n := 0
+	err := writeTx(func(tx *bolt.Tx) error {
+		var expired []string
+		err := tx.Bucket(importJobsBucket).ForEach(func(k, v []byte) error {
+			var job storedImportJob
+			if err := codec.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if job.ExpiresAt != nil && !now.Before(*job.ExpiresAt) {
+				expired = append(expired, job.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range expired {
+			if _, err := deleteImportJob(tx, id); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	if err == nil && n > 0 {
+		debugf("expired %d import jobs", n)
+	}
+	return err
+}
+
+// createImportJob takes a Markdown checklist or a JSON array of todos as
+// the request body and queues it to be validated and staged, answering 202
+// with the job.
+func createImportJob(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "markdown" && format != "json" {
+		http.Error(w, "Invalid format: use markdown or json", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportUpload))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Import is larger than %d bytes", maxImportUpload), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "Send the file to import as the request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	blob, err := randomToken()
+	if err == nil {
+		err = blobs.put(blob, data)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job := storedImportJob{
+		ImportJob: ImportJob{ID: id, Format: format, Status: ImportPending, RequestedAt: clock.Now().UTC()},
+		Owner:     userFromRequest(r),
+		Blob:      blob,
+	}
+	if err := writeTx(func(tx *bolt.Tx) error { return putImportJob(tx, job) }); err != nil {
+		deleteBlobs([]string{blob})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case importJobQueue <- id:
+	default:
+		writeTx(func(tx *bolt.Tx) error { return tx.Bucket(importJobsBucket).Delete([]byte(id)) })
+		deleteBlobs([]string{blob})
+		http.Error(w, "Too many imports are being prepared; try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Location", "/imports/"+id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.ImportJob)
+}
+
+// getCallerImportJob loads the import job named in the path, answering 404
+// unless the caller uploaded it.
+func getCallerImportJob(w http.ResponseWriter, r *http.Request) (*storedImportJob, bool) {
+	var job *storedImportJob
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = loadImportJob(tx, mux.Vars(r)["id"])
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if job == nil || job.Owner != userFromRequest(r) {
+		http.Error(w, errImportNotFound.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+// getImportJob reports on an import job: its progress and the rows that
+// failed validation.
+func getImportJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := getCallerImportJob(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(job.ImportJob)
+}
+
+// commitImportJob creates a todo for every staged row of a ready import
+// job, all in one transaction: if one can't be created, such as over a
+// quota, none are. With skip_invalid=true, rows that failed validation are
+// left out; otherwise they fail the commit.
+func commitImportJob(w http.ResponseWriter, r *http.Request) {
+	current, ok := getCallerImportJob(w, r)
+	if !ok {
+		return
+	}
+	skipInvalid := r.URL.Query().Get("skip_invalid") == "true"
+
+	var job *storedImportJob
+	err := writeTx(func(tx *bolt.Tx) error {
+		var err error
+		if job, err = loadImportJob(tx, current.ID); err != nil {
+			return err
+		}
+		switch {
+		case job == nil:
+			return errImportNotFound
+		case job.Status != ImportReady:
+			return errImportNotReady
+		case job.Invalid > 0 && !skipInvalid:
+			return errImportInvalid
+		}
+
+		staging := tx.Bucket(importStagingBucket).Bucket([]byte(job.ID))
+		var rows []int
+		var todos []Todo
+		err = staging.ForEach(func(k, v []byte) error {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			rows = append(rows, int(binary.BigEndian.Uint64(k)))
+			todos = append(todos, todo)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range todos {
+			todos[i].CreatedBy = job.Owner
+			if err := todoService.save(tx, nil, &todos[i], false); err != nil {
+				return fmt.Errorf("row %d: %w", rows[i], err)
+			}
+		}
+		if err := tx.Bucket(importStagingBucket).DeleteBucket([]byte(job.ID)); err != nil {
+			return err
+		}
+
+		now := clock.Now().UTC()
+		job.Status = ImportCommitted
+		job.CommittedAt = &now
+		job.Created = len(todos)
+		if config.ImportRetention > 0 {
+			expires := now.Add(config.ImportRetention)
+			job.ExpiresAt = &expires
+		}
+		return putImportJob(tx, *job)
+	})
+	switch {
+	case errors.Is(err, errImportNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errImportNotReady):
+		http.Error(w, "Import is "+job.Status, http.StatusConflict)
+	case errors.Is(err, errImportInvalid):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		writeServiceError(w, err)
+	default:
+		json.NewEncoder(w).Encode(job.ImportJob)
+	}
+}
+
+// abortImportJob deletes an import job with its staged rows. Aborting a
+// pending job stops it being staged; deleting a committed one only removes
+// its report.
+func abortImportJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := getCallerImportJob(w, r)
+	if !ok {
+		return
+	}
+	var blob string
+	err := writeTx(func(tx *bolt.Tx) error {
+		var err error
+		blob, err = deleteImportJob(tx, job.ID)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if blob != "" {
+		deleteBlobs([]string{blob})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withImportRetention(t *testing.T, d time.Duration) {
+	previous := config
+	config.ImportRetention = d
+	t.Cleanup(func() { config = previous })
+}
+
+// uploadImport uploads a file as user and stages it, returning the job.
+func uploadImport(t *testing.T, router http.Handler, user, format, body string) ImportJob {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs(user, http.MethodPost, "/imports?format="+format, body))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var job ImportJob
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, "/imports/"+job.ID, w.Header().Get("Location"))
+	buildImportJob(<-importJobQueue)
+	return job
+}
+
+func importJobState(t *testing.T, router http.Handler, user, id string) ImportJob {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs(user, http.MethodGet, "/imports/"+id, ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var job ImportJob
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	return job
+}
+
+func stagingCounts(t *testing.T) (staged, blobs int) {
+	err := db.View(func(tx *bolt.Tx) error {
+		staged = tx.Bucket(importStagingBucket).Stats().KeyN
+		blobs = tx.Bucket(attachmentBlobsBucket).Stats().KeyN
+		return nil
+	})
+	assert.NoError(t, err)
+	return staged, blobs
+}
+
+func TestParseImportRows(t *testing.T) {
+	rows, err := parseImportRows("markdown", []byte("# Home\n- [ ] Pay rent\nnotes\n- [x] Water plants\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []importRow{
+		{todo: Todo{Title: "Pay rent", Tags: []string{"Home"}}},
+		{todo: Todo{Title: "Water plants", Completed: true, Tags: []string{"Home"}}},
+	}, rows)
+
+	rows, err = parseImportRows("json", []byte(`[{"title":"Pay rent"}, {"title":5}, {"title":"Review PR","priority":"high"}]`))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, Todo{Title: "Pay rent"}, rows[0].todo)
+	assert.Error(t, rows[1].err)
+	assert.Equal(t, Todo{Title: "Review PR", Priority: "high"}, rows[2].todo)
+
+	for _, bad := range []string{`{"title":"Pay rent"}`, `[{"title":"Pay rent"`, `[{"title":"Pay rent"}] trailing`, ``} {
+		_, err := parseImportRows("json", []byte(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestImportJob(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	withClock(t, start)
+	withImportRetention(t, 24*time.Hour)
+	router := setupRouter()
+	serve := func(method, url, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, requestAs(user, method, url, ""))
+		return w
+	}
+
+	job := uploadImport(t, router, "alice", "json", `[
+		{"id": 7, "title": "Pay rent", "githubIssue": 12},
+		{"title": "Pay bills", "dueDate": "tomorrow"},
+		{"title": "Review PR", "priority": "urgent"},
+		{"title": "Water plants", "status": "done"}
+	]`)
+	job = importJobState(t, router, "alice", job.ID)
+	assert.Equal(t, ImportReady, job.Status)
+	assert.Equal(t, 4, job.Rows)
+	assert.Equal(t, 4, job.Processed)
+	assert.Equal(t, 2, job.Valid)
+	assert.Equal(t, 2, job.Invalid)
+	assert.Equal(t, []int{2, 3}, []int{job.Errors[0].Row, job.Errors[1].Row})
+	assert.Contains(t, job.Errors[1].Error, "urgent")
+	assert.Equal(t, start.Add(24*time.Hour), *job.ExpiresAt)
+	// Staged rows aren't todos yet, and the upload is gone.
+	assert.Empty(t, localTitles(t))
+	_, blobs := stagingCounts(t)
+	assert.Zero(t, blobs)
+
+	jobURL := "/imports/" + job.ID
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, jobURL, "bob").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, jobURL+"/commit", "bob").Code)
+
+	w := serve(http.MethodPost, jobURL+"/commit", "alice")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "skip_invalid")
+	assert.Empty(t, localTitles(t))
+
+	w = serve(http.MethodPost, jobURL+"/commit?skip_invalid=true", "alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, ImportCommitted, job.Status)
+	assert.Equal(t, 2, job.Created)
+	assert.Equal(t, start, *job.CommittedAt)
+
+	assert.Equal(t, []string{"Pay rent", "Water plants"}, localTitles(t))
+	assert.NoError(t, db.View(func(tx *bolt.Tx) error {
+		first, err := loadTodo(tx, 1)
+		assert.Equal(t, "Pay rent", first.Title)
+		assert.Zero(t, first.GitHubIssue)
+		second, _ := loadTodo(tx, 2)
+		assert.True(t, second.Completed)
+		return err
+	}))
+
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, jobURL+"/commit", "alice").Code)
+	staged, _ := stagingCounts(t)
+	assert.Zero(t, staged)
+}
+
+func TestImportJobMarkdown(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	job := uploadImport(t, router, "", "markdown", "## work\n- [ ] Review PR\n- [x] Ship release\n")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("", http.MethodPost, "/imports/"+job.ID+"/commit", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.ElementsMatch(t, []string{"Review PR", "Ship release"}, localTitles(t))
+}
+
+func TestImportJobCommitIsAtomic(t *testing.T) {
+	clearBucket(t)
+	withQuotas(t, 2, 0, 0)
+	router := setupRouter()
+	saveTodo(t, Todo{Title: "Pay rent", CreatedBy: "alice"})
+	job := uploadImport(t, router, "alice", "json", `[{"title":"Review PR","assignee":"alice"},{"title":"Ship release","assignee":"alice"}]`)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodPost, "/imports/"+job.ID+"/commit", ""))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "row 2")
+	assert.Equal(t, []string{"Pay rent"}, localTitles(t))
+	// The job can still be committed once there's room.
+	assert.Equal(t, ImportReady, importJobState(t, router, "alice", job.ID).Status)
+}
+
+func TestImportJobFailed(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	for _, tt := range []struct{ format, body, err string }{
+		{"markdown", "Just some notes\n", "no rows found"},
+		{"json", `{"title":"Pay rent"}`, "expected a JSON array of todos"},
+	} {
+		job := uploadImport(t, router, "alice", tt.format, tt.body)
+		job = importJobState(t, router, "alice", job.ID)
+		assert.Equal(t, ImportFailed, job.Status)
+		assert.Equal(t, tt.err, job.Error)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, requestAs("alice", http.MethodPost, "/imports/"+job.ID+"/commit", ""))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	}
+	_, blobs := stagingCounts(t)
+	assert.Zero(t, blobs)
+}
+
+func TestCreateImportJobRejects(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	tests := []struct {
+		url, body string
+		code      int
+	}{
+		{"/imports?format=csv", "title\nPay rent\n", http.StatusBadRequest},
+		{"/imports?format=json", "", http.StatusBadRequest},
+		{"/imports?format=json", strings.Repeat(" ", maxImportUpload+1), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString(tt.body)))
+		assert.Equal(t, tt.code, w.Code, tt.url)
+	}
+	assert.Empty(t, importJobQueue)
+}
+
+func TestAbortImportJob(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	job := uploadImport(t, router, "alice", "markdown", "- [ ] Pay rent\n")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodDelete, "/imports/"+job.ID, ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodGet, "/imports/"+job.ID, ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Aborted before it was staged, a job is dropped with its upload.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodPost, "/imports?format=markdown", "- [ ] Pay rent\n"))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodDelete, "/imports/"+job.ID, ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	buildImportJob(<-importJobQueue)
+
+	staged, blobs := stagingCounts(t)
+	assert.Zero(t, staged)
+	assert.Zero(t, blobs)
+	assert.Empty(t, localTitles(t))
+}
+
+func TestExpireImportJobs(t *testing.T) {
+	clearBucket(t)
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	withClock(t, start)
+	withImportRetention(t, time.Hour)
+	router := setupRouter()
+	job := uploadImport(t, router, "alice", "markdown", "- [ ] Pay rent\n")
+
+	assert.NoError(t, expireImportJobs(start.Add(59*time.Minute)))
+	importJobState(t, router, "alice", job.ID)
+	assert.NoError(t, expireImportJobs(start.Add(time.Hour)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodGet, "/imports/"+job.ID, ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	staged, _ := stagingCounts(t)
+	assert.Zero(t, staged)
+}
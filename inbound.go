@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// inboundHooksBucket maps inbound hook tokens to their InboundHook. Services
+// such as Zapier or an alert manager post to the hook's URL, which carries
+// the token in place of X-User.
+var inboundHooksBucket = []byte("inboundHooks")
+
+const maxInboundPayload = 1 << 20
+
+var errHookNotFound = errors.New("inbound hook not found")
+
+// InboundHook turns JSON posted to /hooks/inbound/{token} into a todo for
+// its owner. Template is a Go text/template run over the payload that must
+// produce a todo as JSON; without one, the payload is the todo.
+type InboundHook struct {
+	Token     string    `json:"token"`
+	Owner     string    `json:"owner"`
+	Template  string    `json:"template,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// hookFuncs are available in hook templates: json writes a payload value
+// as a JSON literal, so strings are quoted and escaped.
+var hookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		buf, err := json.Marshal(v)
+		return string(buf), err
+	},
+}
+
+func parseHookTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		text = "{{json .}}"
+	}
+	return template.New("hook").Funcs(hookFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// hookTodo maps a payload to a todo with hook's template. Todos are
+// assigned to the hook's owner unless the template says otherwise.
+func hookTodo(hook InboundHook, payload interface{}) (Todo, error) {
+	tmpl, err := parseHookTemplate(hook.Template)
+	if err != nil {
+		return Todo{}, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, payload); err != nil {
+		return Todo{}, err
+	}
+
+	todo := Todo{Assignee: hook.Owner}
+	if err := json.Unmarshal(out.Bytes(), &todo); err != nil {
+		return Todo{}, fmt.Errorf("template output is not a todo: %v", err)
+	}
+	if strings.TrimSpace(todo.Title) == "" {
+		return Todo{}, errors.New("template output has no title")
+	}
+	return todo, validateTodo(todo)
+}
+
+func loadInboundHook(tx *bolt.Tx, token string) (*InboundHook, error) {
+	v := tx.Bucket(inboundHooksBucket).Get([]byte(token))
+	if v == nil {
+		return nil, nil
+	}
+	var hook InboundHook
+	if err := codec.Unmarshal(v, &hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// userInboundHooks returns user's hooks, oldest first.
+func userInboundHooks(tx *bolt.Tx, user string) ([]InboundHook, error) {
+	hooks := []InboundHook{}
+	err := tx.Bucket(inboundHooksBucket).ForEach(func(_, v []byte) error {
+		var hook InboundHook
+		if err := codec.Unmarshal(v, &hook); err != nil {
+			return err
+		}
+		if hook.Owner == user {
+			hooks = append(hooks, hook)
+		}
+		return nil
+	})
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+	return hooks, err
+}
+
+// revokeInboundHooks deletes every hook of user.
+func revokeInboundHooks(tx *bolt.Tx, user string) error {
+	hooks, err := userInboundHooks(tx, user)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if err := tx.Bucket(inboundHooksBucket).Delete([]byte(hook.Token)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getInboundHooks lists the caller's inbound hooks.
+func getInboundHooks(w http.ResponseWriter, r *http.Request) {
+	user, ok := accountUser(w, r)
+	if !ok {
+		return
+	}
+
+	var hooks []InboundHook
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		hooks, err = userInboundHooks(tx, user)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// createInboundHook issues the caller a hook token with the given template.
+func createInboundHook(w http.ResponseWriter, r *http.Request) {
+	user, ok := accountUser(w, r)
+	if !ok {
+		return
+	}
+
+	var hook InboundHook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := parseHookTemplate(hook.Template); err != nil {
+		http.Error(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hook.Token, hook.Owner, hook.CreatedAt = token, user, clock.Now().UTC()
+
+	err = writeTx(func(tx *bolt.Tx) error {
+		buf, err := codec.Marshal(hook)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(inboundHooksBucket).Put([]byte(token), buf)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// deleteInboundHook revokes one of the caller's hooks.
+func deleteInboundHook(w http.ResponseWriter, r *http.Request) {
+	user, ok := accountUser(w, r)
+	if !ok {
+		return
+	}
+	token := mux.Vars(r)["token"]
+
+	err := writeTx(func(tx *bolt.Tx) error {
+		hook, err := loadInboundHook(tx, token)
+		if err != nil {
+			return err
+		}
+		if hook == nil || hook.Owner != user {
+			return errHookNotFound
+		}
+		return tx.Bucket(inboundHooksBucket).Delete([]byte(token))
+	})
+	if err == errHookNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// receiveInboundHook creates a todo from a payload posted to a hook.
+func receiveInboundHook(w http.ResponseWriter, r *http.Request) {
+	var hook *InboundHook
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		hook, err = loadInboundHook(tx, mux.Vars(r)["token"])
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hook == nil {
+		http.Error(w, "Invalid hook token", http.StatusUnauthorized)
+		return
+	}
+
+	var payload interface{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInboundPayload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		http.Error(w, "Invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	todo, err := hookTodo(*hook, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	todo.CreatedBy = hook.Owner
+	if todo, err = todoService.Create(todo); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(todo)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func createHook(t *testing.T, router http.Handler, user, template string) InboundHook {
+	body, _ := json.Marshal(map[string]string{"template": template})
+	req := httptest.NewRequest(http.MethodPost, "/me/inbound-hooks", strings.NewReader(string(body)))
+	req.Header.Set(userHeader, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var hook InboundHook
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	return hook
+}
+
+func TestInboundHook(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	alerts := createHook(t, router, "alice", `{"title": {{json .alert.name}}, "priority": "high", "tags": ["alert", {{json .alert.severity}}]}`)
+	plain := createHook(t, router, "alice", "")
+	assert.Equal(t, "alice", alerts.Owner)
+	assert.NotEmpty(t, alerts.Token)
+
+	tests := []struct {
+		name           string
+		token          string
+		payload        string
+		expectedStatus int
+		expected       Todo
+	}{
+		{"mapped by template", alerts.Token, `{"alert":{"name":"Disk 91% full on db-1","severity":"critical"}}`, http.StatusCreated,
+			Todo{Title: "Disk 91% full on db-1", Assignee: "alice", CreatedBy: "alice", Priority: "high", Tags: []string{"alert", "critical"}, Status: StatusTodo}},
+		{"payload is the todo", plain.Token, `{"title":"Renew domain","dueDate":"2026-11-01","assignee":"bob"}`, http.StatusCreated,
+			Todo{Title: "Renew domain", Assignee: "bob", CreatedBy: "alice", DueDate: "2026-11-01", Status: StatusTodo}},
+		{"missing title", alerts.Token, `{"alert":{"severity":"low"}}`, http.StatusUnprocessableEntity, Todo{}},
+		{"invalid todo", plain.Token, `{"title":"Renew domain","priority":"urgent"}`, http.StatusUnprocessableEntity, Todo{}},
+		{"not JSON", plain.Token, `title=Renew`, http.StatusBadRequest, Todo{}},
+		{"unknown token", "nope", `{"title":"Renew domain"}`, http.StatusUnauthorized, Todo{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hooks/inbound/"+tt.token, strings.NewReader(tt.payload))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			var todo Todo
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &todo))
+			assert.NotZero(t, todo.ID)
+			tt.expected.ID, tt.expected.Position = todo.ID, todo.Position
+			assert.Equal(t, tt.expected, todo)
+		})
+	}
+}
+
+func TestInboundHookManagement(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	first := createHook(t, router, "alice", `{"title": {{json .subject}}}`)
+	createHook(t, router, "alice", "")
+	createHook(t, router, "bob", "")
+
+	request := func(method, url, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set(userHeader, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodGet, "/me/inbound-hooks", "alice", "")
+	var hooks []InboundHook
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hooks))
+	assert.Len(t, hooks, 2)
+	assert.Equal(t, first, hooks[0])
+
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/me/inbound-hooks", "alice", `{"template":"{{json .subject"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/me/inbound-hooks", "", "").Code)
+
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, "/me/inbound-hooks/"+first.Token, "bob", "").Code)
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/me/inbound-hooks/"+first.Token, "alice", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/hooks/inbound/"+first.Token, "", `{"subject":"Hi"}`).Code)
+
+	db.Update(func(tx *bolt.Tx) error { return revokeInboundHooks(tx, "alice") })
+	w = request(http.MethodGet, "/me/inbound-hooks", "alice", "")
+	assert.JSONEq(t, `[]`, w.Body.String())
+	w = request(http.MethodGet, "/me/inbound-hooks", "bob", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hooks))
+	assert.Len(t, hooks, 1)
+}
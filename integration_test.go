@@ -12,16 +12,15 @@ import (
 )
 
 func setupTestServer(t *testing.T) *httptest.Server {
-	setupTestDB()
+	useTestDB(t)
 
-	r := setupRouter()
-	return httptest.NewServer(r)
+	server := httptest.NewServer(setupRouter())
+	t.Cleanup(server.Close)
+	return server
 }
 
 func TestIntegrationTodoLifecycle(t *testing.T) {
 	server := setupTestServer(t)
-	defer server.Close()
-	defer cleanupTestDB()
 
 	// 1. Create a new todo
 	createPayload := Todo{
@@ -130,8 +129,6 @@ func TestIntegrationTodoLifecycle(t *testing.T) {
 
 func TestIntegrationHealthCheck(t *testing.T) {
 	server := setupTestServer(t)
-	defer server.Close()
-	defer cleanupTestDB()
 
 	resp, err := http.Get(fmt.Sprintf("%s/health", server.URL))
 	assert.NoError(t, err)
@@ -0,0 +1,856 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// integrationsBucket holds a nested bucket per external task service, with
+// its connection state, the links between todos and remote tasks, and an
+// audit log of resolved conflicts.
+var integrationsBucket = []byte("integrations")
+
+var (
+	integrationStateKey = []byte("state")
+	integrationLinksKey = []byte("links")
+	integrationAuditKey = []byte("audit")
+)
+
+const (
+	integrationTimeout = 30 * time.Second
+	syncAuditSize      = 200
+)
+
+var (
+	errIntegrationNotAuthorized = errors.New("integration is not authorized")
+	errNoTaskList               = errors.New("integration has no task list")
+)
+
+// remoteTask is a task in an external service, reduced to the fields sync
+// maps onto a todo. DueDate uses dueDateLayout.
+type remoteTask struct {
+	ID        string
+	Title     string
+	Completed bool
+	DueDate   string
+	Priority  string
+	Updated   time.Time
+}
+
+// taskService is one task list of an external service.
+type taskService interface {
+	listTasks() ([]remoteTask, error)
+	createTask(t remoteTask) (remoteTask, error)
+	updateTask(t remoteTask) (remoteTask, error)
+	deleteTask(id string) error
+}
+
+// integration is an external task service todos can be synced with.
+type integration struct {
+	name string
+	// priorities is whether the service has priorities. If not, sync leaves
+	// them alone on both sides.
+	priorities bool
+	oauth      func() oauthConfig
+	connect    func(client *http.Client, taskList string) taskService
+
+	// mu keeps scheduled and manual syncs of one service from overlapping.
+	mu sync.Mutex
+}
+
+// integrations are the services registered by their provider files.
+var integrations = map[string]*integration{}
+
+// IntegrationState is what is stored about a connection to a service.
+type IntegrationState struct {
+	TaskList    string      `json:"taskList,omitempty"`
+	Token       *oauthToken `json:"token,omitempty"`
+	OAuthState  string      `json:"oauthState,omitempty"`
+	RedirectURL string      `json:"redirectUrl,omitempty"`
+	LastSync    *time.Time  `json:"lastSync,omitempty"`
+	LastError   string      `json:"lastError,omitempty"`
+}
+
+// syncLink pairs a todo with a remote task. The hashes are fingerprints of
+// both sides as of the last sync, which is how a side is known to have
+// changed since.
+type syncLink struct {
+	RemoteID   string `json:"remoteId"`
+	LocalHash  string `json:"localHash"`
+	RemoteHash string `json:"remoteHash"`
+}
+
+// SyncAudit records a conflict: a todo and its remote task both changed
+// since the last sync. Winner is "local" or "remote".
+type SyncAudit struct {
+	At       time.Time `json:"at"`
+	TodoID   int       `json:"todoId"`
+	RemoteID string    `json:"remoteId"`
+	Winner   string    `json:"winner"`
+	LocalAt  time.Time `json:"localAt"`
+	RemoteAt time.Time `json:"remoteAt"`
+}
+
+type SyncResult struct {
+	Pushed    int `json:"pushed"`
+	Pulled    int `json:"pulled"`
+	Conflicts int `json:"conflicts"`
+}
+
+type IntegrationStatus struct {
+	Name       string      `json:"name"`
+	Configured bool        `json:"configured"`
+	Authorized bool        `json:"authorized"`
+	TaskList   string      `json:"taskList,omitempty"`
+	LastSync   *time.Time  `json:"lastSync,omitempty"`
+	LastError  string      `json:"lastError,omitempty"`
+	Linked     int         `json:"linked"`
+	Conflicts  []SyncAudit `json:"conflicts"`
+}
+
+func todoTask(t Todo) remoteTask {
+	return remoteTask{Title: t.Title, Completed: t.Completed, DueDate: t.DueDate, Priority: t.Priority}
+}
+
+// fingerprint covers the fields sync maps, so a todo and its remote task
+// have the same fingerprint when they agree.
+func (in *integration) fingerprint(t remoteTask) string {
+	priority := ""
+	if in.priorities {
+		priority = t.Priority
+	}
+	return fmt.Sprintf("%q %t %s %s", t.Title, t.Completed, t.DueDate, priority)
+}
+
+// applyRemote copies a remote task's fields onto a todo. Status follows
+// completed directly: the remote side has no workflow to respect.
+func (in *integration) applyRemote(todo *Todo, t remoteTask) {
+	todo.Title = t.Title
+	todo.DueDate = t.DueDate
+	if in.priorities {
+		todo.Priority = t.Priority
+	}
+	if t.Completed != todo.Completed || todo.Status == "" {
+		todo.Completed = t.Completed
+		todo.Status = todoStatus(Todo{Completed: t.Completed})
+	}
+}
+
+const (
+	syncPushCreate = iota
+	syncPushUpdate
+	syncPushDelete
+	syncPullCreate
+	syncPullUpdate
+	syncPullDelete
+	syncRelink
+	syncUnlink
+)
+
+// syncAction is one step of a sync. todo is the local side as planned; for
+// pushes, remote becomes the service's answer once the step has run.
+type syncAction struct {
+	op     int
+	todo   Todo
+	remote remoteTask
+	audit  *SyncAudit
+}
+
+func (a syncAction) pushes() bool {
+	return a.op == syncPushCreate || a.op == syncPushUpdate || a.op == syncPushDelete
+}
+
+func (a syncAction) pulls() bool {
+	return a.op == syncPullCreate || a.op == syncPullUpdate || a.op == syncPullDelete
+}
+
+// lastChanges maps each todo ID to when it last changed, deletions included.
+func lastChanges(tx *bolt.Tx) (map[int]time.Time, error) {
+	at := make(map[int]time.Time)
+	err := tx.Bucket(changesBucket).ForEach(func(k, v []byte) error {
+		var change Change
+		if err := codec.Unmarshal(v, &change); err != nil {
+			return err
+		}
+		at[change.ID] = change.At
+		return nil
+	})
+	return at, err
+}
+
+// planSync decides what to do with every linked pair, and every todo or
+// remote task that isn't linked yet. When both sides of a pair changed, the
+// latest write wins; an edit always wins over a deletion.
+func (in *integration) planSync(tx *bolt.Tx, remote []remoteTask) ([]syncAction, error) {
+	todos := make(map[int]Todo)
+	err := tx.Bucket(todosBucket).ForEach(func(k, v []byte) error {
+		var todo Todo
+		if err := codec.Unmarshal(v, &todo); err != nil {
+			return err
+		}
+		todos[todo.ID] = todo
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	changedAt, err := lastChanges(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteByID := make(map[string]remoteTask, len(remote))
+	for _, t := range remote {
+		remoteByID[t.ID] = t
+	}
+
+	var actions []syncAction
+	linkedTodos := make(map[int]bool)
+	linkedRemote := make(map[string]bool)
+	conflict := func(id int, t remoteTask, remoteWins bool) *SyncAudit {
+		audit := &SyncAudit{At: clock.Now().UTC(), TodoID: id, RemoteID: t.ID, Winner: "local", LocalAt: changedAt[id], RemoteAt: t.Updated}
+		if remoteWins {
+			audit.Winner = "remote"
+		}
+		return audit
+	}
+
+	if b := integrationBucket(tx, in.name); b != nil {
+		err := b.Bucket(integrationLinksKey).ForEach(func(k, v []byte) error {
+			var link syncLink
+			if err := codec.Unmarshal(v, &link); err != nil {
+				return err
+			}
+			id := int(binary.BigEndian.Uint64(k))
+			linkedTodos[id] = true
+			linkedRemote[link.RemoteID] = true
+
+			local, hasLocal := todos[id]
+			t, hasRemote := remoteByID[link.RemoteID]
+			if !hasLocal {
+				local = Todo{ID: id}
+			}
+			if !hasRemote {
+				t = remoteTask{ID: link.RemoteID}
+			}
+			localHash, remoteHash := in.fingerprint(todoTask(local)), in.fingerprint(t)
+			localChanged := hasLocal && localHash != link.LocalHash
+			remoteChanged := hasRemote && remoteHash != link.RemoteHash
+
+			a := syncAction{todo: local, remote: t}
+			switch {
+			case !hasLocal && !hasRemote:
+				a.op = syncUnlink
+			case !hasLocal && remoteChanged:
+				a.op, a.audit = syncPullCreate, conflict(id, t, true)
+			case !hasLocal:
+				a.op = syncPushDelete
+			case !hasRemote && localChanged:
+				a.op, a.audit = syncPushCreate, conflict(id, t, false)
+			case !hasRemote:
+				a.op = syncPullDelete
+			case !localChanged && !remoteChanged:
+				return nil
+			case localHash == remoteHash:
+				a.op = syncRelink
+			case !remoteChanged:
+				a.op = syncPushUpdate
+			case !localChanged:
+				a.op = syncPullUpdate
+			default:
+				remoteWins := t.Updated.After(changedAt[id])
+				a.audit = conflict(id, t, remoteWins)
+				a.op = syncPushUpdate
+				if remoteWins {
+					a.op = syncPullUpdate
+				}
+			}
+			actions = append(actions, a)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range remote {
+		if !linkedRemote[t.ID] {
+			actions = append(actions, syncAction{op: syncPullCreate, remote: t})
+		}
+	}
+	c := tx.Bucket(todosBucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		id := int(binary.BigEndian.Uint64(k))
+		if !linkedTodos[id] {
+			actions = append(actions, syncAction{op: syncPushCreate, todo: todos[id]})
+		}
+	}
+	return actions, nil
+}
+
+// pushActions runs the remote side of a sync. It returns the actions that
+// are safe to apply locally: all of them, or those before a failed push.
+func pushActions(svc taskService, actions []syncAction) ([]syncAction, error) {
+	for i := range actions {
+		a := &actions[i]
+		var err error
+		switch a.op {
+		case syncPushCreate:
+			a.remote, err = svc.createTask(todoTask(a.todo))
+		case syncPushUpdate:
+			t := todoTask(a.todo)
+			t.ID = a.remote.ID
+			a.remote, err = svc.updateTask(t)
+		case syncPushDelete:
+			err = svc.deleteTask(a.remote.ID)
+		}
+		if err != nil {
+			return actions[:i], err
+		}
+	}
+	return actions, nil
+}
+
+// applyActions applies the local side of a sync and records the links.
+func (in *integration) applyActions(tx *bolt.Tx, actions []syncAction) error {
+	b, err := createIntegrationBucket(tx, in.name)
+	if err != nil {
+		return err
+	}
+	links := b.Bucket(integrationLinksKey)
+
+	for _, a := range actions {
+		key := itob(a.todo.ID)
+		switch a.op {
+		case syncUnlink, syncPushDelete:
+			if err := links.Delete(key); err != nil {
+				return err
+			}
+		case syncPullDelete:
+			if err := removeTodo(tx, a.todo.ID); err != nil {
+				return err
+			}
+			if err := links.Delete(key); err != nil {
+				return err
+			}
+		case syncPushCreate, syncPushUpdate, syncRelink:
+			if err := in.putLink(links, a.todo, a.remote); err != nil {
+				return err
+			}
+		case syncPullCreate, syncPullUpdate:
+			todo := Todo{}
+			var current *Todo
+			if a.op == syncPullUpdate {
+				var err error
+				current, err = loadTodo(tx, a.todo.ID)
+				if err != nil {
+					return err
+				}
+				// Changed or deleted since the sync was planned; the
+				// next sync sorts it out.
+				if current == nil || in.fingerprint(todoTask(*current)) != in.fingerprint(todoTask(a.todo)) {
+					continue
+				}
+				todo = *current
+			} else {
+				if a.todo.ID != 0 {
+					if err := links.Delete(key); err != nil {
+						return err
+					}
+				}
+				id, _ := tx.Bucket(todosBucket).NextSequence()
+				todo.ID = int(id)
+			}
+			in.applyRemote(&todo, a.remote)
+			if err := todoService.saveExternal(tx, current, &todo); err != nil {
+				return err
+			}
+			if err := in.putLink(links, todo, a.remote); err != nil {
+				return err
+			}
+		}
+
+		if a.audit != nil {
+			if err := appendSyncAudit(b.Bucket(integrationAuditKey), *a.audit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (in *integration) putLink(links *bolt.Bucket, todo Todo, t remoteTask) error {
+	buf, err := codec.Marshal(syncLink{
+		RemoteID:   t.ID,
+		LocalHash:  in.fingerprint(todoTask(todo)),
+		RemoteHash: in.fingerprint(t),
+	})
+	if err != nil {
+		return err
+	}
+	return links.Put(itob(todo.ID), buf)
+}
+
+// appendSyncAudit records a conflict, dropping the oldest records beyond
+// syncAuditSize.
+func appendSyncAudit(b *bolt.Bucket, audit SyncAudit) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	buf, err := codec.Marshal(audit)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(itob(int(seq)), buf); err != nil {
+		return err
+	}
+	c := b.Cursor()
+	for n := b.Stats().KeyN; n > syncAuditSize; n-- {
+		k, _ := c.First()
+		if err := c.Delete(); err != nil || k == nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncTasks reconciles the todos with a remote task list. Remote writes go
+// first, so a failed push never leaves a link to a task that doesn't exist.
+func (in *integration) syncTasks(svc taskService) (SyncResult, error) {
+	var result SyncResult
+	remote, err := svc.listTasks()
+	if err != nil {
+		return result, err
+	}
+
+	var actions []syncAction
+	err = db.View(func(tx *bolt.Tx) error {
+		actions, err = in.planSync(tx, remote)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	done, pushErr := pushActions(svc, actions)
+	err = writeTx(func(tx *bolt.Tx) error {
+		return in.applyActions(tx, done)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for _, a := range done {
+		switch {
+		case a.pushes():
+			result.Pushed++
+		case a.pulls():
+			result.Pulled++
+		}
+		if a.audit != nil {
+			result.Conflicts++
+		}
+	}
+	return result, pushErr
+}
+
+func integrationBucket(tx *bolt.Tx, name string) *bolt.Bucket {
+	return tx.Bucket(integrationsBucket).Bucket([]byte(name))
+}
+
+func createIntegrationBucket(tx *bolt.Tx, name string) (*bolt.Bucket, error) {
+	b, err := tx.Bucket(integrationsBucket).CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range [][]byte{integrationLinksKey, integrationAuditKey} {
+		if _, err := b.CreateBucketIfNotExists(key); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func loadIntegrationState(tx *bolt.Tx, name string) (IntegrationState, error) {
+	var state IntegrationState
+	b := integrationBucket(tx, name)
+	if b == nil || b.Get(integrationStateKey) == nil {
+		return state, nil
+	}
+	err := codec.Unmarshal(b.Get(integrationStateKey), &state)
+	return state, err
+}
+
+// updateIntegrationState loads a service's state, lets fn change it and
+// stores it again. fn may run more than once.
+func updateIntegrationState(name string, fn func(*IntegrationState)) (IntegrationState, error) {
+	var state IntegrationState
+	err := writeTx(func(tx *bolt.Tx) error {
+		b, err := createIntegrationBucket(tx, name)
+		if err != nil {
+			return err
+		}
+		if state, err = loadIntegrationState(tx, name); err != nil {
+			return err
+		}
+		fn(&state)
+		buf, err := codec.Marshal(state)
+		if err != nil {
+			return err
+		}
+		return b.Put(integrationStateKey, buf)
+	})
+	return state, err
+}
+
+// sync syncs a service with its task list, refreshing the access token
+// first if needed, and records the outcome.
+func (in *integration) sync() (SyncResult, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	var state IntegrationState
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		state, err = loadIntegrationState(tx, in.name)
+		return err
+	})
+	if err != nil {
+		return SyncResult{}, err
+	}
+	if state.Token == nil {
+		return SyncResult{}, errIntegrationNotAuthorized
+	}
+	if state.TaskList == "" {
+		return SyncResult{}, errNoTaskList
+	}
+
+	var result SyncResult
+	token, err := in.oauth().fresh(*state.Token)
+	if err == nil {
+		client := withBreaker(in.name, &http.Client{Timeout: integrationTimeout, Transport: bearerTransport{token: token.AccessToken}})
+		result, err = in.syncTasks(in.connect(client, state.TaskList))
+	}
+
+	now := clock.Now().UTC()
+	_, saveErr := updateIntegrationState(in.name, func(s *IntegrationState) {
+		s.Token = &token
+		s.LastSync = &now
+		s.LastError = ""
+		if err != nil {
+			s.LastError = err.Error()
+		}
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, saveErr
+}
+
+// syncIntegrations syncs every connected service, as the integration-sync
+// job.
+func syncIntegrations(now time.Time) error {
+	var failed []string
+	for name, in := range integrations {
+		result, err := in.sync()
+		switch {
+		case err == errIntegrationNotAuthorized || err == errNoTaskList:
+		case err != nil:
+			warnf("%s sync failed: %v", name, err)
+			failed = append(failed, name)
+		case result != SyncResult{}:
+			infof("%s sync pushed %d and pulled %d changes, %d conflicts", name, result.Pushed, result.Pulled, result.Conflicts)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("%s sync failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func integrationFromRequest(w http.ResponseWriter, r *http.Request) (*integration, bool) {
+	in, ok := integrations[mux.Vars(r)["name"]]
+	if !ok {
+		http.Error(w, "Unknown integration", http.StatusNotFound)
+	}
+	return in, ok
+}
+
+func integrationStatus(tx *bolt.Tx, in *integration) (IntegrationStatus, error) {
+	state, err := loadIntegrationState(tx, in.name)
+	if err != nil {
+		return IntegrationStatus{}, err
+	}
+	status := IntegrationStatus{
+		Name:       in.name,
+		Configured: in.oauth().ClientID != "",
+		Authorized: state.Token != nil,
+		TaskList:   state.TaskList,
+		LastSync:   state.LastSync,
+		LastError:  state.LastError,
+		Conflicts:  []SyncAudit{},
+	}
+	b := integrationBucket(tx, in.name)
+	if b == nil || b.Bucket(integrationLinksKey) == nil {
+		return status, nil
+	}
+	status.Linked = b.Bucket(integrationLinksKey).Stats().KeyN
+
+	c := b.Bucket(integrationAuditKey).Cursor()
+	for k, v := c.Last(); k != nil && len(status.Conflicts) < 20; k, v = c.Prev() {
+		var audit SyncAudit
+		if err := codec.Unmarshal(v, &audit); err != nil {
+			return status, err
+		}
+		status.Conflicts = append(status.Conflicts, audit)
+	}
+	return status, nil
+}
+
+// getIntegration reports a service's connection and its latest conflicts.
+func getIntegration(w http.ResponseWriter, r *http.Request) {
+	in, ok := integrationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var status IntegrationStatus
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		status, err = integrationStatus(tx, in)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// updateIntegration picks the remote task list to sync with. Switching
+// lists forgets the links to the old one.
+func updateIntegration(w http.ResponseWriter, r *http.Request) {
+	in, ok := integrationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TaskList string `json:"taskList"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(input.TaskList) == "" {
+		http.Error(w, "taskList is required", http.StatusBadRequest)
+		return
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	var status IntegrationStatus
+	err := writeTx(func(tx *bolt.Tx) error {
+		b, err := createIntegrationBucket(tx, in.name)
+		if err != nil {
+			return err
+		}
+		state, err := loadIntegrationState(tx, in.name)
+		if err != nil {
+			return err
+		}
+		if state.TaskList != input.TaskList {
+			if err := b.DeleteBucket(integrationLinksKey); err != nil {
+				return err
+			}
+			if _, err := b.CreateBucket(integrationLinksKey); err != nil {
+				return err
+			}
+		}
+		state.TaskList = input.TaskList
+		buf, err := codec.Marshal(state)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(integrationStateKey, buf); err != nil {
+			return err
+		}
+		status, err = integrationStatus(tx, in)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// deleteIntegration disconnects a service, forgetting its token and links.
+// Todos and remote tasks are left as they are.
+func deleteIntegration(w http.ResponseWriter, r *http.Request) {
+	in, ok := integrationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	err := writeTx(func(tx *bolt.Tx) error {
+		if integrationBucket(tx, in.name) == nil {
+			return nil
+		}
+		return tx.Bucket(integrationsBucket).DeleteBucket([]byte(in.name))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeIntegration sends the admin to the service's consent screen,
+// which redirects back to integrationCallback.
+func authorizeIntegration(w http.ResponseWriter, r *http.Request) {
+	in, ok := integrationFromRequest(w, r)
+	if !ok {
+		return
+	}
+	oauth := in.oauth()
+	if oauth.ClientID == "" {
+		http.Error(w, "The "+in.name+" OAuth client is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redirectURL := baseURL(r) + "/integrations/" + in.name + "/callback"
+	_, err = updateIntegrationState(in.name, func(s *IntegrationState) {
+		s.OAuthState = state
+		s.RedirectURL = redirectURL
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, oauth.authCodeURL(state, redirectURL), http.StatusFound)
+}
+
+// integrationCallback completes authorization. It isn't behind admin
+// authentication, since the service redirects here; the state issued by
+// authorizeIntegration vouches for the request instead.
+func integrationCallback(w http.ResponseWriter, r *http.Request) {
+	in, ok := integrationFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		http.Error(w, "Authorization failed: "+reason, http.StatusBadRequest)
+		return
+	}
+
+	var state IntegrationState
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		state, err = loadIntegrationState(tx, in.name)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	given := r.URL.Query().Get("state")
+	if state.OAuthState == "" || subtle.ConstantTimeCompare([]byte(given), []byte(state.OAuthState)) != 1 {
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+
+	token, err := in.oauth().exchange(r.URL.Query().Get("code"), state.RedirectURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	_, err = updateIntegrationState(in.name, func(s *IntegrationState) {
+		s.Token = &token
+		s.OAuthState = ""
+		s.RedirectURL = ""
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, in.name+" is connected. You can close this window.\n")
+}
+
+// syncIntegrationNow runs a sync without waiting for the scheduler.
+func syncIntegrationNow(w http.ResponseWriter, r *http.Request) {
+	in, ok := integrationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := in.sync()
+	if err == errIntegrationNotAuthorized || err == errNoTaskList {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// apiRequest sends a JSON request to a REST API and decodes the JSON
+// response into out, if it isn't nil.
+func apiRequest(client *http.Client, method, url string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = strings.NewReader(string(buf))
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s answered %s: %s", method, url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// fakeTaskService is an in-memory remote task list.
+type fakeTaskService struct {
+	tasks map[string]remoteTask
+	next  int
+}
+
+func newFakeTaskService() *fakeTaskService {
+	return &fakeTaskService{tasks: make(map[string]remoteTask)}
+}
+
+func (f *fakeTaskService) listTasks() ([]remoteTask, error) {
+	var tasks []remoteTask
+	for _, t := range f.tasks {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+func (f *fakeTaskService) createTask(t remoteTask) (remoteTask, error) {
+	f.next++
+	t.ID = fmt.Sprintf("r%d", f.next)
+	t.Updated = time.Now()
+	f.tasks[t.ID] = t
+	return t, nil
+}
+
+func (f *fakeTaskService) updateTask(t remoteTask) (remoteTask, error) {
+	t.Updated = time.Now()
+	f.tasks[t.ID] = t
+	return t, nil
+}
+
+func (f *fakeTaskService) deleteTask(id string) error {
+	delete(f.tasks, id)
+	return nil
+}
+
+// titles returns the remote titles in ID order.
+func (f *fakeTaskService) titles() []string {
+	tasks, _ := f.listTasks()
+	titles := []string{}
+	for _, t := range tasks {
+		titles = append(titles, t.Title)
+	}
+	return titles
+}
+
+func newFakeIntegration() *integration {
+	return &integration{name: "fake", oauth: func() oauthConfig { return oauthConfig{} }}
+}
+
+func saveTodo(t *testing.T, todo Todo) Todo {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if todo.ID == 0 {
+			id, _ := tx.Bucket(todosBucket).NextSequence()
+			todo.ID = int(id)
+		}
+		return putTodo(tx, &todo)
+	})
+	assert.NoError(t, err)
+	return todo
+}
+
+func localTitles(t *testing.T) []string {
+	titles := []string{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(todosBucket).ForEach(func(k, v []byte) error {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			titles = append(titles, todo.Title)
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	return titles
+}
+
+func syncAudits(t *testing.T, in *integration) []SyncAudit {
+	var status IntegrationStatus
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		status, err = integrationStatus(tx, in)
+		return err
+	})
+	assert.NoError(t, err)
+	return status.Conflicts
+}
+
+func TestSyncTasks(t *testing.T) {
+	clearBucket(t)
+	in := newFakeIntegration()
+	remote := newFakeTaskService()
+
+	local := saveTodo(t, Todo{Title: "Write report", DueDate: "2026-05-01", Priority: "high"})
+	remote.createTask(remoteTask{Title: "Buy milk", Completed: true})
+
+	// The first sync copies each side to the other.
+	result, err := in.syncTasks(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{Pushed: 1, Pulled: 1}, result)
+	assert.Equal(t, []string{"Buy milk", "Write report"}, remote.titles())
+	assert.Equal(t, []string{"Write report", "Buy milk"}, localTitles(t))
+	assert.Equal(t, "2026-05-01", remote.tasks["r2"].DueDate)
+
+	var pulled *Todo
+	db.View(func(tx *bolt.Tx) error {
+		pulled, _ = loadTodo(tx, local.ID+1)
+		return nil
+	})
+	assert.True(t, pulled.Completed)
+	assert.Equal(t, StatusDone, pulled.Status)
+
+	// Nothing changed, so nothing moves.
+	result, err = in.syncTasks(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{}, result)
+
+	// Edits flow both ways.
+	local.Title = "Write the report"
+	local = saveTodo(t, local)
+	milk := remote.tasks["r1"]
+	milk.Completed = false
+	remote.updateTask(milk)
+
+	result, err = in.syncTasks(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{Pushed: 1, Pulled: 1}, result)
+	assert.Equal(t, "Write the report", remote.tasks["r2"].Title)
+	db.View(func(tx *bolt.Tx) error {
+		pulled, _ = loadTodo(tx, pulled.ID)
+		return nil
+	})
+	assert.False(t, pulled.Completed)
+	assert.Equal(t, StatusTodo, pulled.Status)
+
+	// So do deletions.
+	remote.deleteTask("r1")
+	db.Update(func(tx *bolt.Tx) error { return removeTodo(tx, local.ID) })
+
+	result, err = in.syncTasks(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{Pushed: 1, Pulled: 1}, result)
+	assert.Empty(t, remote.tasks)
+	assert.Empty(t, localTitles(t))
+	assert.Empty(t, syncAudits(t, in))
+}
+
+func TestSyncConflicts(t *testing.T) {
+	clearBucket(t)
+	in := newFakeIntegration()
+	remote := newFakeTaskService()
+
+	first := saveTodo(t, Todo{Title: "First"})
+	second := saveTodo(t, Todo{Title: "Second"})
+	third := saveTodo(t, Todo{Title: "Third"})
+	_, err := in.syncTasks(remote)
+	assert.NoError(t, err)
+
+	// The remote edit of first is newer; the local edit of second is.
+	first.Title = "First, local"
+	saveTodo(t, first)
+	remote.tasks["r1"] = remoteTask{ID: "r1", Title: "First, remote", Updated: time.Now().Add(time.Minute)}
+	remote.tasks["r2"] = remoteTask{ID: "r2", Title: "Second, remote", Updated: time.Now().Add(-time.Minute)}
+	second.Title = "Second, local"
+	saveTodo(t, second)
+
+	// An edit wins over a deletion.
+	db.Update(func(tx *bolt.Tx) error { return removeTodo(tx, third.ID) })
+	remote.tasks["r3"] = remoteTask{ID: "r3", Title: "Third, remote", Updated: time.Now()}
+
+	result, err := in.syncTasks(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Conflicts)
+	assert.Equal(t, []string{"First, remote", "Second, local", "Third, remote"}, remote.titles())
+	assert.Equal(t, []string{"First, remote", "Second, local", "Third, remote"}, localTitles(t))
+
+	audits := syncAudits(t, in)
+	assert.Len(t, audits, 3)
+	winners := map[string]string{}
+	for _, audit := range audits {
+		winners[audit.RemoteID] = audit.Winner
+	}
+	assert.Equal(t, map[string]string{"r1": "remote", "r2": "local", "r3": "remote"}, winners)
+
+	// Resolved conflicts stay resolved.
+	result, err = in.syncTasks(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{}, result)
+}
+
+func TestSyncIgnoresUnsupportedFields(t *testing.T) {
+	clearBucket(t)
+	in := newFakeIntegration()
+	remote := newFakeTaskService()
+
+	todo := saveTodo(t, Todo{Title: "Plan", Priority: "high"})
+	_, err := in.syncTasks(remote)
+	assert.NoError(t, err)
+
+	// A priority change alone doesn't concern a service without them.
+	todo.Priority = "low"
+	saveTodo(t, todo)
+	result, err := in.syncTasks(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{}, result)
+
+	plan := remote.tasks["r1"]
+	plan.Title = "Plan it"
+	remote.updateTask(plan)
+	_, err = in.syncTasks(remote)
+	assert.NoError(t, err)
+
+	db.View(func(tx *bolt.Tx) error {
+		stored, _ := loadTodo(tx, todo.ID)
+		assert.Equal(t, "Plan it", stored.Title)
+		assert.Equal(t, "low", stored.Priority)
+		return nil
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+var jiraKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]+-[1-9][0-9]*$`)
+
+var errNoTransition = errors.New("no matching Jira transition")
+
+// jiraTransitionQueue holds completed todos whose issue is to be
+// transitioned, so completing a todo doesn't wait on Jira.
+var jiraTransitionQueue = make(chan int, 100)
+
+type JiraLinkRequest struct {
+	Key string `json:"key"`
+}
+
+// JiraIssue is a linked issue's state, as fetched from Jira.
+type JiraIssue struct {
+	Key            string `json:"key"`
+	Summary        string `json:"summary"`
+	Status         string `json:"status"`
+	StatusCategory string `json:"statusCategory"`
+	URL            string `json:"url"`
+}
+
+// basicTransport authenticates every request with a user and password,
+// which for Jira Cloud is an account email and an API token.
+type basicTransport struct {
+	user, password string
+}
+
+func (t basicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.user, t.password)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func jiraConfigured() bool {
+	return config.JiraURL != "" && config.JiraEmail != "" && secret("JIRA_API_TOKEN", config.JiraToken) != ""
+}
+
+func jiraClient() *http.Client {
+	return withBreaker("jira", &http.Client{Timeout: integrationTimeout, Transport: basicTransport{user: config.JiraEmail, password: secret("JIRA_API_TOKEN", config.JiraToken)}})
+}
+
+func jiraIssueURL(key string) string {
+	return strings.TrimSuffix(config.JiraURL, "/") + "/rest/api/2/issue/" + url.PathEscape(key)
+}
+
+func fetchJiraIssue(key string) (JiraIssue, error) {
+	var issue struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Summary string `json:"summary"`
+			Status  struct {
+				Name           string `json:"name"`
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	err := apiRequest(jiraClient(), http.MethodGet, jiraIssueURL(key)+"?fields=summary,status", nil, &issue)
+	return JiraIssue{
+		Key:            issue.Key,
+		Summary:        issue.Fields.Summary,
+		Status:         issue.Fields.Status.Name,
+		StatusCategory: issue.Fields.Status.StatusCategory.Key,
+		URL:            strings.TrimSuffix(config.JiraURL, "/") + "/browse/" + key,
+	}, err
+}
+
+// transitionJiraIssue moves an issue along the transition named
+// JIRA_DONE_TRANSITION, if it is available from the issue's status.
+func transitionJiraIssue(key string) error {
+	var available struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	if err := apiRequest(jiraClient(), http.MethodGet, jiraIssueURL(key)+"/transitions", nil, &available); err != nil {
+		return err
+	}
+	for _, t := range available.Transitions {
+		if strings.EqualFold(t.Name, config.JiraDoneTransition) {
+			body := map[string]interface{}{"transition": map[string]string{"id": t.ID}}
+			return apiRequest(jiraClient(), http.MethodPost, jiraIssueURL(key)+"/transitions", body, nil)
+		}
+	}
+	return errNoTransition
+}
+
+// queueJiraTransition queues todos with a Jira issue as they are completed,
+// when JIRA_DONE_TRANSITION is set.
+func queueJiraTransition(e Event) {
+	if e.Type != EventTodoUpdated || e.Todo.JiraIssue == "" || !e.Todo.Completed || e.Previous == nil || e.Previous.Completed {
+		return
+	}
+	if config.JiraDoneTransition == "" || !jiraConfigured() {
+		return
+	}
+	select {
+	case jiraTransitionQueue <- e.Todo.ID:
+	default:
+		warnf("Jira transition queue is full; issue of todo %d is left as it is", e.Todo.ID)
+	}
+}
+
+func init() {
+	events.subscribe(queueJiraTransition)
+}
+
+// runJiraTransitionQueue transitions the issues queued by
+// queueJiraTransition until ctx is cancelled.
+func runJiraTransitionQueue(ctx context.Context) error {
+	for {
+		var id int
+		select {
+		case id = <-jiraTransitionQueue:
+		case <-ctx.Done():
+			return nil
+		}
+		usingDB(func() { transitionQueuedJiraIssue(id) })
+	}
+}
+
+// transitionQueuedJiraIssue transitions the issue of todo id if it is
+// still completed.
+func transitionQueuedJiraIssue(id int) {
+	var todo *Todo
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		todo, err = loadTodo(tx, id)
+		return err
+	})
+	if err != nil || todo == nil || todo.JiraIssue == "" || !todo.Completed {
+		return
+	}
+	if err := transitionJiraIssue(todo.JiraIssue); err != nil {
+		warnf("transitioning Jira issue %s of todo %d: %v", todo.JiraIssue, id, err)
+	}
+}
+
+// jiraIssue fetches the status of a todo's Jira issue (GET), links an issue
+// by key (PUT) or unlinks it (DELETE).
+func jiraIssue(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		getJiraIssue(w, id)
+		return
+	}
+
+	var key string
+	if r.Method == http.MethodPut {
+		var req JiraLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !jiraKeyPattern.MatchString(req.Key) {
+			http.Error(w, "Invalid Jira issue key: use the form PROJ-123", http.StatusBadRequest)
+			return
+		}
+		key = req.Key
+	}
+
+	todo, err := todoService.Modify(id, func(tx *bolt.Tx, todo *Todo) error {
+		todo.JiraIssue = key
+		return nil
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(todo)
+}
+
+func getJiraIssue(w http.ResponseWriter, id int) {
+	var todo *Todo
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		todo, err = loadTodo(tx, id)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if todo == nil {
+		http.Error(w, "todo not found", http.StatusNotFound)
+		return
+	}
+	if todo.JiraIssue == "" {
+		http.Error(w, "Todo has no Jira issue", http.StatusNotFound)
+		return
+	}
+	if !jiraConfigured() {
+		http.Error(w, "Jira integration is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	issue, err := fetchJiraIssue(todo.JiraIssue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	json.NewEncoder(w).Encode(issue)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withJira points the Jira integration at a fake site and returns the IDs
+// of the transitions it was asked to apply.
+func withJira(t *testing.T) *[]string {
+	var applied []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if user != "me@acme.com" || password != "api-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/rest/api/2/issue/APP-12":
+			assert.Equal(t, "summary,status", r.URL.Query().Get("fields"))
+			w.Write([]byte(`{"key":"APP-12","fields":{"summary":"Login fails","status":{"name":"In Review","statusCategory":{"key":"indeterminate"}}}}`))
+		case r.URL.Path == "/rest/api/2/issue/APP-12/transitions" && r.Method == http.MethodGet:
+			w.Write([]byte(`{"transitions":[{"id":"21","name":"Start"},{"id":"31","name":"Done"}]}`))
+		case r.URL.Path == "/rest/api/2/issue/APP-12/transitions":
+			var body struct {
+				Transition struct {
+					ID string `json:"id"`
+				} `json:"transition"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			applied = append(applied, body.Transition.ID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	previous := config
+	config.JiraURL, config.JiraEmail, config.JiraToken = server.URL+"/", "me@acme.com", "api-token"
+	t.Cleanup(func() { config = previous })
+	return &applied
+}
+
+func TestJiraIssue(t *testing.T) {
+	clearBucket(t)
+	withJira(t)
+	router := setupRouter()
+	todo := saveTodo(t, Todo{Title: "Fix login"})
+	url := "/todos/" + strconv.Itoa(todo.ID) + "/jira"
+
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, url, "").Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, url, `{"key":"app-12"}`).Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodPut, "/todos/999/jira", `{"key":"APP-12"}`).Code)
+
+	w := request(http.MethodPut, url, `{"key":"APP-12"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var linked Todo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &linked))
+	assert.Equal(t, "APP-12", linked.JiraIssue)
+
+	// Updates keep the link.
+	w = request(http.MethodPut, "/todos/"+strconv.Itoa(todo.ID), `{"title":"Fix the login"}`)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &linked))
+	assert.Equal(t, "APP-12", linked.JiraIssue)
+
+	w = request(http.MethodGet, url, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var issue JiraIssue
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issue))
+	assert.Equal(t, "In Review", issue.Status)
+	assert.Equal(t, "indeterminate", issue.StatusCategory)
+	assert.Equal(t, "Login fails", issue.Summary)
+	assert.True(t, strings.HasSuffix(issue.URL, "/browse/APP-12"))
+
+	config.JiraToken = "revoked"
+	assert.Equal(t, http.StatusBadGateway, request(http.MethodGet, url, "").Code)
+	config.JiraToken = ""
+	assert.Equal(t, http.StatusServiceUnavailable, request(http.MethodGet, url, "").Code)
+
+	w = request(http.MethodDelete, url, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var unlinked Todo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &unlinked))
+	assert.Empty(t, unlinked.JiraIssue)
+}
+
+func TestJiraTransition(t *testing.T) {
+	clearBucket(t)
+	applied := withJira(t)
+
+	config.JiraDoneTransition = "done"
+	assert.NoError(t, transitionJiraIssue("APP-12"))
+	assert.Equal(t, []string{"31"}, *applied)
+
+	config.JiraDoneTransition = "Close"
+	assert.Equal(t, errNoTransition, transitionJiraIssue("APP-12"))
+
+	// Completing a linked todo queues its issue.
+	todo := saveTodo(t, Todo{Title: "Fix login", JiraIssue: "APP-12"})
+	saveTodo(t, Todo{Title: "Unlinked", Completed: true})
+	todo.Completed = true
+	saveTodo(t, todo)
+	assert.Equal(t, todo.ID, <-jiraTransitionQueue)
+	saveTodo(t, todo)
+	assert.Len(t, jiraTransitionQueue, 0)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// component is a long-running part of the service, such as the HTTP server
+// or a queue worker. run works until ctx is cancelled, then finishes what
+// it has in hand and returns.
+type component struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// lifecycle starts components together and stops them in reverse order, so
+// the HTTP servers stop taking requests before the workers they feed stop.
+type lifecycle struct {
+	components []component
+}
+
+func (l *lifecycle) add(name string, run func(ctx context.Context) error) {
+	l.components = append(l.components, component{name: name, run: run})
+}
+
+// run runs every component until ctx is cancelled, such as on a signal, or
+// one of them fails, then stops them one by one, giving each up to
+// SHUTDOWN_TIMEOUT. It returns the first failure.
+func (l *lifecycle) run(ctx context.Context) error {
+	cancels := make([]context.CancelFunc, len(l.components))
+	done := make([]chan struct{}, len(l.components))
+	failed := make(chan error, len(l.components))
+	for i, c := range l.components {
+		var componentCtx context.Context
+		componentCtx, cancels[i] = context.WithCancel(context.Background())
+		done[i] = make(chan struct{})
+		go func() {
+			defer close(done[i])
+			if err := c.run(componentCtx); err != nil {
+				failed <- fmt.Errorf("%s: %w", c.name, err)
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		infof("shutting down")
+	case err = <-failed:
+		warnf("shutting down: %v", err)
+	}
+
+	for i := len(l.components) - 1; i >= 0; i-- {
+		cancels[i]()
+		select {
+		case <-done[i]:
+		case <-time.After(config.ShutdownTimeout):
+			warnf("%s did not stop within %s", l.components[i].name, config.ShutdownTimeout)
+		}
+	}
+	return err
+}
+
+// serveHTTP serves handler on listener as a component. Cancelling it stops
+// accepting connections and waits for requests in flight.
+func serveHTTP(listener net.Listener, handler http.Handler) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		server := &http.Server{Handler: handler}
+		stopped := make(chan error, 1)
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+			defer cancel()
+			stopped <- server.Shutdown(shutdownCtx)
+		}()
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return <-stopped
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withShutdownTimeout(t *testing.T, d time.Duration) {
+	previous := config.ShutdownTimeout
+	config.ShutdownTimeout = d
+	t.Cleanup(func() { config.ShutdownTimeout = previous })
+}
+
+func TestLifecycle(t *testing.T) {
+	withShutdownTimeout(t, time.Second)
+	var mu sync.Mutex
+	var stopped []string
+	started := make(chan struct{}, 3)
+	waitForStop := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, name)
+			return nil
+		}
+	}
+
+	var app lifecycle
+	app.add("scheduler", waitForStop("scheduler"))
+	app.add("worker", waitForStop("worker"))
+	app.add("server", waitForStop("server"))
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for range 3 {
+			<-started
+		}
+		cancel()
+	}()
+	assert.NoError(t, app.run(ctx))
+	assert.Equal(t, []string{"server", "worker", "scheduler"}, stopped)
+
+	// The first failure stops the rest.
+	stopped = nil
+	app = lifecycle{}
+	app.add("worker", waitForStop("worker"))
+	app.add("server", func(ctx context.Context) error {
+		return errors.New("address in use")
+	})
+	err := app.run(context.Background())
+	assert.EqualError(t, err, "server: address in use")
+	assert.Equal(t, []string{"worker"}, stopped)
+}
+
+func TestLifecycleStopTimeout(t *testing.T) {
+	withShutdownTimeout(t, 10*time.Millisecond)
+	logs := withLogging(t, false, false)
+	var app lifecycle
+	release := make(chan struct{})
+	defer close(release)
+	app.add("stuck", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, app.run(ctx))
+	assert.Contains(t, logs.String(), "WARN stuck did not stop within 10ms")
+}
+
+func TestServeHTTPDrains(t *testing.T) {
+	withShutdownTimeout(t, time.Second)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	inFlight := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	var app lifecycle
+	app.add("server", serveHTTP(l, handler))
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() { result <- app.run(ctx) }()
+
+	response := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+	<-inFlight
+	cancel()
+	assert.Equal(t, "done", <-response, "requests in flight finish")
+	assert.NoError(t, <-result)
+
+	_, err = http.Get("http://" + l.Addr().String())
+	assert.Error(t, err, "no new connections after shutdown")
+}
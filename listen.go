@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor systemd passes sockets on.
+const listenFDsStart = 3
+
+// listen opens the API listener: the socket passed by systemd socket
+// activation if there is one, otherwise addr.
+func listen(addr string) (net.Listener, error) {
+	if l, err := activatedListener(); l != nil || err != nil {
+		return l, err
+	}
+	return listenAddr(addr)
+}
+
+// listenAddr listens on addr, a TCP address or "unix:" and a socket path.
+func listenAddr(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return listenUnix(path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// activatedListener returns the socket systemd passed through LISTEN_FDS,
+// or nil without socket activation.
+func activatedListener() (net.Listener, error) {
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid != os.Getpid() {
+		return nil, nil
+	}
+	fds := os.Getenv("LISTEN_FDS")
+	// Child processes must not take the sockets for their own.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n, err := strconv.Atoi(fds); err != nil || n != 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q: socket activation passes a single socket", fds)
+	}
+
+	f := os.NewFile(listenFDsStart, "LISTEN_FD_3")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// listenUnix listens on a Unix socket at path that the owner and group can
+// connect to, for a reverse proxy running as another user of the group.
+func listenUnix(path string) (net.Listener, error) {
+	// A socket left behind by a previous run would fail the bind. A running
+	// instance can't be using it: it holds the database lock.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
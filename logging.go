@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Log levels, from the most verbose. Info is the zero value.
+const (
+	levelDebug int32 = iota - 1
+	levelInfo
+	levelWarn
+)
+
+var levelNames = map[string]int32{"debug": levelDebug, "info": levelInfo, "warn": levelWarn}
+
+// logLevel is the least severe level logged. It can be changed while
+// running with PUT /admin/log-level.
+var logLevel atomic.Int32
+
+func parseLogLevel(name string) (int32, error) {
+	level, ok := levelNames[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid log level %q: use debug, info or warn", name)
+	}
+	return level, nil
+}
+
+func levelName(level int32) string {
+	for name, l := range levelNames {
+		if l == level {
+			return name
+		}
+	}
+	return ""
+}
+
+// debugf logs details only wanted while chasing a problem.
+func debugf(format string, args ...interface{}) {
+	if logLevel.Load() <= levelDebug {
+		log.Printf("DEBUG "+format, args...)
+	}
+}
+
+// infof logs routine events.
+func infof(format string, args ...interface{}) {
+	if logLevel.Load() <= levelInfo {
+		log.Printf(format, args...)
+	}
+}
+
+// warnf logs failures, which are always logged.
+func warnf(format string, args ...interface{}) {
+	log.Printf("WARN "+format, args...)
+}
+
+// redactUser stands in for a user name in logs. With LOG_REDACTION it is a
+// short hash, so one user's entries can still be followed without naming
+// them.
+func redactUser(user string) string {
+	if !config.LogRedaction || user == "" {
+		return user
+	}
+	sum := sha256.Sum256([]byte(user))
+	return "user-" + hex.EncodeToString(sum[:4])
+}
+
+// redactText stands in for free text, such as a title, in logs. With
+// LOG_REDACTION only its length is kept.
+func redactText(s string) string {
+	if !config.LogRedaction {
+		return s
+	}
+	return "[" + strconv.Itoa(len([]rune(s))) + " chars]"
+}
+
+// todoLabel names a todo in messages that leave the service, such as
+// notifications and texts: its title, or with LOG_REDACTION just its ID.
+func todoLabel(todo Todo) string {
+	if config.LogRedaction {
+		return fmt.Sprintf("todo #%d", todo.ID)
+	}
+	return todo.Title
+}
+
+// statusRecorder remembers the status a handler responded with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// accessLogMiddleware logs every request with ACCESS_LOG. Query strings,
+// which can carry feed tokens and filter values, are never logged, and with
+// LOG_REDACTION paths are logged as their route template, such as
+// /todos/{id}, and the caller as a hash.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !config.AccessLog {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// Paths carrying a token, such as inbound hook URLs, are always
+		// logged as their route template.
+		path := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil && (config.LogRedaction || strings.Contains(tmpl, "{token}")) {
+				path = tmpl
+			}
+		}
+		user := redactUser(userFromRequest(r))
+		if user == "" {
+			user = "-"
+		}
+		// Client addresses are personal data too.
+		ip := clientIP(r)
+		if ip == "" || config.LogRedaction {
+			ip = "-"
+		}
+		infof("%s %s %d %s user=%s ip=%s", r.Method, path, rec.status, time.Since(start).Round(time.Microsecond), user, ip)
+	})
+}
+
+// LogLevel is the body of GET and PUT /admin/log-level.
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// logLevelHandler reports (GET) or changes (PUT) the log level.
+func logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var body LogLevel
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level, err := parseLogLevel(body.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if previous := logLevel.Swap(level); previous != level {
+			log.Printf("log level changed from %s to %s", levelName(previous), body.Level)
+		}
+	}
+
+	json.NewEncoder(w).Encode(LogLevel{Level: levelName(logLevel.Load())})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withLogging(t *testing.T, accessLog, redaction bool) *bytes.Buffer {
+	previous := config
+	config.AccessLog, config.LogRedaction = accessLog, redaction
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		config = previous
+		log.SetOutput(os.Stderr)
+	})
+	return &buf
+}
+
+func TestRedaction(t *testing.T) {
+	todo := Todo{ID: 12, Title: "Call the bank"}
+
+	withLogging(t, false, false)
+	assert.Equal(t, "alice", redactUser("alice"))
+	assert.Equal(t, "Call the bank", redactText(todo.Title))
+	assert.Equal(t, "Call the bank", todoLabel(todo))
+
+	config.LogRedaction = true
+	assert.Equal(t, redactUser("alice"), redactUser("alice"))
+	assert.NotEqual(t, redactUser("alice"), redactUser("bob"))
+	assert.Regexp(t, `^user-[0-9a-f]{8}$`, redactUser("alice"))
+	assert.Equal(t, "", redactUser(""))
+	assert.Equal(t, "[13 chars]", redactText(todo.Title))
+	assert.Equal(t, "todo #12", todoLabel(todo))
+}
+
+func TestAccessLog(t *testing.T) {
+	clearBucket(t)
+	todo := saveTodo(t, Todo{Title: "Call the bank", Assignee: "alice"})
+	url := "/todos/" + strconv.Itoa(todo.ID) + "?assignee=alice"
+
+	tests := []struct {
+		name      string
+		accessLog bool
+		redaction bool
+		expected  string
+	}{
+		{"off", false, false, ""},
+		{"plain", true, false, "GET /todos/" + strconv.Itoa(todo.ID) + " 200 "},
+		{"redacted", true, true, "GET /todos/{id} 200 "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := withLogging(t, tt.accessLog, tt.redaction)
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			req.Header.Set(userHeader, "alice")
+			w := httptest.NewRecorder()
+			setupRouter().ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			if tt.expected == "" {
+				assert.Empty(t, buf.String())
+				return
+			}
+			assert.Contains(t, buf.String(), tt.expected)
+			assert.NotContains(t, buf.String(), "assignee=")
+			if tt.redaction {
+				assert.Contains(t, buf.String(), "user="+redactUser("alice"))
+				assert.NotContains(t, buf.String(), "alice")
+				assert.Contains(t, buf.String(), "ip=-")
+			} else {
+				assert.Contains(t, buf.String(), "user=alice ip=192.0.2.1")
+			}
+		})
+	}
+
+	t.Run("token in path", func(t *testing.T) {
+		buf := withLogging(t, true, false)
+		req := httptest.NewRequest(http.MethodPost, "/hooks/inbound/s3cr3t", strings.NewReader(`{}`))
+		setupRouter().ServeHTTP(httptest.NewRecorder(), req)
+		assert.Contains(t, buf.String(), "POST /hooks/inbound/{token} 401 ")
+		assert.NotContains(t, buf.String(), "s3cr3t")
+	})
+}
+
+func TestRedactedNotifications(t *testing.T) {
+	clearBucket(t)
+	buf := withLogging(t, false, true)
+	router := setupRouter()
+	todo := saveTodo(t, Todo{Title: "Call the bank"})
+	todoURL := "/todos/" + strconv.Itoa(todo.ID)
+
+	watch := httptest.NewRequest(http.MethodPost, todoURL+"/watch", nil)
+	watch.Header.Set(userHeader, "bob")
+	router.ServeHTTP(httptest.NewRecorder(), watch)
+	comment := httptest.NewRequest(http.MethodPost, todoURL+"/comments", strings.NewReader(`{"body":"Ask about the loan"}`))
+	comment.Header.Set(userHeader, "alice")
+	router.ServeHTTP(httptest.NewRecorder(), comment)
+	update := httptest.NewRequest(http.MethodPut, todoURL, strings.NewReader(`{"title":"Call the bank","completed":true}`))
+	router.ServeHTTP(httptest.NewRecorder(), update)
+
+	// The default notifier logs every notification.
+	logged := buf.String()
+	assert.Contains(t, logged, "notify "+redactUser("bob"))
+	assert.Contains(t, logged, redactUser("alice")+" commented: [18 chars]")
+	assert.Contains(t, logged, "updated: todo #"+strconv.Itoa(todo.ID))
+	for _, verbatim := range []string{"alice", "bob", "Call the bank", "loan"} {
+		assert.NotContains(t, logged, verbatim)
+	}
+
+	reminder := smsReminder{todos: []Todo{{ID: 3, Title: "Pay rent", DueDate: "2026-10-01"}}}
+	assert.Equal(t, "Overdue: todo #3 (due 2026-10-01)", reminder.body())
+}
+
+func TestLogLevel(t *testing.T) {
+	buf := withLogging(t, false, false)
+	t.Cleanup(func() { logLevel.Store(levelInfo) })
+
+	debugf("cache miss %d", 1)
+	infof("synced %d", 2)
+	warnf("sync failed %d", 3)
+	assert.Equal(t, []string{"synced 2", "WARN sync failed 3"}, logMessages(buf))
+
+	logLevel.Store(levelDebug)
+	buf.Reset()
+	debugf("cache miss %d", 1)
+	assert.Equal(t, []string{"DEBUG cache miss 1"}, logMessages(buf))
+
+	logLevel.Store(levelWarn)
+	buf.Reset()
+	debugf("cache miss %d", 1)
+	infof("synced %d", 2)
+	warnf("sync failed %d", 3)
+	assert.Equal(t, []string{"WARN sync failed 3"}, logMessages(buf))
+}
+
+// logMessages returns the logged lines without their timestamps.
+func logMessages(buf *bytes.Buffer) []string {
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line != "" {
+			messages = append(messages, strings.SplitN(line, " ", 3)[2])
+		}
+	}
+	return messages
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	withLogging(t, false, false)
+	withAdminToken(t, "secret")
+	t.Cleanup(func() { logLevel.Store(levelInfo) })
+	router := setupRouter()
+
+	request := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"info"}`, w.Body.String())
+
+	w = request(http.MethodPut, `{"level":"debug"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"debug"}`, w.Body.String())
+	assert.Equal(t, levelDebug, logLevel.Load())
+
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, `{"level":"trace"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, `debug`).Code)
+	assert.Equal(t, levelDebug, logLevel.Load())
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	bolt "go.etcd.io/bbolt"
@@ -19,35 +26,120 @@ var (
 )
 
 type Todo struct {
-	ID        int    `json:"id"`
-	Title     string `json:"title"`
-	Completed bool   `json:"completed"`
+	ID          int      `json:"id"`
+	Title       string   `json:"title"`
+	Completed   bool     `json:"completed"`
+	Status      string   `json:"status,omitempty"`
+	Starred     bool     `json:"starred,omitempty"`
+	Assignee    string   `json:"assignee,omitempty"`
+	CreatedBy   string   `json:"createdBy,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	DueDate     string   `json:"dueDate,omitempty"`
+	Position    string   `json:"position,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Estimate    string   `json:"estimate,omitempty"`
+	Color       string   `json:"color,omitempty"`
+	Icon        string   `json:"icon,omitempty"`
+	GitHubIssue int      `json:"githubIssue,omitempty"`
+	JiraIssue   string   `json:"jiraIssue,omitempty"`
 }
 
-func initDB() error {
+// priorities ranks the accepted priority values; no priority ranks lowest.
+var priorities = map[string]int{"": 0, "low": 1, "medium": 2, "high": 3}
+
+const dueDateLayout = "2006-01-02"
+
+// validTag accepts short tags that can be written unquoted in a query.
+func validTag(tag string) error {
+	if tag == "" || len(tag) > 32 || strings.ContainsAny(tag, " \t\n():<>=") {
+		return fmt.Errorf("invalid tag %q: use up to 32 characters without spaces or ():<>=", tag)
+	}
+	return nil
+}
+
+func validateTodo(todo Todo) error {
+	if err := validTitle(todo.Title); err != nil {
+		return err
+	}
+	if err := validStatus(todo.Status); err != nil {
+		return err
+	}
+	if err := validUserName(todo.Assignee); err != nil {
+		return fmt.Errorf("invalid assignee: %v", err)
+	}
+	if _, ok := priorities[todo.Priority]; !ok {
+		return fmt.Errorf("invalid priority %q: use low, medium or high", todo.Priority)
+	}
+	if todo.DueDate != "" {
+		if _, err := time.Parse(dueDateLayout, todo.DueDate); err != nil {
+			return fmt.Errorf("invalid dueDate %q: use YYYY-MM-DD", todo.DueDate)
+		}
+	}
+	if todo.Estimate != "" {
+		if d, err := time.ParseDuration(todo.Estimate); err != nil || d <= 0 {
+			return fmt.Errorf("invalid estimate %q: use a duration such as 90m or 2h", todo.Estimate)
+		}
+	}
+	if err := validColor(todo.Color); err != nil {
+		return err
+	}
+	if err := validIcon(todo.Icon); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(todo.Tags))
+	for _, tag := range todo.Tags {
+		if err := validTag(tag); err != nil {
+			return err
+		}
+		if seen[tag] {
+			return fmt.Errorf("duplicate tag %q", tag)
+		}
+		seen[tag] = true
+	}
+	return nil
+}
+
+// boltOptions are the bolt options set through BOLT_* variables.
+func boltOptions() *bolt.Options {
+	return &bolt.Options{
+		Timeout:         config.BoltTimeout,
+		NoSync:          config.BoltNoSync,
+		NoFreelistSync:  config.BoltNoFreelistSync,
+		FreelistType:    bolt.FreelistType(config.BoltFreelistType),
+		InitialMmapSize: config.BoltInitialMmapSize,
+	}
+}
+
+// initDB opens and prepares the database. With wait, it waits for another
+// process holding the database to release it.
+func initDB(wait bool) error {
+	if config.BoltNoSync {
+		warnf("BOLT_NO_SYNC is set: commits are not fsynced, so a crash can lose or corrupt recent writes")
+	}
 	var err error
-	db, err = bolt.Open("todos.db", 0600, nil)
+	db, err = openDB(config.DBPath, wait)
 	if err != nil {
 		return err
 	}
 
-	return db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("todos"))
-		return err
-	})
+	return db.Update(ensureBuckets)
 }
 
 type PaginatedResponse struct {
 	Items      []Todo `json:"items"`
-	Page       int    `json:"page"`
+	Page       int    `json:"page,omitempty"`
 	Limit      int    `json:"limit"`
 	TotalItems int    `json:"totalItems"`
 	TotalPages int    `json:"totalPages"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 func getTodos(w http.ResponseWriter, r *http.Request) {
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
+	cursorStr := r.URL.Query().Get("cursor")
+	fieldsStr := r.URL.Query().Get("fields")
+	sortStr := r.URL.Query().Get("sort")
 
 	page := 1    // default page
 	limit := 100 // default limit
@@ -64,56 +156,124 @@ func getTodos(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var allTodos []Todo
-	var totalItems int
+	var after []byte
+	if cursorStr != "" {
+		var err error
+		if after, err = decodeCursor(cursorStr); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
 
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("todos"))
-		return b.ForEach(func(k, v []byte) error {
-			var todo Todo
-			if err := json.Unmarshal(v, &todo); err != nil {
-				return err
-			}
-			allTodos = append(allTodos, todo)
-			return nil
-		})
-	})
+	if sortStr != "" && sortStr != "id" && sortStr != "position" {
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
 
+	filters, err := listFilters(r.URL.Query(), userFromRequest(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	totalItems = len(allTodos)
-	totalPages := (totalItems + limit - 1) / limit
-
-	if page > totalPages && totalPages > 0 {
-		page = totalPages
+	var query queryNode
+	var today string
+	if q := r.URL.Query().Get("q"); q != "" {
+		if query, err = compileQuery(q, userFromRequest(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		loc, err := locationFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		today = clock.Now().In(loc).Format(dueDateLayout)
 	}
 
-	start := (page - 1) * limit
-	end := start + limit
-	if end > totalItems {
-		end = totalItems
+	fields, err := parseFieldSelection(fieldsStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	var pagedTodos []Todo
-	if start < totalItems {
-		pagedTodos = allTodos[start:end]
-	} else {
-		pagedTodos = []Todo{}
+	// Only first pages of modest size are cached: they are what dashboards
+	// poll. Everything else is streamed straight from the cursor. Queries
+	// are not cached, as terms like overdue depend on the caller's date,
+	// and neither are listings including archived todos.
+	withArchived := r.URL.Query().Get("include_archived") == "true"
+	if withArchived && archiveDB != nil && after != nil && !validArchiveCursor(after) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
-
-	response := PaginatedResponse{
-		Items:      pagedTodos,
-		Page:       page,
-		Limit:      limit,
-		TotalItems: totalItems,
-		TotalPages: totalPages,
+	cacheKey := ""
+	if query == nil && !withArchived && after == nil && page == 1 && limit <= maxCachedPageSize {
+		cacheKey = fmt.Sprintf("%slimit=%d&sort=%s&%s", listCachePrefix, limit, sortStr, filterKey(filters))
+		if cached, ok := cache.get(cacheKey); ok {
+			response := cached.(PaginatedResponse)
+			setPaginationHeaders(w, r, response)
+			w.Header().Set("Content-Type", "application/json")
+			writeList(w, response, eachTodo(response.Items), fields)
+			return
+		}
 	}
+	gen := cache.currentGeneration()
+
+	iterate := func(tx *bolt.Tx) listIterator {
+		switch {
+		case query != nil:
+			return newQueryIterator(tx, filterNode(query, filters), sortStr, today)
+		case sortStr == "":
+			return newStarredFirstIterator(tx, filters)
+		case sortStr == "id":
+			return newFilteredIterator(tx, filters)
+		default:
+			ordered := newOrderedIterator(tx, "position")
+			ordered.filters = filters
+			return ordered
+		}
+	}
+
+	streaming := false
+	err = timedView(r, func(tx *bolt.Tx) error {
+		return viewArchive(withArchived, func(atx *bolt.Tx) error {
+			it := iterate(tx)
+			if atx != nil {
+				it = &archiveChain{live: it, archived: iterate(atx)}
+			}
+
+			p := openListPage(it, page, limit, after)
+			response := p.envelope()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+			if cacheKey != "" {
+				items, err := p.collect()
+				if err != nil {
+					return err
+				}
+				response.Items = items
+				cache.put(cacheKey, response, gen)
+
+				setPaginationHeaders(w, r, response)
+				w.Header().Set("Content-Type", "application/json")
+				return writeList(w, response, eachTodo(items), fields)
+			}
+
+			setPaginationHeaders(w, r, response)
+			w.Header().Set("Content-Type", "application/json")
+			streaming = true
+			return p.write(w, response, fields)
+		})
+	})
+
+	if err != nil {
+		if streaming {
+			// Headers are gone; all we can do is cut the response short.
+			warnf("streaming todo list: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 }
 
 func createTodo(w http.ResponseWriter, r *http.Request) {
@@ -123,26 +283,35 @@ func createTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("todos"))
-		id, _ := b.NextSequence()
-		todo.ID = int(id)
+	todo.CreatedBy = userFromRequest(r)
+	todo, err := todoService.Create(todo)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
 
-		buf, err := json.Marshal(todo)
-		if err != nil {
-			return err
-		}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(todo)
+}
 
-		return b.Put(itob(todo.ID), buf)
-	})
+// cloneTodo copies a todo into a new one created by the caller, as
+// TodoService.Clone describes.
+func cloneTodo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
 
+	clone, err := todoService.Clone(id, userFromRequest(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(todo)
+	json.NewEncoder(w).Encode(clone)
 }
 
 func updateTodo(w http.ResponseWriter, r *http.Request) {
@@ -153,20 +322,17 @@ func updateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var todo Todo
-	if err := json.NewDecoder(r.Body).Decode(&todo); err != nil {
+	var input Todo
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	todo.ID = id
-
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("todos"))
-		return b.Put(itob(todo.ID), must(json.Marshal(todo)))
-	})
 
+	// Only applies when the PUT creates the todo.
+	input.CreatedBy = userFromRequest(r)
+	todo, err := todoService.Update(id, input, r.URL.Query().Get("force") == "true")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, err)
 		return
 	}
 
@@ -181,13 +347,8 @@ func deleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("todos"))
-		return b.Delete(itob(id))
-	})
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := todoService.Delete(id); err != nil {
+		writeServiceError(w, err)
 		return
 	}
 
@@ -206,13 +367,6 @@ func itob(v int) []byte {
 	return b
 }
 
-func must(b []byte, err error) []byte {
-	if err != nil {
-		panic(err)
-	}
-	return b
-}
-
 func getTodoByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -221,22 +375,17 @@ func getTodoByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var todo Todo
-	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("todos"))
-		v := b.Get(itob(id))
-		if v == nil {
-			return fmt.Errorf("todo not found")
+	todo, err := todoService.Get(id)
+	if errors.Is(err, errTodoNotFound) && r.URL.Query().Get("include_archived") == "true" {
+		var archived *Todo
+		if archived, err = loadArchivedTodo(id); err == nil && archived != nil {
+			todo = *archived
+		} else if err == nil {
+			err = errTodoNotFound
 		}
-		return json.Unmarshal(v, &todo)
-	})
-
+	}
 	if err != nil {
-		if err.Error() == "todo not found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeServiceError(w, err)
 		return
 	}
 
@@ -249,31 +398,313 @@ func setupRouter() *mux.Router {
 	// API routes
 	r.HandleFunc("/todos", getTodos).Methods("GET")
 	r.HandleFunc("/todos", createTodo).Methods("POST")
+	r.HandleFunc("/todos/changes", getChanges).Methods("GET")
+	r.HandleFunc("/todos/next", getNextTodos).Methods("GET")
+	r.HandleFunc("/todos/board", getBoard).Methods("GET")
+	r.HandleFunc("/todos/calendar", getCalendar).Methods("GET")
+	r.HandleFunc("/todos/calendar.ics", getCalendarFeed).Methods("GET")
+	r.HandleFunc("/todos/merge", mergeTodosHandler).Methods("POST")
+	r.HandleFunc("/todos/export", exportTodos).Methods("GET")
 	r.HandleFunc("/todos/{id}", getTodoByID).Methods("GET")
 	r.HandleFunc("/todos/{id}", updateTodo).Methods("PUT")
 	r.HandleFunc("/todos/{id}", deleteTodo).Methods("DELETE")
-
-	// Health check endpoint
+	r.HandleFunc("/todos/{id}/clone", cloneTodo).Methods("POST")
+	r.HandleFunc("/todos/{id}/move", moveTodo).Methods("POST")
+	r.HandleFunc("/todos/{id}/snooze", snoozeTodo).Methods("POST")
+	r.HandleFunc("/todos/{id}/star", starTodo).Methods("POST", "DELETE")
+	r.HandleFunc("/todos/{id}/github-issue", githubIssue).Methods("POST", "DELETE")
+	r.HandleFunc("/todos/{id}/jira", jiraIssue).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/todos/{id}/watch", watchTodo).Methods("POST", "DELETE")
+	r.HandleFunc("/todos/{id}/blockers", getBlockers).Methods("GET")
+	r.HandleFunc("/todos/{id}/blockers", addBlocker).Methods("POST")
+	r.HandleFunc("/todos/{id}/blockers/{blockerID}", deleteBlocker).Methods("DELETE")
+	r.HandleFunc("/todos/{id}/comments", getComments).Methods("GET")
+	r.HandleFunc("/todos/{id}/comments", createComment).Methods("POST")
+	r.HandleFunc("/todos/{id}/comments/{commentID}", updateComment).Methods("PUT", "DELETE")
+	r.HandleFunc("/todos/{id}/attachments", getAttachments).Methods("GET")
+	r.HandleFunc("/todos/{id}/attachments", createAttachment).Methods("POST")
+	r.HandleFunc("/todos/{id}/attachments/{attachmentID}", getAttachment).Methods("GET")
+	r.HandleFunc("/todos/{id}/attachments/{attachmentID}", deleteAttachment).Methods("DELETE")
+
+	// CalDAV speaks its own methods, such as PROPFIND, so it routes them
+	// itself.
+	r.HandleFunc("/.well-known/caldav", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, caldavRoot, http.StatusMovedPermanently)
+	})
+	r.HandleFunc("/caldav", caldavHandler)
+	r.PathPrefix(caldavRoot).HandlerFunc(caldavHandler)
+
+	r.HandleFunc("/exports", createExportJob).Methods("POST")
+	r.HandleFunc("/exports/{id}", getExportJob).Methods("GET")
+	r.HandleFunc("/exports/{id}", deleteExportJob).Methods("DELETE")
+	r.HandleFunc("/exports/{id}/download", downloadExportJob).Methods("GET")
+	r.HandleFunc("/imports", createImportJob).Methods("POST")
+	r.HandleFunc("/imports/{id}", getImportJob).Methods("GET")
+	r.HandleFunc("/imports/{id}", abortImportJob).Methods("DELETE")
+	r.HandleFunc("/imports/{id}/commit", commitImportJob).Methods("POST")
+	r.HandleFunc("/import/markdown", importMarkdown).Methods("POST")
+	r.HandleFunc("/quick-add", quickAdd).Methods("POST")
+
+	r.HandleFunc("/me/achievements", getAchievements).Methods("GET")
+	r.HandleFunc("/me/feed-token", feedToken).Methods("POST", "DELETE")
+	r.HandleFunc("/me/export", exportUserData).Methods("GET")
+	r.HandleFunc("/me/export", requestUserExport).Methods("POST")
+	r.HandleFunc("/me/export", deleteUserExport).Methods("DELETE")
+	r.HandleFunc("/me/export/status", getUserExportStatus).Methods("GET")
+	r.HandleFunc("/me/export/download", downloadUserExport).Methods("GET")
+	r.HandleFunc("/me/deletion-token", deletionToken).Methods("POST")
+	r.HandleFunc("/me", deleteAccount).Methods("DELETE")
+	r.HandleFunc("/me/usage", getUsage).Methods("GET")
+	r.HandleFunc("/me/inbound-hooks", getInboundHooks).Methods("GET")
+	r.HandleFunc("/me/inbound-hooks", createInboundHook).Methods("POST")
+	r.HandleFunc("/me/inbound-hooks/{token}", deleteInboundHook).Methods("DELETE")
+	r.HandleFunc("/hooks/inbound/{token}", receiveInboundHook).Methods("POST")
+	r.HandleFunc("/preferences", getPreferences).Methods("GET")
+	r.HandleFunc("/preferences", updatePreferences).Methods("PUT")
+
+	// The OAuth redirect target; the state parameter authenticates it.
+	r.HandleFunc("/integrations/{name}/callback", integrationCallback).Methods("GET")
+
+	r.HandleFunc("/webhooks/github", githubWebhook).Methods("POST")
+	r.HandleFunc("/webhooks/twilio/status", twilioStatusCallback).Methods("POST")
+
+	r.HandleFunc("/feeds/activity.atom", getActivityFeed).Methods("GET")
+
+	r.HandleFunc("/reports/workload", getWorkload).Methods("GET")
+
+	r.HandleFunc("/views/{name:today|upcoming|someday}", getView).Methods("GET")
+
+	r.HandleFunc("/filters", getSavedFilters).Methods("GET")
+	r.HandleFunc("/filters", createSavedFilter).Methods("POST")
+	r.HandleFunc("/filters/{id}", getSavedFilter).Methods("GET")
+	r.HandleFunc("/filters/{id}", updateSavedFilter).Methods("PUT", "DELETE")
+	r.HandleFunc("/filters/{id}/todos", runSavedFilter).Methods("GET")
+
+	// Health check endpoints: liveness and readiness
 	r.HandleFunc("/health", healthCheck).Methods("GET")
+	r.HandleFunc("/readyz", readyCheck).Methods("GET")
+
+	if config.AdminListen == "" {
+		addAdminRoutes(r)
+	}
+	useMiddleware(r)
+
+	return r
+}
 
+// setupAdminRouter serves the admin routes on ADMIN_LISTEN, apart from the
+// API.
+func setupAdminRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/health", healthCheck).Methods("GET")
+	r.HandleFunc("/readyz", readyCheck).Methods("GET")
+	// Integrations authorized from the admin listener redirect back to it.
+	r.HandleFunc("/integrations/{name}/callback", integrationCallback).Methods("GET")
+	addAdminRoutes(r)
+	useMiddleware(r)
 	return r
 }
 
+// addAdminRoutes adds the admin dashboard, admin API and metrics routes.
+func addAdminRoutes(r *mux.Router) {
+	r.HandleFunc("/admin", adminDashboard).Methods("GET")
+	r.HandleFunc("/admin/login", loginPage).Methods("GET")
+	r.HandleFunc("/admin/login", login).Methods("POST")
+	r.HandleFunc("/admin/logout", requireAdmin(logout)).Methods("POST")
+	r.HandleFunc("/admin/stats", requireAdmin(adminStats)).Methods("GET")
+	r.HandleFunc("/admin/backup", requireAdmin(adminBackup)).Methods("POST")
+	r.HandleFunc("/admin/compact", requireAdmin(adminCompact)).Methods("POST")
+	r.HandleFunc("/admin/jobs", requireAdmin(getJobs)).Methods("GET")
+	r.HandleFunc("/admin/circuits", requireAdmin(getCircuits)).Methods("GET")
+	r.HandleFunc("/metrics", requireAdmin(getMetrics)).Methods("GET")
+	r.HandleFunc("/admin/runtime", requireAdmin(getRuntime)).Methods("GET")
+	r.HandleFunc("/admin/log-level", requireAdmin(logLevelHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/admin/captures", requireAdmin(capturesHandler)).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/admin/integrations/{name}", requireAdmin(getIntegration)).Methods("GET")
+	r.HandleFunc("/admin/integrations/{name}", requireAdmin(updateIntegration)).Methods("PUT")
+	r.HandleFunc("/admin/integrations/{name}", requireAdmin(deleteIntegration)).Methods("DELETE")
+	r.HandleFunc("/admin/integrations/{name}/authorize", requireAdmin(authorizeIntegration)).Methods("GET")
+	r.HandleFunc("/admin/integrations/{name}/sync", requireAdmin(syncIntegrationNow)).Methods("POST")
+	r.HandleFunc("/cdc", requireAdmin(getCDC)).Methods("GET")
+	r.HandleFunc("/cdc/consumers", requireAdmin(getCDCConsumers)).Methods("GET")
+	r.HandleFunc("/cdc/consumers/{name}", requireAdmin(updateCDCConsumer)).Methods("PUT")
+	r.HandleFunc("/cdc/consumers/{name}", requireAdmin(deleteCDCConsumer)).Methods("DELETE")
+
+	// Development-only routes
+	r.HandleFunc("/admin/seed", requireDevMode(requireAdmin(adminSeed))).Methods("POST")
+	r.HandleFunc("/admin/chaos", requireDevMode(requireAdmin(getChaos))).Methods("GET")
+	r.HandleFunc("/admin/chaos", requireDevMode(requireAdmin(setChaos))).Methods("PUT")
+}
+
+// useMiddleware adds the middleware of the API and admin routers.
+func useMiddleware(r *mux.Router) {
+	r.Use(accessLogMiddleware)
+	r.Use(captureMiddleware)
+	r.Use(localizeMiddleware)
+	r.Use(priorityMiddleware)
+	r.Use(replicaMiddleware)
+	r.Use(dbGateMiddleware)
+	r.Use(chaosMiddleware)
+	r.Use(errorTrackingMiddleware)
+}
+
 func main() {
-	if err := initDB(); err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "client" {
+		os.Exit(runClient(newClientFromEnv(), os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheck(loadConfig().Listen, os.Stderr))
+	}
+
+	tui := flag.Bool("tui", false, "run the interactive terminal UI against TODO_URL")
+	reencryptDB := flag.Bool("reencrypt", false, "re-encrypt the database with ENCRYPTION_KEY and exit")
+	waitForDB := flag.Bool("wait-for-db", false, "wait for another process to release the database instead of failing after BOLT_TIMEOUT")
+	mock := flag.Bool("mock", false, "serve deterministic fixtures from a throwaway database, with integrations off")
+	flag.Parse()
+
+	if *tui {
+		if err := runTUI(newClientFromEnv()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	config = loadConfig()
+	if *mock {
+		dir, err := mockDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		config = mockConfig(config, dir)
+	}
+	logLevel.Store(config.LogLevel)
+	if config.VaultAddr != "" {
+		if err := loadVaultSecrets(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	cache = newReadCache(config.CacheSize)
+
+	selected, err := selectCodec(config.JSONCodec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if codec, err = newEncryptedCodec(selected, secret("ENCRYPTION_KEY", config.EncryptionKey), config.EncryptionOldKeys); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := prepareDataDir(); err != nil {
+		log.Fatal(err)
+	}
+	if err := initDB(*waitForDB); err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	if err := initArchive(); err != nil {
+		log.Fatal(err)
+	}
+	if archiveDB != nil {
+		defer archiveDB.Close()
+	}
+	if config.PrimaryURL != "" {
+		// Until a first snapshot arrives, /readyz keeps the replica out of
+		// rotation.
+		if err := syncReplica(clock.Now()); err != nil {
+			warnf("syncing from the primary: %v", err)
+		}
+	}
+	if *mock {
+		if err := seedMock(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Mock mode: serving %d fixture todos from %s, removed on exit", mockTodoCount, config.DataDir)
+		if config.AdminToken == mockAdminToken {
+			log.Printf("Mock mode: admin token is %q", mockAdminToken)
+		}
+	}
+
+	if *reencryptDB {
+		n, err := reencrypt()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("re-encrypted %d values", n)
+		return
+	}
+
+	if blobs, err = newBlobStore(config.AttachmentStore, config.AttachmentDir); err != nil {
+		log.Fatal(err)
+	}
 
-	r := setupRouter()
+	if config.SentryDSN != "" {
+		if errorTracker, err = newSentryClient(config.SentryDSN); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := scheduleJobs(clock.Now()); err != nil {
+		log.Fatal(err)
+	}
+	// Components stop in reverse order: the servers first, so nothing
+	// new reaches the workers, then the workers.
+	var app lifecycle
+	app.add("scheduler", scheduler.run)
+	// A replica forwards the writes that feed these queues, and leaves the
+	// jobs pending in its snapshot to the primary.
+	if config.PrimaryURL == "" {
+		if config.GitHubIssueOnCreate {
+			app.add("github-issues", runGitHubIssueQueue)
+		}
+		if config.JiraDoneTransition != "" {
+			app.add("jira-transitions", runJiraTransitionQueue)
+		}
+		app.add("user-exports", runUserExportQueue)
+		app.add("export-jobs", runExportJobQueue)
+		app.add("import-jobs", runImportJobQueue)
+	}
+	if config.VaultAddr != "" && config.VaultRefreshInterval > 0 {
+		app.add("secret-renewal", func(ctx context.Context) error {
+			return runSecretRenewal(ctx, config.VaultRefreshInterval)
+		})
+	}
+
+	if config.DebugAddr != "" {
+		l, err := listenDebug(config.DebugAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.add("debug server", serveHTTP(l, debugHandler()))
+		log.Printf("Debug endpoints on %s", l.Addr())
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if config.AdminListen != "" {
+		l, err := listenAddr(config.AdminListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.add("admin server", serveHTTP(l, setupAdminRouter()))
+		log.Printf("Admin listening on %s", l.Addr())
 	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
+	l, err := listen(config.Listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.add("server", serveHTTP(l, setupRouter()))
+	log.Printf("Server listening on %s", l.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = app.run(ctx)
+	db.Close()
+	if archiveDB != nil {
+		archiveDB.Close()
+	}
+	if *mock {
+		os.RemoveAll(config.DataDir)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
+	log.Printf("Server stopped")
 }
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -16,59 +18,54 @@ import (
 
 // TestMain é usado para setup e teardown dos testes
 func TestMain(m *testing.M) {
-	// Setup
-	setupTestDB()
+	// Tests that don't ask for a database of their own share this one.
+	dir, err := os.MkdirTemp("", "todo-test-")
+	if err != nil {
+		panic(err)
+	}
+	db, err = bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err == nil {
+		err = db.Update(ensureBuckets)
+	}
+	if err != nil {
+		panic(err)
+	}
 
-	// Run tests
 	code := m.Run()
 
-	// Cleanup
-	cleanupTestDB()
-
+	db.Close()
+	os.RemoveAll(dir)
 	os.Exit(code)
 }
 
-func setupTestDB() {
-	if db != nil {
-		db.Close()
-	}
-
-	os.Remove("test.db")
-
+// useTestDB gives the test an empty database of its own, in a temporary
+// directory, and puts the previous one back when it ends. Handlers reach
+// the database through the db global and read through the cache global, and
+// both are swapped or purged here, so no test may call t.Parallel(); that
+// needs the store threaded through the handlers first.
+func useTestDB(tb testing.TB) {
+	tb.Helper()
+	previous := db
 	var err error
-	db, err = bolt.Open("test.db", 0600, nil)
+	db, err = bolt.Open(filepath.Join(tb.TempDir(), "test.db"), 0600, nil)
 	if err != nil {
-		panic(err)
+		tb.Fatal(err)
 	}
-
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("todos"))
-		return err
-	})
-	if err != nil {
-		panic(err)
+	if err := db.Update(ensureBuckets); err != nil {
+		tb.Fatal(err)
 	}
-}
-
-func cleanupTestDB() {
-	if db != nil {
+	cache.purge()
+	tb.Cleanup(func() {
+		// Compaction swaps the handle, so close whichever is current.
 		db.Close()
-		db = nil
-	}
-	os.Remove("test.db")
+		db = previous
+		cache.purge()
+	})
 }
 
+// clearBucket starts the test on an empty database.
 func clearBucket(t *testing.T) {
-	setupTestDB()
-	err := db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket([]byte("todos"))
-		if err != nil {
-			return err
-		}
-		_, err = tx.CreateBucket([]byte("todos"))
-		return err
-	})
-	assert.NoError(t, err)
+	useTestDB(t)
 }
 
 func Test_itob(t *testing.T) {
@@ -97,6 +94,30 @@ func Test_itob(t *testing.T) {
 	}
 }
 
+func TestBoltOptions(t *testing.T) {
+	previous := config
+	t.Cleanup(func() { config = previous })
+	config.BoltNoSync = true
+	config.BoltNoFreelistSync = true
+	config.BoltFreelistType = string(bolt.FreelistMapType)
+	config.BoltInitialMmapSize = 1 << 20
+
+	tuned, err := bolt.Open(t.TempDir()+"/tuned.db", 0600, boltOptions())
+	assert.NoError(t, err)
+	defer tuned.Close()
+	assert.True(t, tuned.NoSync)
+	assert.True(t, tuned.NoFreelistSync)
+	assert.Equal(t, bolt.FreelistMapType, tuned.FreelistType)
+}
+
+func TestBoltFreelistSyncDefault(t *testing.T) {
+	// Like BoltDB, the freelist is written on commit unless asked not to.
+	t.Setenv("BOLT_NO_FREELIST_SYNC", "")
+	assert.False(t, loadConfig().BoltNoFreelistSync)
+	t.Setenv("BOLT_NO_FREELIST_SYNC", "true")
+	assert.True(t, loadConfig().BoltNoFreelistSync)
+}
+
 func TestHealthCheck(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	w := httptest.NewRecorder()
@@ -138,6 +159,15 @@ func TestCreateTodo(t *testing.T) {
 			expectedStatus: http.StatusCreated,
 			expectedError:  false,
 		},
+		{
+			name: "invalid assignee",
+			payload: Todo{
+				Title:    "Test todo",
+				Assignee: "two words",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -343,3 +373,150 @@ func TestDeleteTodo(t *testing.T) {
 		})
 	}
 }
+
+func TestGetTodosCursorPagination(t *testing.T) {
+	clearBucket(t)
+
+	for i := 1; i <= 5; i++ {
+		payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Todo %d", i)})
+		req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+		w := httptest.NewRecorder()
+		createTodo(w, req)
+	}
+
+	var seen []int
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		url := "/todos?limit=2"
+		if cursor != "" {
+			url += "&cursor=" + cursor
+		}
+
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		w := httptest.NewRecorder()
+		getTodos(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response PaginatedResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+
+		for _, todo := range response.Items {
+			seen = append(seen, todo.ID)
+		}
+
+		// Insert while paginating; keyset pagination must neither skip nor repeat items
+		if pages == 0 {
+			payload, _ := json.Marshal(Todo{Title: "Inserted mid-iteration"})
+			req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+			createTodo(httptest.NewRecorder(), req)
+		}
+
+		if response.NextCursor == "" {
+			break
+		}
+		cursor = response.NextCursor
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, seen)
+}
+
+func TestGetTodosInvalidCursor(t *testing.T) {
+	clearBucket(t)
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "wrong length", cursor: "AAAA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/todos?cursor="+tt.cursor, nil)
+			w := httptest.NewRecorder()
+
+			getTodos(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestCloneTodo(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	payload, _ := json.Marshal(Todo{Title: "Weekly report", Status: StatusDone, Assignee: "alice", Priority: "high", DueDate: "2026-05-01"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{
+			name:           "existing todo",
+			url:            "/todos/1/clone",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "missing todo",
+			url:            "/todos/99/clone",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			var clone Todo
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &clone))
+			assert.Equal(t, Todo{ID: 2, Title: "Weekly report", Status: StatusTodo, Assignee: "alice", Priority: "high", DueDate: "2026-05-01", Position: "k"}, clone)
+		})
+	}
+}
+
+// FuzzCreateTodo checks that no body makes POST /todos fail with anything
+// but a client error, and that whatever it stores is valid.
+func FuzzCreateTodo(f *testing.F) {
+	useTestDB(f)
+	router := setupRouter()
+	for _, seed := range []string{
+		`{"title":"Buy milk"}`,
+		`{"title":"x","priority":"high","dueDate":"2026-12-31","tags":["a","b"],"estimate":"1h"}`,
+		`{"title":"x","status":"done","completed":false}`,
+		`{"title":"x","tags":["a","a"]}`,
+		`{"title":1}`,
+		`{"id":-1,"position":"\u0000"}`,
+		`[]`,
+		`{`,
+		``,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, body string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			return
+		}
+		var todo Todo
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &todo))
+		assert.NoError(t, validateTodo(todo))
+		assert.Equal(t, normalizeTitle(todo.Title), todo.Title)
+	})
+}
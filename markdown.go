@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	markdownItem    = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.*\S)\s*$`)
+	markdownHeading = regexp.MustCompile(`^#{1,6}\s+(.*?)[\s#]*$`)
+)
+
+// maxMarkdownImport caps the size of an imported document.
+const maxMarkdownImport = 1 << 20
+
+// headingTag turns a heading into a tag, hyphenating spaces. Headings that
+// still aren't valid tags give none.
+func headingTag(heading string) string {
+	tag := strings.Join(strings.Fields(heading), "-")
+	if validTag(tag) != nil {
+		return ""
+	}
+	return tag
+}
+
+// parseMarkdownChecklist reads "- [ ] task" and "- [x] task" items. Each
+// item is tagged with the heading it is under, if any; other lines are
+// ignored.
+func parseMarkdownChecklist(r io.Reader) ([]Todo, error) {
+	var todos []Todo
+	tag := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := markdownHeading.FindStringSubmatch(line); m != nil {
+			tag = headingTag(m[1])
+			continue
+		}
+		m := markdownItem.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		todo := Todo{Title: m[2], Completed: m[1] != " "}
+		if tag != "" {
+			todo.Tags = []string{tag}
+		}
+		todos = append(todos, todo)
+	}
+	return todos, scanner.Err()
+}
+
+// importMarkdown creates a todo for every checklist item in a Markdown
+// document and returns them with 201.
+func importMarkdown(w http.ResponseWriter, r *http.Request) {
+	todos, err := parseMarkdownChecklist(io.LimitReader(r.Body, maxMarkdownImport))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(todos) == 0 {
+		http.Error(w, "No checklist items found: use lines like - [ ] task", http.StatusBadRequest)
+		return
+	}
+	for i := range todos {
+		if err := validateTodo(todos[i]); err != nil {
+			http.Error(w, fmt.Sprintf("item %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = writeTx(func(tx *bolt.Tx) error {
+		for i := range todos {
+			todos[i].CreatedBy = userFromRequest(r)
+			if err := todoService.save(tx, nil, &todos[i], false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(todos)
+}
+
+// writeMarkdownChecklist writes todos as a checklist in the format
+// parseMarkdownChecklist reads: untagged todos first, then a heading per
+// first tag in order of appearance.
+func writeMarkdownChecklist(w io.Writer, todos []Todo) {
+	var order []string
+	groups := make(map[string][]Todo)
+	for _, todo := range todos {
+		tag := ""
+		if len(todo.Tags) > 0 {
+			tag = todo.Tags[0]
+		}
+		if _, ok := groups[tag]; !ok {
+			order = append(order, tag)
+		}
+		groups[tag] = append(groups[tag], todo)
+	}
+
+	writeItems := func(items []Todo) {
+		for _, todo := range items {
+			box := " "
+			if todo.Completed {
+				box = "x"
+			}
+			fmt.Fprintf(w, "- [%s] %s\n", box, strings.Join(strings.Fields(todo.Title), " "))
+		}
+	}
+
+	writeItems(groups[""])
+	separate := len(groups[""]) > 0
+	for _, tag := range order {
+		if tag == "" {
+			continue
+		}
+		if separate {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "## %s\n\n", tag)
+		writeItems(groups[tag])
+		separate = true
+	}
+}
+
+// exportFormats are the document formats todos export to, with their
+// content type and file name.
+var exportFormats = map[string]struct{ contentType, filename string }{
+	"markdown": {"text/markdown; charset=utf-8", "todos.md"},
+	"pdf":      {"application/pdf", "todos.pdf"},
+	"json":     {"application/json", "todos.json"},
+}
+
+// validExportFormat checks a format of exportFormats.
+func validExportFormat(format string) error {
+	if _, ok := exportFormats[format]; !ok {
+		return errors.New("Invalid format: use markdown, pdf or json")
+	}
+	return nil
+}
+
+// readExport returns the todos matching filters, in their manual order.
+func readExport(tx *bolt.Tx, filters []indexFilter) ([]Todo, error) {
+	todos := []Todo{}
+	it := newOrderedIterator(tx, "position")
+	it.filters = filters
+	for k, v := it.first(); k != nil; k, v = it.next() {
+		var todo Todo
+		if err := codec.Unmarshal(v, &todo); err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+	return todos, nil
+}
+
+// writeExport writes todos as a document in format.
+func writeExport(w io.Writer, format string, todos []Todo, now time.Time) error {
+	switch format {
+	case "pdf":
+		return writeTodosPDF(w, todos, now)
+	case "json":
+		return json.NewEncoder(w).Encode(todos)
+	}
+	writeMarkdownChecklist(w, todos)
+	return nil
+}
+
+// exportTodos returns the todos in their manual order as a document:
+// markdown, a checklist that POST /import/markdown reads back, pdf, for
+// printing, or json. Large exports should go through POST /exports.
+func exportTodos(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if err := validExportFormat(format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filters, err := listFilters(r.URL.Query(), userFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var todos []Todo
+	err = timedView(r, func(tx *bolt.Tx) error {
+		todos, err = readExport(tx, filters)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", exportFormats[format].contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportFormats[format].filename+`"`)
+	writeExport(w, format, todos, clock.Now())
+}
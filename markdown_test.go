@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMarkdownChecklist(t *testing.T) {
+	doc := `# Groceries
+
+Notes that aren't items.
+
+- [ ] Milk
+* [x] Eggs
+  - [X] Bread
+
+## Work Stuff ##
++ [ ]   Write report
+- plain bullet
+-[ ] not an item
+## Notes (misc)
+- [ ] Untagged under an invalid heading
+`
+	todos, err := parseMarkdownChecklist(strings.NewReader(doc))
+	assert.NoError(t, err)
+	assert.Equal(t, []Todo{
+		{Title: "Milk", Tags: []string{"Groceries"}},
+		{Title: "Eggs", Completed: true, Tags: []string{"Groceries"}},
+		{Title: "Bread", Completed: true, Tags: []string{"Groceries"}},
+		{Title: "Write report", Tags: []string{"Work-Stuff"}},
+		{Title: "Untagged under an invalid heading"},
+	}, todos)
+}
+
+func TestImportMarkdown(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"no items", "# Just a heading\n\nSome text.\n", http.StatusBadRequest},
+		{"valid", "- [ ] Call mom\n## home\n- [x] Water plants\n", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/import/markdown", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	assert.Equal(t, []string{"Call mom", "Water plants"}, localTitles(t))
+}
+
+func TestExportMarkdown(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/export?format=docx", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	doc := "- [ ] Call mom\n\n## home\n\n- [x] Water plants\n- [ ] Fix tap\n\n## work\n\n- [ ] Write report\n"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/import/markdown", strings.NewReader(doc)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// An exported checklist reads back as it was imported.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/export?format=markdown", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, doc, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/export?format=markdown&tag=work", nil))
+	assert.Equal(t, "## work\n\n- [ ] Write report\n", w.Body.String())
+}
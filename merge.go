@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type MergeRequest struct {
+	Primary    int   `json:"primary"`
+	Duplicates []int `json:"duplicates"`
+}
+
+var errInvalidMerge = errors.New("merge needs a primary and at least one other duplicate")
+
+// mergeTodos folds each duplicate into the primary and deletes it. Comments,
+// attachments and watchers move over, the primary gains the duplicates'
+// tags, and dependencies are rewired to the primary, skipping any that would
+// create a cycle.
+func mergeTodos(tx *bolt.Tx, primary int, duplicates []int) error {
+	dup := make(map[int]bool)
+	var unique []int
+	for _, id := range duplicates {
+		if id == primary {
+			return errInvalidMerge
+		}
+		if !dup[id] {
+			dup[id] = true
+			unique = append(unique, id)
+		}
+	}
+	duplicates = unique
+
+	old, err := loadTodo(tx, primary)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return errTodoNotFound
+	}
+	merged := *old
+	merged.Tags = slices.Clone(old.Tags)
+	for _, id := range duplicates {
+		todo, err := loadTodo(tx, id)
+		if err != nil {
+			return err
+		}
+		if todo == nil {
+			return errTodoNotFound
+		}
+		for _, tag := range todo.Tags {
+			if !slices.Contains(merged.Tags, tag) {
+				merged.Tags = append(merged.Tags, tag)
+			}
+		}
+	}
+	// Saving updates the tag index along with the rest of the merge.
+	if len(merged.Tags) != len(old.Tags) {
+		if err := todoService.save(tx, old, &merged, true); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range duplicates {
+		if err := moveComments(tx, id, primary); err != nil {
+			return err
+		}
+		if err := moveAttachments(tx, id, primary); err != nil {
+			return err
+		}
+		if err := copyWatchers(tx, id, primary); err != nil {
+			return err
+		}
+
+		for _, blockerID := range blockerIDs(tx, id) {
+			if blockerID == primary || dup[blockerID] {
+				continue
+			}
+			if err := addDependency(tx, primary, blockerID); err != nil && err != errDependencyLoop {
+				return err
+			}
+		}
+		for _, blockedID := range relatedIDs(tx.Bucket(blockingBucket), id) {
+			if blockedID == primary || dup[blockedID] {
+				continue
+			}
+			if err := addDependency(tx, blockedID, primary); err != nil && err != errDependencyLoop {
+				return err
+			}
+		}
+
+		if err := removeTodo(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveComments appends a todo's comments to another todo's, in order. They
+// get new IDs but keep their author and timestamps.
+func moveComments(tx *bolt.Tx, from, to int) error {
+	src, err := todoComments(tx, from, false)
+	if err != nil || src == nil {
+		return err
+	}
+	dst, err := todoComments(tx, to, true)
+	if err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		var comment Comment
+		if err := codec.Unmarshal(v, &comment); err != nil {
+			return err
+		}
+		id, _ := dst.NextSequence()
+		comment.ID = int(id)
+		comment.TodoID = to
+		buf, err := codec.Marshal(comment)
+		if err != nil {
+			return err
+		}
+		return dst.Put(itob(comment.ID), buf)
+	})
+}
+
+// moveAttachments hands a todo's attachments over to another todo. They get
+// new IDs but keep their contents in the blob store, so removing the first
+// todo afterwards leaves them alone.
+func moveAttachments(tx *bolt.Tx, from, to int) error {
+	src, err := todoAttachments(tx, from, false)
+	if err != nil || src == nil {
+		return err
+	}
+	dst, err := todoAttachments(tx, to, true)
+	if err != nil {
+		return err
+	}
+
+	err = src.ForEach(func(k, v []byte) error {
+		var attachment storedAttachment
+		if err := codec.Unmarshal(v, &attachment); err != nil {
+			return err
+		}
+		id, _ := dst.NextSequence()
+		attachment.ID = int(id)
+		attachment.TodoID = to
+		buf, err := codec.Marshal(attachment)
+		if err != nil {
+			return err
+		}
+		return dst.Put(itob(attachment.ID), buf)
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(attachmentsBucket).DeleteBucket(itob(from))
+}
+
+func copyWatchers(tx *bolt.Tx, from, to int) error {
+	b := tx.Bucket(watchersBucket)
+	prefix := itob(from)
+
+	var users [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		users = append(users, k[len(prefix):])
+	}
+	for _, user := range users {
+		if err := b.Put(append(itob(to), user...), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mergeTodosHandler(w http.ResponseWriter, r *http.Request) {
+	var req MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Duplicates) == 0 {
+		http.Error(w, errInvalidMerge.Error(), http.StatusBadRequest)
+		return
+	}
+
+	primary, err := todoService.Merge(req.Primary, req.Duplicates)
+	if err == errInvalidMerge {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(primary)
+}
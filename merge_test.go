@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMergeTodos(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	tags := [][]string{{"home"}, {"urgent", "home"}, nil, nil}
+	for i := 1; i <= 4; i++ {
+		payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Todo %d", i), Tags: tags[i-1]})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("alice", http.MethodPost, "/todos/1/comments", `{"body":"On the primary"}`))
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("bob", http.MethodPost, "/todos/2/comments", `{"body":"On the duplicate"}`))
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("bob", http.MethodPost, "/todos/2/watch", ""))
+	// 2 is blocked by 3 and blocks 4.
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos/2/blockers", strings.NewReader(`{"id":3}`)))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos/4/blockers", strings.NewReader(`{"id":2}`)))
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "no duplicates",
+			body:           `{"primary":1,"duplicates":[]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "primary among duplicates",
+			body:           `{"primary":1,"duplicates":[1,2]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing duplicate",
+			body:           `{"primary":1,"duplicates":[2,99]}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "merge",
+			body:           `{"primary":1,"duplicates":[2]}`,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos/merge", strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/2", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The primary has the duplicate's tags, and is found by them.
+	primary, err := todoService.Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"home", "urgent"}, primary.Tags)
+	titles, _ := listTitles(t, router, "/todos?q=tag:urgent")
+	assert.Equal(t, []string{"Todo 1"}, titles)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1/comments", nil))
+	var comments []Comment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &comments))
+	assert.Len(t, comments, 2)
+	assert.Equal(t, "bob", comments[1].Author)
+	assert.Equal(t, 2, comments[1].ID)
+
+	watchers, err := todoWatchers(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, watchers)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1/blockers", nil))
+	assert.JSONEq(t, `[{"id":3,"title":"Todo 3","completed":false}]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/4/blockers", nil))
+	assert.JSONEq(t, `[{"id":1,"title":"Todo 1","completed":false}]`, w.Body.String())
+}
+
+func TestMergeTodosKeepsAttachments(t *testing.T) {
+	clearBucket(t)
+	withAttachmentLimits(t)
+	router := setupRouter()
+	saveTodo(t, Todo{Title: "Pay rent"})
+	saveTodo(t, Todo{Title: "Pay the rent"})
+	for _, upload := range []struct{ url, name, data string }{
+		{"/todos/1/attachments", "lease.txt", "Lease"},
+		{"/todos/2/attachments", "receipt.txt", "Receipt"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, uploadRequest(upload.url, "file", upload.name, []byte(upload.data)))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos/merge", strings.NewReader(`{"primary":1,"duplicates":[2]}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1/attachments", nil))
+	var attachments []Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &attachments))
+	assert.Len(t, attachments, 2)
+	moved := attachments[1]
+	assert.Equal(t, "receipt.txt", moved.Name)
+	assert.Equal(t, 1, moved.TodoID)
+	assert.Equal(t, 2, moved.ID)
+
+	// The contents survive the duplicate's removal.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1/attachments/2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Receipt", w.Body.String())
+	db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 2, tx.Bucket(attachmentBlobsBucket).Stats().KeyN)
+		assert.Nil(t, tx.Bucket(attachmentsBucket).Bucket(itob(2)))
+		return nil
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Business counters since the process started; Prometheus derives rates
+// per interval from them.
+var (
+	todosCreated   atomic.Int64
+	todosCompleted atomic.Int64
+	todosDeleted   atomic.Int64
+)
+
+func countTodoEvent(e Event) {
+	switch e.Type {
+	case EventTodoCreated:
+		todosCreated.Add(1)
+		if e.Todo.Completed {
+			todosCompleted.Add(1)
+		}
+	case EventTodoUpdated:
+		if e.Todo.Completed && (e.Previous == nil || !e.Previous.Completed) {
+			todosCompleted.Add(1)
+		}
+	case EventTodoDeleted:
+		todosDeleted.Add(1)
+	}
+}
+
+func init() {
+	events.subscribe(countTodoEvent)
+}
+
+// BusinessGauges are the product-level levels computed on every scrape.
+type BusinessGauges struct {
+	Open    int
+	Overdue int
+	// ReminderBacklog is how many overdue todos are waiting for an SMS
+	// reminder.
+	ReminderBacklog int
+}
+
+// businessGauges counts open and overdue todos, by UTC date, and the
+// reminders not yet sent.
+func businessGauges(tx *bolt.Tx, now time.Time) (BusinessGauges, error) {
+	var g BusinessGauges
+	today := now.UTC().Format(dueDateLayout)
+	it := newIndexIterator(tx, "completed", "false")
+	for k, v := it.first(); k != nil; k, v = it.next() {
+		var todo Todo
+		if err := codec.Unmarshal(v, &todo); err != nil {
+			return g, err
+		}
+		g.Open++
+		if todo.DueDate != "" && todo.DueDate < today {
+			g.Overdue++
+		}
+	}
+
+	reminders, err := overdueReminders(tx, now)
+	if err != nil {
+		return g, err
+	}
+	for _, reminder := range reminders {
+		g.ReminderBacklog += len(reminder.todos)
+	}
+	return g, nil
+}
+
+func writeMetric(w io.Writer, name, kind, help string, samples ...string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, sample := range samples {
+		fmt.Fprintf(w, "%s%s\n", name, sample)
+	}
+}
+
+func sample(value int64) string {
+	return " " + strconv.FormatInt(value, 10)
+}
+
+// getMetrics exports the business metrics in the Prometheus text format.
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	var g BusinessGauges
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		g, err = businessGauges(tx, clock.Now())
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetric(w, "todo_todos_created_total", "counter", "Todos created.", sample(todosCreated.Load()))
+	writeMetric(w, "todo_todos_completed_total", "counter", "Todos marked completed.", sample(todosCompleted.Load()))
+	writeMetric(w, "todo_todos_deleted_total", "counter", "Todos deleted.", sample(todosDeleted.Load()))
+	writeMetric(w, "todo_todos_open", "gauge", "Todos not completed.", sample(int64(g.Open)))
+	writeMetric(w, "todo_todos_overdue", "gauge", "Open todos past their due date.", sample(int64(g.Overdue)))
+	writeMetric(w, "todo_sms_reminder_backlog", "gauge", "Overdue todos waiting for an SMS reminder.", sample(int64(g.ReminderBacklog)))
+
+	var attempts, failures []string
+	for _, stats := range deliveryCounters() {
+		label := fmt.Sprintf("{destination=%q}", stats.Destination)
+		attempts = append(attempts, label+sample(int64(stats.Attempts)))
+		failures = append(failures, label+sample(int64(stats.Failed)))
+	}
+	writeMetric(w, "todo_delivery_attempts_total", "counter", "Outbound delivery attempts, such as SMS reminders.", attempts...)
+	writeMetric(w, "todo_delivery_failures_total", "counter", "Failed outbound delivery attempts.", failures...)
+
+	var slow []string
+	for _, counter := range slowQueryCounters() {
+		slow = append(slow, fmt.Sprintf("{route=%q}", counter.Route)+sample(int64(counter.Count)))
+	}
+	writeMetric(w, "todo_slow_queries_total", "counter", "Read transactions slower than SLOW_QUERY_THRESHOLD.", slow...)
+
+	var shed []string
+	for _, counter := range shedCounters() {
+		shed = append(shed, fmt.Sprintf("{route=%q}", counter.Route)+sample(int64(counter.Count)))
+	}
+	writeMetric(w, "todo_shed_requests_total", "counter", "Batch requests rejected with 503 while the database was overloaded.", shed...)
+
+	var inFlight, limited []string
+	for _, stats := range classCounters() {
+		inFlight = append(inFlight, fmt.Sprintf("{class=%q}", stats.Class)+sample(int64(stats.InFlight)))
+		for _, reason := range []string{"rate", "concurrency"} {
+			limited = append(limited, fmt.Sprintf("{class=%q,reason=%q}", stats.Class, reason)+sample(int64(stats.Rejected[reason])))
+		}
+	}
+	writeMetric(w, "todo_requests_in_flight", "gauge", "Requests being served, by priority class.", inFlight...)
+	writeMetric(w, "todo_limited_requests_total", "counter", "Requests rejected over their priority class's rate budget or concurrency limit.", limited...)
+
+	if config.PrimaryURL != "" {
+		replica.mu.Lock()
+		syncedAt, size := replica.syncedAt, replica.size
+		replica.mu.Unlock()
+		var synced int64
+		if !syncedAt.IsZero() {
+			synced = syncedAt.Unix()
+		}
+		writeMetric(w, "todo_replica_last_sync_timestamp_seconds", "gauge", "When the replica last copied a snapshot from the primary, as a Unix time; 0 before the first.", sample(synced))
+		writeMetric(w, "todo_replica_snapshot_bytes", "gauge", "Size of the last snapshot copied from the primary.", sample(size))
+	}
+}
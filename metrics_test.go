@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCountTodoEvent(t *testing.T) {
+	created, completed, deleted := todosCreated.Load(), todosCompleted.Load(), todosDeleted.Load()
+	open := Todo{ID: 1, Title: "Pay rent"}
+	done := Todo{ID: 1, Title: "Pay rent", Completed: true}
+
+	countTodoEvent(Event{Type: EventTodoCreated, Todo: open})
+	countTodoEvent(Event{Type: EventTodoUpdated, Todo: done, Previous: &open})
+	// Editing a completed todo doesn't complete it again.
+	countTodoEvent(Event{Type: EventTodoUpdated, Todo: done, Previous: &done})
+	countTodoEvent(Event{Type: EventTodoCreated, Todo: done})
+	countTodoEvent(Event{Type: EventTodoDeleted, Todo: done})
+
+	assert.Equal(t, created+2, todosCreated.Load())
+	assert.Equal(t, completed+2, todosCompleted.Load())
+	assert.Equal(t, deleted+1, todosDeleted.Load())
+}
+
+func TestBusinessGauges(t *testing.T) {
+	clearBucket(t)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	saveTodo(t, Todo{Title: "Pay rent", DueDate: "2026-10-01", Priority: "high", Assignee: "alice"})
+	saveTodo(t, Todo{Title: "Renew passport", DueDate: "2026-10-15", Assignee: "alice"})
+	saveTodo(t, Todo{Title: "Book flights", DueDate: "2026-10-16"})
+	saveTodo(t, Todo{Title: "File taxes", DueDate: "2026-04-15", Completed: true})
+	savePreferences(t, "alice", Preferences{SMSReminders: true, Phone: "+15551234567"})
+
+	var g BusinessGauges
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		g, err = businessGauges(tx, now)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, BusinessGauges{Open: 3, Overdue: 2, ReminderBacklog: 1}, g)
+}
+
+func TestGetMetrics(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+	withDeliveries(t, 1)
+	deliver("twilio", func() error { return nil })
+	deliver("twilio", func() error { return errors.New("timeout") })
+	saveTodo(t, Todo{Title: "Pay rent", DueDate: "2020-01-01"})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE todo_todos_created_total counter\ntodo_todos_created_total "+strconv.FormatInt(todosCreated.Load(), 10)+"\n")
+	assert.Contains(t, body, "# TYPE todo_todos_overdue gauge\ntodo_todos_overdue 1\n")
+	assert.Contains(t, body, "todo_todos_open 1\n")
+	assert.Contains(t, body, `todo_delivery_attempts_total{destination="twilio"} 2`+"\n")
+	assert.Contains(t, body, `todo_delivery_failures_total{destination="twilio"} 1`+"\n")
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w = httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, bytes.Contains(w.Body.Bytes(), []byte("todo_todos_open")))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Microsoft's endpoints are variables so tests can point them at a fake.
+var (
+	microsoftLoginURL = "https://login.microsoftonline.com"
+	microsoftGraphAPI = "https://graph.microsoft.com/v1.0"
+)
+
+func init() {
+	integrations["microsoft"] = &integration{
+		name:       "microsoft",
+		priorities: true,
+		oauth: func() oauthConfig {
+			base := microsoftLoginURL + "/" + url.PathEscape(config.MicrosoftTenant) + "/oauth2/v2.0"
+			return oauthConfig{
+				ClientID:     config.MicrosoftClientID,
+				ClientSecret: secret("MICROSOFT_CLIENT_SECRET", config.MicrosoftClientSecret),
+				AuthURL:      base + "/authorize",
+				TokenURL:     base + "/token",
+				// offline_access is what gets a refresh token.
+				Scopes: []string{"Tasks.ReadWrite", "offline_access"},
+			}
+		},
+		connect: func(client *http.Client, taskList string) taskService {
+			return &microsoftTasks{client: client, list: taskList}
+		},
+	}
+}
+
+// microsoftImportance maps To Do's importance to priorities. To Do has no
+// medium: it is sent as normal, which comes back as no priority.
+var microsoftImportance = map[string]string{"low": "low", "normal": "", "high": "high"}
+
+type microsoftDate struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+// microsoftTask is a task in the Microsoft Graph To Do API.
+type microsoftTask struct {
+	ID           string         `json:"id"`
+	Title        string         `json:"title"`
+	Status       string         `json:"status"`
+	Importance   string         `json:"importance"`
+	DueDateTime  *microsoftDate `json:"dueDateTime"`
+	LastModified string         `json:"lastModifiedDateTime"`
+}
+
+func (t microsoftTask) remote() remoteTask {
+	task := remoteTask{
+		ID:        t.ID,
+		Title:     t.Title,
+		Completed: t.Status == "completed",
+		Priority:  microsoftImportance[t.Importance],
+	}
+	if t.DueDateTime != nil && len(t.DueDateTime.DateTime) >= len(dueDateLayout) {
+		task.DueDate = t.DueDateTime.DateTime[:len(dueDateLayout)]
+	}
+	task.Updated, _ = time.Parse(time.RFC3339, t.LastModified)
+	return task
+}
+
+// microsoftBody is what is sent for a task. Clearing the due date needs an
+// explicit null, so it is a map.
+func microsoftBody(t remoteTask) map[string]interface{} {
+	body := map[string]interface{}{"title": t.Title, "status": "notStarted", "importance": "normal", "dueDateTime": nil}
+	if t.Completed {
+		body["status"] = "completed"
+	}
+	if t.Priority == "low" || t.Priority == "high" {
+		body["importance"] = t.Priority
+	}
+	if t.DueDate != "" {
+		body["dueDateTime"] = microsoftDate{DateTime: t.DueDate + "T00:00:00", TimeZone: "UTC"}
+	}
+	return body
+}
+
+// microsoftTasks is one Microsoft To Do list.
+type microsoftTasks struct {
+	client *http.Client
+	list   string
+}
+
+func (m *microsoftTasks) tasksURL() string {
+	return microsoftGraphAPI + "/me/todo/lists/" + url.PathEscape(m.list) + "/tasks"
+}
+
+func (m *microsoftTasks) listTasks() ([]remoteTask, error) {
+	var tasks []remoteTask
+	next := m.tasksURL() + "?$top=100"
+	for next != "" {
+		var page struct {
+			Value    []microsoftTask `json:"value"`
+			NextLink string          `json:"@odata.nextLink"`
+		}
+		if err := apiRequest(m.client, http.MethodGet, next, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, t := range page.Value {
+			tasks = append(tasks, t.remote())
+		}
+		next = page.NextLink
+	}
+	return tasks, nil
+}
+
+func (m *microsoftTasks) createTask(t remoteTask) (remoteTask, error) {
+	var created microsoftTask
+	err := apiRequest(m.client, http.MethodPost, m.tasksURL(), microsoftBody(t), &created)
+	return created.remote(), err
+}
+
+func (m *microsoftTasks) updateTask(t remoteTask) (remoteTask, error) {
+	var updated microsoftTask
+	err := apiRequest(m.client, http.MethodPatch, m.tasksURL()+"/"+url.PathEscape(t.ID), microsoftBody(t), &updated)
+	return updated.remote(), err
+}
+
+func (m *microsoftTasks) deleteTask(id string) error {
+	return apiRequest(m.client, http.MethodDelete, m.tasksURL()+"/"+url.PathEscape(id), nil, nil)
+}
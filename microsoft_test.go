@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMicrosoftTasks(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		if r.Body != nil && r.Method != http.MethodGet {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			bodies = append(bodies, body)
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("page") == "":
+			assert.Equal(t, "/me/todo/lists/AQMk=/tasks", r.URL.Path)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value": []map[string]interface{}{
+					{"id": "t1", "title": "Call", "status": "completed", "importance": "high", "lastModifiedDateTime": "2026-02-03T10:00:00.1234567Z"},
+				},
+				"@odata.nextLink": "http://" + r.Host + r.URL.Path + "?page=2",
+			})
+		case r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value": []map[string]interface{}{
+					{"id": "t2", "title": "Email", "status": "inProgress", "importance": "normal", "dueDateTime": map[string]string{"dateTime": "2026-03-04T00:00:00.0000000", "timeZone": "UTC"}},
+				},
+			})
+		case r.Method == http.MethodDelete:
+			assert.Equal(t, "/me/todo/lists/AQMk=/tasks/t2", r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "t3", "title": "Write", "status": "notStarted", "importance": "low"})
+		}
+	}))
+	defer server.Close()
+
+	previous := microsoftGraphAPI
+	microsoftGraphAPI = server.URL
+	defer func() { microsoftGraphAPI = previous }()
+
+	client := &http.Client{Transport: bearerTransport{token: "token"}}
+	svc := integrations["microsoft"].connect(client, "AQMk=")
+
+	tasks, err := svc.listTasks()
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "Call", tasks[0].Title)
+	assert.True(t, tasks[0].Completed)
+	assert.Equal(t, "high", tasks[0].Priority)
+	assert.Equal(t, 2026, tasks[0].Updated.Year())
+	assert.False(t, tasks[1].Completed)
+	assert.Equal(t, "", tasks[1].Priority)
+	assert.Equal(t, "2026-03-04", tasks[1].DueDate)
+
+	created, err := svc.createTask(remoteTask{Title: "Write", Priority: "low", DueDate: "2026-05-06"})
+	assert.NoError(t, err)
+	assert.Equal(t, "t3", created.ID)
+	assert.Equal(t, "low", created.Priority)
+
+	_, err = svc.updateTask(remoteTask{ID: "t3", Title: "Write", Priority: "medium", Completed: true})
+	assert.NoError(t, err)
+	assert.NoError(t, svc.deleteTask("t2"))
+
+	assert.Len(t, bodies, 3)
+	assert.Equal(t, "low", bodies[0]["importance"])
+	assert.Equal(t, map[string]interface{}{"dateTime": "2026-05-06T00:00:00", "timeZone": "UTC"}, bodies[0]["dueDateTime"])
+	assert.Equal(t, "normal", bodies[1]["importance"])
+	assert.Equal(t, "completed", bodies[1]["status"])
+	assert.Contains(t, bodies[1], "dueDateTime")
+	assert.Nil(t, bodies[1]["dueDateTime"])
+}
+
+func TestMicrosoftOAuthConfig(t *testing.T) {
+	previous := config.MicrosoftTenant
+	config.MicrosoftTenant = "contoso.onmicrosoft.com"
+	defer func() { config.MicrosoftTenant = previous }()
+
+	oauth := integrations["microsoft"].oauth()
+	assert.Equal(t, "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/token", oauth.TokenURL)
+	consent := oauth.authCodeURL("state", "https://todo.example.com/integrations/microsoft/callback")
+	assert.True(t, strings.HasPrefix(consent, "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/authorize?"))
+	assert.Contains(t, consent, "scope=Tasks.ReadWrite+offline_access")
+}
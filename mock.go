@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// mockSeed makes every mock server start with the same fixtures.
+	mockSeed      = 1
+	mockTodoCount = 40
+	// mockAdminToken is the admin token of a mock server started without
+	// ADMIN_TOKEN.
+	mockAdminToken = "mock-admin-token"
+)
+
+var (
+	mockUsers = []string{"alice", "bob", "carol", ""}
+	mockTags  = []string{"home", "work", "errands", "finance", "health"}
+	// mockStart is the first due date handed out. Fixture dates are fixed
+	// rather than relative to today, so responses don't change from day to
+	// day.
+	mockStart = time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+)
+
+// mockConfig is the configuration of a mock server: base with the database
+// in dir, a throwaway directory, and every outbound integration off, so
+// clients exercising the API cause no side effects.
+func mockConfig(base Config, dir string) Config {
+	c := base
+	c.DataDir = dir
+	c.DBPath = filepath.Join(dir, "todos.db")
+	c.ArchivePath = filepath.Join(dir, "archive.db")
+	c.BackupDir = ""
+	c.AttachmentStore = "bolt"
+	c.DevMode = true
+	if c.AdminToken == "" {
+		c.AdminToken = mockAdminToken
+	}
+	c.VaultAddr = ""
+	c.SentryDSN = ""
+	c.GoogleClientID, c.MicrosoftClientID = "", ""
+	c.GitHubRepo, c.GitHubToken, c.GitHubIssueOnCreate = "", "", false
+	c.JiraURL, c.JiraToken, c.JiraDoneTransition = "", "", ""
+	c.TwilioAccountSID, c.TwilioAuthToken, c.TwilioFrom = "", "", ""
+	c.PrimaryURL, c.PrimarySnapshotURL, c.PrimaryToken = "", "", ""
+	return c
+}
+
+// mockTodos generates the fixtures: the same todos, in the same order, on
+// every call.
+func mockTodos() []Todo {
+	rng := rand.New(rand.NewSource(mockSeed))
+	todos := make([]Todo, mockTodoCount)
+	for i := range todos {
+		todo := fakeTodo(rng)
+		todo.Assignee = mockUsers[rng.Intn(len(mockUsers))]
+		todo.Priority = []string{"", "low", "medium", "high"}[rng.Intn(4)]
+		if rng.Intn(3) > 0 {
+			todo.DueDate = mockStart.AddDate(0, 0, rng.Intn(28)).Format(dueDateLayout)
+		}
+		for _, j := range rng.Perm(len(mockTags))[:rng.Intn(3)] {
+			todo.Tags = append(todo.Tags, mockTags[j])
+		}
+		if rng.Intn(4) == 0 {
+			todo.Estimate = []string{"15m", "30m", "1h", "2h"}[rng.Intn(4)]
+		}
+		todos[i] = todo
+	}
+	return todos
+}
+
+// seedMock fills an empty database with the fixtures. IDs start at 1.
+func seedMock() error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, todo := range mockTodos() {
+			id, _ := tx.Bucket(todosBucket).NextSequence()
+			todo.ID = int(id)
+			if err := todoService.saveExternal(tx, nil, &todo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mockDir creates the throwaway data directory of a mock server.
+func mockDir() (string, error) {
+	return os.MkdirTemp("", "todo-mock-")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockTodos(t *testing.T) {
+	todos := mockTodos()
+	assert.Len(t, todos, mockTodoCount)
+	assert.Equal(t, todos, mockTodos(), "fixtures must not change between runs")
+	for _, todo := range todos {
+		assert.NoError(t, validateTodo(todo), todo.Title)
+	}
+}
+
+func TestMockConfig(t *testing.T) {
+	base := Config{AdminToken: "", ArchivePath: "/srv/prod/archive.db", GitHubToken: "ghp", GitHubRepo: "acme/todo", GitHubIssueOnCreate: true, JiraURL: "https://acme.atlassian.net", TwilioAccountSID: "AC123", PrimaryURL: "http://todo-primary:8080", PrimarySnapshotURL: "http://todo-primary:8080/admin/backup", PrimaryToken: "secret", SentryDSN: "https://key@sentry.example.com/1", BackupDir: "/backups", AttachmentStore: "disk"}
+	c := mockConfig(base, "/tmp/todo-mock-1")
+	assert.Equal(t, "/tmp/todo-mock-1/todos.db", c.DBPath)
+	assert.Equal(t, "/tmp/todo-mock-1/archive.db", c.ArchivePath)
+	assert.Equal(t, mockAdminToken, c.AdminToken)
+	assert.True(t, c.DevMode)
+	assert.Empty(t, c.GitHubToken)
+	assert.False(t, c.GitHubIssueOnCreate)
+	assert.Empty(t, c.JiraURL)
+	assert.Empty(t, c.TwilioAccountSID)
+	assert.Empty(t, c.PrimaryURL)
+	assert.Empty(t, c.PrimarySnapshotURL)
+	assert.Empty(t, c.PrimaryToken)
+	assert.Empty(t, c.SentryDSN)
+	assert.Empty(t, c.BackupDir)
+	assert.Equal(t, "bolt", c.AttachmentStore)
+
+	assert.Equal(t, "secret", mockConfig(Config{AdminToken: "secret"}, "/tmp/x").AdminToken)
+}
+
+func TestSeedMock(t *testing.T) {
+	clearBucket(t)
+	assert.NoError(t, seedMock())
+
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var todo Todo
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&todo))
+	want := mockTodos()[0]
+	assert.Equal(t, 1, todo.ID)
+	assert.Equal(t, want.Title, todo.Title)
+	assert.Equal(t, want.DueDate, todo.DueDate)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// readyBefore orders the ready queue: higher priority first, then earlier
+// due date, with undated todos last, then ID.
+func readyBefore(a, b Todo) bool {
+	if pa, pb := priorities[a.Priority], priorities[b.Priority]; pa != pb {
+		return pa > pb
+	}
+	if a.DueDate != b.DueDate {
+		if a.DueDate == "" || b.DueDate == "" {
+			return b.DueDate == ""
+		}
+		return a.DueDate < b.DueDate
+	}
+	return a.ID < b.ID
+}
+
+// getNextTodos returns the ready queue: open todos with no open blockers,
+// best candidate first.
+func getNextTodos(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	assignee, err := resolveAssignee(r.URL.Query().Get("assignee"), userFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filters := []indexFilter{{"completed", "false"}}
+	if assignee != "" {
+		filters = append(filters, indexFilter{"assignee", assignee})
+	}
+
+	ready := []Todo{}
+	err = timedView(r, func(tx *bolt.Tx) error {
+		it := newFilteredIterator(tx, filters)
+		for k, v := it.first(); k != nil; k, v = it.next() {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			blockers, err := openBlockers(tx, todo.ID)
+			if err != nil {
+				return err
+			}
+			if len(blockers) == 0 {
+				ready = append(ready, todo)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(ready, func(i, j int) bool { return readyBefore(ready[i], ready[j]) })
+	if len(ready) > limit {
+		ready = ready[:limit]
+	}
+
+	json.NewEncoder(w).Encode(ready)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetNextTodos(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, todo := range []Todo{
+		{Title: "Someday"},
+		{Title: "Due later", Priority: "high", DueDate: "2026-03-01"},
+		{Title: "Done", Priority: "high", Completed: true},
+		{Title: "Blocked", Priority: "high", DueDate: "2026-01-01"},
+		{Title: "Due sooner", Priority: "high", DueDate: "2026-02-01"},
+		{Title: "Undated", Priority: "high"},
+		{Title: "Medium", Priority: "medium", DueDate: "2025-01-01"},
+	} {
+		payload, _ := json.Marshal(todo)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos/4/blockers", strings.NewReader(`{"id":1}`)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/next", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var todos []Todo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &todos))
+
+	var titles []string
+	for _, todo := range todos {
+		titles = append(titles, todo.Title)
+	}
+	assert.Equal(t, []string{"Due sooner", "Due later", "Undated", "Medium", "Someday"}, titles)
+}
+
+func TestCreateTodoValidatesPriorityAndDueDate(t *testing.T) {
+	clearBucket(t)
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+	}{
+		{
+			name:           "valid",
+			payload:        `{"title":"A","priority":"low","dueDate":"2026-12-31"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "unknown priority",
+			payload:        `{"title":"A","priority":"critical"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "malformed due date",
+			payload:        `{"title":"A","dueDate":"31/12/2026"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.payload))
+			w := httptest.NewRecorder()
+
+			createTodo(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync"
+)
+
+// Notification tells a user about something that happened to a todo.
+type Notification struct {
+	User    string
+	TodoID  int
+	Reason  string
+	Message string
+}
+
+const reasonWatching = "watching"
+
+// Notifier delivers notifications. Notify is called on the writer's
+// goroutine after the change commits, so implementations that talk to slow
+// services must queue the work themselves.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// logNotifier writes notifications to the server log. It is the default
+// until a delivery channel is configured.
+type logNotifier struct{}
+
+func (logNotifier) Notify(n Notification) error {
+	infof("notify %s about todo %d (%s): %s", redactUser(n.User), n.TodoID, n.Reason, n.Message)
+	return nil
+}
+
+var (
+	notifierMu sync.RWMutex
+	notifier   Notifier = logNotifier{}
+)
+
+func currentNotifier() Notifier {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+	return notifier
+}
+
+func setNotifier(n Notifier) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	notifier = n
+}
+
+func notify(n Notification) {
+	if err := currentNotifier().Notify(n); err != nil {
+		warnf("notifying %s about todo %d: %v", redactUser(n.User), n.TodoID, err)
+	}
+}
+
+func notifyWatchers(e Event) {
+	message := map[string]string{
+		EventTodoCreated: "created",
+		EventTodoUpdated: "updated",
+		EventTodoDeleted: "deleted",
+	}[e.Type] + ": " + todoLabel(e.Todo)
+
+	users, err := todoWatchers(e.Todo.ID)
+	if err != nil {
+		warnf("loading watchers of todo %d: %v", e.Todo.ID, err)
+		return
+	}
+	for _, user := range users {
+		notify(Notification{User: user, TodoID: e.Todo.ID, Reason: reasonWatching, Message: message})
+	}
+}
+
+func init() {
+	events.subscribe(notifyWatchers)
+}
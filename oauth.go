@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// oauthConfig is an OAuth 2.0 client of one provider.
+type oauthConfig struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	Scopes       []string
+	// AuthParams are extra parameters the provider needs on the consent
+	// URL, such as Google's access_type=offline for a refresh token.
+	AuthParams url.Values
+}
+
+type oauthToken struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// oauthExpiryMargin refreshes tokens a little before they expire, so one
+// doesn't lapse halfway through a sync.
+const oauthExpiryMargin = time.Minute
+
+func (c oauthConfig) authCodeURL(state, redirectURL string) string {
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.ClientID},
+		"redirect_uri":  {redirectURL},
+		"scope":         {strings.Join(c.Scopes, " ")},
+		"state":         {state},
+	}
+	for k, v := range c.AuthParams {
+		q[k] = v
+	}
+	return c.AuthURL + "?" + q.Encode()
+}
+
+// exchange trades an authorization code for a token.
+func (c oauthConfig) exchange(code, redirectURL string) (oauthToken, error) {
+	return c.requestToken(url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {redirectURL},
+	})
+}
+
+// fresh returns t, refreshed first if it is about to expire.
+func (c oauthConfig) fresh(t oauthToken) (oauthToken, error) {
+	if clock.Now().Add(oauthExpiryMargin).Before(t.Expiry) {
+		return t, nil
+	}
+	if t.RefreshToken == "" {
+		return t, fmt.Errorf("access token expired and there is no refresh token; authorize again")
+	}
+	refreshed, err := c.requestToken(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.RefreshToken},
+	})
+	if err != nil {
+		return t, err
+	}
+	// Providers may or may not rotate the refresh token.
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = t.RefreshToken
+	}
+	return refreshed, nil
+}
+
+func (c oauthConfig) requestToken(form url.Values) (oauthToken, error) {
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+
+	resp, err := http.PostForm(c.TokenURL, form)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return oauthToken{}, fmt.Errorf("token endpoint answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return oauthToken{}, fmt.Errorf("decoding token response: %v", err)
+	}
+	if payload.AccessToken == "" {
+		return oauthToken{}, fmt.Errorf("token response has no access token")
+	}
+	return oauthToken{
+		AccessToken:  payload.AccessToken,
+		RefreshToken: payload.RefreshToken,
+		Expiry:       clock.Now().Add(time.Duration(payload.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// bearerTransport authenticates every request with an access token.
+type bearerTransport struct {
+	token string
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxCachedPageSize = 1000
+
+// listPage is one page of a listing inside a read transaction. Opening it
+// walks the page's keys once (no decoding) to learn the totals and the next
+// cursor, so headers can be sent before the items are streamed.
+type listPage struct {
+	it         listIterator
+	start      []byte
+	size       int
+	page       int
+	limit      int
+	totalItems int
+	totalPages int
+	nextCursor string
+}
+
+func openListPage(it listIterator, page, limit int, after []byte) *listPage {
+	p := &listPage{it: it, limit: limit}
+	p.totalItems = it.count()
+	p.totalPages = (p.totalItems + limit - 1) / limit
+
+	var k []byte
+	if after != nil {
+		// Keyset pagination: resume right after the last key served.
+		k, _ = it.seekAfter(after)
+	} else {
+		if page > p.totalPages && p.totalPages > 0 {
+			page = p.totalPages
+		}
+		p.page = page
+
+		k, _ = it.first()
+		for i := 0; i < (page-1)*limit && k != nil; i++ {
+			k, _ = it.next()
+		}
+	}
+
+	if k != nil {
+		p.start = append([]byte{}, k...)
+	}
+
+	var last []byte
+	for ; k != nil && p.size < limit; k, _ = it.next() {
+		p.size++
+		if p.size == limit {
+			last = it.cursor(k)
+		}
+	}
+	if k != nil && last != nil {
+		p.nextCursor = encodeCursor(last)
+	}
+	return p
+}
+
+// envelope returns the response metadata without items.
+func (p *listPage) envelope() PaginatedResponse {
+	return PaginatedResponse{
+		Items:      []Todo{},
+		Page:       p.page,
+		Limit:      p.limit,
+		TotalItems: p.totalItems,
+		TotalPages: p.totalPages,
+		NextCursor: p.nextCursor,
+	}
+}
+
+// each decodes the page's todos in order.
+func (p *listPage) each(fn func(Todo) error) error {
+	if p.start == nil {
+		return nil
+	}
+	k, v := p.it.seek(p.start)
+	for i := 0; i < p.size && k != nil; i++ {
+		var todo Todo
+		if err := codec.Unmarshal(v, &todo); err != nil {
+			return err
+		}
+		if err := fn(todo); err != nil {
+			return err
+		}
+		k, v = p.it.next()
+	}
+	return nil
+}
+
+func (p *listPage) collect() ([]Todo, error) {
+	items := make([]Todo, 0, p.size)
+	err := p.each(func(todo Todo) error {
+		items = append(items, todo)
+		return nil
+	})
+	return items, err
+}
+
+// write streams the page, decoding and encoding one todo at a time.
+func (p *listPage) write(w io.Writer, envelope PaginatedResponse, fields fieldSelection) error {
+	return writeList(w, envelope, p.each, fields)
+}
+
+func eachTodo(todos []Todo) func(func(Todo) error) error {
+	return func(fn func(Todo) error) error {
+		for _, todo := range todos {
+			if err := fn(todo); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writeList writes a list envelope with items encoded one at a time, so
+// memory use doesn't grow with the page size.
+func writeList(w io.Writer, envelope PaginatedResponse, each func(func(Todo) error) error, fields fieldSelection) error {
+	if _, err := io.WriteString(w, `{"items":[`); err != nil {
+		return err
+	}
+
+	first := true
+	err := each(func(todo Todo) error {
+		buf, err := fields.encode(todo)
+		if err != nil {
+			return err
+		}
+		if !first {
+			buf = append([]byte{','}, buf...)
+		}
+		first = false
+		_, err = w.Write(buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reuse the struct's encoding for the metadata. Items is the first field,
+	// so the encoded envelope starts with the empty array we already wrote.
+	envelope.Items = []Todo{}
+	meta, err := plainCodec().Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "],%s\n", bytes.TrimPrefix(meta, []byte(`{"items":[],`)))
+	return err
+}
+
+// setPaginationHeaders mirrors the response envelope in an RFC 5988 Link
+// header and X-Total-Count, so clients can paginate without parsing the body.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, response PaginatedResponse) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(response.TotalItems))
+
+	lastPage := response.TotalPages
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	var links []string
+	addLink := func(rel string, set map[string]string) {
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pageURL(r, set), rel))
+	}
+
+	page := map[string]string{"cursor": ""}
+
+	// Cursor requests only know the way forward; page requests get page links.
+	if response.Page == 0 {
+		if response.NextCursor != "" {
+			addLink("next", map[string]string{"cursor": response.NextCursor})
+		}
+	} else if response.Page < lastPage {
+		page["page"] = strconv.Itoa(response.Page + 1)
+		addLink("next", page)
+	}
+
+	if response.Page > 1 {
+		page["page"] = strconv.Itoa(response.Page - 1)
+		addLink("prev", page)
+	}
+
+	page["page"] = "1"
+	addLink("first", page)
+
+	page["page"] = strconv.Itoa(lastPage)
+	addLink("last", page)
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// pageURL rebuilds the request URL with the given query parameters replaced;
+// empty values remove the parameter.
+func pageURL(r *http.Request, set map[string]string) string {
+	query := r.URL.Query()
+	for key, value := range set {
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+	}
+
+	u := *r.URL
+	u.Scheme = ""
+	u.Host = ""
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// encodeCursor turns a bucket key into an opaque pagination token.
+func encodeCursor(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+func decodeCursor(cursor string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) < 8 {
+		return nil, fmt.Errorf("invalid cursor length")
+	}
+	return key, nil
+}
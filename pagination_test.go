@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaginationHeaders(t *testing.T) {
+	clearBucket(t)
+
+	for i := 1; i <= 5; i++ {
+		payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Todo %d", i)})
+		req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+		createTodo(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedLink string
+	}{
+		{
+			name:         "first page",
+			url:          "/todos?page=1&limit=2",
+			expectedLink: `</todos?limit=2&page=2>; rel="next", </todos?limit=2&page=1>; rel="first", </todos?limit=2&page=3>; rel="last"`,
+		},
+		{
+			name:         "middle page",
+			url:          "/todos?page=2&limit=2",
+			expectedLink: `</todos?limit=2&page=3>; rel="next", </todos?limit=2&page=1>; rel="prev", </todos?limit=2&page=1>; rel="first", </todos?limit=2&page=3>; rel="last"`,
+		},
+		{
+			name:         "last page",
+			url:          "/todos?page=3&limit=2",
+			expectedLink: `</todos?limit=2&page=2>; rel="prev", </todos?limit=2&page=1>; rel="first", </todos?limit=2&page=3>; rel="last"`,
+		},
+		// Default listings put starred todos first; cursors name the group
+		// (1: not starred) before the key.
+		{
+			name:         "cursor page",
+			url:          "/todos?limit=2&cursor=" + encodeCursor(itob(1)),
+			expectedLink: `</todos?cursor=` + encodeCursor(append([]byte{1}, itob(3)...)) + `&limit=2>; rel="next", </todos?limit=2&page=1>; rel="first", </todos?limit=2&page=3>; rel="last"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			getTodos(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "5", w.Header().Get("X-Total-Count"))
+			assert.Equal(t, tt.expectedLink, w.Header().Get("Link"))
+		})
+	}
+}
+
+func TestPaginationHeadersEmptyList(t *testing.T) {
+	clearBucket(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	w := httptest.NewRecorder()
+
+	getTodos(w, req)
+
+	assert.Equal(t, "0", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</todos?page=1>; rel="first", </todos?page=1>; rel="last"`, w.Header().Get("Link"))
+}
+
+func TestGetTodosStreamsLargePages(t *testing.T) {
+	clearBucket(t)
+
+	err := seedTodos(1500, rand.New(rand.NewSource(1)))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		url           string
+		expectedCount int
+		expectedNext  bool
+	}{
+		{
+			name:          "whole dataset in one page",
+			url:           "/todos?limit=5000",
+			expectedCount: 1500,
+			expectedNext:  false,
+		},
+		{
+			name:          "large page with more to come",
+			url:           "/todos?limit=1200",
+			expectedCount: 1200,
+			expectedNext:  true,
+		},
+		{
+			name:          "cursor page",
+			url:           "/todos?limit=10&cursor=" + encodeCursor(itob(1495)),
+			expectedCount: 5,
+			expectedNext:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			getTodos(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var response PaginatedResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Len(t, response.Items, tt.expectedCount)
+			assert.Equal(t, 1500, response.TotalItems)
+			assert.Equal(t, tt.expectedNext, response.NextCursor != "")
+
+			for i := 1; i < len(response.Items); i++ {
+				assert.Less(t, response.Items[i-1].ID, response.Items[i].ID)
+			}
+		})
+	}
+}
+
+func TestGetTodosStreamedEmptyPage(t *testing.T) {
+	clearBucket(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/todos?limit=10&cursor="+encodeCursor(itob(7)), nil)
+	w := httptest.NewRecorder()
+
+	getTodos(w, req)
+
+	assert.JSONEq(t, `{"items":[],"limit":10,"totalItems":0,"totalPages":0}`, w.Body.String())
+}
+
+// FuzzDecodeCursor checks that cursors round-trip and that any cursor a
+// client sends answers 200 or 400.
+func FuzzDecodeCursor(f *testing.F) {
+	useTestDB(f)
+	router := setupRouter()
+	f.Add("AAAAAAAAAAI")
+	f.Add("AQAAAAAAAAAC")
+	f.Add("")
+	f.Add("!!!")
+	f.Add("AAAA")
+
+	f.Fuzz(func(t *testing.T, cursor string) {
+		if key, err := decodeCursor(cursor); err == nil {
+			again, err := decodeCursor(encodeCursor(key))
+			assert.NoError(t, err)
+			assert.Equal(t, key, again)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos?limit=2&cursor="+url.QueryEscape(cursor), nil))
+		assert.Contains(t, []int{http.StatusOK, http.StatusBadRequest}, w.Code, w.Body.String())
+	})
+}
+
+// TestPaginationProperties checks that walking the pages of a listing, by
+// page number or by cursor, yields every todo exactly once, in the order of
+// the unpaginated listing, for any page size and mix of starred todos.
+func TestPaginationProperties(t *testing.T) {
+	router := setupRouter()
+	list := func(url string) PaginatedResponse {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusOK, w.Code, url)
+		var response PaginatedResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		return response
+	}
+	ids := func(todos []Todo) []int {
+		var ids []int
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		return ids
+	}
+
+	property := func(count, limit uint8, seed int64) bool {
+		clearBucket(t)
+		n, size := int(count%40), int(limit%12)+1
+		rng := rand.New(rand.NewSource(seed))
+		for i := 0; i < n; i++ {
+			saveTodo(t, Todo{Title: "Todo", Starred: rng.Intn(3) == 0, Tags: []string{[]string{"a", "b"}[rng.Intn(2)]}})
+		}
+
+		for _, filter := range []string{"", "&tag=a"} {
+			want := ids(list("/todos?limit=1000" + filter).Items)
+
+			var paged []int
+			first := list(fmt.Sprintf("/todos?limit=%d%s", size, filter))
+			for page := 1; page <= max(first.TotalPages, 1); page++ {
+				paged = append(paged, ids(list(fmt.Sprintf("/todos?limit=%d&page=%d%s", size, page, filter)).Items)...)
+			}
+
+			var walked []int
+			for response := first; ; {
+				walked = append(walked, ids(response.Items)...)
+				if response.NextCursor == "" {
+					break
+				}
+				response = list(fmt.Sprintf("/todos?limit=%d&cursor=%s%s", size, response.NextCursor, filter))
+			}
+
+			if !assert.Equal(t, want, paged, "pages of %d%s", size, filter) || !assert.Equal(t, want, walked, "cursor pages of %d%s", size, filter) {
+				return false
+			}
+		}
+		return true
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 30}))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A4, in points.
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 56
+)
+
+// pdfMaxTitle caps a printed title, in characters, so it fits on a line.
+const pdfMaxTitle = 80
+
+var pdfStatusTitles = map[string]string{
+	StatusTodo:       "To do",
+	StatusInProgress: "In progress",
+	StatusBlocked:    "Blocked",
+	StatusDone:       "Done",
+}
+
+// pdfWriter lays out lines of text on A4 pages in the standard Helvetica
+// fonts, which is all a printed checklist needs.
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+// space moves down by height, starting a new page when it doesn't fit, and
+// returns the page to draw on.
+func (p *pdfWriter) space(height float64) *bytes.Buffer {
+	if len(p.pages) == 0 || p.y-height < pdfMargin {
+		p.pages = append(p.pages, &bytes.Buffer{})
+		p.y = pdfPageHeight - pdfMargin
+	}
+	p.y -= height
+	return p.pages[len(p.pages)-1]
+}
+
+// text writes a line in font F1 (regular) or F2 (bold).
+func (p *pdfWriter) text(font string, size, x float64, s string) {
+	page := p.space(size * 1.5)
+	fmt.Fprintf(page, "BT /%s %g Tf %g %.1f Td (%s) Tj ET\n", font, size, x, p.y, pdfString(s))
+}
+
+// checkbox writes a line with a box in front, ticked when done.
+func (p *pdfWriter) checkbox(size float64, done bool, s string) {
+	page := p.space(size * 1.8)
+	fmt.Fprintf(page, "%g %.1f %g %g re S\n", float64(pdfMargin), p.y-1, size, size)
+	if done {
+		fmt.Fprintf(page, "%g %.1f m %g %.1f l %g %.1f l S\n",
+			pdfMargin+size*0.2, p.y+size*0.45, pdfMargin+size*0.45, p.y+size*0.15, pdfMargin+size*0.85, p.y+size*0.85)
+	}
+	fmt.Fprintf(page, "BT /F1 %g Tf %g %.1f Td (%s) Tj ET\n", size, pdfMargin+size*1.8, p.y, pdfString(s))
+}
+
+// writeTo writes the document: a catalog, a page tree and the two fonts,
+// then each page followed by its content stream.
+func (p *pdfWriter) writeTo(w io.Writer) error {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.Len(), page.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfString escapes s for a PDF string literal. The standard fonts only
+// cover Latin-1, so other characters print as "?".
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r > 0xff || (r >= 0x7f && r < 0xa0):
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+func pdfTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if runes := []rune(title); len(runes) > pdfMaxTitle {
+		return string(runes[:pdfMaxTitle-3]) + "..."
+	}
+	return title
+}
+
+// writeTodosPDF writes todos as a printable checklist, grouped by status,
+// with each todo's due date and assignee under it.
+func writeTodosPDF(w io.Writer, todos []Todo, now time.Time) error {
+	groups := make(map[string][]Todo)
+	for _, todo := range todos {
+		status := todoStatus(todo)
+		groups[status] = append(groups[status], todo)
+	}
+
+	p := &pdfWriter{}
+	p.text("F2", 18, pdfMargin, "Todos")
+	p.text("F1", 9, pdfMargin, "Printed "+now.Format("2 January 2006"))
+	for _, status := range statusOrder {
+		items := groups[status]
+		if len(items) == 0 {
+			continue
+		}
+		p.space(8)
+		p.text("F2", 13, pdfMargin, fmt.Sprintf("%s (%d)", pdfStatusTitles[status], len(items)))
+		for _, todo := range items {
+			p.checkbox(11, todo.Completed, pdfTitle(todo.Title))
+			var details []string
+			if todo.DueDate != "" {
+				details = append(details, "Due "+todo.DueDate)
+			}
+			if todo.Assignee != "" {
+				details = append(details, "Assigned to "+todo.Assignee)
+			}
+			if len(details) > 0 {
+				p.text("F1", 9, pdfMargin+20, strings.Join(details, " · "))
+			}
+		}
+	}
+	return p.writeTo(w)
+}
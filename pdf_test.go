@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPDFString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Buy milk", "Buy milk"},
+		{`Fix (urgent) C:\temp`, `Fix \(urgent\) C:\\temp`},
+		{"Café", "Caf\xe9"},
+		{"Tab\there", "Tab?here"},
+		{"寿司", "??"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.want, pdfString(tt.in))
+		})
+	}
+}
+
+func TestWriteTodosPDF(t *testing.T) {
+	todos := []Todo{
+		{Title: "File taxes", Status: StatusInProgress, DueDate: "2026-10-20", Assignee: "alice"},
+		{Title: "Buy milk"},
+		{Title: "Water plants", Completed: true},
+		{Title: strings.Repeat("long ", 30)},
+	}
+	for i := 0; i < 40; i++ {
+		todos = append(todos, Todo{Title: "Chore " + strconv.Itoa(i)})
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeTodosPDF(&buf, todos, time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)))
+	doc := buf.String()
+
+	assert.True(t, strings.HasPrefix(doc, "%PDF-1.4\n"))
+	assert.True(t, strings.HasSuffix(doc, "%%EOF\n"))
+	assert.Contains(t, doc, "(Printed 16 October 2026) Tj")
+	assert.Contains(t, doc, "(To do \\(42\\)) Tj")
+	assert.Contains(t, doc, "(In progress \\(1\\)) Tj")
+	assert.Contains(t, doc, "(Done \\(1\\)) Tj")
+	assert.NotContains(t, doc, "(Blocked")
+	assert.Contains(t, doc, "(Due 2026-10-20 \xb7 Assigned to alice) Tj")
+	assert.Contains(t, doc, " lo...) Tj")
+
+	// Statuses are printed in workflow order.
+	assert.Less(t, strings.Index(doc, "(To do"), strings.Index(doc, "(In progress"))
+	assert.Less(t, strings.Index(doc, "(In progress"), strings.Index(doc, "(Done"))
+
+	// Too many todos for one page continue on the next.
+	assert.Contains(t, doc, "/Count 2 ")
+
+	// Every cross-reference entry points at its object.
+	xref := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(doc, -1)
+	assert.Len(t, xref, 8)
+	for i, entry := range xref {
+		offset, _ := strconv.Atoi(entry[1])
+		assert.True(t, strings.HasPrefix(doc[offset:], strconv.Itoa(i+1)+" 0 obj\n"), "object %d", i+1)
+	}
+}
+
+func TestExportPDF(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	saveTodo(t, Todo{Title: "File taxes", Tags: []string{"home"}})
+	saveTodo(t, Todo{Title: "Write report", Tags: []string{"work"}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/export?format=pdf&tag=home", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "(File taxes) Tj")
+	assert.NotContains(t, w.Body.String(), "Write report")
+}
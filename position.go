@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Positions are fractional indexes: strings of base-62 digits compared
+// byte-wise, with no trailing zero digit. There is always a position between
+// two others, so moving a todo rewrites only that todo.
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var errInvalidMove = errors.New("move needs exactly one of before, after or a non-negative index")
+
+// positionBetween returns a position strictly between a and b. An empty a
+// means the start of the list and an empty b its end.
+func positionBetween(a, b string) string {
+	if b != "" {
+		// Skip the common prefix, padding a with zero digits.
+		n := 0
+		for n < len(b) {
+			da := byte('0')
+			if n < len(a) {
+				da = a[n]
+			}
+			if da != b[n] {
+				break
+			}
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + positionBetween(rest, b[n:])
+		}
+	}
+
+	da := 0
+	if a != "" {
+		da = strings.IndexByte(positionDigits, a[0])
+	}
+	db := len(positionDigits)
+	if b != "" {
+		db = strings.IndexByte(positionDigits, b[0])
+	}
+
+	if db-da > 1 {
+		return string(positionDigits[(da+db)/2])
+	}
+	// The first digits are adjacent. A longer b can be cut short; otherwise
+	// keep a's first digit and go past the rest of a.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(positionDigits[da]) + positionBetween(rest, "")
+}
+
+func positionOf(indexKey []byte) string {
+	return string(indexKey[:bytes.IndexByte(indexKey, 0)])
+}
+
+// lastPositionExcept returns the position of the last todo other than id,
+// or "" if there is none.
+func lastPositionExcept(tx *bolt.Tx, id int) string {
+	c := tx.Bucket(indexesBucket).Bucket([]byte("position")).Cursor()
+	for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+		if !bytes.Equal(k[bytes.IndexByte(k, 0)+1:], itob(id)) {
+			return positionOf(k)
+		}
+	}
+	return ""
+}
+
+// backfillPositions gives todos written before positions existed one each,
+// keeping ID order. It rewrites records directly: nothing observable changes
+// but the new field.
+func backfillPositions(tx *bolt.Tx) error {
+	b := tx.Bucket(todosBucket)
+	updated := make(map[string][]byte)
+	last := ""
+	err := b.ForEach(func(k, v []byte) error {
+		var todo Todo
+		if err := codec.Unmarshal(v, &todo); err != nil {
+			return err
+		}
+		if todo.Position != "" {
+			if todo.Position > last {
+				last = todo.Position
+			}
+			return nil
+		}
+		last = positionBetween(last, "")
+		todo.Position = last
+		buf, err := codec.Marshal(todo)
+		if err != nil {
+			return err
+		}
+		updated[string(k)] = buf
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range updated {
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type MoveRequest struct {
+	Before *int `json:"before"`
+	After  *int `json:"after"`
+	Index  *int `json:"index"`
+}
+
+// neighbours returns the positions a todo moved as requested would sit
+// between. The moving todo itself is left out of the ordering.
+func neighbours(tx *bolt.Tx, id int, req MoveRequest) (string, string, error) {
+	self := itob(id)
+	c := tx.Bucket(indexesBucket).Bucket([]byte("position")).Cursor()
+	isSelf := func(k []byte) bool { return k != nil && bytes.Equal(k[bytes.IndexByte(k, 0)+1:], self) }
+	position := func(k []byte) string {
+		if k == nil {
+			return ""
+		}
+		return positionOf(k)
+	}
+
+	if req.Index != nil {
+		k, _ := c.First()
+		for i := 0; k != nil; k, _ = c.Next() {
+			if isSelf(k) {
+				continue
+			}
+			if i == *req.Index {
+				break
+			}
+			i++
+		}
+		next := position(k)
+		k, _ = c.Prev()
+		for isSelf(k) {
+			k, _ = c.Prev()
+		}
+		if next == "" {
+			return lastPositionExcept(tx, id), "", nil
+		}
+		return position(k), next, nil
+	}
+
+	targetID := req.Before
+	if targetID == nil {
+		targetID = req.After
+	}
+	target, err := loadTodo(tx, *targetID)
+	if err != nil {
+		return "", "", err
+	}
+	if target == nil {
+		return "", "", errTodoNotFound
+	}
+
+	c.Seek(indexKey(target.Position, itob(target.ID)))
+	if req.Before != nil {
+		k, _ := c.Prev()
+		for isSelf(k) {
+			k, _ = c.Prev()
+		}
+		return position(k), target.Position, nil
+	}
+	k, _ := c.Next()
+	for isSelf(k) {
+		k, _ = c.Next()
+	}
+	return target.Position, position(k), nil
+}
+
+func moveTodo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	given := 0
+	for _, p := range []*int{req.Before, req.After, req.Index} {
+		if p != nil {
+			given++
+		}
+	}
+	if given != 1 || (req.Index != nil && *req.Index < 0) {
+		http.Error(w, errInvalidMove.Error(), http.StatusBadRequest)
+		return
+	}
+
+	todo, err := todoService.Modify(id, func(tx *bolt.Tx, todo *Todo) error {
+		prev, next, err := neighbours(tx, id, req)
+		if err != nil {
+			return err
+		}
+		todo.Position = positionBetween(prev, next)
+		return nil
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(todo)
+}
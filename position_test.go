@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestPositionBetween(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"", "", "V"},
+		{"V", "", "k"},
+		{"", "V", "F"},
+		{"V", "W", "VV"},
+		{"z", "", "zV"},
+		{"", "01", "00V"},
+		{"a1", "a2", "a1V"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q-%q", tt.a, tt.b), func(t *testing.T) {
+			assert.Equal(t, tt.expected, positionBetween(tt.a, tt.b))
+		})
+	}
+
+	// Repeatedly inserting at random spots must keep the order strict.
+	rng := rand.New(rand.NewSource(1))
+	positions := []string{positionBetween("", "")}
+	for i := 0; i < 2000; i++ {
+		at := rng.Intn(len(positions) + 1)
+		prev, next := "", ""
+		if at > 0 {
+			prev = positions[at-1]
+		}
+		if at < len(positions) {
+			next = positions[at]
+		}
+		p := positionBetween(prev, next)
+		assert.True(t, prev < p && (next == "" || p < next), "%q not between %q and %q", p, prev, next)
+		assert.False(t, strings.HasSuffix(p, "0"))
+		positions = append(positions[:at], append([]string{p}, positions[at:]...)...)
+	}
+}
+
+func listTitlesByPosition(t *testing.T, router http.Handler) []string {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos?sort=position", nil))
+
+	var response PaginatedResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	var titles []string
+	for _, todo := range response.Items {
+		titles = append(titles, todo.Title)
+	}
+	return titles
+}
+
+func TestMoveTodo(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, title := range []string{"A", "B", "C", "D"} {
+		payload, _ := json.Marshal(Todo{Title: title})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+		expectedOrder  []string
+	}{
+		{
+			name:           "before",
+			url:            "/todos/4/move",
+			body:           `{"before":2}`,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  []string{"A", "D", "B", "C"},
+		},
+		{
+			name:           "after",
+			url:            "/todos/1/move",
+			body:           `{"after":3}`,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  []string{"D", "B", "C", "A"},
+		},
+		{
+			name:           "to the start",
+			url:            "/todos/3/move",
+			body:           `{"index":0}`,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  []string{"C", "D", "B", "A"},
+		},
+		{
+			name:           "to an index",
+			url:            "/todos/3/move",
+			body:           `{"index":2}`,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  []string{"D", "B", "C", "A"},
+		},
+		{
+			name:           "past the end",
+			url:            "/todos/4/move",
+			body:           `{"index":10}`,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  []string{"B", "C", "A", "D"},
+		},
+		{
+			name:           "two targets",
+			url:            "/todos/4/move",
+			body:           `{"before":1,"after":2}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedOrder:  []string{"B", "C", "A", "D"},
+		},
+		{
+			name:           "missing target",
+			url:            "/todos/4/move",
+			body:           `{"before":99}`,
+			expectedStatus: http.StatusNotFound,
+			expectedOrder:  []string{"B", "C", "A", "D"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedOrder, listTitlesByPosition(t, router))
+		})
+	}
+}
+
+func TestSortByPositionCursorPagination(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for i := 1; i <= 5; i++ {
+		payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Todo %d", i)})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos/5/move", strings.NewReader(`{"index":0}`)))
+
+	assert.Equal(t, []int{5, 1, 2, 3, 4}, listIDs(t, router, "/todos?sort=position&limit=2"))
+}
+
+func TestEnsureBucketsBackfillsPositions(t *testing.T) {
+	clearBucket(t)
+
+	// Simulate a database written before positions existed
+	err := db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(indexesBucket); err != nil {
+			return err
+		}
+		b := tx.Bucket(todosBucket)
+		for i, title := range []string{"A", "B", "C"} {
+			buf, _ := json.Marshal(Todo{ID: i + 1, Title: title})
+			if err := b.Put(itob(i+1), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(ensureBuckets)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"A", "B", "C"}, listTitlesByPosition(t, setupRouter()))
+}
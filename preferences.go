@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// preferencesBucket holds each user's Preferences keyed by user name.
+var preferencesBucket = []byte("preferences")
+
+// Preferences are per-user settings.
+type Preferences struct {
+	// Timezone is an IANA zone name. Due dates are plain dates, so it
+	// decides which date is "today" for the user.
+	Timezone string `json:"timezone,omitempty"`
+	// Phone is an E.164 number such as +14155550123, for SMS reminders.
+	Phone        string      `json:"phone,omitempty"`
+	SMSReminders bool        `json:"smsReminders,omitempty"`
+	QuietHours   *QuietHours `json:"quietHours,omitempty"`
+	// Language, such as pt-BR, overrides Accept-Language for error
+	// messages, and is the language of SMS reminders.
+	Language string `json:"language,omitempty"`
+}
+
+// QuietHours is a daily span, in the user's time zone, during which no SMS
+// is sent. It wraps past midnight when Start is after End.
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+const clockLayout = "15:04"
+
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+func validatePreferences(p Preferences) error {
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			return fmt.Errorf("unknown time zone %q", p.Timezone)
+		}
+	}
+	if p.Phone != "" && !phonePattern.MatchString(p.Phone) {
+		return fmt.Errorf("invalid phone %q: use the international format, such as +14155550123", p.Phone)
+	}
+	if p.SMSReminders && p.Phone == "" {
+		return fmt.Errorf("smsReminders needs a phone number")
+	}
+	if p.Language != "" && !slices.Contains(languages, p.Language) {
+		return fmt.Errorf("unsupported language %q: use %s", p.Language, strings.Join(languages, " or "))
+	}
+	if q := p.QuietHours; q != nil {
+		for _, value := range []string{q.Start, q.End} {
+			if _, err := time.Parse(clockLayout, value); err != nil {
+				return fmt.Errorf("invalid quiet hours time %q: use HH:MM", value)
+			}
+		}
+	}
+	return nil
+}
+
+// quiet reports whether now, in the user's time zone, falls in q.
+func (q *QuietHours) quiet(now time.Time) bool {
+	if q == nil {
+		return false
+	}
+	start, _ := time.Parse(clockLayout, q.Start)
+	end, _ := time.Parse(clockLayout, q.End)
+	current, _ := time.Parse(clockLayout, now.Format(clockLayout))
+	if start.Before(end) {
+		return !current.Before(start) && current.Before(end)
+	}
+	if end.Before(start) {
+		return !current.Before(start) || current.Before(end)
+	}
+	return false
+}
+
+func loadPreferences(tx *bolt.Tx, user string) (Preferences, error) {
+	var p Preferences
+	v := tx.Bucket(preferencesBucket).Get([]byte(user))
+	if v == nil {
+		return p, nil
+	}
+	err := codec.Unmarshal(v, &p)
+	return p, err
+}
+
+func preferencesUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Preferences require the "+userHeader+" header", http.StatusBadRequest)
+		return "", false
+	}
+	if err := validUserName(user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return user, true
+}
+
+// getPreferences returns the caller's preferences.
+func getPreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := preferencesUser(w, r)
+	if !ok {
+		return
+	}
+
+	var p Preferences
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		p, err = loadPreferences(tx, user)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(p)
+}
+
+// updatePreferences replaces the caller's preferences.
+func updatePreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := preferencesUser(w, r)
+	if !ok {
+		return
+	}
+
+	var p Preferences
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePreferences(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := writeTx(func(tx *bolt.Tx) error {
+		buf, err := codec.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(preferencesBucket).Put([]byte(user), buf)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(p)
+}
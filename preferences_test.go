@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreferences(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	tests := []struct {
+		name, user, method, body string
+		code                     int
+		want                     string
+	}{
+		{"defaults", "alice", http.MethodGet, "", http.StatusOK, `{}`},
+		{"set timezone", "alice", http.MethodPut, `{"timezone":"Europe/Lisbon"}`, http.StatusOK, `{"timezone":"Europe/Lisbon"}`},
+		{"read back", "alice", http.MethodGet, "", http.StatusOK, `{"timezone":"Europe/Lisbon"}`},
+		{"per user", "bob", http.MethodGet, "", http.StatusOK, `{}`},
+		{"unknown timezone", "alice", http.MethodPut, `{"timezone":"Mars/Olympus_Mons"}`, http.StatusBadRequest, ""},
+		{"sms reminders", "carol", http.MethodPut, `{"phone":"+14155550123","smsReminders":true,"quietHours":{"start":"22:00","end":"07:00"}}`, http.StatusOK, `{"phone":"+14155550123","smsReminders":true,"quietHours":{"start":"22:00","end":"07:00"}}`},
+		{"local phone", "carol", http.MethodPut, `{"phone":"4155550123"}`, http.StatusBadRequest, ""},
+		{"reminders without phone", "carol", http.MethodPut, `{"smsReminders":true}`, http.StatusBadRequest, ""},
+		{"invalid quiet hours", "carol", http.MethodPut, `{"quietHours":{"start":"10pm","end":"07:00"}}`, http.StatusBadRequest, ""},
+		{"language", "dave", http.MethodPut, `{"language":"pt-BR"}`, http.StatusOK, `{"language":"pt-BR"}`},
+		{"unsupported language", "dave", http.MethodPut, `{"language":"fr"}`, http.StatusBadRequest, ""},
+		{"anonymous", "", http.MethodGet, "", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, requestAs(tt.user, tt.method, "/preferences", tt.body))
+			assert.Equal(t, tt.code, w.Code)
+			if tt.want != "" {
+				assert.JSONEq(t, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTimezoneAwareQueries(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	// UTC+14 and UTC-11 are always on different dates.
+	ahead, _ := time.LoadLocation("Pacific/Kiritimati")
+	aheadToday := time.Now().In(ahead).Format(dueDateLayout)
+
+	payload, _ := json.Marshal(Todo{Title: "Due in Kiritimati", DueDate: aheadToday})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("kai", http.MethodPut, "/preferences", `{"timezone":"Pacific/Kiritimati"}`))
+	router.ServeHTTP(httptest.NewRecorder(), requestAs("sam", http.MethodPut, "/preferences", `{"timezone":"Pacific/Pago_Pago"}`))
+
+	query := func(user, zone, q string) []int {
+		req := requestAs(user, http.MethodGet, "/todos?q="+q, "")
+		if zone != "" {
+			req.Header.Set(timezoneHeader, zone)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response PaginatedResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		ids := []int{}
+		for _, todo := range response.Items {
+			ids = append(ids, todo.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []int{1}, query("kai", "", "due:today"))
+	assert.Equal(t, []int{}, query("sam", "", "due:today"))
+	assert.Equal(t, []int{1}, query("sam", "", "due%3Etoday"))
+	// The header overrides the stored preference.
+	assert.Equal(t, []int{1}, query("sam", "Pacific/Kiritimati", "due:today"))
+
+	// A day later in Kiritimati the todo is overdue there, but not yet
+	// anywhere else.
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/todos/1", bytes.NewBufferString(
+		`{"title":"Due in Kiritimati","dueDate":"`+time.Now().In(ahead).AddDate(0, 0, -1).Format(dueDateLayout)+`"}`)))
+	assert.Equal(t, []int{1}, query("kai", "", "overdue"))
+	assert.Equal(t, []int{}, query("sam", "", "overdue"))
+
+	view := getTestView(t, router, "/views/today", "")
+	assert.Equal(t, time.Now().UTC().Format(dueDateLayout), view.Today)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority classes of API traffic. Each class has its own concurrency
+// limit and rate budget, so a burst of exports can't use up the capacity
+// ordinary list and create requests need.
+const (
+	classInteractive = "interactive"
+	classBatch       = "batch"
+	classAdmin       = "admin"
+)
+
+var trafficClasses = []string{classInteractive, classBatch, classAdmin}
+
+// batchRoutes are the routes of the batch class, by method and path
+// template: bulk imports and exports.
+var batchRoutes = map[string]bool{
+	"POST /import/markdown":      true,
+	"GET /todos/export":          true,
+	"POST /imports":              true,
+	"POST /imports/{id}/commit":  true,
+	"POST /exports":              true,
+	"GET /exports/{id}/download": true,
+	"GET /me/export":             true,
+	"POST /me/export":            true,
+	"GET /me/export/download":    true,
+}
+
+// ClassLimit caps one priority class: Concurrency requests at once, and
+// Rate requests per second on average, in bursts of up to Rate, at least
+// one. Zero means no limit.
+type ClassLimit struct {
+	Concurrency int
+	Rate        float64
+}
+
+// ClassStats are the requests of one priority class in flight and
+// rejected, by reason.
+type ClassStats struct {
+	Class    string         `json:"class"`
+	InFlight int            `json:"inFlight"`
+	Rejected map[string]int `json:"rejected"`
+}
+
+// routeClass returns the priority class of r, or "" for health checks,
+// which are never limited.
+func routeClass(r *http.Request) string {
+	route := routeName(r)
+	switch {
+	case route == "/health", route == "/readyz":
+		return ""
+	case route == "/admin", strings.HasPrefix(route, "/admin/"), route == "/metrics", route == "/cdc", strings.HasPrefix(route, "/cdc/"):
+		return classAdmin
+	case batchRoutes[r.Method+" "+route]:
+		return classBatch
+	default:
+		return classInteractive
+	}
+}
+
+// classLimiter enforces a ClassLimit with a counter of requests in flight
+// and a token bucket.
+type classLimiter struct {
+	mu       sync.Mutex
+	limit    ClassLimit
+	inFlight int
+	tokens   float64
+	refilled time.Time
+	rejected map[string]int
+}
+
+// take spends a request from the rate budget, or returns how long until
+// one is available.
+func (l *classLimiter) take(now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit.Rate == 0 {
+		return 0, true
+	}
+	burst := math.Max(1, l.limit.Rate)
+	if l.refilled.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens = math.Min(burst, l.tokens+now.Sub(l.refilled).Seconds()*l.limit.Rate)
+	}
+	l.refilled = now
+	if l.tokens < 1 {
+		l.rejected["rate"]++
+		return time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second)), false
+	}
+	l.tokens--
+	return 0, true
+}
+
+// acquire admits a request under the concurrency limit; admitted requests
+// must be released.
+func (l *classLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit.Concurrency > 0 && l.inFlight >= l.limit.Concurrency {
+		l.rejected["concurrency"]++
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *classLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*classLimiter)
+)
+
+// limiterFor returns the limiter of a priority class, configured from
+// CLASS_LIMITS.
+func limiterFor(class string) *classLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[class]
+	if !ok {
+		l = &classLimiter{limit: config.ClassLimits[class], rejected: make(map[string]int)}
+		limiters[class] = l
+	}
+	return l
+}
+
+// priorityMiddleware admits each request under its class's limits.
+// Requests over the rate budget get 429 and those over the concurrency
+// limit 503, both with Retry-After. Batch requests are also shed while the
+// database is overloaded.
+func priorityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := routeClass(r)
+		if class == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if class == classBatch && shed(w, r) {
+			return
+		}
+
+		l := limiterFor(class)
+		if wait, ok := l.take(clock.Now()); !ok {
+			debugf("%s %s over the %s rate budget", r.Method, routeName(r), class)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests, retry later", http.StatusTooManyRequests)
+			return
+		}
+		if !l.acquire() {
+			debugf("%s %s over the %s concurrency limit", r.Method, routeName(r), class)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "server busy, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		defer l.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// classCounters returns the stats of every priority class, in a fixed
+// order.
+func classCounters() []ClassStats {
+	stats := make([]ClassStats, 0, len(trafficClasses))
+	for _, class := range trafficClasses {
+		l := limiterFor(class)
+		l.mu.Lock()
+		s := ClassStats{Class: class, InFlight: l.inFlight, Rejected: make(map[string]int, len(l.rejected))}
+		for reason, n := range l.rejected {
+			s.Rejected[reason] = n
+		}
+		l.mu.Unlock()
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// parseClassLimits parses CLASS_LIMITS: semicolon-separated entries such
+// as batch=4,2, a class and its concurrency limit, optionally followed by
+// its rate budget in requests per second.
+func parseClassLimits(s string, limits map[string]ClassLimit) error {
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		class, value, ok := strings.Cut(entry, "=")
+		if !ok || !slices.Contains(trafficClasses, class) {
+			return fmt.Errorf("invalid CLASS_LIMITS entry %q: use interactive, batch or admin=concurrency[,rate]", entry)
+		}
+		concurrency, rate, hasRate := strings.Cut(value, ",")
+		var limit ClassLimit
+		var err error
+		if limit.Concurrency, err = strconv.Atoi(concurrency); err != nil || limit.Concurrency < 0 {
+			return fmt.Errorf("invalid CLASS_LIMITS concurrency %q for %s", concurrency, class)
+		}
+		if hasRate {
+			if limit.Rate, err = strconv.ParseFloat(rate, 64); err != nil || !(limit.Rate >= 0) || math.IsInf(limit.Rate, 0) {
+				return fmt.Errorf("invalid CLASS_LIMITS rate %q for %s", rate, class)
+			}
+		}
+		limits[class] = limit
+	}
+	return nil
+}
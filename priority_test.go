@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func withClassLimits(t *testing.T, limits map[string]ClassLimit) {
+	previous, previousConfig := limiters, config
+	limiters = make(map[string]*classLimiter)
+	config.ClassLimits = limits
+	t.Cleanup(func() { limiters, config = previous, previousConfig })
+}
+
+func TestRouteClass(t *testing.T) {
+	var got string
+	r := mux.NewRouter()
+	record := func(w http.ResponseWriter, r *http.Request) { got = routeClass(r) }
+	for _, path := range []string{"/health", "/readyz", "/todos", "/todos/export", "/todos/{id}", "/import/markdown", "/me/export", "/admin", "/admin/stats", "/metrics", "/cdc", "/cdc/consumers/{name}", "/administrators"} {
+		r.HandleFunc(path, record)
+	}
+
+	tests := []struct {
+		method, url, class string
+	}{
+		{http.MethodGet, "/health", ""},
+		{http.MethodGet, "/readyz", ""},
+		{http.MethodGet, "/todos", classInteractive},
+		{http.MethodPost, "/todos", classInteractive},
+		{http.MethodDelete, "/todos/1", classInteractive},
+		{http.MethodGet, "/todos/export", classBatch},
+		{http.MethodPost, "/import/markdown", classBatch},
+		{http.MethodPost, "/me/export", classBatch},
+		{http.MethodDelete, "/me/export", classInteractive},
+		{http.MethodGet, "/admin", classAdmin},
+		{http.MethodGet, "/admin/stats", classAdmin},
+		{http.MethodGet, "/metrics", classAdmin},
+		{http.MethodGet, "/cdc", classAdmin},
+		{http.MethodPut, "/cdc/consumers/search", classAdmin},
+		{http.MethodGet, "/administrators", classInteractive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.url, nil))
+			assert.Equal(t, tt.class, got)
+		})
+	}
+}
+
+func TestClassLimiterRate(t *testing.T) {
+	l := &classLimiter{limit: ClassLimit{Rate: 2}, rejected: make(map[string]int)}
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+
+	// A burst of the rate goes through, then requests wait for tokens.
+	for range 2 {
+		_, ok := l.take(start)
+		assert.True(t, ok)
+	}
+	wait, ok := l.take(start)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	_, ok = l.take(start.Add(500 * time.Millisecond))
+	assert.True(t, ok)
+	// Idle time doesn't save up more than a burst.
+	for range 2 {
+		_, ok = l.take(start.Add(time.Hour))
+		assert.True(t, ok)
+	}
+	_, ok = l.take(start.Add(time.Hour))
+	assert.False(t, ok)
+	assert.Equal(t, 2, l.rejected["rate"])
+
+	// Under one request per second, the burst is a single request.
+	l = &classLimiter{limit: ClassLimit{Rate: 0.1}, rejected: make(map[string]int)}
+	_, ok = l.take(start)
+	assert.True(t, ok)
+	wait, ok = l.take(start)
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, wait)
+}
+
+func TestClassLimiterConcurrency(t *testing.T) {
+	l := &classLimiter{limit: ClassLimit{Concurrency: 2}, rejected: make(map[string]int)}
+	assert.True(t, l.acquire())
+	assert.True(t, l.acquire())
+	assert.False(t, l.acquire())
+	l.release()
+	assert.True(t, l.acquire())
+	assert.Equal(t, 1, l.rejected["concurrency"])
+
+	unlimited := &classLimiter{rejected: make(map[string]int)}
+	for range 100 {
+		assert.True(t, unlimited.acquire())
+	}
+}
+
+func TestPriorityMiddleware(t *testing.T) {
+	clearBucket(t)
+	fake := withClock(t, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))
+	withClassLimits(t, map[string]ClassLimit{classBatch: {Concurrency: 1, Rate: 1}})
+	router := setupRouter()
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, requestAs("alice", method, url, ""))
+		return w
+	}
+
+	// A long export holds the only batch slot; interactive requests and
+	// health checks are still served.
+	batch := limiterFor(classBatch)
+	assert.True(t, batch.acquire())
+	w := serve(http.MethodGet, "/todos/export?format=markdown")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/todos").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/health").Code)
+	batch.release()
+
+	// The export above spent the budget.
+	w = serve(http.MethodGet, "/todos/export?format=markdown")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	fake.Advance(time.Second)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/todos/export?format=markdown").Code)
+
+	stats := classCounters()
+	assert.Equal(t, ClassStats{Class: classBatch, Rejected: map[string]int{"concurrency": 1, "rate": 1}}, stats[1])
+}
+
+func TestClassMetrics(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+	withClassLimits(t, map[string]ClassLimit{classBatch: {Concurrency: 1}})
+	batch := limiterFor(classBatch)
+	assert.True(t, batch.acquire())
+	t.Cleanup(batch.release)
+	router := setupRouter()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/todos/export", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	body := w.Body.String()
+	assert.Contains(t, body, `todo_requests_in_flight{class="batch"} 1`+"\n")
+	assert.Contains(t, body, `todo_requests_in_flight{class="admin"} 1`+"\n")
+	assert.Contains(t, body, `todo_limited_requests_total{class="batch",reason="concurrency"} 1`+"\n")
+	assert.Contains(t, body, `todo_limited_requests_total{class="interactive",reason="rate"} 0`+"\n")
+}
+
+func TestParseClassLimits(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]ClassLimit
+		err   bool
+	}{
+		{value: "batch=2", want: map[string]ClassLimit{classBatch: {Concurrency: 2}, classAdmin: {Concurrency: 8}}},
+		{value: "batch=2,0.5; interactive=100,50", want: map[string]ClassLimit{
+			classBatch:       {Concurrency: 2, Rate: 0.5},
+			classInteractive: {Concurrency: 100, Rate: 50},
+			classAdmin:       {Concurrency: 8},
+		}},
+		{value: "admin=0", want: map[string]ClassLimit{classAdmin: {}}},
+		{value: "bulk=2", err: true},
+		{value: "batch", err: true},
+		{value: "batch=-1", err: true},
+		{value: "batch=2,fast", err: true},
+		{value: "batch=2,NaN", err: true},
+		{value: "batch=2,-1", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			limits := map[string]ClassLimit{classAdmin: {Concurrency: 8}}
+			err := parseClassLimits(tt.value, limits)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, limits)
+		})
+	}
+}
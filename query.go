@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The query language of GET /todos?q=:
+//
+//	query  = or
+//	or     = and { "OR" and }
+//	and    = unary { [ "AND" ] unary }
+//	unary  = "NOT" unary | "(" or ")" | term
+//	term   = "overdue" | field ( ":" | "<" | "<=" | ">" | ">=" ) value
+//
+// Keywords are case-insensitive. Every term is answered from a secondary
+// index, and the combinators work on sets of IDs, so no todo is decoded to
+// evaluate a query.
+
+type querySyntaxError struct {
+	pos int
+	msg string
+}
+
+func (e *querySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.pos+1, e.msg)
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokOp
+	tokLParen
+	tokRParen
+	tokEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lexQuery(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ':':
+			tokens = append(tokens, token{tokOp, ":", i})
+			i++
+		case c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		case c == '=':
+			return nil, &querySyntaxError{i, "unexpected '='; use ':' for equality"}
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n():<>=", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokWord, s[start:i], start})
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(s)}), nil
+}
+
+type queryParser struct {
+	tokens []token
+	i      int
+	user   string
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *queryParser) take() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *queryParser) keyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+// compileQuery parses a query. user is the caller, for assignee:me.
+func compileQuery(s, user string) (queryNode, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, user: user}
+	if p.peek().kind == tokEOF {
+		return nil, &querySyntaxError{0, "empty query"}
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &querySyntaxError{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+	}
+	return n, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.keyword("AND") {
+			p.take()
+		} else if t := p.peek(); p.keyword("OR") || (t.kind != tokWord && t.kind != tokLParen) {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.keyword("NOT") {
+		p.take()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokLParen:
+		p.take()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != tokRParen {
+			return nil, &querySyntaxError{closing.pos, "expected ')'"}
+		}
+		return n, nil
+	case t.kind == tokWord && !p.keyword("AND") && !p.keyword("OR"):
+		return p.parseTerm()
+	case t.kind == tokEOF:
+		return nil, &querySyntaxError{t.pos, "unexpected end of query"}
+	}
+	return nil, &querySyntaxError{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+}
+
+func (p *queryParser) parseTerm() (queryNode, error) {
+	field := p.take()
+	name := strings.ToLower(field.text)
+
+	if name == "overdue" && p.peek().kind != tokOp {
+		return overdueNode{}, nil
+	}
+
+	op := p.take()
+	if op.kind != tokOp {
+		return nil, &querySyntaxError{op.pos, fmt.Sprintf("expected ':' or a comparison after %q", field.text)}
+	}
+	value := p.take()
+	if value.kind != tokWord {
+		return nil, &querySyntaxError{value.pos, fmt.Sprintf("expected a value after %q", field.text+op.text)}
+	}
+
+	fail := func(format string, args ...interface{}) (queryNode, error) {
+		return nil, &querySyntaxError{value.pos, fmt.Sprintf(format, args...)}
+	}
+	if op.text != ":" && name != "priority" && name != "due" {
+		return nil, &querySyntaxError{op.pos, fmt.Sprintf("%s only supports ':'", field.text)}
+	}
+
+	switch name {
+	case "completed", "starred":
+		b, err := strconv.ParseBool(value.text)
+		if err != nil {
+			return fail("%s expects true or false", name)
+		}
+		return indexNode{name, []string{strconv.FormatBool(b)}}, nil
+
+	case "status":
+		if err := validStatus(value.text); err != nil {
+			return fail("%v", err)
+		}
+		return indexNode{"status", []string{value.text}}, nil
+
+	case "assignee":
+		assignee, err := resolveAssignee(value.text, p.user)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return indexNode{"assignee", []string{assignee}}, nil
+
+	case "tag":
+		return indexNode{"tag", []string{value.text}}, nil
+
+	case "priority":
+		rank, ok := priorities[value.text]
+		if !ok || value.text == "" {
+			return fail("priority expects low, medium or high")
+		}
+		var values []string
+		for priority, r := range priorities {
+			if priority != "" && compareRanks(r, op.text, rank) {
+				values = append(values, priority)
+			}
+		}
+		return indexNode{"priority", values}, nil
+
+	case "due":
+		if op.text == ":" && value.text == "none" {
+			return indexNode{"due", []string{""}}, nil
+		}
+		if strings.EqualFold(value.text, "today") {
+			return dueRangeNode{op.text, ""}, nil
+		}
+		if _, err := time.Parse(dueDateLayout, value.text); err != nil {
+			return fail("due expects a YYYY-MM-DD date")
+		}
+		if op.text == ":" {
+			return indexNode{"due", []string{value.text}}, nil
+		}
+		return dueRangeNode{op.text, value.text}, nil
+	}
+
+	return nil, &querySyntaxError{field.pos, fmt.Sprintf("unknown field %q", field.text)}
+}
+
+func compareRanks(a int, op string, b int) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return a == b
+}
+
+// idSet is a set of todo IDs.
+type idSet map[uint64]struct{}
+
+type queryEnv struct {
+	tx    *bolt.Tx
+	today string
+}
+
+type queryNode interface {
+	eval(env *queryEnv) idSet
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ inner queryNode }
+type overdueNode struct{}
+
+// indexNode matches todos whose field has any of values.
+type indexNode struct {
+	field  string
+	values []string
+}
+
+// dueRangeNode compares due dates with date, or today if it is empty.
+// Todos without a due date never match.
+type dueRangeNode struct {
+	op   string
+	date string
+}
+
+func (n andNode) eval(env *queryEnv) idSet {
+	left, right := n.left.eval(env), n.right.eval(env)
+	set := make(idSet)
+	for id := range left {
+		if _, ok := right[id]; ok {
+			set[id] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (n orNode) eval(env *queryEnv) idSet {
+	set := n.left.eval(env)
+	for id := range n.right.eval(env) {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+func (n notNode) eval(env *queryEnv) idSet {
+	excluded := n.inner.eval(env)
+	set := make(idSet)
+	c := env.tx.Bucket(todosBucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if _, ok := excluded[binary.BigEndian.Uint64(k)]; !ok {
+			set[binary.BigEndian.Uint64(k)] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (overdueNode) eval(env *queryEnv) idSet {
+	return andNode{
+		dueRangeNode{"<", ""},
+		indexNode{"completed", []string{"false"}},
+	}.eval(env)
+}
+
+func (n indexNode) eval(env *queryEnv) idSet {
+	set := make(idSet)
+	c := env.tx.Bucket(indexesBucket).Bucket([]byte(n.field)).Cursor()
+	for _, value := range n.values {
+		prefix := indexPrefix(value)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			set[binary.BigEndian.Uint64(k[len(prefix):])] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (n dueRangeNode) eval(env *queryEnv) idSet {
+	date := n.date
+	if date == "" {
+		date = env.today
+	}
+
+	set := make(idSet)
+	c := env.tx.Bucket(indexesBucket).Bucket([]byte("due")).Cursor()
+	// Entries without a due date have an empty value and sort first.
+	for k, _ := c.Seek([]byte{1}); k != nil; k, _ = c.Next() {
+		sep := bytes.IndexByte(k, 0)
+		due := string(k[:sep])
+
+		var match bool
+		switch {
+		case due < date:
+			match = n.op == "<" || n.op == "<="
+		case due == date:
+			match = n.op == ":" || n.op == "<=" || n.op == ">="
+		case n.op != ">" && n.op != ">=":
+			return set
+		default:
+			match = true
+		}
+		if match {
+			set[binary.BigEndian.Uint64(k[sep+1:])] = struct{}{}
+		}
+	}
+	return set
+}
+
+// filterNode turns listing filters into a query, so they combine with q.
+func filterNode(n queryNode, filters []indexFilter) queryNode {
+	for _, f := range filters {
+		n = andNode{n, indexNode{f.field, []string{f.value}}}
+	}
+	return n
+}
+
+// keyListIterator pages through a query result, materialized as an ordered
+// list of keys.
+type keyListIterator struct {
+	todos *bolt.Bucket
+	keys  [][]byte
+	at    map[string]int
+	byID  bool
+	i     int
+}
+
+// newQueryIterator evaluates a query and orders the matches like a listing
+// with the given sort. today is the caller's date, for relative terms.
+func newQueryIterator(tx *bolt.Tx, n queryNode, sortBy, today string) *keyListIterator {
+	set := n.eval(&queryEnv{tx: tx, today: today})
+
+	var keys [][]byte
+	if sortBy == "position" {
+		c := tx.Bucket(indexesBucket).Bucket([]byte("position")).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			key := k[bytes.IndexByte(k, 0)+1:]
+			if _, ok := set[binary.BigEndian.Uint64(key)]; ok {
+				keys = append(keys, key)
+			}
+		}
+	} else {
+		ids := make([]uint64, 0, len(set))
+		for id := range set {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		var rest [][]byte
+		starred := tx.Bucket(indexesBucket).Bucket([]byte("starred"))
+		for _, id := range ids {
+			key := itob(int(id))
+			if sortBy == "" && starred.Get(indexKey("true", key)) == nil {
+				rest = append(rest, key)
+				continue
+			}
+			keys = append(keys, key)
+		}
+		keys = append(keys, rest...)
+	}
+
+	it := &keyListIterator{todos: tx.Bucket(todosBucket), keys: keys, at: make(map[string]int, len(keys)), byID: sortBy == "id"}
+	for i, key := range keys {
+		it.at[string(key)] = i
+	}
+	return it
+}
+
+func (it *keyListIterator) get() ([]byte, []byte) {
+	if it.i >= len(it.keys) {
+		return nil, nil
+	}
+	k := it.keys[it.i]
+	return k, it.todos.Get(k)
+}
+
+func (it *keyListIterator) first() ([]byte, []byte) {
+	it.i = 0
+	return it.get()
+}
+
+func (it *keyListIterator) seek(key []byte) ([]byte, []byte) {
+	i, ok := it.at[string(key)]
+	if !ok {
+		i = len(it.keys)
+	}
+	it.i = i
+	return it.get()
+}
+
+// seekAfter resumes after the cursor's todo. If it no longer matches, ID
+// order can still resume from the next ID; other orders end the listing.
+func (it *keyListIterator) seekAfter(cursor []byte) ([]byte, []byte) {
+	if i, ok := it.at[string(cursor)]; ok {
+		it.i = i + 1
+	} else if it.byID {
+		it.i = sort.Search(len(it.keys), func(i int) bool { return bytes.Compare(it.keys[i], cursor) > 0 })
+	} else {
+		it.i = len(it.keys)
+	}
+	return it.get()
+}
+
+func (it *keyListIterator) next() ([]byte, []byte) {
+	it.i++
+	return it.get()
+}
+
+func (it *keyListIterator) count() int {
+	return len(it.keys)
+}
+
+func (it *keyListIterator) cursor(key []byte) []byte {
+	return key
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"(status:todo", "query syntax error at position 13: expected ')'"},
+		{"status", "query syntax error at position 7: expected ':' or a comparison after \"status\""},
+		{"priority>", "query syntax error at position 10: expected a value after \"priority>\""},
+		{"color:red", "query syntax error at position 1: unknown field \"color\""},
+		{"tag<x", "query syntax error at position 4: tag only supports ':'"},
+		{"due<tomorrow", "query syntax error at position 5: due expects a YYYY-MM-DD date"},
+		{"status:todo OR", "query syntax error at position 15: unexpected end of query"},
+		{"status:todo)", "query syntax error at position 12: unexpected \")\""},
+		{"status=todo", "query syntax error at position 7: unexpected '='; use ':' for equality"},
+		{"   ", "query syntax error at position 1: empty query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := compileQuery(tt.query, "")
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestQueryTodos(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	yesterday := time.Now().AddDate(0, 0, -1).Format(dueDateLayout)
+	todos := []Todo{
+		{Title: "Pay rent", Priority: "high", DueDate: yesterday, Tags: []string{"home"}},
+		{Title: "Review PR", Assignee: "alice", Priority: "medium", Tags: []string{"work"}},
+		{Title: "Ship release", Assignee: "bob", Priority: "high", DueDate: "2999-01-01", Tags: []string{"work", "urgent"}},
+		{Title: "Old bill", Completed: true, DueDate: yesterday, Tags: []string{"home"}},
+	}
+	for _, todo := range todos {
+		payload, _ := json.Marshal(todo)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	tests := []struct {
+		query string
+		ids   []int
+	}{
+		{"tag:work", []int{2, 3}},
+		{"tag:work AND priority:high", []int{3}},
+		{"tag:work priority:high", []int{3}},
+		{"priority>=medium", []int{1, 2, 3}},
+		{"priority<high", []int{2}},
+		{"tag:home OR assignee:bob", []int{1, 3, 4}},
+		{"NOT tag:work", []int{1, 4}},
+		{"not (tag:home or priority:medium)", []int{3}},
+		{"overdue", []int{1}},
+		{"due:none", []int{2}},
+		{"due>" + yesterday, []int{3}},
+		{"due<=" + yesterday + " AND completed:true", []int{4}},
+		{"assignee:me", []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/todos?q="+url.QueryEscape(tt.query), nil)
+			req.Header.Set(userHeader, "alice")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response PaginatedResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			var ids []int
+			for _, todo := range response.Items {
+				ids = append(ids, todo.ID)
+			}
+			assert.Equal(t, tt.ids, ids)
+			assert.Equal(t, len(tt.ids), response.TotalItems)
+		})
+	}
+
+	// Queries combine with the other filters and page with cursors.
+	assert.Equal(t, []int{1}, listIDs(t, router, "/todos?completed=false&q=tag%3Ahome"))
+	assert.Equal(t, []int{1, 2, 3, 4}, listIDs(t, router, "/todos?limit=1&sort=id&q=NOT+tag%3Anone"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos?q=%28tag%3Awork", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "expected ')'")
+}
+
+func TestTagValidation(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, body := range []string{
+		`{"title":"x","tags":["two words"]}`,
+		`{"title":"x","tags":[""]}`,
+		`{"title":"x","tags":["a","a"]}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBufferString(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+// FuzzCompileQuery checks that any q either fails with a syntax error or
+// evaluates: GET /todos answers 200 or 400, never 500.
+func FuzzCompileQuery(f *testing.F) {
+	useTestDB(f)
+	router := setupRouter()
+	for _, seed := range []string{
+		"tag:work AND (priority>=medium OR overdue)",
+		"NOT NOT due:none",
+		"due<today OR due:2026-13-01",
+		"((((",
+		"assignee:me status:in_progress",
+		"priority<=", ")", `tag:"a b"`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, q string) {
+		if _, err := compileQuery(q, "alice"); err != nil {
+			var syntax *querySyntaxError
+			assert.ErrorAs(t, err, &syntax)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, requestAs("alice", http.MethodGet, "/todos?q="+url.QueryEscape(q), ""))
+		assert.Contains(t, []int{http.StatusOK, http.StatusBadRequest}, w.Code, w.Body.String())
+	})
+}
+
+// TestQueryProperties checks set identities on random todos: a filter and
+// its negation partition the todos, and AND and OR match intersection and
+// union.
+func TestQueryProperties(t *testing.T) {
+	tags := []string{"home", "work", "errands"}
+	property := func(seed int64) bool {
+		clearBucket(t)
+		rng := rand.New(rand.NewSource(seed))
+		for i := 0; i < 30; i++ {
+			todo := Todo{Title: "Todo", Priority: []string{"", "low", "medium", "high"}[rng.Intn(4)], Completed: rng.Intn(3) == 0}
+			for _, j := range rng.Perm(len(tags))[:rng.Intn(3)] {
+				todo.Tags = append(todo.Tags, tags[j])
+			}
+			reconcileStatus(nil, &todo)
+			saveTodo(t, todo)
+		}
+
+		all := queryIDs(t, "")
+		a, b := "tag:"+tags[rng.Intn(len(tags))], []string{"priority>=medium", "completed:true", "due:none"}[rng.Intn(3)]
+		matching, rest := queryIDs(t, a), queryIDs(t, "NOT "+a)
+		return assert.ElementsMatch(t, all, append(matching, rest...)) &&
+			assert.Empty(t, intersect(matching, rest)) &&
+			assert.ElementsMatch(t, intersect(matching, queryIDs(t, b)), queryIDs(t, a+" AND "+b)) &&
+			assert.ElementsMatch(t, union(matching, queryIDs(t, b)), queryIDs(t, a+" OR "+b))
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 20}))
+}
+
+// queryIDs lists the IDs of the todos matching q, or all of them.
+func queryIDs(t *testing.T, q string) []int {
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos?limit=1000&q="+url.QueryEscape(q), nil))
+	assert.Equal(t, http.StatusOK, w.Code, q)
+	var response PaginatedResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	ids := []int{}
+	for _, todo := range response.Items {
+		ids = append(ids, todo.ID)
+	}
+	return ids
+}
+
+func intersect(a, b []int) []int {
+	var both []int
+	for _, id := range a {
+		if slices.Contains(b, id) {
+			both = append(both, id)
+		}
+	}
+	return both
+}
+
+func union(a, b []int) []int {
+	either := slices.Clone(a)
+	for _, id := range b {
+		if !slices.Contains(a, id) {
+			either = append(either, id)
+		}
+	}
+	return either
+}
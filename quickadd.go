@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxQuickAdd caps the text of a quick add.
+const maxQuickAdd = 4 << 10
+
+// QuickAddRequest is the JSON body of POST /quick-add. A text/plain body is
+// taken as the text itself.
+type QuickAddRequest struct {
+	Text string `json:"text"`
+}
+
+// parseQuickAdd turns a line such as "buy milk tomorrow #errands !high"
+// into a todo: #word adds a tag, !low, !medium and !high set the priority,
+// and today, tomorrow, a weekday, "next week" or a YYYY-MM-DD date set the
+// due date, the last one winning. The other words make up the title; a
+// leading backslash keeps a word as is, as in \#1. now carries the caller's
+// time zone.
+func parseQuickAdd(text string, now time.Time) (Todo, error) {
+	var todo Todo
+	var title []string
+	words := strings.Fields(text)
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		lower := strings.ToLower(word)
+		switch {
+		case strings.HasPrefix(word, `\`) && len(word) > 1:
+			title = append(title, word[1:])
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			tag := strings.ToLower(word[1:])
+			if err := validTag(tag); err != nil {
+				return Todo{}, err
+			}
+			if !slices.Contains(todo.Tags, tag) {
+				todo.Tags = append(todo.Tags, tag)
+			}
+		case strings.HasPrefix(word, "!") && priorities[lower[1:]] > 0:
+			todo.Priority = lower[1:]
+		case lower == "next" && i+1 < len(words) && strings.EqualFold(words[i+1], "week"):
+			todo.DueDate = nextMonday(now).Format(dueDateLayout)
+			i++
+		default:
+			if due, ok := quickAddDate(lower, now); ok {
+				todo.DueDate = due
+				continue
+			}
+			title = append(title, word)
+		}
+	}
+	todo.Title = strings.Join(title, " ")
+	if todo.Title == "" {
+		return Todo{}, errors.New("quick add needs a title besides tags, priority and due date")
+	}
+	return todo, nil
+}
+
+// quickAddDate reads a due date word. A weekday is the next one after today.
+func quickAddDate(word string, now time.Time) (string, bool) {
+	switch word {
+	case "today":
+		return now.Format(dueDateLayout), true
+	case "tomorrow":
+		return now.AddDate(0, 0, 1).Format(dueDateLayout), true
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if word == name || word == name[:3] {
+			days := (int(day)-int(now.Weekday())+6)%7 + 1
+			return now.AddDate(0, 0, days).Format(dueDateLayout), true
+		}
+	}
+	if _, err := time.Parse(dueDateLayout, word); err == nil {
+		return word, true
+	}
+	return "", false
+}
+
+// quickAdd creates a todo from a line of text, assigned to the caller, and
+// returns it with 201.
+func quickAdd(w http.ResponseWriter, r *http.Request) {
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Quick add requires the "+userHeader+" header", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxQuickAdd+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxQuickAdd {
+		http.Error(w, fmt.Sprintf("quick add text longer than %d bytes", maxQuickAdd), http.StatusRequestEntityTooLarge)
+		return
+	}
+	text := string(body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "text/plain" {
+		var req QuickAddRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		text = req.Text
+	}
+
+	loc, err := locationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	todo, err := parseQuickAdd(text, clock.Now().In(loc))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	todo.Assignee, todo.CreatedBy = user, user
+	if todo, err = todoService.Create(todo); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(todo)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	// Friday 2026-10-16.
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name, text string
+		want       Todo
+		err        string
+	}{
+		{"tokens", "buy milk tomorrow #errands !high", Todo{Title: "buy milk", Tags: []string{"errands"}, Priority: "high", DueDate: "2026-10-17"}, ""},
+		{"plain", "call mom", Todo{Title: "call mom"}, ""},
+		{"anywhere", "#Home !LOW fix tap", Todo{Title: "fix tap", Tags: []string{"home"}, Priority: "low"}, ""},
+		{"repeated tag", "#a #b #a pay rent", Todo{Title: "pay rent", Tags: []string{"a", "b"}}, ""},
+		{"today", "stretch today", Todo{Title: "stretch", DueDate: "2026-10-16"}, ""},
+		{"weekday", "report monday", Todo{Title: "report", DueDate: "2026-10-19"}, ""},
+		{"same weekday", "review fri", Todo{Title: "review", DueDate: "2026-10-23"}, ""},
+		{"next week", "plan trip next week", Todo{Title: "plan trip", DueDate: "2026-10-19"}, ""},
+		{"date", "renew passport 2026-12-01", Todo{Title: "renew passport", DueDate: "2026-12-01"}, ""},
+		{"last date wins", "draft today tomorrow", Todo{Title: "draft", DueDate: "2026-10-17"}, ""},
+		{"unknown priority", "fix !urgent bug", Todo{Title: "fix !urgent bug"}, ""},
+		{"escaped", `close \#12 \tomorrow`, Todo{Title: "close #12 tomorrow"}, ""},
+		{"bare marks", "# ! done", Todo{Title: "# ! done"}, ""},
+		{"invalid tag", "#a:b thing", Todo{}, `invalid tag "a:b": use up to 32 characters without spaces or ():<>=`},
+		{"no title", "#errands tomorrow !high", Todo{}, "quick add needs a title besides tags, priority and due date"},
+		{"empty", "  ", Todo{}, "quick add needs a title besides tags, priority and due date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todo, err := parseQuickAdd(tt.text, now)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, todo)
+		})
+	}
+}
+
+func TestQuickAdd(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	tests := []struct {
+		name, user, contentType, body string
+		code                          int
+	}{
+		{"json", "alice", "application/json", `{"text":"buy milk #errands !high"}`, http.StatusCreated},
+		{"plain text", "alice", "text/plain; charset=utf-8", "buy milk #errands !high", http.StatusCreated},
+		{"anonymous", "", "text/plain", "buy milk", http.StatusBadRequest},
+		{"bad json", "alice", "application/json", `{"text":`, http.StatusBadRequest},
+		{"no title", "alice", "text/plain", "#errands", http.StatusBadRequest},
+		{"too long", "alice", "text/plain", strings.Repeat("a", maxQuickAdd+1), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := requestAs(tt.user, http.MethodPost, "/quick-add", tt.body)
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code != http.StatusCreated {
+				return
+			}
+			var todo Todo
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&todo))
+			assert.NotZero(t, todo.ID)
+			assert.Equal(t, "buy milk", todo.Title)
+			assert.Equal(t, "alice", todo.Assignee)
+			assert.Equal(t, []string{"errands"}, todo.Tags)
+			assert.Equal(t, "high", todo.Priority)
+		})
+	}
+
+	// Due dates are in the caller's time zone.
+	req := requestAs("alice", http.MethodPost, "/quick-add", "call bank today")
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set(timezoneHeader, "Pacific/Kiritimati")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var todo Todo
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&todo))
+	kiritimati, _ := time.LoadLocation("Pacific/Kiritimati")
+	assert.Equal(t, time.Now().In(kiritimati).Format(dueDateLayout), todo.DueDate)
+}
+
+// FuzzParseQuickAdd checks that any text either fails or parses into a todo
+// that passes validation, short of an over-long title.
+func FuzzParseQuickAdd(f *testing.F) {
+	for _, seed := range []string{"buy milk tomorrow #errands !high", `\#1 next week`, "# ! next", "#a:b x", "fri 2026-02-30 x"} {
+		f.Add(seed)
+	}
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	f.Fuzz(func(t *testing.T, text string) {
+		todo, err := parseQuickAdd(text, now)
+		if err != nil {
+			return
+		}
+		assert.NotEmpty(t, todo.Title)
+		if err := validateTodo(todo); err != nil {
+			assert.ErrorContains(t, err, "title longer than")
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// errQuotaExceeded is wrapped by the errors of writes that would take a
+// user past one of their limits.
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// errCreatorRequired is returned for todos created without a user while
+// QUOTA_TODOS is set, which would count against no one.
+var errCreatorRequired = errors.New("creating todos requires the " + userHeader + " header while QUOTA_TODOS is set")
+
+// Quota is how much of a limited resource a user has used. A zero Limit is
+// unlimited.
+type Quota struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit,omitempty"`
+}
+
+// Usage is a user's usage of each limited resource.
+type Usage struct {
+	Todos           Quota `json:"todos"`
+	Filters         Quota `json:"filters"`
+	AttachmentBytes Quota `json:"attachmentBytes"`
+}
+
+// userAttachmentBytes adds up the size of the attachments user uploaded.
+func userAttachmentBytes(tx *bolt.Tx, user string) (int64, error) {
+	var total int64
+	err := tx.Bucket(attachmentsBucket).ForEachBucket(func(k []byte) error {
+		return tx.Bucket(attachmentsBucket).Bucket(k).ForEach(func(_, v []byte) error {
+			var attachment Attachment
+			if err := codec.Unmarshal(v, &attachment); err != nil {
+				return err
+			}
+			if attachment.Uploader == user {
+				total += attachment.Size
+			}
+			return nil
+		})
+	})
+	return total, err
+}
+
+func userFilterCount(tx *bolt.Tx, user string) (int, error) {
+	n := 0
+	err := tx.Bucket(savedFiltersBucket).ForEach(func(_, v []byte) error {
+		var f SavedFilter
+		if err := codec.Unmarshal(v, &f); err != nil {
+			return err
+		}
+		if f.Owner == user {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+func userUsage(tx *bolt.Tx, user string) (Usage, error) {
+	filters, err := userFilterCount(tx, user)
+	if err != nil {
+		return Usage{}, err
+	}
+	attachmentBytes, err := userAttachmentBytes(tx, user)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		Todos:           Quota{Used: int64(newIndexIterator(tx, "creator", user).count()), Limit: int64(config.QuotaTodos)},
+		Filters:         Quota{Used: int64(filters), Limit: int64(config.QuotaFilters)},
+		AttachmentBytes: Quota{Used: attachmentBytes, Limit: config.QuotaAttachmentBytes},
+	}, nil
+}
+
+// checkTodoQuota fails when the new todo would take its creator past
+// QUOTA_TODOS. Todos count against the user who created them, whoever they
+// are assigned to. Those the service creates itself, such as from
+// integrations, have no creator and don't count.
+func checkTodoQuota(tx *bolt.Tx, todo Todo) error {
+	if config.QuotaTodos == 0 || todo.CreatedBy == "" {
+		return nil
+	}
+	if newIndexIterator(tx, "creator", todo.CreatedBy).count() >= config.QuotaTodos {
+		return fmt.Errorf("%w: %s already created the most todos allowed, %d", errQuotaExceeded, todo.CreatedBy, config.QuotaTodos)
+	}
+	return nil
+}
+
+// checkFilterQuota fails when user already has QUOTA_FILTERS saved filters.
+func checkFilterQuota(tx *bolt.Tx, user string) error {
+	if config.QuotaFilters == 0 {
+		return nil
+	}
+	n, err := userFilterCount(tx, user)
+	if err != nil {
+		return err
+	}
+	if n >= config.QuotaFilters {
+		return fmt.Errorf("%w: you already have the most saved filters allowed, %d", errQuotaExceeded, config.QuotaFilters)
+	}
+	return nil
+}
+
+// checkAttachmentQuota fails when uploading size more bytes would take user
+// past QUOTA_ATTACHMENT_BYTES.
+func checkAttachmentQuota(tx *bolt.Tx, user string, size int64) error {
+	if config.QuotaAttachmentBytes == 0 {
+		return nil
+	}
+	used, err := userAttachmentBytes(tx, user)
+	if err != nil {
+		return err
+	}
+	if used+size > config.QuotaAttachmentBytes {
+		return fmt.Errorf("%w: attachments would take %d bytes, more than the %d allowed", errQuotaExceeded, used+size, config.QuotaAttachmentBytes)
+	}
+	return nil
+}
+
+// getUsage reports the caller's usage and limits.
+func getUsage(w http.ResponseWriter, r *http.Request) {
+	user, ok := accountUser(w, r)
+	if !ok {
+		return
+	}
+
+	var usage Usage
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		usage, err = userUsage(tx, user)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(usage)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withQuotas(t *testing.T, todos, filters int, attachmentBytes int64) {
+	withAttachmentLimits(t)
+	config.QuotaTodos, config.QuotaFilters, config.QuotaAttachmentBytes = todos, filters, attachmentBytes
+}
+
+func TestQuotas(t *testing.T) {
+	clearBucket(t)
+	withQuotas(t, 2, 1, 10)
+	router := setupRouter()
+
+	request := func(method, url, user string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, body)
+		req.Header.Set(userHeader, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := saveTodo(t, Todo{Title: "File taxes", Assignee: "alice", CreatedBy: "alice"})
+	theirs := saveTodo(t, Todo{Title: "Mow lawn", Assignee: "bob", CreatedBy: "bob"})
+	firstURL := "/todos/" + strconv.Itoa(first.ID)
+	hook := createHook(t, router, "alice", "")
+
+	tests := []struct {
+		name           string
+		user           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{"create within quota", "alice", http.MethodPost, "/todos", `{"title":"Pay rent"}`, http.StatusCreated},
+		{"create past quota", "alice", http.MethodPost, "/todos", `{"title":"Buy milk","assignee":"bob"}`, http.StatusForbidden},
+		{"creator can't be set", "alice", http.MethodPost, "/todos", `{"title":"Buy milk","createdBy":"carol"}`, http.StatusForbidden},
+		{"assigning uses the creator's quota", "bob", http.MethodPost, "/todos", `{"title":"Buy milk","assignee":"alice"}`, http.StatusCreated},
+		{"reassigning doesn't count", "alice", http.MethodPut, "/todos/" + strconv.Itoa(theirs.ID), `{"title":"Mow lawn","assignee":"alice"}`, http.StatusOK},
+		{"update at quota", "alice", http.MethodPut, firstURL, `{"title":"File taxes","assignee":"alice","completed":true}`, http.StatusOK},
+		{"clone past quota", "alice", http.MethodPost, firstURL + "/clone", ``, http.StatusForbidden},
+		{"inbound hook past quota", "", http.MethodPost, "/hooks/inbound/" + hook.Token, `{"title":"Renew domain"}`, http.StatusForbidden},
+		{"create without a user", "", http.MethodPost, "/todos", `{"title":"Buy milk"}`, http.StatusBadRequest},
+		{"filter within quota", "alice", http.MethodPost, "/filters", `{"name":"Open","query":"completed=false"}`, http.StatusCreated},
+		{"filter past quota", "alice", http.MethodPost, "/filters", `{"name":"Done","query":"completed=true"}`, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := request(tt.method, tt.url, tt.user, strings.NewReader(tt.body))
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.Contains(t, w.Body.String(), "quota exceeded")
+			}
+		})
+	}
+
+	upload := func(data string) int {
+		req := uploadRequest(firstURL+"/attachments", "file", "notes.txt", []byte(data))
+		req.Header.Set(userHeader, "alice")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusCreated, upload("Paid 40"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload("Paid 40"))
+	db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 1, tx.Bucket(attachmentBlobsBucket).Stats().KeyN, "the rejected upload is not kept")
+		return nil
+	})
+
+	w := request(http.MethodGet, "/me/usage", "alice", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var usage Usage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	assert.Equal(t, Usage{
+		Todos:           Quota{Used: 2, Limit: 2},
+		Filters:         Quota{Used: 1, Limit: 1},
+		AttachmentBytes: Quota{Used: 7, Limit: 10},
+	}, usage)
+
+	// Without limits, usage is still reported.
+	config.QuotaTodos, config.QuotaFilters, config.QuotaAttachmentBytes = 0, 0, 0
+	assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/todos", "alice", strings.NewReader(`{"title":"Buy milk"}`)).Code)
+	w = request(http.MethodGet, "/me/usage", "alice", nil)
+	assert.JSONEq(t, `{"todos":{"used":3},"filters":{"used":1},"attachmentBytes":{"used":7}}`, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/me/usage", "", nil).Code)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// replicaSnapshotTimeout bounds fetching one snapshot from the primary.
+const replicaSnapshotTimeout = 5 * time.Minute
+
+var replicaClient = &http.Client{Timeout: replicaSnapshotTimeout}
+
+// replica records the last snapshot a read replica took from its primary.
+var replica struct {
+	mu       sync.Mutex
+	syncedAt time.Time
+	size     int64
+}
+
+// replicaSyncedAt is when the replica last copied a snapshot, zero if it
+// hasn't yet.
+func replicaSyncedAt() time.Time {
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+	return replica.syncedAt
+}
+
+// syncReplica fetches a snapshot of the primary's database and copies it
+// over the local one in a single transaction, so reads running meanwhile
+// see either the old or the new data, never a mix.
+func syncReplica(now time.Time) error {
+	if config.PrimaryURL == "" {
+		return errors.New("set PRIMARY_URL to replicate")
+	}
+	req, err := http.NewRequest(http.MethodPost, config.PrimarySnapshotURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+secret("PRIMARY_TOKEN", config.PrimaryToken))
+	resp, err := replicaClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("primary answered %s for a snapshot", resp.Status)
+	}
+
+	path := db.Path() + ".snapshot"
+	defer os.Remove(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("opening snapshot: %w", err)
+	}
+	defer snapshot.Close()
+	err = snapshot.View(func(src *bolt.Tx) error {
+		return db.Update(func(dst *bolt.Tx) error {
+			if err := replaceContents(dst, src); err != nil {
+				return err
+			}
+			// A primary running an older version may lack buckets.
+			return ensureBuckets(dst)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cache.purge()
+
+	replica.mu.Lock()
+	replica.syncedAt, replica.size = now, size
+	replica.mu.Unlock()
+	debugf("replica synced %d bytes from the primary", size)
+	return nil
+}
+
+// replaceContents makes dst a copy of src, bucket by bucket.
+func replaceContents(dst, src *bolt.Tx) error {
+	var names [][]byte
+	dst.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		names = append(names, append([]byte{}, name...))
+		return nil
+	})
+	for _, name := range names {
+		if err := dst.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	return src.ForEach(func(name []byte, b *bolt.Bucket) error {
+		copied, err := dst.CreateBucket(name)
+		if err != nil {
+			return err
+		}
+		return copyBucket(copied, b)
+	})
+}
+
+func copyBucket(dst, src *bolt.Bucket) error {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
+
+// replicaReadMethods are served from the replica's snapshot; every other
+// method is a write and goes to the primary.
+var replicaReadMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+	"REPORT":           true,
+}
+
+// replicaRefusedRoutes are admin routes, by method and path template, that
+// change data the replica copies from its primary. They only make sense on
+// the primary.
+var replicaRefusedRoutes = map[string]bool{
+	"PUT /admin/integrations/{name}":           true,
+	"DELETE /admin/integrations/{name}":        true,
+	"GET /admin/integrations/{name}/authorize": true,
+	"POST /admin/integrations/{name}/sync":     true,
+	"POST /admin/seed":                         true,
+}
+
+// replicaForwards reports whether a replica sends r to the primary: writes,
+// and reads that write, such as the OAuth callback storing a token or a
+// thumbnail made on first request. The replica's own admin routes are
+// never forwarded.
+func replicaForwards(r *http.Request) bool {
+	route := routeName(r)
+	switch {
+	case route == "/admin", strings.HasPrefix(route, "/admin/"):
+		return false
+	case r.Method == http.MethodGet && route == "/integrations/{name}/callback":
+		return true
+	case r.Method == http.MethodGet && route == "/todos/{id}/attachments/{attachmentID}" && r.URL.Query().Get("size") != "":
+		return true
+	}
+	return !replicaReadMethods[r.Method]
+}
+
+// replicaMiddleware forwards writes to the primary when the service runs as
+// a read replica.
+func replicaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.PrimaryURL == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if replicaRefusedRoutes[r.Method+" "+routeName(r)] {
+			http.Error(w, "This is a read replica; use the primary", http.StatusConflict)
+			return
+		}
+		if !replicaForwards(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		target, err := url.Parse(config.PrimaryURL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			warnf("forwarding %s %s to the primary: %v", r.Method, r.URL.Path, err)
+			http.Error(w, "The primary is unavailable; try again later", http.StatusBadGateway)
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func withPrimary(t *testing.T, url string) {
+	previous := config
+	config.PrimaryURL = url
+	config.PrimarySnapshotURL = url + "/admin/backup"
+	config.PrimaryToken = "secret"
+	replica.syncedAt, replica.size = time.Time{}, 0
+	t.Cleanup(func() {
+		config = previous
+		replica.syncedAt, replica.size = time.Time{}, 0
+	})
+}
+
+// fakePrimary serves snapshots of its own database to the replica.
+func fakePrimary(t *testing.T) (*bolt.DB, *httptest.Server) {
+	primary, err := bolt.Open(filepath.Join(t.TempDir(), "primary.db"), 0600, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, primary.Update(ensureBuckets))
+	t.Cleanup(func() { primary.Close() })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/admin/backup" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		primary.View(func(tx *bolt.Tx) error {
+			_, err := tx.WriteTo(w)
+			return err
+		})
+	}))
+	t.Cleanup(server.Close)
+	return primary, server
+}
+
+func putPrimaryTodo(t *testing.T, primary *bolt.DB, todo Todo) {
+	assert.NoError(t, primary.Update(func(tx *bolt.Tx) error { return putTodo(tx, &todo) }))
+}
+
+func TestSyncReplica(t *testing.T) {
+	clearBucket(t)
+	primary, server := fakePrimary(t)
+	withPrimary(t, server.URL)
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	router := setupRouter()
+	saveTodo(t, Todo{Title: "Only on the replica"})
+	putPrimaryTodo(t, primary, Todo{ID: 1, Title: "Pay rent"})
+	putPrimaryTodo(t, primary, Todo{ID: 2, Title: "Review PR", Tags: []string{"work"}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	assert.NoError(t, syncReplica(start))
+	assert.Equal(t, []string{"Pay rent", "Review PR"}, localTitles(t))
+	assert.Equal(t, start, replicaSyncedAt())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Listings are read from the snapshot, indexes included, and cached
+	// pages don't outlive the next sync.
+	titles, _ := listTitles(t, router, "/todos?tag=work")
+	assert.Equal(t, []string{"Review PR"}, titles)
+	putPrimaryTodo(t, primary, Todo{ID: 3, Title: "Ship release", Tags: []string{"work"}})
+	assert.NoError(t, syncReplica(start.Add(time.Minute)))
+	titles, _ = listTitles(t, router, "/todos?tag=work")
+	assert.Equal(t, []string{"Review PR", "Ship release"}, titles)
+
+	// A failed sync leaves the last snapshot in place.
+	config.PrimaryToken = "wrong"
+	assert.ErrorContains(t, syncReplica(start.Add(2*time.Minute)), "403")
+	assert.Len(t, localTitles(t), 3)
+	assert.Equal(t, start.Add(time.Minute), replicaSyncedAt())
+}
+
+func TestReplicaForwardsWrites(t *testing.T) {
+	clearBucket(t)
+	var forwarded []string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, r.Method+" "+r.URL.String()+" "+r.Header.Get(userHeader)+" "+string(body))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":7,"title":"Pay rent"}`)
+	}))
+	defer primary.Close()
+	withPrimary(t, primary.URL)
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodPost, "/todos?lang=en", `{"title":"Pay rent"}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id":7,"title":"Pay rent"}`, w.Body.String())
+	assert.Equal(t, []string{`POST /todos?lang=en alice {"title":"Pay rent"}`}, forwarded)
+	assert.Empty(t, localTitles(t))
+
+	// Reads are served locally.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodGet, "/todos", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, forwarded, 1)
+
+	primary.Close()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("alice", http.MethodDelete, "/todos/7", ""))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestReplicaAdminRoutes(t *testing.T) {
+	clearBucket(t)
+	withCaptures(t, 10)
+	withAdminToken(t, "secret")
+	var forwarded []string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Method+" "+r.URL.Path)
+	}))
+	defer primary.Close()
+	withPrimary(t, primary.URL)
+	router := setupRouter()
+
+	tests := []struct {
+		method, url    string
+		expectedStatus int
+		forwarded      bool
+	}{
+		{http.MethodPut, "/admin/captures", http.StatusOK, false},
+		{http.MethodGet, "/admin/stats", http.StatusOK, false},
+		{http.MethodPut, "/admin/integrations/google", http.StatusConflict, false},
+		{http.MethodGet, "/admin/integrations/google/authorize", http.StatusConflict, false},
+		{http.MethodPut, "/cdc/consumers/search", http.StatusOK, true},
+		{http.MethodGet, "/integrations/google/callback?state=abc&code=xyz", http.StatusOK, true},
+		{http.MethodGet, "/todos/1/attachments/1?size=small", http.StatusOK, true},
+		{http.MethodGet, "/todos/1/attachments/1", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			forwarded = nil
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(`{"enabled":false,"seq":0}`))
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.forwarded, len(forwarded) == 1)
+		})
+	}
+}
+
+func TestScheduleJobsOnReplica(t *testing.T) {
+	withScheduler(t)
+	withPrimary(t, "http://todo-primary:8080")
+	config.ReplicaSyncInterval = time.Minute
+	config.BackupDir = t.TempDir()
+	config.JobSchedules = map[string]string{"backup": "@hourly"}
+
+	assert.NoError(t, scheduleJobs(time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)))
+	jobs := scheduler.list()
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "replica-sync", jobs[0].Name)
+	assert.Equal(t, "@every 1m0s", jobs[0].Schedule)
+}
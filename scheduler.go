@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// schedule decides when a recurring job runs next.
+type schedule interface {
+	next(after time.Time) time.Time
+}
+
+// everySchedule runs a job at a fixed interval, as @every 15m.
+type everySchedule time.Duration
+
+func (s everySchedule) next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+
+// cronSchedule is a five-field cron expression: minute, hour, day of month,
+// month and day of week, each a bit set of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// anyDom and anyDow are set when the day of month or week is *, in
+	// which case the other alone decides; otherwise either matching is
+	// enough, as in cron.
+	anyDom, anyDow bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseSchedule parses a cron expression, such as "30 3 * * 1-5", one of
+// the descriptors @hourly, @daily, @weekly, @monthly and @yearly, or
+// "@every" and a Go duration.
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || interval < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: @every needs a duration of at least 1s", spec)
+		}
+		return everySchedule(interval), nil
+	}
+	if expr, ok := cronDescriptors[spec]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: use five cron fields, a descriptor such as @daily, or @every and a duration", spec)
+	}
+	ranges := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, ranges[i][0], ranges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is 0 or 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		anyDom: fields[2] == "*", anyDow: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma-separated list of *, values and ranges,
+// each optionally with a /step.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if expr != "*" {
+			from, to, isRange := strings.Cut(expr, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (s cronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<t.Weekday()) != 0
+	switch {
+	case s.anyDom:
+		return dow
+	case s.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// next returns the first matching minute after after, or the zero time if
+// none comes within five years, as for February 30.
+func (s cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			// Jump straight to the next matching minute of the hour.
+			rest := s.minute >> (t.Minute() + 1)
+			if rest == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)+1) * time.Minute)
+			}
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Job is the state of a recurring job, as shown at GET /admin/jobs.
+type Job struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration string     `json:"lastDuration,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+}
+
+type scheduledJob struct {
+	Job
+	schedule schedule
+	run      func(now time.Time) error
+}
+
+// jobScheduler runs recurring jobs on their schedules. A job still running
+// when it is due again skips that run.
+type jobScheduler struct {
+	mu   sync.Mutex
+	jobs []*scheduledJob
+	// running counts the jobs in progress, for run to wait on.
+	running sync.WaitGroup
+}
+
+var scheduler = &jobScheduler{}
+
+// add schedules run as name, starting after now.
+func (s *jobScheduler) add(name, spec string, now time.Time, run func(now time.Time) error) error {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	job := &scheduledJob{Job: Job{Name: name, Schedule: spec}, schedule: sched, run: run}
+	job.setNext(now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+	return nil
+}
+
+func (j *scheduledJob) setNext(after time.Time) {
+	j.NextRun = nil
+	if next := j.schedule.next(after); !next.IsZero() {
+		j.NextRun = &next
+	}
+}
+
+// list returns the state of every job, by name.
+func (s *jobScheduler) list() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.Job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// runDue starts the jobs due at now, and returns a channel closed once they
+// have finished.
+func (s *jobScheduler) runDue(now time.Time) <-chan struct{} {
+	var wg sync.WaitGroup
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		if job.NextRun == nil || job.NextRun.After(now) {
+			continue
+		}
+		job.setNext(now)
+		if job.Running {
+			continue
+		}
+		job.Running = true
+		wg.Add(1)
+		s.running.Add(1)
+		go func(job *scheduledJob) {
+			defer s.running.Done()
+			defer wg.Done()
+			start := clock.Now()
+			debugf("job %s started", job.Name)
+			var err error
+			usingDB(func() { err = job.run(now) })
+			if err != nil {
+				warnf("job %s failed: %v", job.Name, err)
+			} else {
+				debugf("job %s finished in %s", job.Name, clock.Now().Sub(start).Round(time.Millisecond))
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			job.Running = false
+			job.LastRun = &start
+			job.LastDuration = clock.Now().Sub(start).Round(time.Millisecond).String()
+			job.LastError = ""
+			if err != nil {
+				job.LastError = err.Error()
+			}
+		}(job)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// run checks for due jobs every second until ctx is cancelled, then waits
+// for the jobs still running.
+func (s *jobScheduler) run(ctx context.Context) error {
+	ticks, stop := clock.NewTicker(time.Second)
+	defer stop()
+	for {
+		select {
+		case now := <-ticks:
+			s.runDue(now)
+		case <-ctx.Done():
+			s.running.Wait()
+			return nil
+		}
+	}
+}
+
+// jobSchedule returns the schedule JOB_SCHEDULES sets for a job, or def.
+// An empty result, or "off", leaves the job out.
+func jobSchedule(name, def string) string {
+	if spec, ok := config.JobSchedules[name]; ok {
+		if spec == "off" {
+			return ""
+		}
+		return spec
+	}
+	return def
+}
+
+// everyInterval is the default schedule of jobs configured by an interval,
+// where zero turns them off.
+func everyInterval(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return "@every " + d.String()
+}
+
+// scheduleJobs adds the service's recurring jobs to the scheduler.
+func scheduleJobs(now time.Time) error {
+	var archive, backup, compaction, reminders, exportExpiry, importExpiry, replicaSync string
+	if config.PrimaryURL != "" {
+		replicaSync = everyInterval(config.ReplicaSyncInterval)
+	}
+	if config.ArchiveAfter > 0 {
+		archive = "@daily"
+	}
+	if config.BackupDir != "" {
+		backup = "@daily"
+	}
+	if config.ChangeRetention > 0 {
+		compaction = everyInterval(changeCompactionInterval)
+	}
+	if config.ExportRetention > 0 {
+		exportExpiry = everyInterval(exportExpiryInterval)
+	}
+	if config.ImportRetention > 0 {
+		importExpiry = everyInterval(importExpiryInterval)
+	}
+	if twilioConfigured() {
+		reminders = everyInterval(config.ReminderInterval)
+	}
+
+	jobs := []struct {
+		name string
+		def  string
+		run  func(now time.Time) error
+	}{
+		{"archive", archive, archiveTodos},
+		{"backup", backup, backupDatabase},
+		{"change-compaction", compaction, compactChangeFeed},
+		{"export-expiry", exportExpiry, expireExportJobs},
+		{"import-expiry", importExpiry, expireImportJobs},
+		{"integration-sync", everyInterval(config.SyncInterval), syncIntegrations},
+		{"replica-sync", replicaSync, syncReplica},
+		{"sms-reminders", reminders, sendOverdueReminders},
+	}
+	known := make(map[string]bool)
+	for _, job := range jobs {
+		known[job.name] = true
+		// A replica only follows its primary, which runs everything else.
+		if config.PrimaryURL != "" && job.name != "replica-sync" {
+			continue
+		}
+		spec := jobSchedule(job.name, job.def)
+		if spec == "" {
+			continue
+		}
+		if err := scheduler.add(job.name, spec, now, job.run); err != nil {
+			return err
+		}
+	}
+	for name := range config.JobSchedules {
+		if !known[name] {
+			return fmt.Errorf("unknown job %q in JOB_SCHEDULES", name)
+		}
+	}
+	return nil
+}
+
+// backupDatabase writes a consistent copy of the database, and of the
+// archive if there is one, to BACKUP_DIR and removes all but the newest
+// BACKUP_KEEP copies of each.
+func backupDatabase(now time.Time) error {
+	if config.BackupDir == "" {
+		return fmt.Errorf("set BACKUP_DIR to back up")
+	}
+	if err := os.MkdirAll(config.BackupDir, 0700); err != nil {
+		return err
+	}
+	if err := backupFile(db, "todos", now); err != nil {
+		return err
+	}
+	if archiveDB != nil {
+		return backupFile(archiveDB, "archive", now)
+	}
+	return nil
+}
+
+// backupFile copies one database to BACKUP_DIR as <name>-<timestamp>.db.
+func backupFile(d *bolt.DB, name string, now time.Time) error {
+	path := filepath.Join(config.BackupDir, fmt.Sprintf("%s-%s.db", name, now.UTC().Format("20060102-150405")))
+	err := d.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path+".tmp", 0600)
+	})
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	backups, err := filepath.Glob(filepath.Join(config.BackupDir, name+"-*.db"))
+	if err != nil {
+		return err
+	}
+	// The timestamps sort in time order.
+	sort.Strings(backups)
+	for len(backups) > config.BackupKeep {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// getJobs lists the recurring jobs with their last and next runs.
+func getJobs(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(scheduler.list())
+}
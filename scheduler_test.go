@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withScheduler(t *testing.T) {
+	previous, previousConfig := scheduler, config
+	scheduler = &jobScheduler{}
+	t.Cleanup(func() { scheduler, config = previous, previousConfig })
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"* * * * *", "30 3 * * 1-5", "*/15 0-6,22 1,15 * 0", "5/10 * * * 7", "@daily", "@every 90s"} {
+		_, err := parseSchedule(spec)
+		assert.NoError(t, err, spec)
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "x * * * *", "@often", "@every 10ms", "@every soon"} {
+		_, err := parseSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// A Friday.
+	from := time.Date(2026, 10, 16, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 16, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 10, 15, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2026, 10, 16, 11, 5, 0, 0, time.UTC)},
+		{"30 3 * * 1-5", time.Date(2026, 10, 19, 3, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// With both days restricted, either matches.
+		{"0 9 20 * 0", time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 9 17 * 7", time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		{"@every 15m", from.Add(15 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, s.next(from))
+		})
+	}
+}
+
+func TestJobScheduler(t *testing.T) {
+	withScheduler(t)
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+
+	runs := 0
+	assert.NoError(t, scheduler.add("count", "@every 1m", start, func(now time.Time) error {
+		runs++
+		return nil
+	}))
+	assert.NoError(t, scheduler.add("fail", "*/5 * * * *", start, func(now time.Time) error {
+		return errors.New("disk full")
+	}))
+	assert.Error(t, scheduler.add("bad", "@sometimes", start, nil))
+
+	<-scheduler.runDue(start.Add(30 * time.Second))
+	assert.Equal(t, 0, runs)
+	<-scheduler.runDue(start.Add(time.Minute))
+	<-scheduler.runDue(start.Add(2 * time.Minute))
+	assert.Equal(t, 2, runs)
+
+	<-scheduler.runDue(start.Add(5 * time.Minute))
+	jobs := scheduler.list()
+	assert.Equal(t, []string{"count", "fail"}, []string{jobs[0].Name, jobs[1].Name})
+	assert.Equal(t, 3, runs)
+	assert.NotNil(t, jobs[0].LastRun)
+	assert.Empty(t, jobs[0].LastError)
+	assert.Equal(t, start.Add(6*time.Minute), *jobs[0].NextRun)
+	assert.Equal(t, "disk full", jobs[1].LastError)
+	assert.Equal(t, start.Add(10*time.Minute), *jobs[1].NextRun)
+}
+
+func TestJobSchedulerSkipsOverlappingRuns(t *testing.T) {
+	withScheduler(t)
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+
+	runs := 0
+	release := make(chan struct{})
+	scheduler.add("slow", "@every 1m", start, func(now time.Time) error {
+		runs++
+		<-release
+		return nil
+	})
+
+	first := scheduler.runDue(start.Add(time.Minute))
+	<-scheduler.runDue(start.Add(2 * time.Minute))
+	assert.True(t, scheduler.list()[0].Running)
+	close(release)
+	<-first
+
+	job := scheduler.list()[0]
+	assert.Equal(t, 1, runs)
+	assert.False(t, job.Running)
+	assert.Equal(t, start.Add(3*time.Minute), *job.NextRun)
+}
+
+func TestScheduleJobs(t *testing.T) {
+	withScheduler(t)
+	config.SyncInterval = 15 * time.Minute
+	config.ChangeRetention = 0
+	config.BackupDir = ""
+	config.JobSchedules = map[string]string{"change-compaction": "0 4 * * *", "integration-sync": "off"}
+	assert.NoError(t, scheduleJobs(time.Now()))
+	jobs := scheduler.list()
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "change-compaction", jobs[0].Name)
+	assert.Equal(t, "0 4 * * *", jobs[0].Schedule)
+
+	withScheduler(t)
+	config.JobSchedules = map[string]string{"recurrence": "@daily"}
+	assert.ErrorContains(t, scheduleJobs(time.Now()), `unknown job "recurrence"`)
+}
+
+func TestBackupDatabase(t *testing.T) {
+	clearBucket(t)
+	withScheduler(t)
+	config.BackupDir, config.BackupKeep = t.TempDir(), 2
+	saveTodo(t, Todo{Title: "Back me up"})
+
+	start := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	for day := 0; day < 3; day++ {
+		assert.NoError(t, backupDatabase(start.AddDate(0, 0, day)))
+	}
+	backups, _ := filepath.Glob(filepath.Join(config.BackupDir, "*"))
+	assert.Equal(t, []string{
+		filepath.Join(config.BackupDir, "todos-20261017-030000.db"),
+		filepath.Join(config.BackupDir, "todos-20261018-030000.db"),
+	}, backups)
+	info, err := os.Stat(backups[1])
+	assert.NoError(t, err)
+	assert.Greater(t, info.Size(), int64(0))
+}
+
+func TestBackupDatabaseWithArchive(t *testing.T) {
+	clearBucket(t)
+	withScheduler(t)
+	withArchive(t, time.Hour)
+	config.BackupDir, config.BackupKeep = t.TempDir(), 1
+
+	start := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	for day := 0; day < 2; day++ {
+		assert.NoError(t, backupDatabase(start.AddDate(0, 0, day)))
+	}
+	backups, _ := filepath.Glob(filepath.Join(config.BackupDir, "*"))
+	assert.Equal(t, []string{
+		filepath.Join(config.BackupDir, "archive-20261017-030000.db"),
+		filepath.Join(config.BackupDir, "todos-20261017-030000.db"),
+	}, backups)
+}
+
+func TestGetJobs(t *testing.T) {
+	withScheduler(t)
+	withAdminToken(t, "secret")
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	scheduler.add("backup", "@daily", start, func(time.Time) error { return nil })
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/jobs", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var jobs []Job
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jobs))
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "@daily", jobs[0].Schedule)
+	assert.Nil(t, jobs[0].LastRun)
+	assert.Equal(t, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), *jobs[0].NextRun)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretStore holds secrets fetched from Vault by the name of the
+// environment variable they stand in for, such as GITHUB_WEBHOOK_SECRET.
+type secretStore struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+var secrets = &secretStore{}
+
+func (s *secretStore) set(values map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = values
+}
+
+func (s *secretStore) get(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[name]
+	return v, ok
+}
+
+// secret returns the named secret from Vault, or fallback, its value from
+// the environment, when Vault doesn't have it. Read secrets through it
+// rather than caching them, so renewed values take effect.
+func secret(name, fallback string) string {
+	if v, ok := secrets.get(name); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+var vaultClient = &http.Client{Timeout: integrationTimeout}
+
+// vaultRequest calls the Vault HTTP API and decodes the response into out.
+func vaultRequest(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(config.VaultAddr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", config.VaultToken)
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("vault %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// fetchVaultSecrets reads the string values of the secret at
+// VAULT_SECRET_PATH, from a KV version 2 or version 1 engine.
+func fetchVaultSecrets() (map[string]string, error) {
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := vaultRequest(http.MethodGet, config.VaultSecretPath, &resp); err != nil {
+		return nil, err
+	}
+	data := resp.Data
+	if nested, ok := data["data"]; ok {
+		// KV version 2 nests the secret next to its metadata.
+		data = nil
+		if err := json.Unmarshal(nested, &data); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make(map[string]string)
+	for k, raw := range data {
+		var v string
+		if json.Unmarshal(raw, &v) == nil {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+// loadVaultSecrets fetches the secrets once, at startup.
+func loadVaultSecrets() error {
+	values, err := fetchVaultSecrets()
+	if err != nil {
+		return err
+	}
+	secrets.set(values)
+	infof("loaded %d secrets from vault", len(values))
+	return nil
+}
+
+// refreshVaultSecrets renews the Vault token and refetches the secrets. On
+// failure the previous values are kept.
+func refreshVaultSecrets() error {
+	if err := vaultRequest(http.MethodPost, "auth/token/renew-self", nil); err != nil {
+		warnf("renewing vault token: %v", err)
+	}
+	values, err := fetchVaultSecrets()
+	if err != nil {
+		return err
+	}
+	secrets.set(values)
+	return nil
+}
+
+// runSecretRenewal refreshes the secrets every interval, so rotated secrets
+// are picked up without a restart, until ctx is cancelled.
+func runSecretRenewal(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := refreshVaultSecrets(); err != nil {
+				warnf("refreshing vault secrets: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withVault points the Vault settings at a fake server answering with
+// body for the secret, and returns how often the token was renewed.
+func withVault(t *testing.T, body *string) *int {
+	renewals := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/token/renew-self":
+			renewals++
+			w.Write([]byte(`{"auth":{"renewable":true}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/todo-list-service":
+			w.Write([]byte(*body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	previousConfig := config
+	config.VaultAddr, config.VaultToken, config.VaultSecretPath = server.URL, "s.test", "secret/data/todo-list-service"
+	t.Cleanup(func() {
+		config = previousConfig
+		secrets.set(nil)
+	})
+	return &renewals
+}
+
+func TestFetchVaultSecrets(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected map[string]string
+	}{
+		{"kv v2", `{"data":{"data":{"GITHUB_WEBHOOK_SECRET":"from-vault","RETRIES":3},"metadata":{"version":2}}}`, map[string]string{"GITHUB_WEBHOOK_SECRET": "from-vault"}},
+		{"kv v1", `{"data":{"ADMIN_TOKEN":"from-vault"},"lease_duration":2764800}`, map[string]string{"ADMIN_TOKEN": "from-vault"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withVault(t, &tt.body)
+			values, err := fetchVaultSecrets()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+
+	body := `{}`
+	withVault(t, &body)
+	config.VaultToken = "s.wrong"
+	_, err := fetchVaultSecrets()
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestVaultSecrets(t *testing.T) {
+	body := `{"data":{"data":{"GITHUB_WEBHOOK_SECRET":"hook-secret"}}}`
+	withGitHub(t, func(w http.ResponseWriter, r *http.Request) {})
+	renewals := withVault(t, &body)
+	config.GitHubWebhookSecret = "from-env"
+	router := setupRouter()
+	deliver := func() int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, githubDelivery("ping", `{}`))
+		return w.Code
+	}
+
+	// Environment values are used until Vault has the secret.
+	assert.Equal(t, "from-env", secret("GITHUB_WEBHOOK_SECRET", config.GitHubWebhookSecret))
+	assert.Equal(t, http.StatusUnauthorized, deliver())
+
+	assert.NoError(t, loadVaultSecrets())
+	assert.Equal(t, http.StatusNoContent, deliver())
+	assert.Equal(t, "fallback", secret("JIRA_API_TOKEN", "fallback"))
+
+	// A rotated secret is picked up on the next refresh.
+	body = strings.Replace(body, "hook-secret", "rotated", 1)
+	assert.NoError(t, refreshVaultSecrets())
+	assert.Equal(t, 1, *renewals)
+	assert.Equal(t, http.StatusUnauthorized, deliver())
+
+	// An unreachable Vault keeps the last values.
+	config.VaultToken = "s.expired"
+	assert.Error(t, refreshVaultSecrets())
+	assert.Equal(t, "rotated", secret("GITHUB_WEBHOOK_SECRET", ""))
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TodoService holds the rules every change to a todo goes through,
+// whichever interface it comes from: validation, the status workflow,
+// blockers and quotas. New todos carry their creator, the caller, in
+// CreatedBy. Storing through putTodo records the change and
+// publishes its event. Handlers decode requests, call the service and map
+// its errors to responses with writeServiceError.
+type TodoService struct{}
+
+var todoService TodoService
+
+// invalidTodoError is a todo failing validation: the caller's mistake.
+type invalidTodoError struct {
+	error
+}
+
+func (e invalidTodoError) Unwrap() error { return e.error }
+
+// Get returns a todo, from the read cache when it can.
+func (s TodoService) Get(id int) (Todo, error) {
+	if cached, ok := cache.get(todoCacheKey(id)); ok {
+		return cached.(Todo), nil
+	}
+	gen := cache.currentGeneration()
+
+	var todo *Todo
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		todo, err = loadTodo(tx, id)
+		return err
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	if todo == nil {
+		return Todo{}, errTodoNotFound
+	}
+	cache.put(todoCacheKey(id), *todo, gen)
+	return *todo, nil
+}
+
+// Create stores a new todo, assigning its ID.
+func (s TodoService) Create(todo Todo) (Todo, error) {
+	todo.ID = 0
+	err := writeTx(func(tx *bolt.Tx) error {
+		return s.save(tx, nil, &todo, false)
+	})
+	return todo, err
+}
+
+// Update replaces the todo with the given ID, creating it if it doesn't
+// exist. An archived todo can't be replaced. Positions, stars and issue links are kept, since they only change
+// through their own endpoints. With force, a todo can be completed while
+// it still has open blockers.
+func (s TodoService) Update(id int, input Todo, force bool) (Todo, error) {
+	var todo Todo
+	err := writeTx(func(tx *bolt.Tx) error {
+		old, err := loadTodo(tx, id)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			archived, err := loadArchivedTodo(id)
+			if err != nil {
+				return err
+			}
+			if archived != nil {
+				return errTodoArchived
+			}
+		}
+		todo = input
+		todo.ID = id
+		todo.Position = ""
+		todo.Starred = false
+		todo.GitHubIssue = 0
+		todo.JiraIssue = ""
+		if old != nil {
+			todo.Position = old.Position
+			todo.Starred = old.Starred
+			todo.GitHubIssue = old.GitHubIssue
+			todo.JiraIssue = old.JiraIssue
+		}
+		return s.save(tx, old, &todo, force)
+	})
+	return todo, err
+}
+
+// Modify changes the todo with the given ID with fn and stores it through
+// the same rules as Update. Endpoints that change one thing about a todo,
+// such as starring, snoozing or moving it, use it. fn may run more than
+// once.
+func (s TodoService) Modify(id int, fn func(tx *bolt.Tx, todo *Todo) error) (Todo, error) {
+	var todo Todo
+	err := writeTx(func(tx *bolt.Tx) error {
+		old, err := loadTodo(tx, id)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return errTodoNotFound
+		}
+		todo = *old
+		todo.Tags = slices.Clone(old.Tags)
+		if err := fn(tx, &todo); err != nil {
+			return err
+		}
+		// fn doesn't complete todos, but one completed before stays so
+		// whatever its blockers.
+		return s.save(tx, old, &todo, old.Completed)
+	})
+	return todo, err
+}
+
+// Clone copies a todo into a new one created by createdBy. The copy starts
+// over: it is not completed, its status is reset and it is linked to no
+// issue.
+func (s TodoService) Clone(id int, createdBy string) (Todo, error) {
+	var clone Todo
+	err := writeTx(func(tx *bolt.Tx) error {
+		source, err := loadTodo(tx, id)
+		if err != nil {
+			return err
+		}
+		if source == nil {
+			return errTodoNotFound
+		}
+		clone = *source
+		clone.ID = 0
+		clone.Completed = false
+		clone.Status = StatusTodo
+		clone.GitHubIssue = 0
+		clone.JiraIssue = ""
+		clone.CreatedBy = createdBy
+		return s.save(tx, nil, &clone, false)
+	})
+	return clone, err
+}
+
+// Merge folds the duplicates into the primary, as mergeTodos describes, and
+// returns the primary.
+func (s TodoService) Merge(primary int, duplicates []int) (Todo, error) {
+	var todo *Todo
+	err := writeTx(func(tx *bolt.Tx) error {
+		if err := mergeTodos(tx, primary, duplicates); err != nil {
+			return err
+		}
+		var err error
+		todo, err = loadTodo(tx, primary)
+		return err
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return *todo, nil
+}
+
+// Delete removes a todo, live or archived, along with its index entries.
+// Deleting a todo that doesn't exist succeeds.
+func (s TodoService) Delete(id int) error {
+	err := writeTx(func(tx *bolt.Tx) error {
+		return removeTodo(tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	return deleteArchivedTodo(id)
+}
+
+// save checks todo, the new version of old, against the rules and stores
+// it in tx. old is nil for a new todo, which is given the next ID unless
+// it has one. Interfaces that write other records in the same transaction,
+// such as CalDAV, call it directly.
+func (s TodoService) save(tx *bolt.Tx, old, todo *Todo, force bool) error {
+	if err := validateTodo(*todo); err != nil {
+		return invalidTodoError{err}
+	}
+	if old == nil && todo.CreatedBy == "" && config.QuotaTodos > 0 {
+		return invalidTodoError{errCreatorRequired}
+	}
+	if err := reconcileStatus(old, todo); err != nil {
+		return err
+	}
+	if todo.ID == 0 {
+		id, _ := tx.Bucket(todosBucket).NextSequence()
+		todo.ID = int(id)
+		todo.Position = ""
+	}
+	if todo.Completed && !force {
+		if err := checkCompletable(tx, todo.ID); err != nil {
+			return err
+		}
+	}
+	return putTodo(tx, todo)
+}
+
+// saveExternal stores a todo whose state another system settled, such as an
+// integration, the GitHub webhook or a seed. It is stored as is, even where
+// validation, the workflow, blockers or quotas would refuse it; titles are
+// still cut and status and completed brought into agreement. It has no
+// creator.
+func (s TodoService) saveExternal(tx *bolt.Tx, old, todo *Todo) error {
+	if err := reconcileStatus(old, todo); err != nil && !errors.Is(err, errInvalidTransition) {
+		return err
+	}
+	if todo.ID == 0 {
+		id, _ := tx.Bucket(todosBucket).NextSequence()
+		todo.ID = int(id)
+		todo.Position = ""
+	}
+	return putTodo(tx, todo)
+}
+
+// writeServiceError answers with the status matching a TodoService error.
+func writeServiceError(w http.ResponseWriter, err error) {
+	var invalid invalidTodoError
+	switch {
+	case errors.As(err, &invalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errTodoNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errBlocked), errors.Is(err, errInvalidTransition), errors.Is(err, errTodoArchived):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
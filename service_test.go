@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestTodoService(t *testing.T) {
+	clearBucket(t)
+
+	_, err := todoService.Create(Todo{Title: "Bad", Priority: "urgent"})
+	var invalid invalidTodoError
+	assert.True(t, errors.As(err, &invalid))
+
+	todo, err := todoService.Create(Todo{ID: 42, Title: "  Write   report "})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, todo.ID, "IDs are assigned, not taken from the caller")
+	assert.Equal(t, "Write report", todo.Title)
+	assert.Equal(t, "todo", todo.Status)
+
+	blocker, err := todoService.Create(Todo{Title: "Gather numbers"})
+	assert.NoError(t, err)
+	router := setupRouter()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos/1/blockers", strings.NewReader(`{"id":2}`)))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Stars, positions and issue links survive updates.
+	saveTodo(t, Todo{ID: todo.ID, Title: todo.Title, Starred: true, GitHubIssue: 7, Position: todo.Position})
+	updated, err := todoService.Update(todo.ID, Todo{Title: "Write the report"}, false)
+	assert.NoError(t, err)
+	assert.True(t, updated.Starred)
+	assert.Equal(t, 7, updated.GitHubIssue)
+	assert.Equal(t, todo.Position, updated.Position)
+
+	_, err = todoService.Update(todo.ID, Todo{Title: "Write the report", Completed: true}, false)
+	assert.ErrorIs(t, err, errBlocked)
+	_, err = todoService.Update(todo.ID, Todo{Title: "Write the report", Completed: true}, true)
+	assert.NoError(t, err)
+
+	// Modify applies the same rules, but leaves a completed todo so.
+	starred, err := todoService.Modify(todo.ID, func(tx *bolt.Tx, todo *Todo) error {
+		todo.Starred = false
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, starred.Starred)
+	assert.True(t, starred.Completed)
+	_, err = todoService.Modify(todo.ID, func(tx *bolt.Tx, todo *Todo) error {
+		todo.Priority = "urgent"
+		return nil
+	})
+	assert.True(t, errors.As(err, &invalid))
+	_, err = todoService.Modify(99, func(tx *bolt.Tx, todo *Todo) error { return nil })
+	assert.ErrorIs(t, err, errTodoNotFound)
+
+	clone, err := todoService.Clone(todo.ID, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, clone.ID)
+	assert.Equal(t, StatusTodo, clone.Status)
+	assert.False(t, clone.Completed)
+	assert.Zero(t, clone.GitHubIssue)
+	assert.Equal(t, "alice", clone.CreatedBy)
+	_, err = todoService.Clone(99, "alice")
+	assert.ErrorIs(t, err, errTodoNotFound)
+
+	got, err := todoService.Get(blocker.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Gather numbers", got.Title)
+
+	assert.NoError(t, todoService.Delete(blocker.ID))
+	assert.NoError(t, todoService.Delete(blocker.ID))
+	_, err = todoService.Get(blocker.ID)
+	assert.ErrorIs(t, err, errTodoNotFound)
+}
+
+func TestWriteServiceError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"invalid", invalidTodoError{errors.New(`invalid priority "urgent": use low, medium or high`)}, http.StatusBadRequest},
+		{"not found", errTodoNotFound, http.StatusNotFound},
+		{"blocked", errBlocked, http.StatusConflict},
+		{"transition", errInvalidTransition, http.StatusConflict},
+		{"quota", errQuotaExceeded, http.StatusForbidden},
+		{"other", errors.New("disk full"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeServiceError(w, tt.err)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.err.Error()+"\n", w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loginRequest(token string) *http.Request {
+	form := url.Values{"token": {token}}
+	req := httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestLogin(t *testing.T) {
+	withAdminToken(t, "secret")
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+		expectCookie   bool
+	}{
+		{
+			name:           "valid token",
+			token:          "secret",
+			expectedStatus: http.StatusSeeOther,
+			expectCookie:   true,
+		},
+		{
+			name:           "invalid token",
+			token:          "wrong",
+			expectedStatus: http.StatusUnauthorized,
+			expectCookie:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			login(w, loginRequest(tt.token))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			cookies := w.Result().Cookies()
+			if tt.expectCookie {
+				assert.Len(t, cookies, 1)
+				assert.Equal(t, sessionCookie, cookies[0].Name)
+				assert.True(t, cookies[0].HttpOnly)
+				assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+			} else {
+				assert.Empty(t, cookies)
+			}
+		})
+	}
+}
+
+func TestSessionAuthAndCSRF(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+
+	w := httptest.NewRecorder()
+	login(w, loginRequest("secret"))
+	cookie := w.Result().Cookies()[0]
+
+	session, ok := sessions.get(cookie.Value)
+	assert.True(t, ok)
+
+	tests := []struct {
+		name           string
+		method         string
+		csrfToken      string
+		expectedStatus int
+	}{
+		{
+			name:           "read without csrf token",
+			method:         http.MethodGet,
+			csrfToken:      "",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "mutation without csrf token",
+			method:         http.MethodPost,
+			csrfToken:      "",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "mutation with wrong csrf token",
+			method:         http.MethodPost,
+			csrfToken:      "wrong",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "mutation with csrf token",
+			method:         http.MethodPost,
+			csrfToken:      session.CSRFToken,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/stats", nil)
+			req.AddCookie(cookie)
+			if tt.csrfToken != "" {
+				req.Header.Set(csrfHeader, tt.csrfToken)
+			}
+			w := httptest.NewRecorder()
+
+			requireAdmin(adminStats)(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	withAdminToken(t, "secret")
+
+	w := httptest.NewRecorder()
+	login(w, loginRequest("secret"))
+	cookie := w.Result().Cookies()[0]
+	session, _ := sessions.get(cookie.Value)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/logout", nil)
+	req.AddCookie(cookie)
+	req.Header.Set(csrfHeader, session.CSRFToken)
+	w = httptest.NewRecorder()
+
+	requireAdmin(logout)(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	_, ok := sessions.get(cookie.Value)
+	assert.False(t, ok)
+}
+
+func TestAdminDashboardRedirectsToLogin(t *testing.T) {
+	withAdminToken(t, "secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	w := httptest.NewRecorder()
+
+	adminDashboard(w, req)
+
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/admin/login", w.Header().Get("Location"))
+}
+
+func TestSessionsSweptOnCreate(t *testing.T) {
+	fake := withClock(t, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))
+	store := &sessionStore{sessions: make(map[string]*Session)}
+
+	abandoned, err := store.create()
+	assert.NoError(t, err)
+	fake.Advance(sessionTTL / 2)
+	kept, err := store.create()
+	assert.NoError(t, err)
+
+	fake.Advance(sessionTTL/2 + time.Minute)
+	fresh, err := store.create()
+	assert.NoError(t, err)
+	assert.Len(t, store.sessions, 2)
+	assert.NotContains(t, store.sessions, abandoned.ID)
+	assert.Contains(t, store.sessions, kept.ID)
+	assert.Contains(t, store.sessions, fresh.ID)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// writeLatencyWeight is how much each write moves the average write
+	// latency.
+	writeLatencyWeight = 0.2
+	// writeLatencyWindow is how long the average write latency counts after
+	// the last write. Without writes there's no pressure to measure, and
+	// shedding every batch request would keep it that way.
+	writeLatencyWindow = 10 * time.Second
+)
+
+// ShedRequests counts the requests to one route rejected under load.
+type ShedRequests struct {
+	Route string `json:"route"`
+	Count int    `json:"count"`
+}
+
+// writeLoad measures the pressure on the database: the moving average
+// latency of write transactions, waiting for the writer lock included, and
+// how many are queued or running.
+type writeLoad struct {
+	mu        sync.Mutex
+	latency   time.Duration
+	lastWrite time.Time
+	inFlight  atomic.Int64
+}
+
+var (
+	writes writeLoad
+
+	shedMu     sync.Mutex
+	shedCounts = make(map[string]int)
+)
+
+// observe records a write transaction that took d, finishing at now.
+func (l *writeLoad) observe(d time.Duration, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastWrite) > writeLatencyWindow {
+		l.latency = d
+	} else {
+		l.latency += time.Duration(writeLatencyWeight * float64(d-l.latency))
+	}
+	l.lastWrite = now
+}
+
+// overloaded reports whether the write queue is longer than SHED_WRITE_QUEUE
+// or recent writes took longer than SHED_WRITE_LATENCY on average.
+func (l *writeLoad) overloaded(now time.Time) bool {
+	if config.ShedWriteQueue > 0 && l.inFlight.Load() > int64(config.ShedWriteQueue) {
+		return true
+	}
+	if config.ShedWriteLatency == 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return now.Sub(l.lastWrite) <= writeLatencyWindow && l.latency > config.ShedWriteLatency
+}
+
+// shed answers a batch request, such as an import or an export, with 503
+// while the database is overloaded, keeping it free for interactive
+// requests, and reports whether it did. Retry-After tells clients when to
+// come back.
+func shed(w http.ResponseWriter, r *http.Request) bool {
+	if !writes.overloaded(clock.Now()) {
+		return false
+	}
+	route := routeName(r)
+	shedMu.Lock()
+	shedCounts[route]++
+	shedMu.Unlock()
+	debugf("shed %s %s: database overloaded", r.Method, route)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(config.ShedRetryAfter.Seconds())))
+	http.Error(w, "server busy, retry later", http.StatusServiceUnavailable)
+	return true
+}
+
+// shedCounters returns the shed request counts of every route, by route.
+func shedCounters() []ShedRequests {
+	shedMu.Lock()
+	defer shedMu.Unlock()
+	counters := make([]ShedRequests, 0, len(shedCounts))
+	for route, count := range shedCounts {
+		counters = append(counters, ShedRequests{Route: route, Count: count})
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].Route < counters[j].Route })
+	return counters
+}
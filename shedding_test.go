@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withShedding(t *testing.T, latency time.Duration, queue int) {
+	previousConfig := config
+	config.ShedWriteLatency, config.ShedWriteQueue, config.ShedRetryAfter = latency, queue, 30*time.Second
+	writes.mu.Lock()
+	writes.latency, writes.lastWrite = 0, time.Time{}
+	writes.mu.Unlock()
+	shedMu.Lock()
+	shedCounts = make(map[string]int)
+	shedMu.Unlock()
+	t.Cleanup(func() {
+		config = previousConfig
+		writes.mu.Lock()
+		writes.latency, writes.lastWrite = 0, time.Time{}
+		writes.mu.Unlock()
+	})
+}
+
+func TestWriteLoadOverloaded(t *testing.T) {
+	withShedding(t, 500*time.Millisecond, 2)
+	var l writeLoad
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+
+	assert.False(t, l.overloaded(start))
+	l.observe(50*time.Millisecond, start)
+	assert.False(t, l.overloaded(start))
+
+	// One slow write moves the average, a run of them crosses the threshold.
+	l.observe(time.Second, start)
+	assert.False(t, l.overloaded(start))
+	for range 5 {
+		l.observe(time.Second, start)
+	}
+	assert.True(t, l.overloaded(start))
+
+	// Without writes, an old average no longer counts.
+	assert.False(t, l.overloaded(start.Add(writeLatencyWindow+time.Second)))
+	// The first write after a quiet spell starts a fresh average.
+	l.observe(10*time.Millisecond, start.Add(time.Minute))
+	assert.False(t, l.overloaded(start.Add(time.Minute)))
+
+	l.inFlight.Add(3)
+	assert.True(t, l.overloaded(start.Add(time.Minute)))
+	l.inFlight.Add(-1)
+	assert.False(t, l.overloaded(start.Add(time.Minute)))
+}
+
+func TestWriteLoadThresholdsOff(t *testing.T) {
+	withShedding(t, 0, 0)
+	var l writeLoad
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	l.observe(time.Minute, now)
+	l.inFlight.Add(1000)
+	assert.False(t, l.overloaded(now))
+}
+
+func TestShedBatchRoutes(t *testing.T) {
+	clearBucket(t)
+	withShedding(t, 100*time.Millisecond, 0)
+	withClock(t, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))
+	for range 10 {
+		writes.observe(time.Second, clock.Now())
+	}
+	router := setupRouter()
+
+	tests := []struct {
+		method, url, body string
+	}{
+		{http.MethodPost, "/import/markdown", "- [ ] Pay rent"},
+		{http.MethodGet, "/todos/export", ""},
+		{http.MethodGet, "/me/export", ""},
+		{http.MethodPost, "/me/export", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			req := requestAs("alice", tt.method, tt.url, tt.body)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		})
+	}
+
+	// Interactive requests are still served.
+	req := requestAs("alice", http.MethodPost, "/todos", `{"title":"Pay rent"}`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	assert.Equal(t, []ShedRequests{
+		{Route: "/import/markdown", Count: 1},
+		{Route: "/me/export", Count: 2},
+		{Route: "/todos/export", Count: 1},
+	}, shedCounters())
+}
+
+func TestShedMetrics(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+	withShedding(t, 0, 1)
+	writes.inFlight.Add(2)
+	t.Cleanup(func() { writes.inFlight.Add(-2) })
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/export", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `todo_shed_requests_total{route="/todos/export"} 1`+"\n")
+}
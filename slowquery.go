@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// pagingParams shape a listing's page rather than which todos it reads, so
+// they are left out of slow query reports. Tokens are secrets.
+var pagingParams = []string{"page", "limit", "cursor", "fields", "token"}
+
+// SlowQueries counts the read transactions of one route that took longer
+// than SLOW_QUERY_THRESHOLD.
+type SlowQueries struct {
+	Route string `json:"route"`
+	Count int    `json:"count"`
+}
+
+var (
+	slowQueryMu     sync.Mutex
+	slowQueryCounts = make(map[string]int)
+)
+
+// timedView runs a read transaction for r, reporting it as a slow query
+// when it takes longer than SLOW_QUERY_THRESHOLD. Listings that stream
+// their response from the transaction include the time spent writing it.
+func timedView(r *http.Request, fn func(*bolt.Tx) error) error {
+	start := time.Now()
+	err := db.View(fn)
+	if d := time.Since(start); config.SlowQueryThreshold > 0 && d > config.SlowQueryThreshold {
+		recordSlowQuery(r, d)
+	}
+	return err
+}
+
+// routeName is the path template of the route serving r, such as
+// /todos/{id}, or its path outside the router.
+func routeName(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+func recordSlowQuery(r *http.Request, d time.Duration) {
+	route := routeName(r)
+	slowQueryMu.Lock()
+	slowQueryCounts[route]++
+	slowQueryMu.Unlock()
+	warnf("slow query: %s %s took %s filter=%s", r.Method, route, d.Round(time.Millisecond), queryFilter(r.URL.Query()))
+}
+
+// queryFilter renders the parameters selecting todos. Under LOG_REDACTION
+// only their names are kept, since values can name users.
+func queryFilter(query url.Values) string {
+	for _, param := range pagingParams {
+		query.Del(param)
+	}
+	if len(query) == 0 {
+		return "-"
+	}
+	if !config.LogRedaction {
+		return query.Encode()
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// slowQueryCounters returns the slow query counts of every route, by route.
+func slowQueryCounters() []SlowQueries {
+	slowQueryMu.Lock()
+	defer slowQueryMu.Unlock()
+	counters := make([]SlowQueries, 0, len(slowQueryCounts))
+	for route, count := range slowQueryCounts {
+		counters = append(counters, SlowQueries{Route: route, Count: count})
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i].Route < counters[j].Route })
+	return counters
+}
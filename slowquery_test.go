@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowQueryLog(t *testing.T) {
+	clearBucket(t)
+	withAdminToken(t, "secret")
+	logs := withLogging(t, false, false)
+	slowQueryCounts = make(map[string]int)
+	t.Cleanup(func() { slowQueryCounts = make(map[string]int) })
+	router := setupRouter()
+	get := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	config.SlowQueryThreshold = time.Hour
+	get("/todos?assignee=alice")
+	assert.Empty(t, logs.String())
+
+	// Every query is slow now.
+	config.SlowQueryThreshold = time.Nanosecond
+	get("/todos?assignee=alice&limit=5&fields=id")
+	get("/views/today")
+	assert.Contains(t, logs.String(), "WARN slow query: GET /todos took ")
+	assert.Contains(t, logs.String(), "filter=assignee=alice\n")
+	assert.Contains(t, logs.String(), "WARN slow query: GET /views/{name:today|upcoming|someday} took ")
+
+	config.LogRedaction = true
+	logs.Reset()
+	get("/todos?assignee=alice&completed=false")
+	assert.Contains(t, logs.String(), "filter=assignee,completed\n")
+	assert.NotContains(t, logs.String(), "alice")
+
+	assert.Equal(t, []SlowQueries{
+		{Route: "/todos", Count: 2},
+		{Route: "/views/{name:today|upcoming|someday}", Count: 1},
+	}, slowQueryCounters())
+	assert.Contains(t, get("/metrics").Body.String(), `todo_slow_queries_total{route="/todos"} 2`)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// twilioAPI is a variable so tests can point it at a fake.
+var twilioAPI = "https://api.twilio.com"
+
+var (
+	// smsRemindedBucket remembers which overdue todos a user was texted
+	// about, keyed by user + 0x00 + todo key, with the due date the
+	// reminder was for. A todo is reminded about once per due date.
+	smsRemindedBucket = []byte("smsReminded")
+	// smsMessagesBucket tracks sent messages by Twilio SID until their
+	// delivery status is final.
+	smsMessagesBucket = []byte("smsMessages")
+)
+
+// smsReminderTitles caps the titles listed in one reminder.
+const smsReminderTitles = 3
+
+// SMSMessage is a sent reminder and the todos it was about.
+type SMSMessage struct {
+	User    string    `json:"user"`
+	TodoIDs []int     `json:"todoIds"`
+	Due     []string  `json:"due"`
+	Status  string    `json:"status"`
+	SentAt  time.Time `json:"sentAt"`
+}
+
+// smsReminder is a reminder about to be sent.
+type smsReminder struct {
+	user  string
+	phone string
+	lang  string
+	todos []Todo
+}
+
+func twilioConfigured() bool {
+	return config.TwilioAccountSID != "" && secret("TWILIO_AUTH_TOKEN", config.TwilioAuthToken) != "" && config.TwilioFrom != ""
+}
+
+// sendSMS sends a text through Twilio, retrying under the delivery policy,
+// and returns the message SID.
+func sendSMS(to, body string) (string, error) {
+	form := url.Values{"To": {to}, "From": {config.TwilioFrom}, "Body": {body}}
+	if config.TwilioStatusCallback != "" {
+		form.Set("StatusCallback", config.TwilioStatusCallback)
+	}
+
+	client := withBreaker("twilio", &http.Client{Timeout: config.DeliveryTimeout, Transport: basicTransport{user: config.TwilioAccountSID, password: secret("TWILIO_AUTH_TOKEN", config.TwilioAuthToken)}})
+	var sid string
+	err := deliver("twilio", func() error {
+		resp, err := client.PostForm(twilioAPI+"/2010-04-01/Accounts/"+url.PathEscape(config.TwilioAccountSID)+"/Messages.json", form)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var message struct {
+			SID     string `json:"sid"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&message)
+		switch {
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("Twilio answered %s: %s", resp.Status, message.Message)
+		case resp.StatusCode >= 300:
+			return fmt.Errorf("Twilio answered %s: %s (%w)", resp.Status, message.Message, errDeliveryRejected)
+		}
+		sid = message.SID
+		return nil
+	})
+	return sid, err
+}
+
+func smsRemindedKey(user string, id int) []byte {
+	return append([]byte(user+"\x00"), itob(id)...)
+}
+
+// overdueReminders finds, for every user who opted in and isn't in quiet
+// hours, the open high-priority todos assigned to them that are overdue in
+// their time zone and they haven't been reminded about.
+func overdueReminders(tx *bolt.Tx, now time.Time) ([]smsReminder, error) {
+	var reminders []smsReminder
+	reminded := tx.Bucket(smsRemindedBucket)
+	err := tx.Bucket(preferencesBucket).ForEach(func(k, v []byte) error {
+		var p Preferences
+		if err := codec.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		if !p.SMSReminders || p.Phone == "" {
+			return nil
+		}
+		user := string(k)
+		loc, err := time.LoadLocation(p.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		local := now.In(loc)
+		if p.QuietHours.quiet(local) {
+			return nil
+		}
+		today := local.Format(dueDateLayout)
+
+		reminder := smsReminder{user: user, phone: p.Phone, lang: p.Language}
+		it := newIndexIterator(tx, "assignee", user)
+		for k, v := it.first(); k != nil; k, v = it.next() {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			if todo.Completed || todo.Priority != "high" || todo.DueDate == "" || todo.DueDate >= today {
+				continue
+			}
+			if string(reminded.Get(smsRemindedKey(user, todo.ID))) == todo.DueDate {
+				continue
+			}
+			reminder.todos = append(reminder.todos, todo)
+		}
+		if len(reminder.todos) > 0 {
+			reminders = append(reminders, reminder)
+		}
+		return nil
+	})
+	return reminders, err
+}
+
+func (r smsReminder) body() string {
+	var b strings.Builder
+	b.WriteString(localize(r.lang, "Overdue:"))
+	for i, todo := range r.todos {
+		if i == smsReminderTitles {
+			b.WriteString(" " + localize(r.lang, "and %d more", len(r.todos)-i))
+			break
+		}
+		if i > 0 {
+			b.WriteString(";")
+		}
+		b.WriteString(" " + localize(r.lang, "%s (due %s)", todoLabel(todo), todo.DueDate))
+	}
+	return b.String()
+}
+
+// sendOverdueReminders texts every user their new overdue todos.
+func sendOverdueReminders(now time.Time) error {
+	var reminders []smsReminder
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		reminders, err = overdueReminders(tx, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, reminder := range reminders {
+		sid, err := sendSMS(reminder.phone, reminder.body())
+		if err != nil {
+			warnf("texting %s about overdue todos: %v", redactUser(reminder.user), err)
+			continue
+		}
+
+		message := SMSMessage{User: reminder.user, Status: "queued", SentAt: now.UTC()}
+		for _, todo := range reminder.todos {
+			message.TodoIDs = append(message.TodoIDs, todo.ID)
+			message.Due = append(message.Due, todo.DueDate)
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			reminded := tx.Bucket(smsRemindedBucket)
+			for i, id := range message.TodoIDs {
+				if err := reminded.Put(smsRemindedKey(message.User, id), []byte(message.Due[i])); err != nil {
+					return err
+				}
+			}
+			// Without status callbacks the message would never be
+			// cleaned up.
+			if config.TwilioStatusCallback == "" {
+				return nil
+			}
+			buf, err := codec.Marshal(message)
+			if err != nil {
+				return err
+			}
+			return tx.Bucket(smsMessagesBucket).Put([]byte(sid), buf)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validTwilioSignature checks the X-Twilio-Signature header: an HMAC-SHA1,
+// keyed by the auth token, of the callback URL followed by every POST
+// parameter name and value in name order.
+func validTwilioSignature(callbackURL string, params url.Values, signature string) bool {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var data bytes.Buffer
+	data.WriteString(callbackURL)
+	for _, name := range names {
+		for _, value := range params[name] {
+			data.WriteString(name + value)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(secret("TWILIO_AUTH_TOKEN", config.TwilioAuthToken)))
+	mac.Write(data.Bytes())
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// twilioStatusCallback records a message's delivery status. When delivery
+// fails, its todos are forgotten as reminded, so the next run tries again.
+func twilioStatusCallback(w http.ResponseWriter, r *http.Request) {
+	if config.TwilioStatusCallback == "" || secret("TWILIO_AUTH_TOKEN", config.TwilioAuthToken) == "" {
+		http.Error(w, "Twilio callbacks are disabled", http.StatusForbidden)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validTwilioSignature(config.TwilioStatusCallback, r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	sid := []byte(r.PostForm.Get("MessageSid"))
+	status := r.PostForm.Get("MessageStatus")
+	err := writeTx(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(smsMessagesBucket)
+		v := messages.Get(sid)
+		if v == nil {
+			return nil
+		}
+		var message SMSMessage
+		if err := codec.Unmarshal(v, &message); err != nil {
+			return err
+		}
+
+		switch status {
+		case "delivered":
+			return messages.Delete(sid)
+		case "failed", "undelivered":
+			warnf("SMS reminder to %s was %s (error %s)", redactUser(message.User), status, r.PostForm.Get("ErrorCode"))
+			reminded := tx.Bucket(smsRemindedBucket)
+			for _, id := range message.TodoIDs {
+				if err := reminded.Delete(smsRemindedKey(message.User, id)); err != nil {
+					return err
+				}
+			}
+			return messages.Delete(sid)
+		}
+
+		message.Status = status
+		buf, err := codec.Marshal(message)
+		if err != nil {
+			return err
+		}
+		return messages.Put(sid, buf)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
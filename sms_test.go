@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// withTwilio points SMS at a fake Twilio and returns the texts it was
+// asked to send.
+func withTwilio(t *testing.T) *[]url.Values {
+	var sent []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "AC123", user)
+		assert.Equal(t, "auth-token", password)
+		assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", r.URL.Path)
+		r.ParseForm()
+		sent = append(sent, r.PostForm)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"SM` + strconv.Itoa(len(sent)) + `","status":"queued"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	previous, previousConfig := twilioAPI, config
+	twilioAPI = server.URL
+	config.TwilioAccountSID, config.TwilioAuthToken, config.TwilioFrom = "AC123", "auth-token", "+15005550006"
+	config.TwilioStatusCallback = "https://todo.example.com/webhooks/twilio/status"
+	t.Cleanup(func() { twilioAPI, config = previous, previousConfig })
+	return &sent
+}
+
+func savePreferences(t *testing.T, user string, p Preferences) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		buf, err := codec.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(preferencesBucket).Put([]byte(user), buf)
+	})
+	assert.NoError(t, err)
+}
+
+func twilioCallback(params url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/twilio/status", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	data := "https://todo.example.com/webhooks/twilio/status"
+	for _, name := range []string{"ErrorCode", "MessageSid", "MessageStatus"} {
+		if params.Has(name) {
+			data += name + params.Get(name)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte("auth-token"))
+	mac.Write([]byte(data))
+	req.Header.Set("X-Twilio-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestQuietHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, _ := time.Parse(clockLayout, clock)
+		return parsed
+	}
+	tests := []struct {
+		name  string
+		hours *QuietHours
+		now   string
+		quiet bool
+	}{
+		{"none", nil, "03:00", false},
+		{"inside", &QuietHours{Start: "12:00", End: "14:00"}, "13:00", true},
+		{"at start", &QuietHours{Start: "12:00", End: "14:00"}, "12:00", true},
+		{"at end", &QuietHours{Start: "12:00", End: "14:00"}, "14:00", false},
+		{"overnight late", &QuietHours{Start: "22:00", End: "07:00"}, "23:30", true},
+		{"overnight early", &QuietHours{Start: "22:00", End: "07:00"}, "06:59", true},
+		{"overnight day", &QuietHours{Start: "22:00", End: "07:00"}, "12:00", false},
+		{"empty span", &QuietHours{Start: "09:00", End: "09:00"}, "09:00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.quiet, tt.hours.quiet(at(tt.now)))
+		})
+	}
+}
+
+func TestSMSReminders(t *testing.T) {
+	clearBucket(t)
+	sent := withTwilio(t)
+	router := setupRouter()
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	savePreferences(t, "alice", Preferences{Phone: "+14155550123", SMSReminders: true})
+	savePreferences(t, "bob", Preferences{Phone: "+14155550124"})
+	late := saveTodo(t, Todo{Title: "File taxes", Assignee: "alice", Priority: "high", DueDate: "2026-10-10"})
+	saveTodo(t, Todo{Title: "Not urgent", Assignee: "alice", Priority: "medium", DueDate: "2026-10-10"})
+	saveTodo(t, Todo{Title: "Later", Assignee: "alice", Priority: "high", DueDate: "2026-10-20"})
+	saveTodo(t, Todo{Title: "Done", Assignee: "alice", Priority: "high", DueDate: "2026-10-10", Completed: true})
+	saveTodo(t, Todo{Title: "Opted out", Assignee: "bob", Priority: "high", DueDate: "2026-10-10"})
+
+	assert.NoError(t, sendOverdueReminders(now))
+	assert.Len(t, *sent, 1)
+	assert.Equal(t, "+14155550123", (*sent)[0].Get("To"))
+	assert.Equal(t, "+15005550006", (*sent)[0].Get("From"))
+	assert.Equal(t, "Overdue: File taxes (due 2026-10-10)", (*sent)[0].Get("Body"))
+	assert.Equal(t, config.TwilioStatusCallback, (*sent)[0].Get("StatusCallback"))
+
+	// A todo is reminded about once per due date.
+	assert.NoError(t, sendOverdueReminders(now))
+	assert.Len(t, *sent, 1)
+	late.DueDate = "2026-10-12"
+	saveTodo(t, late)
+	assert.NoError(t, sendOverdueReminders(now))
+	assert.Len(t, *sent, 2)
+
+	// A failed delivery is retried on the next run.
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, twilioCallback(url.Values{"MessageSid": {"SM2"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.NoError(t, sendOverdueReminders(now))
+	assert.Len(t, *sent, 3)
+
+	forged := twilioCallback(url.Values{"MessageSid": {"SM3"}, "MessageStatus": {"failed"}})
+	forged.Header.Set("X-Twilio-Signature", "AAAA")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, forged)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Nothing is sent during quiet hours, in the user's time zone.
+	late.DueDate = "2026-10-13"
+	saveTodo(t, late)
+	savePreferences(t, "alice", Preferences{Phone: "+14155550123", SMSReminders: true, Timezone: "Asia/Tokyo", QuietHours: &QuietHours{Start: "20:00", End: "23:00"}})
+	assert.NoError(t, sendOverdueReminders(now))
+	assert.Len(t, *sent, 3)
+	assert.NoError(t, sendOverdueReminders(now.Add(3*time.Hour)))
+	assert.Len(t, *sent, 4)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+var errSnoozeCompleted = errors.New("completed todos can't be snoozed")
+
+// SnoozeRequest is the body of POST /todos/{id}/snooze: a preset, or an
+// explicit date or RFC 3339 time in until.
+type SnoozeRequest struct {
+	Preset string `json:"preset,omitempty"`
+	Until  string `json:"until,omitempty"`
+}
+
+// nextMonday is the Monday after now, a full week away if today is Monday.
+func nextMonday(now time.Time) time.Time {
+	return now.AddDate(0, 0, 7-(int(now.Weekday())+6)%7)
+}
+
+// snoozeDate works out the due date a snooze moves a todo to. now carries
+// the caller's time zone; due dates are plain dates in it.
+func snoozeDate(req SnoozeRequest, now time.Time) (string, error) {
+	if (req.Preset == "") == (req.Until == "") {
+		return "", fmt.Errorf("give either preset or until")
+	}
+
+	switch req.Preset {
+	case "":
+	case "1h":
+		return now.Add(time.Hour).Format(dueDateLayout), nil
+	case "tomorrow":
+		return now.AddDate(0, 0, 1).Format(dueDateLayout), nil
+	case "next-week":
+		return nextMonday(now).Format(dueDateLayout), nil
+	default:
+		return "", fmt.Errorf("invalid preset %q: use 1h, tomorrow or next-week", req.Preset)
+	}
+
+	if until, err := time.Parse(time.RFC3339, req.Until); err == nil {
+		return until.In(now.Location()).Format(dueDateLayout), nil
+	}
+	if _, err := time.Parse(dueDateLayout, req.Until); err == nil {
+		return req.Until, nil
+	}
+	return "", fmt.Errorf("invalid until %q: use YYYY-MM-DD or an RFC 3339 time", req.Until)
+}
+
+// snoozeTodo moves an open todo's due date out. The change feed records it
+// like any other update.
+func snoozeTodo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req SnoozeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := locationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	due, err := snoozeDate(req, clock.Now().In(loc))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	todo, err := todoService.Modify(id, func(tx *bolt.Tx, todo *Todo) error {
+		if todo.Completed {
+			return errSnoozeCompleted
+		}
+		todo.DueDate = due
+		return nil
+	})
+	if err == errSnoozeCompleted {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(todo)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnoozeDate(t *testing.T) {
+	lisbon, _ := time.LoadLocation("Europe/Lisbon")
+	// Friday 2026-10-16, 23:30 in Lisbon.
+	now := time.Date(2026, 10, 16, 23, 30, 0, 0, lisbon)
+
+	tests := []struct {
+		name string
+		req  SnoozeRequest
+		want string
+		err  string
+	}{
+		{"1h crosses midnight", SnoozeRequest{Preset: "1h"}, "2026-10-17", ""},
+		{"tomorrow", SnoozeRequest{Preset: "tomorrow"}, "2026-10-17", ""},
+		{"next week", SnoozeRequest{Preset: "next-week"}, "2026-10-19", ""},
+		{"date", SnoozeRequest{Until: "2026-11-02"}, "2026-11-02", ""},
+		{"time in caller's zone", SnoozeRequest{Until: "2026-11-02T23:30:00Z"}, "2026-11-02", ""},
+		{"time past midnight locally", SnoozeRequest{Until: "2026-10-20T23:30:00Z"}, "2026-10-21", ""},
+		{"unknown preset", SnoozeRequest{Preset: "later"}, "", `invalid preset "later": use 1h, tomorrow or next-week`},
+		{"bad until", SnoozeRequest{Until: "soon"}, "", `invalid until "soon": use YYYY-MM-DD or an RFC 3339 time`},
+		{"both", SnoozeRequest{Preset: "1h", Until: "2026-11-02"}, "", "give either preset or until"},
+		{"neither", SnoozeRequest{}, "", "give either preset or until"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, err := snoozeDate(tt.req, now)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, due)
+		})
+	}
+
+	monday := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	due, _ := snoozeDate(SnoozeRequest{Preset: "next-week"}, monday)
+	assert.Equal(t, "2026-10-26", due)
+}
+
+func TestSnoozeTodo(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, todo := range []Todo{{Title: "Open", DueDate: "2026-01-01"}, {Title: "Done", Completed: true}} {
+		payload, _ := json.Marshal(todo)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos/1/snooze", bytes.NewBufferString(`{"until":"2026-12-24"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var todo Todo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &todo))
+	assert.Equal(t, "2026-12-24", todo.DueDate)
+
+	// The snooze shows up in the change feed.
+	changes := fetchChanges(t, "/todos/changes")
+	last := changes.Changes[len(changes.Changes)-1]
+	assert.Equal(t, EventTodoUpdated, last.Type)
+	assert.Equal(t, "2026-12-24", last.Todo.DueDate)
+
+	for _, tt := range []struct {
+		url, body string
+		code      int
+	}{
+		{"/todos/2/snooze", `{"preset":"tomorrow"}`, http.StatusConflict},
+		{"/todos/9/snooze", `{"preset":"tomorrow"}`, http.StatusNotFound},
+		{"/todos/1/snooze", `{"preset":"someday"}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString(tt.body)))
+		assert.Equal(t, tt.code, w.Code, tt.url+" "+tt.body)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listIDs follows nextCursor from url and returns every ID listed.
+func listIDs(t *testing.T, router http.Handler, target string) []int {
+	var ids []int
+	for {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response PaginatedResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		for _, todo := range response.Items {
+			ids = append(ids, todo.ID)
+		}
+		if response.NextCursor == "" {
+			return ids
+		}
+
+		u, _ := url.Parse(target)
+		q := u.Query()
+		q.Set("cursor", response.NextCursor)
+		u.RawQuery = q.Encode()
+		target = u.String()
+	}
+}
+
+func TestStarredTodos(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for i := 1; i <= 4; i++ {
+		payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Todo %d", i), Completed: i == 3})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	for _, id := range []int{3, 2} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/todos/%d/star", id), nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// A PUT from a client that doesn't know about stars keeps the star.
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/todos/2", strings.NewReader(`{"title":"Todo 2"}`)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos/99/star", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	tests := []struct {
+		name        string
+		url         string
+		expectedIDs []int
+	}{
+		{
+			name:        "starred first",
+			url:         "/todos",
+			expectedIDs: []int{2, 3, 1, 4},
+		},
+		{
+			name:        "starred first across cursor pages",
+			url:         "/todos?limit=1",
+			expectedIDs: []int{2, 3, 1, 4},
+		},
+		{
+			name:        "starred first within a filter",
+			url:         "/todos?completed=false&limit=1",
+			expectedIDs: []int{2, 1, 4},
+		},
+		{
+			name:        "starred only",
+			url:         "/todos?starred=true",
+			expectedIDs: []int{2, 3},
+		},
+		{
+			name:        "ID order",
+			url:         "/todos?sort=id",
+			expectedIDs: []int{1, 2, 3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedIDs, listIDs(t, router, tt.url))
+		})
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/todos/3/star", nil))
+	assert.Equal(t, []int{2, 1, 3, 4}, listIDs(t, router, "/todos"))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusBlocked    = "blocked"
+	StatusDone       = "done"
+)
+
+// statusOrder is the workflow's column order on the board.
+var statusOrder = []string{StatusTodo, StatusInProgress, StatusBlocked, StatusDone}
+
+// statusTransitions lists the statuses each status may move to. Moving to
+// the same status is always allowed.
+var statusTransitions = map[string][]string{
+	StatusTodo:       {StatusInProgress, StatusBlocked, StatusDone},
+	StatusInProgress: {StatusTodo, StatusBlocked, StatusDone},
+	StatusBlocked:    {StatusTodo, StatusInProgress},
+	StatusDone:       {StatusTodo, StatusInProgress},
+}
+
+var errInvalidTransition = errors.New("invalid status transition")
+
+// todoStatus returns a todo's status, deriving it from completed for records
+// written before statuses existed.
+func todoStatus(t Todo) string {
+	if t.Status != "" {
+		return t.Status
+	}
+	if t.Completed {
+		return StatusDone
+	}
+	return StatusTodo
+}
+
+func validStatus(status string) error {
+	if status == "" {
+		return nil
+	}
+	if _, ok := statusTransitions[status]; !ok {
+		return fmt.Errorf("invalid status %q: use todo, in_progress, blocked or done", status)
+	}
+	return nil
+}
+
+// reconcileStatus keeps status and completed in agreement. Status wins,
+// except when a client that only knows about completed flips it and leaves
+// status as it was; then status follows completed.
+func reconcileStatus(old *Todo, todo *Todo) error {
+	switch {
+	case todo.Status == "":
+		todo.Status = todoStatus(*todo)
+	case old != nil && todo.Status == todoStatus(*old) && todo.Completed != old.Completed:
+		todo.Status = todoStatus(Todo{Completed: todo.Completed})
+	}
+	todo.Completed = todo.Status == StatusDone
+
+	if old == nil {
+		return nil
+	}
+	from := todoStatus(*old)
+	if from == todo.Status {
+		return nil
+	}
+	for _, to := range statusTransitions[from] {
+		if to == todo.Status {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w from %s to %s", errInvalidTransition, from, todo.Status)
+}
+
+type BoardColumn struct {
+	Status string `json:"status"`
+	Items  []Todo `json:"items"`
+}
+
+// getBoard returns every todo grouped into one column per status.
+func getBoard(w http.ResponseWriter, r *http.Request) {
+	board := make([]BoardColumn, 0, len(statusOrder))
+	err := timedView(r, func(tx *bolt.Tx) error {
+		for _, status := range statusOrder {
+			column := BoardColumn{Status: status, Items: []Todo{}}
+			it := newIndexIterator(tx, "status", status)
+			for k, v := it.first(); k != nil; k, v = it.next() {
+				var todo Todo
+				if err := codec.Unmarshal(v, &todo); err != nil {
+					return err
+				}
+				todo.Status = todoStatus(todo)
+				column.Items = append(column.Items, todo)
+			}
+			board = append(board, column)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(board)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileStatus(t *testing.T) {
+	tests := []struct {
+		name              string
+		old               *Todo
+		todo              Todo
+		expectedStatus    string
+		expectedCompleted bool
+		expectedError     bool
+	}{
+		{
+			name:           "new without status",
+			todo:           Todo{},
+			expectedStatus: StatusTodo,
+		},
+		{
+			name:              "new completed without status",
+			todo:              Todo{Completed: true},
+			expectedStatus:    StatusDone,
+			expectedCompleted: true,
+		},
+		{
+			name:              "status wins",
+			todo:              Todo{Status: StatusDone},
+			expectedStatus:    StatusDone,
+			expectedCompleted: true,
+		},
+		{
+			name:              "completed flipped by a status-unaware client",
+			old:               &Todo{Status: StatusInProgress},
+			todo:              Todo{Status: StatusInProgress, Completed: true},
+			expectedStatus:    StatusDone,
+			expectedCompleted: true,
+		},
+		{
+			name:           "reopened",
+			old:            &Todo{Status: StatusDone, Completed: true},
+			todo:           Todo{Status: StatusDone, Completed: false},
+			expectedStatus: StatusTodo,
+		},
+		{
+			name:          "disallowed transition",
+			old:           &Todo{Status: StatusBlocked},
+			todo:          Todo{Status: StatusDone},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todo := tt.todo
+			err := reconcileStatus(tt.old, &todo)
+
+			if tt.expectedError {
+				assert.ErrorIs(t, err, errInvalidTransition)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, todo.Status)
+			assert.Equal(t, tt.expectedCompleted, todo.Completed)
+		})
+	}
+}
+
+func TestUpdateTodoRejectsInvalidTransition(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	payload, _ := json.Marshal(Todo{Title: "Stuck", Status: StatusBlocked})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/todos/1", strings.NewReader(`{"title":"Stuck","status":"done"}`)))
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestGetBoard(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, todo := range []Todo{
+		{Title: "A"},
+		{Title: "B", Status: StatusInProgress},
+		{Title: "C", Completed: true},
+		{Title: "D", Status: StatusInProgress},
+	} {
+		payload, _ := json.Marshal(todo)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/board", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var board []BoardColumn
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &board))
+
+	columns := make(map[string][]string)
+	var order []string
+	for _, column := range board {
+		order = append(order, column.Status)
+		for _, todo := range column.Items {
+			columns[column.Status] = append(columns[column.Status], todo.Title)
+		}
+	}
+	assert.Equal(t, statusOrder, order)
+	assert.Equal(t, map[string][]string{
+		StatusTodo:       {"A"},
+		StatusInProgress: {"B", "D"},
+		StatusDone:       {"C"},
+	}, columns)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos?status=in_progress", nil))
+
+	var response PaginatedResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.TotalItems)
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	todosBucket   = []byte("todos")
+	indexesBucket = []byte("indexes")
+)
+
+// indexedFields lists the secondary indexes maintained alongside the todos
+// bucket. Each index is a nested bucket under "indexes" whose keys are
+// value + 0x00 + todo key, so all todos sharing a value are contiguous and
+// ordered by ID.
+var indexedFields = map[string]func(Todo) []string{
+	"completed": func(t Todo) []string { return []string{strconv.FormatBool(t.Completed)} },
+	"status":    func(t Todo) []string { return []string{todoStatus(t)} },
+	"assignee":  func(t Todo) []string { return []string{t.Assignee} },
+	"creator":   func(t Todo) []string { return []string{t.CreatedBy} },
+	"position":  func(t Todo) []string { return []string{t.Position} },
+	"starred":   func(t Todo) []string { return []string{strconv.FormatBool(t.Starred)} },
+	"priority":  func(t Todo) []string { return []string{t.Priority} },
+	"due":       func(t Todo) []string { return []string{t.DueDate} },
+	"tag":       func(t Todo) []string { return t.Tags },
+}
+
+// writeTx runs a write transaction for request handlers. With WRITE_BATCHING
+// enabled, concurrent writes are coalesced into shared commits via db.Batch,
+// so fn may run more than once and must not have side effects outside tx.
+// Each call is measured for load shedding.
+func writeTx(fn func(*bolt.Tx) error) error {
+	writes.inFlight.Add(1)
+	start := time.Now()
+	defer func() {
+		writes.observe(time.Since(start), clock.Now())
+		writes.inFlight.Add(-1)
+	}()
+	if config.WriteBatching {
+		return db.Batch(fn)
+	}
+	return db.Update(fn)
+}
+
+func ensureBuckets(tx *bolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(todosBucket); err != nil {
+		return err
+	}
+
+	for _, name := range [][]byte{blockedByBucket, blockingBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(savedFiltersBucket); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(commentsBucket); err != nil {
+		return err
+	}
+
+	for _, name := range [][]byte{attachmentsBucket, attachmentBlobsBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range [][]byte{userExportsBucket, exportJobsBucket, importJobsBucket, importStagingBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range [][]byte{deletionTokensBucket, accountDeletionsBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(watchersBucket); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(preferencesBucket); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(achievementsBucket); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(feedTokensBucket); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(inboundHooksBucket); err != nil {
+		return err
+	}
+
+	for _, name := range [][]byte{caldavNamesBucket, caldavObjectsBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range [][]byte{smsRemindedBucket, smsMessagesBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(integrationsBucket); err != nil {
+		return err
+	}
+
+	for _, name := range [][]byte{syncMetaBucket, cdcConsumersBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	if tx.Bucket(changesBucket) == nil {
+		if _, err := tx.CreateBucket(changesBucket); err != nil {
+			return err
+		}
+		if err := backfillChanges(tx); err != nil {
+			return err
+		}
+	}
+
+	indexes, err := tx.CreateBucketIfNotExists(indexesBucket)
+	if err != nil {
+		return err
+	}
+
+	if indexes.Bucket([]byte("position")) == nil {
+		if err := backfillPositions(tx); err != nil {
+			return err
+		}
+	}
+
+	rebuild := false
+	for field := range indexedFields {
+		if indexes.Bucket([]byte(field)) == nil {
+			rebuild = true
+		}
+	}
+	if rebuild {
+		return rebuildIndexes(tx)
+	}
+	return nil
+}
+
+// rebuildIndexes recreates every index from the todos bucket. It runs when a
+// database predates an index.
+func rebuildIndexes(tx *bolt.Tx) error {
+	if err := tx.DeleteBucket(indexesBucket); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	indexes, err := tx.CreateBucket(indexesBucket)
+	if err != nil {
+		return err
+	}
+	for field := range indexedFields {
+		if _, err := indexes.CreateBucket([]byte(field)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket(todosBucket).ForEach(func(k, v []byte) error {
+		var todo Todo
+		if err := codec.Unmarshal(v, &todo); err != nil {
+			return err
+		}
+		return updateIndexes(tx, k, nil, &todo)
+	})
+}
+
+func indexKey(value string, key []byte) []byte {
+	return append(append([]byte(value), 0), key...)
+}
+
+func indexPrefix(value string) []byte {
+	return append([]byte(value), 0)
+}
+
+func updateIndexes(tx *bolt.Tx, key []byte, before, after *Todo) error {
+	indexes := tx.Bucket(indexesBucket)
+	for field, values := range indexedFields {
+		b := indexes.Bucket([]byte(field))
+		if before != nil {
+			for _, value := range values(*before) {
+				if err := b.Delete(indexKey(value, key)); err != nil {
+					return err
+				}
+			}
+		}
+		if after != nil {
+			for _, value := range values(*after) {
+				if err := b.Put(indexKey(value, key), nil); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func loadTodo(tx *bolt.Tx, id int) (*Todo, error) {
+	v := tx.Bucket(todosBucket).Get(itob(id))
+	if v == nil {
+		return nil, nil
+	}
+	var todo Todo
+	if err := codec.Unmarshal(v, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// putTodo writes a todo and keeps its index entries and change feed in the
+// same transaction. A todo without a position is given one at the end of the
+// list. A todo keeps its creator, and a new one must fit in its creator's
+// QUOTA_TODOS. A created or updated event is published once the transaction
+// commits.
+func putTodo(tx *bolt.Tx, todo *Todo) error {
+	key := itob(todo.ID)
+	normalizeTodo(todo)
+	if todo.Position == "" {
+		todo.Position = positionBetween(lastPositionExcept(tx, todo.ID), "")
+	}
+
+	old, err := loadTodo(tx, todo.ID)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		todo.CreatedBy = old.CreatedBy
+	} else if err := checkTodoQuota(tx, *todo); err != nil {
+		return err
+	}
+
+	buf, err := codec.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(todosBucket).Put(key, buf); err != nil {
+		return err
+	}
+
+	if err := updateIndexes(tx, key, old, todo); err != nil {
+		return err
+	}
+
+	eventType := EventTodoUpdated
+	if old == nil {
+		eventType = EventTodoCreated
+	}
+	saved := *todo
+	if err := recordChange(tx, eventType, saved); err != nil {
+		return err
+	}
+	tx.OnCommit(func() { events.publish(Event{Type: eventType, Todo: saved, Previous: old}) })
+	return nil
+}
+
+func removeTodo(tx *bolt.Tx, id int) error {
+	old, err := loadTodo(tx, id)
+	if err != nil || old == nil {
+		return err
+	}
+
+	key := itob(id)
+	if err := tx.Bucket(todosBucket).Delete(key); err != nil {
+		return err
+	}
+
+	if err := updateIndexes(tx, key, old, nil); err != nil {
+		return err
+	}
+
+	if err := deleteComments(tx, key); err != nil {
+		return err
+	}
+
+	if err := deleteAttachments(tx, key); err != nil {
+		return err
+	}
+
+	if err := removeDependencies(tx, id); err != nil {
+		return err
+	}
+
+	if err := forgetCalDAVObject(tx, key); err != nil {
+		return err
+	}
+
+	if err := recordChange(tx, EventTodoDeleted, *old); err != nil {
+		return err
+	}
+
+	tx.OnCommit(func() { events.publish(Event{Type: EventTodoDeleted, Todo: *old}) })
+	return nil
+}
+
+// listIterator is what listPage pages through.
+type listIterator interface {
+	first() ([]byte, []byte)
+	seek(key []byte) ([]byte, []byte)
+	seekAfter(cursor []byte) ([]byte, []byte)
+	next() ([]byte, []byte)
+	count() int
+	cursor(key []byte) []byte
+}
+
+// indexFilter restricts an iteration to todos whose indexed field has value.
+type indexFilter struct {
+	field string
+	value string
+}
+
+// todoIterator walks todos in ID order, either over the whole bucket or over
+// the entries of one index value, or in the order of an index's values when
+// orderBy is set. Further filters are checked by looking the key up in their
+// index, so matching never decodes a todo.
+type todoIterator struct {
+	todos   *bolt.Bucket
+	c       *bolt.Cursor
+	prefix  []byte
+	orderBy string
+	indexes *bolt.Bucket
+	filters []indexFilter
+}
+
+func newTodoIterator(tx *bolt.Tx) *todoIterator {
+	b := tx.Bucket(todosBucket)
+	return &todoIterator{todos: b, c: b.Cursor(), indexes: tx.Bucket(indexesBucket)}
+}
+
+func newIndexIterator(tx *bolt.Tx, field, value string) *todoIterator {
+	indexes := tx.Bucket(indexesBucket)
+	return &todoIterator{
+		todos:   tx.Bucket(todosBucket),
+		c:       indexes.Bucket([]byte(field)).Cursor(),
+		prefix:  indexPrefix(value),
+		indexes: indexes,
+	}
+}
+
+// newOrderedIterator walks every todo sorted by an indexed field, then ID.
+func newOrderedIterator(tx *bolt.Tx, field string) *todoIterator {
+	indexes := tx.Bucket(indexesBucket)
+	return &todoIterator{
+		todos:   tx.Bucket(todosBucket),
+		c:       indexes.Bucket([]byte(field)).Cursor(),
+		prefix:  []byte{},
+		orderBy: field,
+		indexes: indexes,
+	}
+}
+
+// newFilteredIterator walks the todos matching every filter. The first filter
+// drives the cursor; the rest are checked per key.
+func newFilteredIterator(tx *bolt.Tx, filters []indexFilter) *todoIterator {
+	if len(filters) == 0 {
+		return newTodoIterator(tx)
+	}
+	it := newIndexIterator(tx, filters[0].field, filters[0].value)
+	it.filters = filters[1:]
+	return it
+}
+
+// filterKey renders filters as a query string, for cache keys.
+func filterKey(filters []indexFilter) string {
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		parts[i] = url.QueryEscape(f.field) + "=" + url.QueryEscape(f.value)
+	}
+	return strings.Join(parts, "&")
+}
+
+func (it *todoIterator) matches(key []byte) bool {
+	for _, f := range it.filters {
+		if it.indexes.Bucket([]byte(f.field)).Get(indexKey(f.value, key)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (it *todoIterator) resolve(k []byte) ([]byte, []byte) {
+	if k == nil || !bytes.HasPrefix(k, it.prefix) {
+		return nil, nil
+	}
+	key := it.todoKey(k)
+	return key, it.todos.Get(key)
+}
+
+// todoKey extracts the todo key from an index key.
+func (it *todoIterator) todoKey(k []byte) []byte {
+	if it.orderBy != "" {
+		return k[bytes.IndexByte(k, 0)+1:]
+	}
+	return k[len(it.prefix):]
+}
+
+// target returns the cursor key of the todo with the given key. Ordered
+// iterators have to look up the todo's value for the ordering field.
+func (it *todoIterator) target(key []byte) []byte {
+	if it.orderBy == "" {
+		return append(append([]byte{}, it.prefix...), key...)
+	}
+	v := it.todos.Get(key)
+	if v == nil {
+		return nil
+	}
+	var todo Todo
+	if err := codec.Unmarshal(v, &todo); err != nil {
+		return nil
+	}
+	return indexKey(indexedFields[it.orderBy](todo)[0], key)
+}
+
+// skip advances past todos rejected by the extra filters.
+func (it *todoIterator) skip(k, v []byte) ([]byte, []byte) {
+	for k != nil && !it.matches(k) {
+		k, v = it.advance()
+	}
+	return k, v
+}
+
+func (it *todoIterator) advance() ([]byte, []byte) {
+	k, v := it.c.Next()
+	if it.prefix == nil {
+		return k, v
+	}
+	return it.resolve(k)
+}
+
+func (it *todoIterator) first() ([]byte, []byte) {
+	if it.prefix == nil {
+		return it.skip(it.c.First())
+	}
+	k, _ := it.c.Seek(it.prefix)
+	return it.skip(it.resolve(k))
+}
+
+// seek positions the iterator on the todo with the given key, or the next one
+// after it.
+func (it *todoIterator) seek(key []byte) ([]byte, []byte) {
+	if it.prefix == nil {
+		return it.skip(it.c.Seek(key))
+	}
+	target := it.target(key)
+	if target == nil {
+		return nil, nil
+	}
+	k, _ := it.c.Seek(target)
+	return it.skip(it.resolve(k))
+}
+
+// seekAfter positions the iterator on the first todo whose key is greater
+// than key.
+func (it *todoIterator) seekAfter(key []byte) ([]byte, []byte) {
+	target := key
+	switch {
+	case it.orderBy != "" && len(key) > 8:
+		// Already an index entry, from cursor.
+	case it.prefix != nil:
+		if target = it.target(key); target == nil {
+			return nil, nil
+		}
+	}
+
+	k, v := it.c.Seek(target)
+	if k != nil && bytes.Equal(k, target) {
+		k, v = it.c.Next()
+	}
+	if it.prefix == nil {
+		return it.skip(k, v)
+	}
+	return it.skip(it.resolve(k))
+}
+
+func (it *todoIterator) next() ([]byte, []byte) {
+	return it.skip(it.advance())
+}
+
+// cursor returns the token seekAfter resumes from. Ordered iterators resume
+// from the index entry, so the cursor stays usable once its todo is gone.
+func (it *todoIterator) cursor(key []byte) []byte {
+	if it.orderBy == "" {
+		return key
+	}
+	return it.target(key)
+}
+
+// contains reports whether the todo with the given key is part of the
+// iteration.
+func (it *todoIterator) contains(key []byte) bool {
+	if it.prefix == nil || it.orderBy != "" {
+		return it.todos.Get(key) != nil && it.matches(key)
+	}
+	return it.c.Bucket().Get(append(append([]byte{}, it.prefix...), key...)) != nil && it.matches(key)
+}
+
+func (it *todoIterator) count() int {
+	if (it.prefix == nil || it.orderBy != "") && len(it.filters) == 0 {
+		return it.todos.Stats().KeyN
+	}
+	n := 0
+	c := it.c.Bucket().Cursor()
+	for k, _ := c.Seek(it.prefix); k != nil && bytes.HasPrefix(k, it.prefix); k, _ = c.Next() {
+		if it.matches(it.todoKey(k)) {
+			n++
+		}
+	}
+	return n
+}
+
+// chainIterator walks several iterators one after the other, such as
+// starred todos before the rest. Its cursors are prefixed with the number of
+// the segment they point into.
+type chainIterator struct {
+	segments []*todoIterator
+	cur      int
+	total    func() int
+}
+
+// newStarredFirstIterator walks the todos matching filters, starred ones
+// first, each group in ID order.
+func newStarredFirstIterator(tx *bolt.Tx, filters []indexFilter) *chainIterator {
+	it := &chainIterator{total: newFilteredIterator(tx, filters).count}
+	for _, starred := range []string{"true", "false"} {
+		segment := append(append([]indexFilter{}, filters...), indexFilter{"starred", starred})
+		it.segments = append(it.segments, newFilteredIterator(tx, segment))
+	}
+	return it
+}
+
+// continueFrom moves on to later segments once the current one runs out.
+func (it *chainIterator) continueFrom(k, v []byte) ([]byte, []byte) {
+	for k == nil && it.cur+1 < len(it.segments) {
+		it.cur++
+		k, v = it.segments[it.cur].first()
+	}
+	return k, v
+}
+
+func (it *chainIterator) first() ([]byte, []byte) {
+	it.cur = 0
+	return it.continueFrom(it.segments[0].first())
+}
+
+func (it *chainIterator) seek(key []byte) ([]byte, []byte) {
+	it.cur = it.segmentOf(key)
+	return it.continueFrom(it.segments[it.cur].seek(key))
+}
+
+func (it *chainIterator) seekAfter(cursor []byte) ([]byte, []byte) {
+	key := cursor
+	if len(cursor) == 9 && int(cursor[0]) < len(it.segments) {
+		it.cur, key = int(cursor[0]), cursor[1:]
+	} else {
+		it.cur = it.segmentOf(key)
+	}
+	return it.continueFrom(it.segments[it.cur].seekAfter(key))
+}
+
+func (it *chainIterator) next() ([]byte, []byte) {
+	return it.continueFrom(it.segments[it.cur].next())
+}
+
+func (it *chainIterator) count() int {
+	return it.total()
+}
+
+func (it *chainIterator) cursor(key []byte) []byte {
+	return append([]byte{byte(it.cur)}, it.segments[it.cur].cursor(key)...)
+}
+
+// segmentOf finds the segment holding key, defaulting to the last one for
+// todos that no longer exist.
+func (it *chainIterator) segmentOf(key []byte) int {
+	for i, segment := range it.segments {
+		if segment.contains(key) {
+			return i
+		}
+	}
+	return len(it.segments) - 1
+}
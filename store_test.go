@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func indexEntries(t *testing.T, field, value string) []int {
+	var ids []int
+	err := db.View(func(tx *bolt.Tx) error {
+		it := newIndexIterator(tx, field, value)
+		for k, _ := it.first(); k != nil; k, _ = it.next() {
+			ids = append(ids, int(k[7]))
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return ids
+}
+
+func TestIndexesFollowWrites(t *testing.T) {
+	clearBucket(t)
+
+	for _, todo := range []Todo{{Title: "A"}, {Title: "B", Completed: true}, {Title: "C"}} {
+		payload, _ := json.Marshal(todo)
+		req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+		createTodo(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, []int{1, 3}, indexEntries(t, "completed", "false"))
+	assert.Equal(t, []int{2}, indexEntries(t, "completed", "true"))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/todos/{id}", updateTodo).Methods("PUT")
+	router.HandleFunc("/todos/{id}", deleteTodo).Methods("DELETE")
+
+	payload, _ := json.Marshal(Todo{Title: "A", Completed: true})
+	req := httptest.NewRequest(http.MethodPut, "/todos/1", bytes.NewBuffer(payload))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []int{3}, indexEntries(t, "completed", "false"))
+	assert.Equal(t, []int{1, 2}, indexEntries(t, "completed", "true"))
+
+	req = httptest.NewRequest(http.MethodDelete, "/todos/2", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []int{1}, indexEntries(t, "completed", "true"))
+}
+
+func TestEnsureBucketsRebuildsMissingIndexes(t *testing.T) {
+	clearBucket(t)
+
+	// Simulate a database written before indexes existed
+	err := db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(indexesBucket); err != nil {
+			return err
+		}
+		b := tx.Bucket(todosBucket)
+		for i, completed := range []bool{false, true, true} {
+			buf, _ := json.Marshal(Todo{ID: i + 1, Title: "Legacy", Completed: completed})
+			if err := b.Put(itob(i+1), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(ensureBuckets)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int{1}, indexEntries(t, "completed", "false"))
+	assert.Equal(t, []int{2, 3}, indexEntries(t, "completed", "true"))
+}
+
+func TestGetTodosCompletedFilter(t *testing.T) {
+	clearBucket(t)
+
+	for i := 1; i <= 6; i++ {
+		payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Todo %d", i), Completed: i%2 == 0})
+		req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+		createTodo(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedIDs    []int
+		expectedTotal  int
+	}{
+		{
+			name:           "completed",
+			url:            "/todos?completed=true",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{2, 4, 6},
+			expectedTotal:  3,
+		},
+		{
+			name:           "open second page",
+			url:            "/todos?completed=false&page=2&limit=2",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{5},
+			expectedTotal:  3,
+		},
+		{
+			name:           "open after cursor",
+			url:            "/todos?completed=false&limit=1&cursor=" + encodeCursor(itob(1)),
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{3},
+			expectedTotal:  3,
+		},
+		{
+			name:           "invalid filter",
+			url:            "/todos?completed=maybe",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			getTodos(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response PaginatedResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			var ids []int
+			for _, todo := range response.Items {
+				ids = append(ids, todo.ID)
+			}
+			assert.Equal(t, tt.expectedIDs, ids)
+			assert.Equal(t, tt.expectedTotal, response.TotalItems)
+		})
+	}
+}
+
+func TestGetTodosAssigneeFilter(t *testing.T) {
+	clearBucket(t)
+
+	for _, todo := range []Todo{
+		{Title: "A", Assignee: "alice"},
+		{Title: "B", Assignee: "bob"},
+		{Title: "C", Assignee: "alice", Completed: true},
+		{Title: "D"},
+	} {
+		payload, _ := json.Marshal(todo)
+		req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+		createTodo(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		user           string
+		expectedStatus int
+		expectedIDs    []int
+	}{
+		{
+			name:           "by name",
+			url:            "/todos?assignee=bob",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{2},
+		},
+		{
+			name:           "me",
+			url:            "/todos?assignee=me",
+			user:           "alice",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{1, 3},
+		},
+		{
+			name:           "combined with completed",
+			url:            "/todos?assignee=me&completed=false",
+			user:           "alice",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{1},
+		},
+		{
+			name:           "me without user header",
+			url:            "/todos?assignee=me",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.user != "" {
+				req.Header.Set(userHeader, tt.user)
+			}
+			w := httptest.NewRecorder()
+
+			getTodos(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response PaginatedResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			var ids []int
+			for _, todo := range response.Items {
+				ids = append(ids, todo.ID)
+			}
+			assert.Equal(t, tt.expectedIDs, ids)
+			assert.Equal(t, len(tt.expectedIDs), response.TotalItems)
+		})
+	}
+}
+
+func TestWriteBatchingConcurrentCreates(t *testing.T) {
+	clearBucket(t)
+
+	previous := config.WriteBatching
+	config.WriteBatching = true
+	t.Cleanup(func() { config.WriteBatching = previous })
+
+	const writers = 50
+	var wg sync.WaitGroup
+	ids := make(chan int, writers)
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload, _ := json.Marshal(Todo{Title: fmt.Sprintf("Batched %d", i)})
+			req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload))
+			w := httptest.NewRecorder()
+			createTodo(w, req)
+
+			var created Todo
+			json.Unmarshal(w.Body.Bytes(), &created)
+			ids <- created.ID
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+
+	unique := make(map[int]bool)
+	for id := range ids {
+		unique[id] = true
+	}
+	assert.Len(t, unique, writers)
+	assert.Len(t, indexEntries(t, "completed", "false"), writers)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	changesBucket  = []byte("changes")
+	syncMetaBucket = []byte("syncMeta")
+
+	// compactedThroughKey holds the highest sequence number of a tombstone
+	// removed by compaction. Tokens older than it may have missed a deletion.
+	compactedThroughKey = []byte("compactedThrough")
+)
+
+const changeCompactionInterval = time.Hour
+
+var errResyncRequired = errors.New("sync token predates compacted changes")
+
+// Change is one entry of the change feed. Deletions are tombstones: they
+// carry only the ID of the removed todo.
+type Change struct {
+	Seq  uint64    `json:"seq"`
+	Type string    `json:"type"`
+	ID   int       `json:"id"`
+	Todo *Todo     `json:"todo,omitempty"`
+	At   time.Time `json:"at"`
+}
+
+type ChangesResponse struct {
+	Changes   []Change `json:"changes"`
+	SyncToken string   `json:"syncToken"`
+	HasMore   bool     `json:"hasMore"`
+}
+
+// recordChange appends a change to the feed in the same transaction as the
+// write it describes, so the feed never misses or invents a change.
+func recordChange(tx *bolt.Tx, eventType string, todo Todo) error {
+	b := tx.Bucket(changesBucket)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	change := Change{Seq: seq, Type: eventType, ID: todo.ID, At: clock.Now().UTC()}
+	if eventType != EventTodoDeleted {
+		change.Todo = &todo
+	}
+	buf, err := codec.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return b.Put(itob(int(seq)), buf)
+}
+
+// backfillChanges records a creation for every stored todo. It runs when a
+// database predates the change feed, so a first sync still sees everything.
+func backfillChanges(tx *bolt.Tx) error {
+	return tx.Bucket(todosBucket).ForEach(func(k, v []byte) error {
+		var todo Todo
+		if err := codec.Unmarshal(v, &todo); err != nil {
+			return err
+		}
+		return recordChange(tx, EventTodoCreated, todo)
+	})
+}
+
+// compactChanges drops change records older than cutoff that a client can do
+// without: tombstones, and records superseded by a later change to the same
+// todo. What remains still replays to the current state, so a sync without a
+// token is always complete. Records a CDC consumer hasn't processed yet are
+// kept.
+func compactChanges(tx *bolt.Tx, cutoff time.Time) (int, error) {
+	b := tx.Bucket(changesBucket)
+	floor, err := cdcFloor(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	latest := make(map[int]uint64)
+	err = b.ForEach(func(k, v []byte) error {
+		var change Change
+		if err := codec.Unmarshal(v, &change); err != nil {
+			return err
+		}
+		latest[change.ID] = change.Seq
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var stale [][]byte
+	var through, pruned uint64
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var change Change
+		if err := codec.Unmarshal(v, &change); err != nil {
+			return 0, err
+		}
+		if !change.At.Before(cutoff) || change.Seq > floor {
+			break
+		}
+		if change.Type == EventTodoDeleted {
+			through = change.Seq
+		} else if latest[change.ID] == change.Seq {
+			continue
+		}
+		stale = append(stale, k)
+		pruned = change.Seq
+	}
+
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	if through > compactedThrough(tx) {
+		if err := tx.Bucket(syncMetaBucket).Put(compactedThroughKey, itob(int(through))); err != nil {
+			return 0, err
+		}
+	}
+	if pruned > prunedThrough(tx) {
+		if err := tx.Bucket(syncMetaBucket).Put(prunedThroughKey, itob(int(pruned))); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+func compactedThrough(tx *bolt.Tx) uint64 {
+	v := tx.Bucket(syncMetaBucket).Get(compactedThroughKey)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// compactChangeFeed compacts the change feed, keeping records for at least
+// CHANGE_RETENTION.
+func compactChangeFeed(now time.Time) error {
+	var removed int
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		removed, err = compactChanges(tx, now.Add(-config.ChangeRetention))
+		return err
+	})
+	if err == nil && removed > 0 {
+		infof("change feed compaction removed %d records", removed)
+	}
+	return err
+}
+
+// getChanges returns the changes recorded after the since token. Clients
+// start without a token, apply each page in order and send back the returned
+// syncToken until hasMore is false. A token that predates compacted
+// tombstones gets 410 Gone: the client must discard its copy and sync again
+// without a token.
+func getChanges(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	var since []byte
+	if token := r.URL.Query().Get("since"); token != "" {
+		var err error
+		if since, err = decodeCursor(token); err != nil {
+			http.Error(w, "Invalid sync token", http.StatusBadRequest)
+			return
+		}
+	}
+
+	response := ChangesResponse{Changes: []Change{}}
+	err := timedView(r, func(tx *bolt.Tx) error {
+		b := tx.Bucket(changesBucket)
+		c := b.Cursor()
+
+		// With no changes to report the token stays where the client is.
+		last := since
+		if last == nil {
+			last = itob(0)
+		}
+
+		if since != nil && binary.BigEndian.Uint64(since) < compactedThrough(tx) {
+			return errResyncRequired
+		}
+
+		k, v := c.First()
+		if since != nil {
+			k, v = c.Seek(since)
+			if k != nil && bytes.Equal(k, since) {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = c.Next() {
+			if len(response.Changes) == limit {
+				response.HasMore = true
+				break
+			}
+			var change Change
+			if err := codec.Unmarshal(v, &change); err != nil {
+				return err
+			}
+			response.Changes = append(response.Changes, change)
+			last = k
+		}
+
+		response.SyncToken = encodeCursor(last)
+		return nil
+	})
+	if err == errResyncRequired {
+		http.Error(w, "Sync token expired; resync required", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	codec.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func fetchChanges(t *testing.T, url string) ChangesResponse {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	w := httptest.NewRecorder()
+
+	getChanges(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response ChangesResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+// recordSampleChanges creates two todos, completes the first and deletes the
+// second, leaving four entries in the change feed.
+func recordSampleChanges() {
+	for _, title := range []string{"Keep", "Drop"} {
+		payload, _ := json.Marshal(Todo{Title: title})
+		createTodo(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	payload, _ := json.Marshal(Todo{Title: "Keep", Completed: true})
+	req := httptest.NewRequest(http.MethodPut, "/todos/1", bytes.NewBuffer(payload))
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	updateTodo(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodDelete, "/todos/2", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	deleteTodo(httptest.NewRecorder(), req)
+}
+
+func TestGetChanges(t *testing.T) {
+	clearBucket(t)
+	recordSampleChanges()
+
+	first := fetchChanges(t, "/todos/changes?limit=3")
+	assert.True(t, first.HasMore)
+	assert.Len(t, first.Changes, 3)
+	assert.Equal(t, EventTodoCreated, first.Changes[0].Type)
+	assert.Equal(t, EventTodoUpdated, first.Changes[2].Type)
+	assert.True(t, first.Changes[2].Todo.Completed)
+
+	second := fetchChanges(t, "/todos/changes?limit=3&since="+first.SyncToken)
+	assert.False(t, second.HasMore)
+	assert.Len(t, second.Changes, 1)
+	assert.Equal(t, uint64(4), second.Changes[0].Seq)
+	assert.Equal(t, EventTodoDeleted, second.Changes[0].Type)
+	assert.Nil(t, second.Changes[0].Todo)
+
+	caughtUp := fetchChanges(t, "/todos/changes?since="+second.SyncToken)
+	assert.Empty(t, caughtUp.Changes)
+	assert.Equal(t, second.SyncToken, caughtUp.SyncToken)
+}
+
+func TestGetChangesInvalidToken(t *testing.T) {
+	clearBucket(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/todos/changes?since=bogus", nil)
+	w := httptest.NewRecorder()
+
+	getChanges(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCompactChanges(t *testing.T) {
+	clearBucket(t)
+	recordSampleChanges()
+
+	var removed int
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		removed, err = compactChanges(tx, time.Now().Add(time.Minute))
+		return err
+	})
+	assert.NoError(t, err)
+	// Both creations are superseded and the tombstone is past retention.
+	assert.Equal(t, 3, removed)
+
+	full := fetchChanges(t, "/todos/changes")
+	assert.Len(t, full.Changes, 1)
+	assert.Equal(t, EventTodoUpdated, full.Changes[0].Type)
+
+	tests := []struct {
+		name           string
+		since          uint64
+		expectedStatus int
+	}{
+		{
+			name:           "token before compacted tombstone",
+			since:          2,
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:           "token after compacted tombstone",
+			since:          4,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/todos/changes?since="+encodeCursor(itob(int(tt.since))), nil)
+			w := httptest.NewRecorder()
+
+			getChanges(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
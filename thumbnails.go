@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// maxThumbnailPixels guards against decompression bombs: larger images get
+// no thumbnails.
+const maxThumbnailPixels = 50_000_000
+
+var errImageTooLarge = errors.New("image too large for thumbnails")
+
+func thumbnailKey(blob, size string) string {
+	return blob + "-" + size
+}
+
+// canThumbnail reports whether thumbnails can be made of a media type.
+func canThumbnail(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// thumbnailType is the media type thumbnails of an image are encoded as:
+// JPEG for photos, PNG for everything else so transparency survives.
+func thumbnailType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// makeThumbnail scales an image down to fit a square of side pixels,
+// keeping its aspect ratio. Smaller images are only re-encoded.
+func makeThumbnail(data []byte, side int) ([]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxThumbnailPixels {
+		return nil, errImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, scaleDown(src, side), &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, scaleDown(src, side))
+	}
+	return buf.Bytes(), err
+}
+
+// scaleDown shrinks an image to fit a square of side pixels by averaging
+// the source pixels each thumbnail pixel covers.
+func scaleDown(src image.Image, side int) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw <= side && sh <= side {
+		return src
+	}
+	w, h := side, side
+	if sw >= sh {
+		h = max(1, sh*side/sw)
+	} else {
+		w = max(1, sw*side/sh)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max((y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max((x+1)*sw/w, x0+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := range sum {
+						sum[c] += int(rgba.Pix[i+c])
+					}
+					i += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			j := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[j+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// createThumbnails stores a thumbnail of an uploaded image for every size
+// in THUMBNAIL_SIZES and returns the sizes made. An image that can't be
+// thumbnailed is still accepted, just without thumbnails.
+func createThumbnails(blob, contentType string, data []byte) []string {
+	if !canThumbnail(contentType) {
+		return nil
+	}
+	sizes := make([]string, 0, len(config.ThumbnailSizes))
+	for size := range config.ThumbnailSizes {
+		sizes = append(sizes, size)
+	}
+	sort.Strings(sizes)
+
+	var made []string
+	for _, size := range sizes {
+		thumbnail, err := makeThumbnail(data, config.ThumbnailSizes[size])
+		if err == nil {
+			err = blobs.put(thumbnailKey(blob, size), thumbnail)
+		}
+		if err != nil {
+			warnf("making %s thumbnail of blob %s: %v", size, blob, err)
+			break
+		}
+		made = append(made, size)
+	}
+	return made
+}
+
+// getThumbnail serves a thumbnail of an image attachment. Thumbnails of
+// sizes added to THUMBNAIL_SIZES after the upload are made on first request
+// and kept.
+func getThumbnail(w http.ResponseWriter, attachment storedAttachment, size string) {
+	side, ok := config.ThumbnailSizes[size]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown thumbnail size %q", size), http.StatusBadRequest)
+		return
+	}
+	if !canThumbnail(attachment.ContentType) {
+		http.Error(w, "Attachment has no thumbnails", http.StatusNotFound)
+		return
+	}
+
+	data, err := blobs.get(thumbnailKey(attachment.Blob, size))
+	if err == errBlobNotFound {
+		data, err = addThumbnail(attachment, size, side)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", thumbnailType(attachment.ContentType))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+func addThumbnail(attachment storedAttachment, size string, side int) ([]byte, error) {
+	original, err := blobs.get(attachment.Blob)
+	if err != nil {
+		return nil, err
+	}
+	data, err := makeThumbnail(original, side)
+	if err != nil {
+		return nil, err
+	}
+	key := thumbnailKey(attachment.Blob, size)
+	if err := blobs.put(key, data); err != nil {
+		return nil, err
+	}
+
+	err = writeTx(func(tx *bolt.Tx) error {
+		stored, err := loadAttachment(tx, attachment.TodoID, attachment.ID)
+		if err != nil || slices.Contains(stored.Thumbnails, size) {
+			return err
+		}
+		stored.Thumbnails = append(stored.Thumbnails, size)
+		buf, err := codec.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		b, _ := todoAttachments(tx, attachment.TodoID, false)
+		return b.Put(itob(stored.ID), buf)
+	})
+	if err != nil {
+		deleteBlobs([]string{key})
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestScaleDown(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		side          int
+		want          image.Point
+	}{
+		{"landscape", 600, 300, 256, image.Pt(256, 128)},
+		{"portrait", 300, 600, 256, image.Pt(128, 256)},
+		{"small", 100, 50, 256, image.Pt(100, 50)},
+		{"sliver", 1000, 2, 100, image.Pt(100, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+			assert.Equal(t, tt.want, scaleDown(src, tt.side).Bounds().Size())
+		})
+	}
+
+	// Each thumbnail pixel averages the pixels it covers.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, color.RGBA{A: 255})
+	src.Set(1, 0, color.RGBA{R: 200, A: 255})
+	src.Set(0, 1, color.RGBA{G: 100, A: 255})
+	src.Set(1, 1, color.RGBA{B: 40, A: 255})
+	assert.Equal(t, color.RGBA{R: 50, G: 25, B: 10, A: 255}, scaleDown(src, 1).At(0, 0))
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	data, err := makeThumbnail(encodePNG(t, 64, 32), 16)
+	assert.NoError(t, err)
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, 16, cfg.Width)
+	assert.Equal(t, 8, cfg.Height)
+
+	_, err = makeThumbnail(pngHeader, 16)
+	assert.Error(t, err)
+}
+
+func TestAttachmentThumbnails(t *testing.T) {
+	clearBucket(t)
+	withAttachmentLimits(t)
+	config.AttachmentMaxSize = 1 << 20
+	router := setupRouter()
+	todo := saveTodo(t, Todo{Title: "Paint the fence"})
+	url := "/todos/" + strconv.Itoa(todo.ID) + "/attachments"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(url, "file", "fence.png", encodePNG(t, 64, 32)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var attachment Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &attachment))
+	assert.Equal(t, []string{"thumb"}, attachment.Thumbnails)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(url, "file", "notes.txt", []byte("two coats")))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	thumbnailSize := func(url string) image.Point {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		cfg, _, err := image.DecodeConfig(w.Body)
+		assert.NoError(t, err)
+		return image.Pt(cfg.Width, cfg.Height)
+	}
+	assert.Equal(t, image.Pt(16, 8), thumbnailSize(url+"/1?size=thumb"))
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{"unknown size", url + "/1?size=huge", http.StatusBadRequest},
+		{"not an image", url + "/2?size=thumb", http.StatusNotFound},
+		{"original", url + "/1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	// Sizes configured after the upload are made when first asked for.
+	config.ThumbnailSizes["small"] = 8
+	assert.Equal(t, image.Pt(8, 4), thumbnailSize(url+"/1?size=small"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	var attachments []Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &attachments))
+	assert.Equal(t, []string{"thumb", "small"}, attachments[0].Thumbnails)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	keyUp = iota + 256
+	keyDown
+	keyEnter
+	keyEscape
+	keyBackspace
+)
+
+type tuiMode int
+
+const (
+	tuiBrowse tuiMode = iota
+	tuiAdding
+)
+
+// tuiModel holds the terminal UI state. Keys are applied with handleKey and
+// the screen is produced by render, so the model can be driven without a
+// real terminal.
+type tuiModel struct {
+	client *Client
+	todos  []Todo
+	cursor int
+	mode   tuiMode
+	input  string
+	status string
+	quit   bool
+}
+
+func newTUIModel(c *Client) *tuiModel {
+	m := &tuiModel{client: c}
+	m.refresh()
+	return m
+}
+
+func (m *tuiModel) refresh() {
+	todos, err := m.client.ListAll()
+	if err != nil {
+		m.status = "error: " + err.Error()
+		return
+	}
+	m.todos = todos
+	if m.cursor >= len(m.todos) {
+		m.cursor = len(m.todos) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+func (m *tuiModel) handleKey(key int) {
+	m.status = ""
+
+	if m.mode == tuiAdding {
+		m.handleInputKey(key)
+		return
+	}
+
+	switch key {
+	case 'q':
+		m.quit = true
+	case 'j', keyDown:
+		if m.cursor < len(m.todos)-1 {
+			m.cursor++
+		}
+	case 'k', keyUp:
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case ' ', 'x', keyEnter:
+		m.toggle()
+	case 'a':
+		m.mode = tuiAdding
+		m.input = ""
+	case 'd':
+		m.remove()
+	case 'r':
+		m.refresh()
+	}
+}
+
+func (m *tuiModel) handleInputKey(key int) {
+	switch key {
+	case keyEscape:
+		m.mode = tuiBrowse
+	case keyEnter:
+		m.mode = tuiBrowse
+		title := strings.TrimSpace(m.input)
+		if title == "" {
+			return
+		}
+		added, err := m.client.Add(title)
+		if err != nil {
+			m.status = "error: " + err.Error()
+			return
+		}
+		m.refresh()
+		// Others may have added todos meanwhile, so the new one is found
+		// by ID rather than assumed last.
+		for i, todo := range m.todos {
+			if todo.ID == added.ID {
+				m.cursor = i
+				break
+			}
+		}
+	case keyBackspace:
+		if len(m.input) > 0 {
+			runes := []rune(m.input)
+			m.input = string(runes[:len(runes)-1])
+		}
+	default:
+		// Bytes are appended as-is so multi-byte UTF-8 input survives.
+		if key >= 32 && key < 256 {
+			m.input += string([]byte{byte(key)})
+		}
+	}
+}
+
+func (m *tuiModel) toggle() {
+	if len(m.todos) == 0 {
+		return
+	}
+	todo := m.todos[m.cursor]
+	todo.Completed = !todo.Completed
+	updated, err := m.client.Update(todo)
+	if err != nil {
+		m.status = "error: " + err.Error()
+		return
+	}
+	m.todos[m.cursor] = *updated
+}
+
+func (m *tuiModel) remove() {
+	if len(m.todos) == 0 {
+		return
+	}
+	if err := m.client.Delete(m.todos[m.cursor].ID); err != nil {
+		m.status = "error: " + err.Error()
+		return
+	}
+	m.refresh()
+}
+
+func (m *tuiModel) render() string {
+	var sb strings.Builder
+	sb.WriteString("\x1b[H\x1b[2J")
+	sb.WriteString("Todos\r\n\r\n")
+
+	if len(m.todos) == 0 {
+		sb.WriteString("  (no todos)\r\n")
+	}
+	for i, todo := range m.todos {
+		pointer := "  "
+		if i == m.cursor {
+			pointer = "> "
+		}
+		mark := " "
+		if todo.Completed {
+			mark = "x"
+		}
+		fmt.Fprintf(&sb, "%s[%s] %s\r\n", pointer, mark, todo.Title)
+	}
+
+	sb.WriteString("\r\n")
+	if m.mode == tuiAdding {
+		fmt.Fprintf(&sb, "New todo: %s", m.input)
+	} else {
+		sb.WriteString("j/k move  space toggle  a add  d delete  r refresh  q quit")
+		if m.status != "" {
+			fmt.Fprintf(&sb, "\r\n%s", m.status)
+		}
+	}
+	return sb.String()
+}
+
+// readKey decodes a single keypress, including arrow key escape sequences.
+func readKey(r *bufio.Reader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch b {
+	case '\r', '\n':
+		return keyEnter, nil
+	case 127, 8:
+		return keyBackspace, nil
+	case 3:
+		return 'q', nil
+	case 27:
+		if r.Buffered() == 0 {
+			return keyEscape, nil
+		}
+		if next, _ := r.ReadByte(); next != '[' {
+			return keyEscape, nil
+		}
+		switch code, _ := r.ReadByte(); code {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		}
+		return keyEscape, nil
+	}
+	return int(b), nil
+}
+
+func runTUI(c *Client) error {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("--tui requires an interactive terminal")
+	}
+
+	state, err := stty("-g")
+	if err != nil {
+		return err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return err
+	}
+	defer stty(strings.TrimSpace(state))
+
+	return tuiLoop(newTUIModel(c), os.Stdin, os.Stdout)
+}
+
+// stty runs stty against the controlling terminal; it avoids pulling in a
+// terminal library just to toggle raw mode.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+func tuiLoop(m *tuiModel, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	for !m.quit {
+		io.WriteString(out, m.render())
+
+		key, err := readKey(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		m.handleKey(key)
+	}
+
+	io.WriteString(out, "\x1b[H\x1b[2J")
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func typeKeys(m *tuiModel, keys ...int) {
+	for _, key := range keys {
+		m.handleKey(key)
+	}
+}
+
+func typeText(m *tuiModel, text string) {
+	for _, b := range []byte(text) {
+		m.handleKey(int(b))
+	}
+}
+
+func TestTUIModel(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	m := newTUIModel(NewClient(server.URL, ""))
+	assert.Empty(t, m.todos)
+	assert.Contains(t, m.render(), "(no todos)")
+
+	// Quick add two todos
+	typeKeys(m, 'a')
+	typeText(m, "First")
+	typeKeys(m, keyEnter, 'a')
+	typeText(m, "Second")
+	typeKeys(m, keyEnter)
+
+	assert.Len(t, m.todos, 2)
+	assert.Equal(t, 1, m.cursor)
+
+	// Navigate and toggle
+	typeKeys(m, keyUp, ' ')
+	assert.Equal(t, 0, m.cursor)
+	assert.True(t, m.todos[0].Completed)
+	assert.Contains(t, m.render(), "> [x] First")
+
+	typeKeys(m, 'j', 'j', 'x')
+	assert.Equal(t, 1, m.cursor)
+	assert.True(t, m.todos[1].Completed)
+
+	// Cancelled add leaves the list untouched
+	typeKeys(m, 'a')
+	typeText(m, "Nope")
+	typeKeys(m, keyEscape)
+	assert.Len(t, m.todos, 2)
+
+	// Delete the selected todo
+	typeKeys(m, 'd')
+	assert.Len(t, m.todos, 1)
+	assert.Equal(t, "First", m.todos[0].Title)
+
+	typeKeys(m, 'q')
+	assert.True(t, m.quit)
+}
+
+func TestTUIAddSelectsNewTodo(t *testing.T) {
+	useTestDB(t)
+	router := setupRouter()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+		// Another client adds a todo right after ours.
+		if r.Method == http.MethodPost {
+			saveTodo(t, Todo{Title: "Someone else's"})
+		}
+	}))
+	defer server.Close()
+
+	m := newTUIModel(NewClient(server.URL, ""))
+	typeKeys(m, 'a')
+	typeText(m, "Mine")
+	typeKeys(m, keyEnter)
+
+	assert.Len(t, m.todos, 2)
+	assert.Equal(t, 0, m.cursor)
+	assert.Contains(t, m.render(), "> [ ] Mine")
+}
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []int
+	}{
+		{
+			name:     "plain characters",
+			input:    "ab",
+			expected: []int{'a', 'b'},
+		},
+		{
+			name:     "arrow keys",
+			input:    "\x1b[A\x1b[B",
+			expected: []int{keyUp, keyDown},
+		},
+		{
+			name:     "enter and backspace",
+			input:    "\r\x7f",
+			expected: []int{keyEnter, keyBackspace},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.input))
+			var keys []int
+			for range tt.expected {
+				key, err := readKey(reader)
+				assert.NoError(t, err)
+				keys = append(keys, key)
+			}
+			assert.Equal(t, tt.expected, keys)
+		})
+	}
+}
+
+func TestTUILoopQuits(t *testing.T) {
+	server := setupTestServer(t)
+	defer server.Close()
+
+	var out bytes.Buffer
+	m := newTUIModel(NewClient(server.URL, ""))
+
+	err := tuiLoop(m, strings.NewReader("aTask\rq"), &out)
+
+	assert.NoError(t, err)
+	assert.True(t, m.quit)
+	assert.Contains(t, out.String(), "[ ] Task")
+}
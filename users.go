@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+
+	// The runtime image ships without a zoneinfo database.
+	_ "time/tzdata"
+)
+
+// userHeader carries the caller's user name. The service keeps no accounts of
+// its own; it trusts the authenticating proxy in front of it to set this.
+const userHeader = "X-User"
+
+const maxUserNameLength = 64
+
+func userFromRequest(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(userHeader))
+}
+
+func validUserName(name string) error {
+	if len(name) > maxUserNameLength {
+		return fmt.Errorf("user name longer than %d characters", maxUserNameLength)
+	}
+	for _, c := range name {
+		if unicode.IsSpace(c) || unicode.IsControl(c) {
+			return fmt.Errorf("user name %q contains whitespace", name)
+		}
+	}
+	return nil
+}
+
+// timezoneHeader carries an IANA time zone, e.g. Europe/Lisbon, overriding
+// the caller's preference for one request.
+const timezoneHeader = "X-Timezone"
+
+// locationFromRequest returns the caller's time zone: the header, else their
+// stored preference, else UTC.
+func locationFromRequest(r *http.Request) (*time.Location, error) {
+	return userLocation(userFromRequest(r), r.Header.Get(timezoneHeader))
+}
+
+// userLocation returns the time zone named by override, else user's stored
+// preference, else UTC.
+func userLocation(user, override string) (*time.Location, error) {
+	name := strings.TrimSpace(override)
+	if name == "" && user != "" {
+		err := db.View(func(tx *bolt.Tx) error {
+			p, err := loadPreferences(tx, user)
+			name = p.Timezone
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+const maxUpcomingDays = 365
+
+// View is a ready-made selection of open todos, grouped into sections.
+type View struct {
+	Name     string        `json:"name"`
+	Today    string        `json:"today"`
+	Sections []ViewSection `json:"sections"`
+}
+
+type ViewSection struct {
+	Name  string `json:"name"`
+	Date  string `json:"date,omitempty"`
+	Items []Todo `json:"items"`
+}
+
+// getView serves /views/today, /views/upcoming and /views/someday. Due dates are plain dates, so "today" is the
+// date in the caller's time zone.
+func getView(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	loc, err := locationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := clock.Now().In(loc)
+	today := now.Format(dueDateLayout)
+
+	days := 7
+	if s := r.URL.Query().Get("days"); s != "" {
+		if days, err = strconv.Atoi(s); err != nil || days < 1 || days > maxUpcomingDays {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	assignee, err := resolveAssignee(r.URL.Query().Get("assignee"), userFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var open queryNode = indexNode{"completed", []string{"false"}}
+	if assignee != "" {
+		open = andNode{open, indexNode{"assignee", []string{assignee}}}
+	}
+
+	view := View{Name: name, Today: today, Sections: []ViewSection{}}
+	err = timedView(r, func(tx *bolt.Tx) error {
+		switch name {
+		case "today":
+			overdue, err := viewTodos(tx, andNode{open, dueRangeNode{"<", today}})
+			if err != nil {
+				return err
+			}
+			dueToday, err := viewTodos(tx, andNode{open, indexNode{"due", []string{today}}})
+			if err != nil {
+				return err
+			}
+			view.Sections = append(view.Sections,
+				ViewSection{Name: "overdue", Items: overdue},
+				ViewSection{Name: "today", Date: today, Items: dueToday})
+
+		case "upcoming":
+			last := now.AddDate(0, 0, days).Format(dueDateLayout)
+			todos, err := viewTodos(tx, andNode{open, andNode{dueRangeNode{">", today}, dueRangeNode{"<=", last}}})
+			if err != nil {
+				return err
+			}
+			for day := 1; day <= days; day++ {
+				date := now.AddDate(0, 0, day).Format(dueDateLayout)
+				section := ViewSection{Name: now.AddDate(0, 0, day).Weekday().String(), Date: date, Items: []Todo{}}
+				for _, todo := range todos {
+					if todo.DueDate == date {
+						section.Items = append(section.Items, todo)
+					}
+				}
+				view.Sections = append(view.Sections, section)
+			}
+
+		case "someday":
+			todos, err := viewTodos(tx, andNode{open, indexNode{"due", []string{""}}})
+			if err != nil {
+				return err
+			}
+			for _, priority := range []string{"high", "medium", "low", ""} {
+				section := ViewSection{Name: priority, Items: []Todo{}}
+				if priority == "" {
+					section.Name = "none"
+				}
+				for _, todo := range todos {
+					if todo.Priority == priority {
+						section.Items = append(section.Items, todo)
+					}
+				}
+				view.Sections = append(view.Sections, section)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(view)
+}
+
+// viewTodos loads the todos matching n, ordered like the ready queue.
+func viewTodos(tx *bolt.Tx, n queryNode) ([]Todo, error) {
+	b := tx.Bucket(todosBucket)
+	todos := []Todo{}
+	for id := range n.eval(&queryEnv{tx: tx}) {
+		var todo Todo
+		if err := codec.Unmarshal(b.Get(itob(int(id))), &todo); err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+	sort.Slice(todos, func(i, j int) bool { return readyBefore(todos[i], todos[j]) })
+	return todos, nil
+}
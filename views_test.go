@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestView(t *testing.T, router http.Handler, target, zone string) View {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set(timezoneHeader, zone)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var view View
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &view))
+	return view
+}
+
+func sectionTitles(section ViewSection) []string {
+	titles := []string{}
+	for _, todo := range section.Items {
+		titles = append(titles, todo.Title)
+	}
+	return titles
+}
+
+func TestViews(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	// UTC+14 and UTC-11 are always on different dates.
+	ahead, _ := time.LoadLocation("Pacific/Kiritimati")
+	behind, _ := time.LoadLocation("Pacific/Pago_Pago")
+	today := time.Now().In(ahead)
+	date := func(days int) string { return today.AddDate(0, 0, days).Format(dueDateLayout) }
+
+	for _, todo := range []Todo{
+		{Title: "Late", DueDate: date(-2)},
+		{Title: "Now", DueDate: date(0)},
+		{Title: "Soon", DueDate: date(3), Priority: "low"},
+		{Title: "Urgent soon", DueDate: date(3), Priority: "high"},
+		{Title: "Far", DueDate: date(30)},
+		{Title: "Done", DueDate: date(0), Completed: true},
+		{Title: "Whenever"},
+		{Title: "Important whenever", Priority: "high"},
+	} {
+		payload, _ := json.Marshal(todo)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+	}
+
+	view := getTestView(t, router, "/views/today", "Pacific/Kiritimati")
+	assert.Equal(t, date(0), view.Today)
+	assert.Equal(t, []string{"Late"}, sectionTitles(view.Sections[0]))
+	assert.Equal(t, []string{"Now"}, sectionTitles(view.Sections[1]))
+
+	// A day behind, "Now" isn't due yet.
+	view = getTestView(t, router, "/views/today", "Pacific/Pago_Pago")
+	assert.Equal(t, time.Now().In(behind).Format(dueDateLayout), view.Today)
+	assert.NotContains(t, sectionTitles(view.Sections[1]), "Now")
+
+	view = getTestView(t, router, "/views/upcoming?days=5", "Pacific/Kiritimati")
+	assert.Len(t, view.Sections, 5)
+	assert.Equal(t, date(1), view.Sections[0].Date)
+	assert.Equal(t, date(3), view.Sections[2].Date)
+	assert.Equal(t, []string{"Urgent soon", "Soon"}, sectionTitles(view.Sections[2]))
+
+	view = getTestView(t, router, "/views/someday", "")
+	assert.Equal(t, "high", view.Sections[0].Name)
+	assert.Equal(t, []string{"Important whenever"}, sectionTitles(view.Sections[0]))
+	assert.Equal(t, "none", view.Sections[3].Name)
+	assert.Equal(t, []string{"Whenever"}, sectionTitles(view.Sections[3]))
+
+	for _, tt := range []struct {
+		target, zone string
+		code         int
+	}{
+		{"/views/upcoming?days=0", "", http.StatusBadRequest},
+		{"/views/today", "Mars/Olympus_Mons", http.StatusBadRequest},
+		{"/views/later", "", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Header.Set(timezoneHeader, tt.zone)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.code, w.Code, tt.target)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// watchersBucket holds one key per watch: todo key + user name. Watches
+// outlive their todo, so a todo recreated under the same ID keeps them.
+var watchersBucket = []byte("watchers")
+
+func todoWatchers(id int) ([]string, error) {
+	var users []string
+	err := db.View(func(tx *bolt.Tx) error {
+		prefix := itob(id)
+		c := tx.Bucket(watchersBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			users = append(users, string(k[len(prefix):]))
+		}
+		return nil
+	})
+	return users, err
+}
+
+// deleteWatchers removes every watch of the todo with key.
+func deleteWatchers(tx *bolt.Tx, key []byte) error {
+	b := tx.Bucket(watchersBucket)
+	var watches [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(key); k != nil && bytes.HasPrefix(k, key); k, _ = c.Next() {
+		watches = append(watches, append([]byte{}, k...))
+	}
+	for _, k := range watches {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchTodo subscribes the caller to changes of a todo (POST) or
+// unsubscribes them (DELETE).
+func watchTodo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	user := userFromRequest(r)
+	if user == "" {
+		http.Error(w, "Watching requires the "+userHeader+" header", http.StatusBadRequest)
+		return
+	}
+	if err := validUserName(user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	found := true
+	err = writeTx(func(tx *bolt.Tx) error {
+		key := append(itob(id), user...)
+		if r.Method == http.MethodDelete {
+			return tx.Bucket(watchersBucket).Delete(key)
+		}
+
+		todo, err := loadTodo(tx, id)
+		if err != nil {
+			return err
+		}
+		found = todo != nil
+		if !found {
+			return nil
+		}
+		return tx.Bucket(watchersBucket).Put(key, nil)
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "todo not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (n *recordingNotifier) Notify(notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func withRecordingNotifier(t *testing.T) *recordingNotifier {
+	previous := currentNotifier()
+	n := &recordingNotifier{}
+	setNotifier(n)
+	t.Cleanup(func() { setNotifier(previous) })
+	return n
+}
+
+func TestWatchTodo(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	payload, _ := json.Marshal(Todo{Title: "Watched"})
+	createTodo(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		user           string
+		expectedStatus int
+	}{
+		{
+			name:           "watch",
+			method:         http.MethodPost,
+			url:            "/todos/1/watch",
+			user:           "alice",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "missing user",
+			method:         http.MethodPost,
+			url:            "/todos/1/watch",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing todo",
+			method:         http.MethodPost,
+			url:            "/todos/99/watch",
+			user:           "alice",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.user != "" {
+				req.Header.Set(userHeader, tt.user)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	watchers, err := todoWatchers(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, watchers)
+}
+
+func TestWatchersAreNotified(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+	notifications := withRecordingNotifier(t)
+
+	payload, _ := json.Marshal(Todo{Title: "Watched"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+
+	for _, user := range []string{"alice", "bob"} {
+		req := httptest.NewRequest(http.MethodPost, "/todos/1/watch", nil)
+		req.Header.Set(userHeader, user)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/todos/1/watch", nil)
+	req.Header.Set(userHeader, "bob")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	payload, _ = json.Marshal(Todo{Title: "Watched", Completed: true})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/todos/1", bytes.NewBuffer(payload)))
+
+	assert.Equal(t, []Notification{
+		{User: "alice", TodoID: 1, Reason: reasonWatching, Message: "updated: Watched"},
+	}, notifications.sent)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Workload is the remaining estimated effort of one assignee, by due date.
+// Unassigned todos are reported under an empty assignee.
+type Workload struct {
+	Assignee string        `json:"assignee"`
+	Minutes  int           `json:"minutes"`
+	Days     []WorkloadDay `json:"days"`
+	// Unscheduled is the effort of todos without a due date.
+	Unscheduled int `json:"unscheduled"`
+}
+
+type WorkloadDay struct {
+	Date    string `json:"date"`
+	Minutes int    `json:"minutes"`
+}
+
+// getWorkload sums the estimates of open todos per assignee and due date.
+func getWorkload(w http.ResponseWriter, r *http.Request) {
+	assignee, err := resolveAssignee(r.URL.Query().Get("assignee"), userFromRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filters := []indexFilter{{"completed", "false"}}
+	if assignee != "" {
+		filters = append(filters, indexFilter{"assignee", assignee})
+	}
+
+	byAssignee := make(map[string]map[string]int)
+	err = timedView(r, func(tx *bolt.Tx) error {
+		it := newFilteredIterator(tx, filters)
+		for k, v := it.first(); k != nil; k, v = it.next() {
+			var todo Todo
+			if err := codec.Unmarshal(v, &todo); err != nil {
+				return err
+			}
+			if todo.Estimate == "" {
+				continue
+			}
+			// Estimates are validated when stored.
+			d, _ := time.ParseDuration(todo.Estimate)
+			if byAssignee[todo.Assignee] == nil {
+				byAssignee[todo.Assignee] = make(map[string]int)
+			}
+			byAssignee[todo.Assignee][todo.DueDate] += int(d.Round(time.Minute) / time.Minute)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := []Workload{}
+	for name, byDate := range byAssignee {
+		load := Workload{Assignee: name, Days: []WorkloadDay{}}
+		for date, minutes := range byDate {
+			load.Minutes += minutes
+			if date == "" {
+				load.Unscheduled = minutes
+				continue
+			}
+			load.Days = append(load.Days, WorkloadDay{date, minutes})
+		}
+		sort.Slice(load.Days, func(i, j int) bool { return load.Days[i].Date < load.Days[j].Date })
+		report = append(report, load)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Assignee < report[j].Assignee })
+
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkload(t *testing.T) {
+	clearBucket(t)
+	router := setupRouter()
+
+	for _, todo := range []Todo{
+		{Title: "a", Assignee: "alice", Estimate: "2h", DueDate: "2026-10-16"},
+		{Title: "b", Assignee: "alice", Estimate: "30m", DueDate: "2026-10-16"},
+		{Title: "c", Assignee: "alice", Estimate: "1h", DueDate: "2026-10-19"},
+		{Title: "d", Assignee: "alice", Estimate: "45m"},
+		{Title: "e", Assignee: "alice", Estimate: "8h", DueDate: "2026-10-16", Completed: true},
+		{Title: "f", Assignee: "alice", DueDate: "2026-10-16"},
+		{Title: "g", Assignee: "bob", Estimate: "1h30m", DueDate: "2026-10-17"},
+		{Title: "h", Estimate: "15m"},
+	} {
+		payload, _ := json.Marshal(todo)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reports/workload", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[
+		{"assignee": "", "minutes": 15, "days": [], "unscheduled": 15},
+		{"assignee": "alice", "minutes": 255, "days": [
+			{"date": "2026-10-16", "minutes": 150},
+			{"date": "2026-10-19", "minutes": 60}
+		], "unscheduled": 45},
+		{"assignee": "bob", "minutes": 90, "days": [{"date": "2026-10-17", "minutes": 90}], "unscheduled": 0}
+	]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, requestAs("bob", http.MethodGet, "/reports/workload?assignee=me", ""))
+	assert.JSONEq(t, `[{"assignee": "bob", "minutes": 90, "days": [{"date": "2026-10-17", "minutes": 90}], "unscheduled": 0}]`, w.Body.String())
+
+	for _, estimate := range []string{"soon", "-1h", "0s"} {
+		payload, _ := json.Marshal(Todo{Title: "x", Estimate: estimate})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/todos", bytes.NewBuffer(payload)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, estimate)
+	}
+}